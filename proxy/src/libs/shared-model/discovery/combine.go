@@ -41,5 +41,7 @@ func (agg EndpointAgg) Combine(aggB EndpointAgg) EndpointAgg {
 		),
 		AverageDuration:      averageDuration,
 		AverageTotalDuration: averageSpoeAndProviderTotalDuration,
+		DurationSketch:       agg.DurationSketch.Combine(aggB.DurationSketch),
+		TotalDurationSketch:  agg.TotalDurationSketch.Combine(aggB.TotalDurationSketch),
 	}
 }
@@ -0,0 +1,214 @@
+package shareddiscovery
+
+import (
+	"lunar/toolkit-core/utils"
+	"sort"
+	"time"
+)
+
+// The history keeps per minute buckets for the last 2 hours, per hour buckets for the last
+// 7 days and per day buckets for the last 90 days. Older buckets are downsampled into the
+// next resolution, so every call is counted in exactly one bucket.
+var (
+	MinuteBucket = HistoryResolution{Width: time.Minute, Retention: 2 * time.Hour}
+	HourBucket   = HistoryResolution{Width: time.Hour, Retention: 7 * 24 * time.Hour}
+	DayBucket    = HistoryResolution{Width: 24 * time.Hour, Retention: 90 * 24 * time.Hour}
+)
+
+type (
+	HistoryResolution struct {
+		Width     time.Duration
+		Retention time.Duration
+	}
+
+	// HistoryBucket aggregates the calls to an endpoint during a bucket of time
+	HistoryBucket struct {
+		// Start is the Unix timestamp in milliseconds the bucket starts at
+		Start                int64       `json:"start"`
+		Count                int         `json:"count"`
+		StatusCodes          map[int]int `json:"status_codes"`
+		AverageDuration      float32     `json:"average_duration"`
+		AverageTotalDuration float32     `json:"average_total_duration"`
+		// The sketches give the percentiles of a time range
+		DurationSketch      *LatencySketch `json:"duration_sketch,omitempty"`
+		TotalDurationSketch *LatencySketch `json:"total_duration_sketch,omitempty"`
+	}
+
+	// EndpointHistory holds the buckets of an endpoint, each resolution sorted by start
+	EndpointHistory struct {
+		Minutes []HistoryBucket `json:"minutes,omitempty"`
+		Hours   []HistoryBucket `json:"hours,omitempty"`
+		Days    []HistoryBucket `json:"days,omitempty"`
+	}
+
+	HistoryMapping map[Endpoint]EndpointHistory
+)
+
+// BucketStart returns the start of the bucket of the given width holding the timestamp
+func (resolution HistoryResolution) BucketStart(timestamp int64) int64 {
+	return timestamp - timestamp%resolution.Width.Milliseconds()
+}
+
+func (bucket HistoryBucket) Combine(bucketB HistoryBucket) HistoryBucket {
+	count := bucket.Count + bucketB.Count
+
+	var averageDuration, averageTotalDuration float32
+	if count > 0 {
+		averageDuration = (bucket.AverageDuration*float32(bucket.Count) +
+			bucketB.AverageDuration*float32(bucketB.Count)) / float32(count)
+		averageTotalDuration = (bucket.AverageTotalDuration*float32(bucket.Count) +
+			bucketB.AverageTotalDuration*float32(bucketB.Count)) / float32(count)
+	}
+
+	statusCodes := make(map[int]int, len(bucket.StatusCodes))
+	for _, source := range []map[int]int{bucket.StatusCodes, bucketB.StatusCodes} {
+		for code, codeCount := range source {
+			statusCodes[code] += codeCount
+		}
+	}
+
+	return HistoryBucket{
+		Start:                utils.Min(bucket.Start, bucketB.Start),
+		Count:                count,
+		StatusCodes:          statusCodes,
+		AverageDuration:      averageDuration,
+		AverageTotalDuration: averageTotalDuration,
+		DurationSketch:       bucket.DurationSketch.Combine(bucketB.DurationSketch),
+		TotalDurationSketch:  bucket.TotalDurationSketch.Combine(bucketB.TotalDurationSketch),
+	}
+}
+
+func (history EndpointHistory) Combine(historyB EndpointHistory) EndpointHistory {
+	return EndpointHistory{
+		Minutes: mergeBuckets(MinuteBucket, history.Minutes, historyB.Minutes),
+		Hours:   mergeBuckets(HourBucket, history.Hours, historyB.Hours),
+		Days:    mergeBuckets(DayBucket, history.Days, historyB.Days),
+	}
+}
+
+func (history EndpointHistory) IsEmpty() bool {
+	return len(history.Minutes) == 0 && len(history.Hours) == 0 && len(history.Days) == 0
+}
+
+// Latest returns the start of the most recent bucket, 0 for an empty history
+func (history EndpointHistory) Latest() int64 {
+	var latest int64
+	for _, buckets := range [][]HistoryBucket{history.Minutes, history.Hours, history.Days} {
+		if len(buckets) > 0 {
+			latest = utils.Max(latest, buckets[len(buckets)-1].Start)
+		}
+	}
+	return latest
+}
+
+// Downsample moves the buckets which left the retention of their resolution
+// into the next resolution, and drops the day buckets older than 90 days
+func (history EndpointHistory) Downsample(now int64) EndpointHistory {
+	minutes, expiredMinutes := splitExpired(MinuteBucket, history.Minutes, now)
+	hours, expiredHours := splitExpired(
+		HourBucket, mergeBuckets(HourBucket, history.Hours, expiredMinutes), now)
+	days, _ := splitExpired(DayBucket, mergeBuckets(DayBucket, history.Days, expiredHours), now)
+
+	return EndpointHistory{Minutes: minutes, Hours: hours, Days: days}
+}
+
+// InRange combines the buckets overlapping [from, to) into a single bucket, along with
+// the bounds of the combined buckets. Calls are only known at the resolution of their bucket,
+// so a range not aligned to the buckets includes the whole of its edge buckets.
+func (history EndpointHistory) InRange(from, to int64) (HistoryBucket, int64, int64) {
+	var (
+		res              HistoryBucket
+		minTime, maxTime int64
+		found            bool
+	)
+	resolutions := []HistoryResolution{MinuteBucket, HourBucket, DayBucket}
+	for i, buckets := range [][]HistoryBucket{history.Minutes, history.Hours, history.Days} {
+		width := resolutions[i].Width.Milliseconds()
+		for _, bucket := range buckets {
+			end := bucket.Start + width
+			if end <= from || bucket.Start >= to {
+				continue
+			}
+			if !found {
+				res, minTime, maxTime, found = bucket, bucket.Start, end, true
+				continue
+			}
+			res = res.Combine(bucket)
+			minTime = utils.Min(minTime, bucket.Start)
+			maxTime = utils.Max(maxTime, end)
+		}
+	}
+	return res, minTime, maxTime
+}
+
+// Combine merges the histories of both mappings and downsamples them all to the most recent
+// bucket, so endpoints which are no longer called still age out of the history
+func (historyA HistoryMapping) Combine(historyB HistoryMapping) HistoryMapping {
+	combined := make(HistoryMapping)
+	for _, source := range []HistoryMapping{historyA, historyB} {
+		for endpoint, history := range source {
+			if existing, found := combined[endpoint]; found {
+				history = existing.Combine(history)
+			}
+			combined[endpoint] = history
+		}
+	}
+
+	var now int64
+	for _, history := range combined {
+		now = utils.Max(now, history.Latest())
+	}
+
+	res := make(HistoryMapping, len(combined))
+	for endpoint, history := range combined {
+		downsampled := history.Downsample(now)
+		if !downsampled.IsEmpty() {
+			res[endpoint] = downsampled
+		}
+	}
+	return res
+}
+
+// mergeBuckets combines the buckets of both lists which fall into the same bucket
+// of the given resolution, and returns them sorted by start
+func mergeBuckets(
+	resolution HistoryResolution,
+	bucketsA, bucketsB []HistoryBucket,
+) []HistoryBucket {
+	if len(bucketsA) == 0 && len(bucketsB) == 0 {
+		return nil
+	}
+
+	byStart := make(map[int64]HistoryBucket, len(bucketsA)+len(bucketsB))
+	for _, buckets := range [][]HistoryBucket{bucketsA, bucketsB} {
+		for _, bucket := range buckets {
+			start := resolution.BucketStart(bucket.Start)
+			if existing, found := byStart[start]; found {
+				bucket = existing.Combine(bucket)
+			}
+			bucket.Start = start
+			byStart[start] = bucket
+		}
+	}
+
+	res := make([]HistoryBucket, 0, len(byStart))
+	for _, bucket := range byStart {
+		res = append(res, bucket)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Start < res[j].Start })
+	return res
+}
+
+// splitExpired splits sorted buckets into the ones within the retention and the older ones
+func splitExpired(
+	resolution HistoryResolution,
+	buckets []HistoryBucket,
+	now int64,
+) ([]HistoryBucket, []HistoryBucket) {
+	cutoff := resolution.BucketStart(now) - resolution.Retention.Milliseconds()
+	index := sort.Search(len(buckets), func(i int) bool { return buckets[i].Start >= cutoff })
+	if index == 0 {
+		return buckets, nil
+	}
+	return buckets[index:], buckets[:index]
+}
@@ -0,0 +1,183 @@
+package shareddiscovery
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var historyNow = time.Date(2024, 5, 20, 15, 30, 0, 0, time.UTC)
+
+func minuteBucket(at time.Time, count int, statusCode int) HistoryBucket {
+	return HistoryBucket{
+		Start:           at.UnixMilli(),
+		Count:           count,
+		StatusCodes:     map[int]int{statusCode: count},
+		AverageDuration: 10,
+	}
+}
+
+func TestEndpointHistoryCombineMergesSameBuckets(t *testing.T) {
+	historyA := EndpointHistory{Minutes: []HistoryBucket{
+		minuteBucket(historyNow.Add(-time.Minute), 1, 200),
+		minuteBucket(historyNow, 1, 200),
+	}}
+	historyB := EndpointHistory{Minutes: []HistoryBucket{
+		{Start: historyNow.UnixMilli(), Count: 3, StatusCodes: map[int]int{500: 3}, AverageDuration: 30},
+	}}
+
+	combined := historyA.Combine(historyB)
+	assert.Len(t, combined.Minutes, 2)
+	assert.Equal(t, historyNow.UnixMilli(), combined.Minutes[1].Start)
+	assert.Equal(t, 4, combined.Minutes[1].Count)
+	assert.Equal(t, map[int]int{200: 1, 500: 3}, combined.Minutes[1].StatusCodes)
+	assert.InDelta(t, 25, combined.Minutes[1].AverageDuration, 0.001)
+}
+
+func TestEndpointHistoryDownsample(t *testing.T) {
+	history := EndpointHistory{
+		Minutes: []HistoryBucket{
+			minuteBucket(historyNow.Add(-3*time.Hour), 1, 200),
+			minuteBucket(historyNow.Add(-3*time.Hour+time.Minute), 2, 500),
+			minuteBucket(historyNow.Add(-time.Hour), 1, 200),
+		},
+		Hours: []HistoryBucket{
+			minuteBucket(historyNow.Add(-8*24*time.Hour).Truncate(time.Hour), 5, 200),
+		},
+		Days: []HistoryBucket{
+			minuteBucket(historyNow.Add(-100*24*time.Hour).Truncate(24*time.Hour), 7, 200),
+		},
+	}
+
+	downsampled := history.Downsample(historyNow.UnixMilli())
+
+	assert.Len(t, downsampled.Minutes, 1)
+	assert.Equal(t, historyNow.Add(-time.Hour).UnixMilli(), downsampled.Minutes[0].Start)
+
+	assert.Len(t, downsampled.Hours, 1)
+	assert.Equal(t, historyNow.Add(-3*time.Hour).Truncate(time.Hour).UnixMilli(),
+		downsampled.Hours[0].Start)
+	assert.Equal(t, 3, downsampled.Hours[0].Count)
+	assert.Equal(t, map[int]int{200: 1, 500: 2}, downsampled.Hours[0].StatusCodes)
+
+	// the hour bucket is older than 7 days, the day bucket older than 90 days
+	assert.Len(t, downsampled.Days, 1)
+	assert.Equal(t, historyNow.Add(-8*24*time.Hour).Truncate(24*time.Hour).UnixMilli(),
+		downsampled.Days[0].Start)
+	assert.Equal(t, 5, downsampled.Days[0].Count)
+}
+
+func TestEndpointHistoryIsBounded(t *testing.T) {
+	var history EndpointHistory
+	end := historyNow.Add(100 * 24 * time.Hour)
+	for at := historyNow; at.Before(end); at = at.Add(7 * time.Minute) {
+		history = history.Combine(EndpointHistory{
+			Minutes: []HistoryBucket{minuteBucket(at, 1, 200)},
+		}).Downsample(at.UnixMilli())
+	}
+
+	assert.LessOrEqual(t, len(history.Minutes), 121)
+	assert.LessOrEqual(t, len(history.Hours), 7*24+1)
+	assert.LessOrEqual(t, len(history.Days), 91)
+}
+
+func TestHistoryMappingCombineDownsamplesIdleEndpoints(t *testing.T) {
+	idle := Endpoint{Method: "GET", URL: "api.com/idle"}
+	busy := Endpoint{Method: "GET", URL: "api.com/busy"}
+	historyA := HistoryMapping{
+		idle: {Minutes: []HistoryBucket{minuteBucket(historyNow.Add(-3*time.Hour), 1, 200)}},
+	}
+	historyB := HistoryMapping{
+		busy: {Minutes: []HistoryBucket{minuteBucket(historyNow, 1, 200)}},
+	}
+
+	combined := historyA.Combine(historyB)
+	assert.Empty(t, combined[idle].Minutes)
+	assert.Len(t, combined[idle].Hours, 1)
+	assert.Len(t, combined[busy].Minutes, 1)
+}
+
+func TestEndpointsInRange(t *testing.T) {
+	history := map[string]EndpointHistory{
+		"GET:::api.com/users": {
+			Minutes: []HistoryBucket{
+				minuteBucket(historyNow.Add(-10*time.Minute), 2, 200),
+				minuteBucket(historyNow.Add(-5*time.Minute), 1, 500),
+			},
+			Hours: []HistoryBucket{
+				minuteBucket(historyNow.Add(-24*time.Hour).Truncate(time.Hour), 4, 200),
+			},
+		},
+		"GET:::api.com/orders": {
+			Hours: []HistoryBucket{
+				minuteBucket(historyNow.Add(-48*time.Hour).Truncate(time.Hour), 4, 200),
+			},
+		},
+	}
+
+	endpoints := EndpointsInRange(history,
+		historyNow.Add(-time.Hour).UnixMilli(), historyNow.UnixMilli())
+	assert.Len(t, endpoints, 1)
+	users := endpoints["GET:::api.com/users"]
+	assert.Equal(t, 3, users.Count)
+	assert.Equal(t, map[int]int{200: 2, 500: 1}, users.StatusCodes)
+
+	// a range within an hour bucket includes the whole bucket
+	endpoints = EndpointsInRange(history,
+		historyNow.Add(-24*time.Hour).UnixMilli(), historyNow.Add(-23*time.Hour).UnixMilli())
+	assert.Equal(t, 4, endpoints["GET:::api.com/users"].Count)
+	assert.NotContains(t, endpoints, "GET:::api.com/orders")
+}
+
+func TestEndpointsInRangeCombinesPercentiles(t *testing.T) {
+	fast := minuteBucket(historyNow.Add(-10*time.Minute), 90, 200)
+	fast.DurationSketch = NewLatencySketch()
+	for range 90 {
+		fast.DurationSketch.Add(50)
+	}
+	slow := minuteBucket(historyNow.Add(-5*time.Minute), 10, 200)
+	slow.DurationSketch = NewLatencySketch()
+	for range 10 {
+		slow.DurationSketch.Add(1000)
+	}
+	history := map[string]EndpointHistory{
+		"GET:::api.com/users": {Minutes: []HistoryBucket{fast, slow}},
+	}
+
+	endpoints := EndpointsInRange(history,
+		historyNow.Add(-time.Hour).UnixMilli(), historyNow.UnixMilli())
+	percentiles := endpoints["GET:::api.com/users"].DurationPercentiles
+	assert.InEpsilon(t, 50, percentiles.P90, 0.01)
+	assert.InEpsilon(t, 1000, percentiles.P99, 0.01)
+	assert.Nil(t, endpoints["GET:::api.com/users"].TotalDurationPercentiles)
+}
+
+func TestOutputKeepsSketchesInTheirOwnSection(t *testing.T) {
+	sketch := NewLatencySketch()
+	sketch.Add(50)
+	output := Output{
+		Endpoints: map[string]EndpointOutput{
+			"GET:::api.com/users": {Count: 1, DurationSketch: sketch},
+		},
+		Consumers: map[string]map[string]EndpointOutput{
+			"acme": {"GET:::api.com/users": {Count: 1, TotalDurationSketch: sketch}},
+		},
+	}
+	output.StoreSketches()
+
+	data, err := json.Marshal(output.Endpoints)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "bins")
+
+	data, err = json.Marshal(output)
+	assert.NoError(t, err)
+	restored := Output{}
+	assert.NoError(t, json.Unmarshal(data, &restored))
+	assert.Nil(t, restored.Endpoints["GET:::api.com/users"].DurationSketch)
+
+	restored.LoadSketches()
+	assert.Equal(t, sketch, restored.Endpoints["GET:::api.com/users"].DurationSketch)
+	assert.Equal(t, sketch, restored.Consumers["acme"]["GET:::api.com/users"].TotalDurationSketch)
+}
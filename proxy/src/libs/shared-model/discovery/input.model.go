@@ -1,7 +1,17 @@
 package shareddiscovery
 
 type KnownEndpoints struct {
-	Endpoints []Endpoint `yaml:"endpoints"`
+	Endpoints          []Endpoint               `yaml:"endpoints"`
+	PathParamDetection []PathParamDetectionRule `yaml:"path_param_detection,omitempty"`
+}
+
+// PathParamDetectionRule enables detecting path params by the format of path segments
+// for a host, or for all hosts with '*', see urltree.SegmentClassifier.
+// Hosts without a rule are only parameterized once the split threshold is reached.
+type PathParamDetectionRule struct {
+	Host        string   `json:"host"                  yaml:"host"`
+	Disabled    bool     `json:"disabled,omitempty"    yaml:"disabled,omitempty"`
+	Classifiers []string `json:"classifiers,omitempty" yaml:"classifiers,omitempty"`
 }
 
 type Endpoint struct {
@@ -19,6 +29,8 @@ type EndpointAgg struct {
 	StatusCodes          map[int]Count
 	AverageDuration      float32 // round trip time from proxy to provider
 	AverageTotalDuration float32 // total duration (spoe time + provider time)
+	DurationSketch       *LatencySketch
+	TotalDurationSketch  *LatencySketch
 }
 
 type EndpointMapping map[Endpoint]EndpointAgg
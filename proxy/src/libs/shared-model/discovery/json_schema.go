@@ -0,0 +1,214 @@
+package shareddiscovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+const (
+	SchemaTypeObject  = "object"
+	SchemaTypeArray   = "array"
+	SchemaTypeString  = "string"
+	SchemaTypeInteger = "integer"
+	SchemaTypeNumber  = "number"
+	SchemaTypeBoolean = "boolean"
+
+	// schemaMaxDepth and schemaMaxProperties bound the size of an inferred schema,
+	// deeper values and further properties are left unspecified
+	schemaMaxDepth      = 10
+	schemaMaxProperties = 200
+)
+
+// JSONSchema is the subset of the OpenAPI 3 schema object which is inferred from JSON bodies
+type JSONSchema struct {
+	Type       string                 `json:"type,omitempty"`
+	Nullable   bool                   `json:"nullable,omitempty"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *JSONSchema            `json:"items,omitempty"`
+	OneOf      []*JSONSchema          `json:"oneOf,omitempty"`
+}
+
+// InferSchema returns the schema of a JSON document
+func InferSchema(document []byte) (*JSONSchema, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return inferValueSchema(value, 0), nil
+}
+
+func inferValueSchema(value any, depth int) *JSONSchema {
+	switch typedValue := value.(type) {
+	case nil:
+		return &JSONSchema{Nullable: true}
+	case bool:
+		return &JSONSchema{Type: SchemaTypeBoolean}
+	case string:
+		return &JSONSchema{Type: SchemaTypeString}
+	case json.Number:
+		if _, err := typedValue.Int64(); err == nil {
+			return &JSONSchema{Type: SchemaTypeInteger}
+		}
+		return &JSONSchema{Type: SchemaTypeNumber}
+	case []any:
+		schema := &JSONSchema{Type: SchemaTypeArray}
+		if depth >= schemaMaxDepth {
+			return schema
+		}
+		for _, item := range typedValue {
+			schema.Items = schema.Items.Merge(inferValueSchema(item, depth+1))
+		}
+		return schema
+	case map[string]any:
+		schema := &JSONSchema{Type: SchemaTypeObject}
+		if depth >= schemaMaxDepth {
+			return schema
+		}
+		schema.Properties = make(map[string]*JSONSchema, len(typedValue))
+		for _, key := range sortedKeys(typedValue) {
+			if len(schema.Properties) >= schemaMaxProperties {
+				break
+			}
+			schema.Properties[key] = inferValueSchema(typedValue[key], depth+1)
+			schema.Required = append(schema.Required, key)
+		}
+		return schema
+	}
+	return &JSONSchema{}
+}
+
+// Merge returns a schema which both schemas conform to. Integers widen into numbers,
+// fields missing from either object become optional, and different types become a oneOf.
+// nil schemas are treated as unknown ones.
+func (schema *JSONSchema) Merge(schemaB *JSONSchema) *JSONSchema {
+	if schema == nil {
+		return schemaB.copy()
+	}
+	if schemaB == nil {
+		return schema.copy()
+	}
+
+	nullable := schema.Nullable || schemaB.Nullable
+	var res *JSONSchema
+	switch {
+	case schema.isNull():
+		res = schemaB.copy()
+	case schemaB.isNull():
+		res = schema.copy()
+	default:
+		merged := []*JSONSchema{}
+		for _, variant := range append(schema.variants(), schemaB.variants()...) {
+			merged = mergeIntoVariants(merged, variant)
+		}
+		if len(merged) == 1 {
+			res = merged[0]
+		} else {
+			res = &JSONSchema{OneOf: merged}
+		}
+	}
+	res.Nullable = nullable
+	return res
+}
+
+func (schema *JSONSchema) isNull() bool {
+	return schema.Type == "" && len(schema.OneOf) == 0
+}
+
+func (schema *JSONSchema) variants() []*JSONSchema {
+	if len(schema.OneOf) > 0 {
+		return append([]*JSONSchema{}, schema.OneOf...)
+	}
+	variant := *schema
+	variant.Nullable = false
+	return []*JSONSchema{&variant}
+}
+
+// mergeIntoVariants merges the schema into the variant of the same type, if there is one
+func mergeIntoVariants(variants []*JSONSchema, schema *JSONSchema) []*JSONSchema {
+	for i, variant := range variants {
+		if mergedType, compatible := mergeTypes(variant.Type, schema.Type); compatible {
+			variants[i] = mergeSameType(mergedType, variant, schema)
+			return variants
+		}
+	}
+	return append(variants, schema.copy())
+}
+
+func mergeTypes(typeA, typeB string) (string, bool) {
+	if typeA == typeB {
+		return typeA, true
+	}
+	if (typeA == SchemaTypeInteger && typeB == SchemaTypeNumber) ||
+		(typeA == SchemaTypeNumber && typeB == SchemaTypeInteger) {
+		return SchemaTypeNumber, true
+	}
+	return "", false
+}
+
+func mergeSameType(schemaType string, schemaA, schemaB *JSONSchema) *JSONSchema {
+	res := &JSONSchema{Type: schemaType}
+	switch schemaType {
+	case SchemaTypeArray:
+		res.Items = schemaA.Items.Merge(schemaB.Items)
+	case SchemaTypeObject:
+		res.Properties = make(map[string]*JSONSchema)
+		for _, properties := range []map[string]*JSONSchema{schemaA.Properties, schemaB.Properties} {
+			for key, property := range properties {
+				if _, found := res.Properties[key]; !found &&
+					len(res.Properties) >= schemaMaxProperties {
+					continue
+				}
+				res.Properties[key] = res.Properties[key].Merge(property)
+			}
+		}
+		// A field is only required when every sample had it
+		requiredB := make(map[string]struct{}, len(schemaB.Required))
+		for _, key := range schemaB.Required {
+			requiredB[key] = struct{}{}
+		}
+		for _, key := range schemaA.Required {
+			if _, found := requiredB[key]; found {
+				res.Required = append(res.Required, key)
+			}
+		}
+	}
+	return res
+}
+
+func (schema *JSONSchema) copy() *JSONSchema {
+	if schema == nil {
+		return nil
+	}
+	res := &JSONSchema{
+		Type:     schema.Type,
+		Nullable: schema.Nullable,
+		Items:    schema.Items.copy(),
+	}
+	if schema.Properties != nil {
+		res.Properties = make(map[string]*JSONSchema, len(schema.Properties))
+		for key, property := range schema.Properties {
+			res.Properties[key] = property.copy()
+		}
+	}
+	if schema.Required != nil {
+		res.Required = append([]string{}, schema.Required...)
+	}
+	for _, variant := range schema.OneOf {
+		res.OneOf = append(res.OneOf, variant.copy())
+	}
+	return res
+}
+
+func sortedKeys(values map[string]any) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package shareddiscovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func inferSchema(t *testing.T, document string) *JSONSchema {
+	schema, err := InferSchema([]byte(document))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestInferSchema(t *testing.T) {
+	schema := inferSchema(t, `{"id": 1, "name": "a", "price": 1.5, "tags": ["x"], "owner": null}`)
+
+	assert.Equal(t, &JSONSchema{
+		Type: SchemaTypeObject,
+		Properties: map[string]*JSONSchema{
+			"id":    {Type: SchemaTypeInteger},
+			"name":  {Type: SchemaTypeString},
+			"price": {Type: SchemaTypeNumber},
+			"tags":  {Type: SchemaTypeArray, Items: &JSONSchema{Type: SchemaTypeString}},
+			"owner": {Nullable: true},
+		},
+		Required: []string{"id", "name", "owner", "price", "tags"},
+	}, schema)
+
+	_, err := InferSchema([]byte(`{"id": `))
+	assert.Error(t, err)
+}
+
+func TestMergeSchemasMarksOptionalFields(t *testing.T) {
+	schema := inferSchema(t, `{"id": 1, "nickname": "a"}`).
+		Merge(inferSchema(t, `{"id": 2.5, "email": "b@c.d"}`))
+
+	assert.Equal(t, []string{"id"}, schema.Required)
+	assert.Equal(t, SchemaTypeNumber, schema.Properties["id"].Type)
+	assert.Contains(t, schema.Properties, "nickname")
+	assert.Contains(t, schema.Properties, "email")
+}
+
+func TestMergeSchemasOfDifferentTypes(t *testing.T) {
+	schema := inferSchema(t, `{"value": "a"}`).
+		Merge(inferSchema(t, `{"value": 1}`)).
+		Merge(inferSchema(t, `{"value": null}`)).
+		Merge(inferSchema(t, `{"value": "b"}`))
+
+	value := schema.Properties["value"]
+	assert.True(t, value.Nullable)
+	assert.Equal(t, []*JSONSchema{
+		{Type: SchemaTypeString},
+		{Type: SchemaTypeInteger},
+	}, value.OneOf)
+}
+
+func TestMergeArrayItems(t *testing.T) {
+	schema := inferSchema(t, `[{"id": 1, "extra": true}, {"id": 2}]`)
+
+	assert.Equal(t, SchemaTypeArray, schema.Type)
+	assert.Equal(t, []string{"id"}, schema.Items.Required)
+	assert.Equal(t, SchemaTypeBoolean, schema.Items.Properties["extra"].Type)
+}
+
+func TestMergeLeavesSchemasUntouched(t *testing.T) {
+	schemaA := inferSchema(t, `{"id": 1}`)
+	schemaB := inferSchema(t, `{"id": "a"}`)
+
+	_ = schemaA.Merge(schemaB)
+	assert.Equal(t, inferSchema(t, `{"id": 1}`), schemaA)
+	assert.Equal(t, schemaA, (*JSONSchema)(nil).Merge(schemaA))
+}
@@ -0,0 +1,165 @@
+package shareddiscovery
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// sketchRelativeAccuracy bounds the relative error of the percentiles of a LatencySketch
+	sketchRelativeAccuracy = 0.01
+	// sketchMaxBins bounds the size of a LatencySketch, the lowest bins are collapsed beyond it
+	sketchMaxBins = 2048
+)
+
+var (
+	sketchGamma       = (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+	sketchLogGamma    = math.Log(sketchGamma)
+	sketchPercentiles = []float64{0.5, 0.9, 0.95, 0.99}
+)
+
+type (
+	// LatencySketch is a mergeable latency histogram with logarithmic bins (DDSketch).
+	// Percentiles taken from it are within 1% of the actual latencies,
+	// and sketches of different flushes combine without losing accuracy.
+	LatencySketch struct {
+		// Bins counts the latencies of each bin, bin i holds the latencies in (gamma^(i-1), gamma^i]
+		Bins map[int]Count `json:"bins"`
+		// ZeroCount counts the latencies below 1 ms
+		ZeroCount Count `json:"zero_count,omitempty"`
+	}
+
+	LatencyPercentiles struct {
+		P50 float32 `json:"p50"`
+		P90 float32 `json:"p90"`
+		P95 float32 `json:"p95"`
+		P99 float32 `json:"p99"`
+	}
+)
+
+func NewLatencySketch() *LatencySketch {
+	return &LatencySketch{Bins: make(map[int]Count)}
+}
+
+// Add records a latency in milliseconds
+func (sketch *LatencySketch) Add(latency float64) {
+	if latency < 1 {
+		sketch.ZeroCount++
+		return
+	}
+	sketch.Bins[int(math.Ceil(math.Log(latency)/sketchLogGamma))]++
+	sketch.collapse()
+}
+
+func (sketch *LatencySketch) Count() Count {
+	if sketch == nil {
+		return 0
+	}
+	count := sketch.ZeroCount
+	for _, binCount := range sketch.Bins {
+		count += binCount
+	}
+	return count
+}
+
+// Quantile returns the latency below which the given fraction of the latencies falls
+func (sketch *LatencySketch) Quantile(quantile float64) float64 {
+	count := sketch.Count()
+	if count == 0 {
+		return 0
+	}
+
+	rank := quantile * float64(count-1)
+	cumulative := float64(sketch.ZeroCount)
+	if cumulative > rank {
+		return 0
+	}
+
+	indexes := sketch.sortedIndexes()
+	for _, index := range indexes {
+		cumulative += float64(sketch.Bins[index])
+		if cumulative > rank {
+			return binValue(index)
+		}
+	}
+	return binValue(indexes[len(indexes)-1])
+}
+
+// CountAbove returns the number of latencies above the given latency in milliseconds,
+// within the relative accuracy of the sketch
+func (sketch *LatencySketch) CountAbove(latency float64) Count {
+	if sketch == nil {
+		return 0
+	}
+	var count Count
+	if latency < 0 {
+		count = sketch.ZeroCount
+	}
+	for index, binCount := range sketch.Bins {
+		if binValue(index) > latency {
+			count += binCount
+		}
+	}
+	return count
+}
+
+// Percentiles returns the p50, p90, p95 and p99 latencies, nil for an empty sketch
+func (sketch *LatencySketch) Percentiles() *LatencyPercentiles {
+	if sketch.Count() == 0 {
+		return nil
+	}
+	values := make([]float32, len(sketchPercentiles))
+	for i, percentile := range sketchPercentiles {
+		values[i] = float32(sketch.Quantile(percentile))
+	}
+	return &LatencyPercentiles{P50: values[0], P90: values[1], P95: values[2], P99: values[3]}
+}
+
+// Combine returns a new sketch holding the latencies of both sketches,
+// nil sketches are treated as empty ones
+func (sketch *LatencySketch) Combine(sketchB *LatencySketch) *LatencySketch {
+	if sketch == nil && sketchB == nil {
+		return nil
+	}
+
+	res := NewLatencySketch()
+	for _, source := range []*LatencySketch{sketch, sketchB} {
+		if source == nil {
+			continue
+		}
+		res.ZeroCount += source.ZeroCount
+		for index, binCount := range source.Bins {
+			res.Bins[index] += binCount
+		}
+	}
+	res.collapse()
+	return res
+}
+
+// collapse merges the lowest bins once there are too many of them,
+// which keeps the accuracy of the higher percentiles
+func (sketch *LatencySketch) collapse() {
+	if len(sketch.Bins) <= sketchMaxBins {
+		return
+	}
+	indexes := sketch.sortedIndexes()
+	collapseInto := indexes[len(indexes)-sketchMaxBins]
+	for _, index := range indexes[:len(indexes)-sketchMaxBins] {
+		sketch.Bins[collapseInto] += sketch.Bins[index]
+		delete(sketch.Bins, index)
+	}
+}
+
+func (sketch *LatencySketch) sortedIndexes() []int {
+	indexes := make([]int, 0, len(sketch.Bins))
+	for index := range sketch.Bins {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// binValue returns the latency representing a bin, within the relative accuracy of its latencies
+func binValue(index int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(index)) / (sketchGamma + 1)
+}
@@ -0,0 +1,54 @@
+package shareddiscovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencySketchPercentiles(t *testing.T) {
+	sketch := NewLatencySketch()
+	for latency := 1; latency <= 1000; latency++ {
+		sketch.Add(float64(latency))
+	}
+
+	percentiles := sketch.Percentiles()
+	assert.InEpsilon(t, 500, percentiles.P50, sketchRelativeAccuracy)
+	assert.InEpsilon(t, 900, percentiles.P90, sketchRelativeAccuracy)
+	assert.InEpsilon(t, 950, percentiles.P95, sketchRelativeAccuracy)
+	assert.InEpsilon(t, 990, percentiles.P99, sketchRelativeAccuracy)
+	assert.Nil(t, NewLatencySketch().Percentiles())
+}
+
+func TestLatencySketchCombine(t *testing.T) {
+	fast, slow := NewLatencySketch(), NewLatencySketch()
+	for range 98 {
+		fast.Add(10)
+	}
+	fast.Add(0)
+	slow.Add(2000)
+
+	combined := fast.Combine(slow)
+	assert.Equal(t, Count(100), combined.Count())
+	assert.InEpsilon(t, 10, combined.Quantile(0.5), sketchRelativeAccuracy)
+	assert.InEpsilon(t, 2000, combined.Quantile(1), sketchRelativeAccuracy)
+	assert.Zero(t, combined.Quantile(0))
+	// the combined sketches are left untouched
+	assert.Equal(t, Count(99), fast.Count())
+
+	assert.Equal(t, combined, combined.Combine(nil))
+	assert.Nil(t, (*LatencySketch)(nil).Combine(nil))
+}
+
+func TestLatencySketchCountAbove(t *testing.T) {
+	sketch := NewLatencySketch()
+	for latency := 1; latency <= 1000; latency++ {
+		sketch.Add(float64(latency))
+	}
+	sketch.Add(0)
+
+	assert.InDelta(t, 500, int(sketch.CountAbove(500)), 10)
+	assert.Equal(t, Count(1001), sketch.CountAbove(-1))
+	assert.Zero(t, sketch.CountAbove(2000))
+	assert.Zero(t, (*LatencySketch)(nil).CountAbove(0))
+}
@@ -0,0 +1,190 @@
+package shareddiscovery
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	openAPIVersion         = "3.0.3"
+	openAPIDocumentVersion = "discovered"
+	jsonContentType        = "application/json"
+
+	// The schemas come from sampled bodies, which are opt-in and limited to body capturing flows
+	openAPIDocumentDescription = "Generated from the traffic discovered by Lunar Proxy. " +
+		"Request and response schemas are inferred from sampled JSON bodies, " +
+		"which requires LUNAR_DISCOVERY_BODY_SAMPLE_RATE to be set above 0 and " +
+		"only covers endpoints whose flows require the request or response body."
+)
+
+type (
+	// OpenAPIDocument is an OpenAPI 3 document describing the discovered traffic to a host
+	OpenAPIDocument struct {
+		OpenAPI string                                  `json:"openapi"`
+		Info    OpenAPIInfo                             `json:"info"`
+		Servers []OpenAPIServer                         `json:"servers"`
+		Paths   map[string]map[string]*OpenAPIOperation `json:"paths"`
+	}
+
+	OpenAPIInfo struct {
+		Title       string `json:"title"`
+		Description string `json:"description,omitempty"`
+		Version     string `json:"version"`
+	}
+
+	OpenAPIServer struct {
+		URL string `json:"url"`
+	}
+
+	OpenAPIOperation struct {
+		Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+		RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+		Responses   map[string]*OpenAPIResponse `json:"responses"`
+		// The extensions report what was observed in the traffic
+		CallCount int      `json:"x-lunar-call-count"`
+		Consumers []string `json:"x-lunar-consumers,omitempty"`
+	}
+
+	OpenAPIParameter struct {
+		Name     string      `json:"name"`
+		In       string      `json:"in"`
+		Required bool        `json:"required"`
+		Schema   *JSONSchema `json:"schema"`
+	}
+
+	OpenAPIRequestBody struct {
+		Content map[string]OpenAPIMediaType `json:"content"`
+	}
+
+	OpenAPIResponse struct {
+		Description string                      `json:"description"`
+		Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+	}
+
+	OpenAPIMediaType struct {
+		Schema *JSONSchema `json:"schema"`
+	}
+)
+
+// BuildOpenAPIDocuments returns an OpenAPI document per provider host, describing the
+// discovered endpoints along with the schemas inferred from their sampled bodies
+func BuildOpenAPIDocuments(
+	discovered Output,
+	schemas SchemasOutput,
+) map[string]*OpenAPIDocument {
+	consumersByEndpoint := map[string][]string{}
+	for consumer, endpoints := range discovered.Consumers {
+		for key := range endpoints {
+			consumersByEndpoint[key] = append(consumersByEndpoint[key], consumer)
+		}
+	}
+
+	keys := map[string]struct{}{}
+	for key := range discovered.Endpoints {
+		keys[key] = struct{}{}
+	}
+	for key := range schemas.Endpoints {
+		keys[key] = struct{}{}
+	}
+
+	documents := map[string]*OpenAPIDocument{}
+	for key := range keys {
+		method, url, found := strings.Cut(key, EndpointDelimiter)
+		if !found || method == "" {
+			continue
+		}
+		host, path := splitEndpointURL(url)
+		document, found := documents[host]
+		if !found {
+			document = newOpenAPIDocument(host)
+			documents[host] = document
+		}
+		if document.Paths[path] == nil {
+			document.Paths[path] = map[string]*OpenAPIOperation{}
+		}
+
+		consumers := consumersByEndpoint[key]
+		sort.Strings(consumers)
+		document.Paths[path][strings.ToLower(method)] = buildOpenAPIOperation(
+			path, discovered.Endpoints[key], schemas.Endpoints[key], consumers)
+	}
+	return documents
+}
+
+func newOpenAPIDocument(host string) *OpenAPIDocument {
+	return &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: OpenAPIInfo{
+			Title:       host,
+			Description: openAPIDocumentDescription,
+			Version:     openAPIDocumentVersion,
+		},
+		Servers: []OpenAPIServer{{URL: "https://" + host}},
+		Paths:   map[string]map[string]*OpenAPIOperation{},
+	}
+}
+
+func buildOpenAPIOperation(
+	path string,
+	endpoint EndpointOutput,
+	schemas EndpointSchemas,
+	consumers []string,
+) *OpenAPIOperation {
+	operation := &OpenAPIOperation{
+		Parameters: pathParameters(path),
+		Responses:  map[string]*OpenAPIResponse{},
+		CallCount:  endpoint.Count,
+		Consumers:  consumers,
+	}
+	if schemas.Request != nil {
+		operation.RequestBody = &OpenAPIRequestBody{
+			Content: map[string]OpenAPIMediaType{jsonContentType: {Schema: schemas.Request}},
+		}
+	}
+
+	statusCodes := map[int]struct{}{}
+	for statusCode := range endpoint.StatusCodes {
+		statusCodes[statusCode] = struct{}{}
+	}
+	for statusCode := range schemas.Responses {
+		statusCodes[statusCode] = struct{}{}
+	}
+	for statusCode := range statusCodes {
+		response := &OpenAPIResponse{Description: http.StatusText(statusCode)}
+		if response.Description == "" {
+			response.Description = "Observed response"
+		}
+		if schema := schemas.Responses[statusCode]; schema != nil {
+			response.Content = map[string]OpenAPIMediaType{jsonContentType: {Schema: schema}}
+		}
+		operation.Responses[strconv.Itoa(statusCode)] = response
+	}
+	return operation
+}
+
+// pathParameters declares the path parameters assumed by the URL tree, e.g. /users/{_param_1}
+func pathParameters(path string) []OpenAPIParameter {
+	var parameters []OpenAPIParameter
+	for _, segment := range strings.Split(path, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		parameters = append(parameters, OpenAPIParameter{
+			Name:     strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}"),
+			In:       "path",
+			Required: true,
+			Schema:   &JSONSchema{Type: SchemaTypeString},
+		})
+	}
+	return parameters
+}
+
+func splitEndpointURL(url string) (string, string) {
+	host, path, found := strings.Cut(url, "/")
+	if !found {
+		return host, "/"
+	}
+	return host, "/" + path
+}
@@ -0,0 +1,79 @@
+package shareddiscovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildOpenAPIDocuments(t *testing.T) {
+	discovered := Output{
+		Endpoints: map[string]EndpointOutput{
+			"GET:::api.com/users/{_param_1}": {Count: 3, StatusCodes: map[int]int{200: 2, 404: 1}},
+			"POST:::api.com/users":           {Count: 1, StatusCodes: map[int]int{201: 1}},
+			"GET:::other.com":                {Count: 1, StatusCodes: map[int]int{200: 1}},
+		},
+		Consumers: map[string]map[string]EndpointOutput{
+			"consumerB": {"GET:::api.com/users/{_param_1}": {}},
+			"consumerA": {"GET:::api.com/users/{_param_1}": {}},
+		},
+	}
+
+	user := EndpointSchemas{}.AddSample(BodySample{
+		StatusCode:   200,
+		ResponseBody: []byte(`{"id": 1, "name": "a"}`),
+	})
+	created := EndpointSchemas{}.AddSample(BodySample{
+		StatusCode:   201,
+		RequestBody:  []byte(`{"name": "a"}`),
+		ResponseBody: []byte(`{"id": 1}`),
+	})
+	schemas := SchemasOutput{Endpoints: map[string]EndpointSchemas{
+		"GET:::api.com/users/{_param_1}": user,
+		"POST:::api.com/users":           created,
+	}}
+
+	documents := BuildOpenAPIDocuments(discovered, schemas)
+	require.Len(t, documents, 2)
+	assert.Contains(t, documents, "other.com")
+	assert.Contains(t, documents["other.com"].Paths, "/")
+
+	document := documents["api.com"]
+	assert.Equal(t, "3.0.3", document.OpenAPI)
+	assert.Equal(t, []OpenAPIServer{{URL: "https://api.com"}}, document.Servers)
+
+	getUser := document.Paths["/users/{_param_1}"]["get"]
+	require.NotNil(t, getUser)
+	assert.Equal(t, 3, getUser.CallCount)
+	assert.Equal(t, []string{"consumerA", "consumerB"}, getUser.Consumers)
+	assert.Equal(t, []OpenAPIParameter{{
+		Name: "_param_1", In: "path", Required: true, Schema: &JSONSchema{Type: SchemaTypeString},
+	}}, getUser.Parameters)
+	assert.Equal(t, "OK", getUser.Responses["200"].Description)
+	assert.Equal(t, user.Responses[200], getUser.Responses["200"].Content[jsonContentType].Schema)
+	assert.Nil(t, getUser.Responses["404"].Content)
+	assert.Nil(t, getUser.RequestBody)
+
+	createUser := document.Paths["/users"]["post"]
+	require.NotNil(t, createUser)
+	assert.Equal(t, created.Request, createUser.RequestBody.Content[jsonContentType].Schema)
+	assert.Empty(t, createUser.Parameters)
+}
+
+func TestEndpointSchemasCombine(t *testing.T) {
+	schemasA := EndpointSchemas{}.AddSample(BodySample{
+		StatusCode:   200,
+		ResponseBody: []byte(`{"id": 1, "name": "a"}`),
+	})
+	schemasB := EndpointSchemas{}.AddSample(BodySample{
+		StatusCode:   200,
+		ResponseBody: []byte(`{"id": 2}`),
+	}).AddSample(BodySample{StatusCode: 500, ResponseBody: []byte(`not json`)})
+
+	combined := schemasA.Combine(schemasB)
+	assert.Equal(t, 3, combined.Samples)
+	assert.Equal(t, []string{"id"}, combined.Responses[200].Required)
+	assert.NotContains(t, combined.Responses, 500)
+	assert.Nil(t, combined.Request)
+}
@@ -16,6 +16,21 @@ type (
 		Interceptors []InterceptorOutput                  `json:"interceptors"`
 		Endpoints    map[string]EndpointOutput            `json:"endpoints"`
 		Consumers    map[string]map[string]EndpointOutput `json:"consumers"`
+		// History holds the time buckets of each endpoint, so a time range can be queried
+		History map[string]EndpointHistory `json:"history,omitempty"`
+		// Sketches hold the latency sketches of the endpoints and consumers in the persisted
+		// state, so the percentiles can be combined with the next flushes
+		Sketches *OutputSketches `json:"sketches,omitempty"`
+	}
+
+	OutputSketches struct {
+		Endpoints map[string]EndpointSketches            `json:"endpoints,omitempty"`
+		Consumers map[string]map[string]EndpointSketches `json:"consumers,omitempty"`
+	}
+
+	EndpointSketches struct {
+		Duration      *LatencySketch `json:"duration,omitempty"`
+		TotalDuration *LatencySketch `json:"total_duration,omitempty"`
 	}
 
 	EndpointOutput struct {
@@ -26,5 +41,70 @@ type (
 		StatusCodes          map[int]int `json:"status_codes"`
 		AverageDuration      float32     `json:"average_duration"`
 		AverageTotalDuration float32     `json:"average_total_duration"` //(spoe time + provider time)
+
+		DurationPercentiles      *LatencyPercentiles `json:"duration_percentiles,omitempty"`
+		TotalDurationPercentiles *LatencyPercentiles `json:"total_duration_percentiles,omitempty"`
+		// The sketches are persisted in the Sketches of the output, see StoreSketches
+		DurationSketch      *LatencySketch `json:"-"`
+		TotalDurationSketch *LatencySketch `json:"-"`
 	}
 )
+
+// StoreSketches moves the sketches of the endpoints and consumers into the Sketches
+// of the output, which are only kept in the persisted state
+func (output *Output) StoreSketches() {
+	sketches := &OutputSketches{
+		Endpoints: storeEndpointSketches(output.Endpoints),
+		Consumers: make(map[string]map[string]EndpointSketches),
+	}
+	for consumer, endpoints := range output.Consumers {
+		if consumerSketches := storeEndpointSketches(endpoints); len(consumerSketches) > 0 {
+			sketches.Consumers[consumer] = consumerSketches
+		}
+	}
+
+	output.Sketches = nil
+	if len(sketches.Endpoints) > 0 || len(sketches.Consumers) > 0 {
+		output.Sketches = sketches
+	}
+}
+
+// LoadSketches sets the persisted Sketches of the output back on its endpoints and consumers
+func (output *Output) LoadSketches() {
+	if output.Sketches == nil {
+		return
+	}
+	loadEndpointSketches(output.Endpoints, output.Sketches.Endpoints)
+	for consumer, endpoints := range output.Consumers {
+		loadEndpointSketches(endpoints, output.Sketches.Consumers[consumer])
+	}
+}
+
+func storeEndpointSketches(endpoints map[string]EndpointOutput) map[string]EndpointSketches {
+	sketches := make(map[string]EndpointSketches, len(endpoints))
+	for key, endpoint := range endpoints {
+		if endpoint.DurationSketch == nil && endpoint.TotalDurationSketch == nil {
+			continue
+		}
+		sketches[key] = EndpointSketches{
+			Duration:      endpoint.DurationSketch,
+			TotalDuration: endpoint.TotalDurationSketch,
+		}
+	}
+	return sketches
+}
+
+func loadEndpointSketches(
+	endpoints map[string]EndpointOutput,
+	sketches map[string]EndpointSketches,
+) {
+	for key, endpointSketches := range sketches {
+		endpoint, found := endpoints[key]
+		if !found {
+			continue
+		}
+		endpoint.DurationSketch = endpointSketches.Duration
+		endpoint.TotalDurationSketch = endpointSketches.TotalDuration
+		endpoints[key] = endpoint
+	}
+}
@@ -0,0 +1,66 @@
+package shareddiscovery
+
+import "encoding/json"
+
+type (
+	// BodySample is a transaction whose JSON bodies were sampled for schema inference
+	BodySample struct {
+		Method string `json:"method"`
+		// URL is the host and path of the request, as in the access logs
+		URL          string          `json:"url"`
+		StatusCode   int             `json:"status_code"`
+		RequestBody  json.RawMessage `json:"request_body,omitempty"`
+		ResponseBody json.RawMessage `json:"response_body,omitempty"`
+	}
+
+	// EndpointSchemas holds the schemas inferred from the bodies sampled for an endpoint
+	EndpointSchemas struct {
+		Samples   int                 `json:"samples"`
+		Request   *JSONSchema         `json:"request,omitempty"`
+		Responses map[int]*JSONSchema `json:"responses,omitempty"`
+	}
+
+	// SchemasOutput is the persisted state of the inferred schemas,
+	// keyed by endpoint like the discovery state
+	SchemasOutput struct {
+		Endpoints map[string]EndpointSchemas `json:"endpoints"`
+	}
+)
+
+// AddSample merges the schemas of the sampled bodies into the schemas of the endpoint
+func (schemas EndpointSchemas) AddSample(sample BodySample) EndpointSchemas {
+	res := EndpointSchemas{
+		Samples:   schemas.Samples + 1,
+		Request:   schemas.Request,
+		Responses: make(map[int]*JSONSchema, len(schemas.Responses)+1),
+	}
+	for statusCode, schema := range schemas.Responses {
+		res.Responses[statusCode] = schema
+	}
+
+	if len(sample.RequestBody) > 0 {
+		if schema, err := InferSchema(sample.RequestBody); err == nil {
+			res.Request = res.Request.Merge(schema)
+		}
+	}
+	if len(sample.ResponseBody) > 0 {
+		if schema, err := InferSchema(sample.ResponseBody); err == nil {
+			res.Responses[sample.StatusCode] = res.Responses[sample.StatusCode].Merge(schema)
+		}
+	}
+	return res
+}
+
+func (schemas EndpointSchemas) Combine(schemasB EndpointSchemas) EndpointSchemas {
+	res := EndpointSchemas{
+		Samples:   schemas.Samples + schemasB.Samples,
+		Request:   schemas.Request.Merge(schemasB.Request),
+		Responses: make(map[int]*JSONSchema),
+	}
+	for _, responses := range []map[int]*JSONSchema{schemas.Responses, schemasB.Responses} {
+		for statusCode, schema := range responses {
+			res.Responses[statusCode] = res.Responses[statusCode].Merge(schema)
+		}
+	}
+	return res
+}
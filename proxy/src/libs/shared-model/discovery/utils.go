@@ -1,7 +1,9 @@
 package shareddiscovery
 
 import (
+	"fmt"
 	sharedActions "lunar/shared-model/actions"
+	"lunar/toolkit-core/urltree"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -69,9 +71,50 @@ func ConvertEndpointFromPersisted(
 		StatusCodes:          convertMapOfIntToCount(endpoint.StatusCodes),
 		AverageDuration:      endpoint.AverageDuration,
 		AverageTotalDuration: endpoint.AverageTotalDuration,
+		DurationSketch:       endpoint.DurationSketch,
+		TotalDurationSketch:  endpoint.TotalDurationSketch,
 	}
 }
 
+func ConvertHistoryFromPersisted(history map[string]EndpointHistory) HistoryMapping {
+	output := make(HistoryMapping)
+	for key, endpointHistory := range history {
+		parts := strings.Split(key, EndpointDelimiter)
+		output[Endpoint{
+			Method: parts[0],
+			URL:    parts[1],
+		}] = endpointHistory
+	}
+	return output
+}
+
+// EndpointsInRange aggregates the calls made to each endpoint during [from, to),
+// given as Unix timestamps in milliseconds, out of the history of the endpoints
+func EndpointsInRange(
+	history map[string]EndpointHistory,
+	from, to int64,
+) map[string]EndpointOutput {
+	output := make(map[string]EndpointOutput)
+	for key, endpointHistory := range history {
+		bucket, minTime, maxTime := endpointHistory.InRange(from, to)
+		if bucket.Count == 0 {
+			continue
+		}
+		output[key] = EndpointOutput{
+			MinTime:              sharedActions.TimestampToStringFromInt64(minTime),
+			MaxTime:              sharedActions.TimestampToStringFromInt64(maxTime),
+			Count:                bucket.Count,
+			StatusCodes:          bucket.StatusCodes,
+			AverageDuration:      bucket.AverageDuration,
+			AverageTotalDuration: bucket.AverageTotalDuration,
+
+			DurationPercentiles:      bucket.DurationSketch.Percentiles(),
+			TotalDurationPercentiles: bucket.TotalDurationSketch.Percentiles(),
+		}
+	}
+	return output
+}
+
 func convertMapOfIntToCount(ints map[int]int) map[int]Count {
 	result := make(map[int]Count)
 	for key, value := range ints {
@@ -79,3 +122,23 @@ func convertMapOfIntToCount(ints map[int]int) map[int]Count {
 	}
 	return result
 }
+
+// ConvertPathParamDetection converts the path param detection rules of the known endpoints
+// into the per host overrides of the URL tree
+func ConvertPathParamDetection(
+	rules []PathParamDetectionRule,
+) (map[string]urltree.HostPathParamDetection, error) {
+	overrides := make(map[string]urltree.HostPathParamDetection, len(rules))
+	for _, rule := range rules {
+		override := urltree.HostPathParamDetection{Disabled: rule.Disabled}
+		for _, name := range rule.Classifiers {
+			classifier, err := urltree.ParseSegmentClassifier(name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path param detection for %v: %w", rule.Host, err)
+			}
+			override.Classifiers = append(override.Classifiers, classifier)
+		}
+		overrides[rule.Host] = override
+	}
+	return overrides, nil
+}
@@ -12,6 +12,8 @@ type URLTree[T any] struct {
 	Root                     *Node[T]
 	maxSplitThreshold        int
 	assumedPathParamsEnabled bool
+
+	pathParamDetectionHosts map[string]HostPathParamDetection
 }
 
 type Node[T any] struct {
@@ -2,6 +2,7 @@ package urltree
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/samber/lo"
@@ -54,7 +55,13 @@ func (urlTree *URLTree[T]) insertWithConvergenceIndication(
 	pathParamCount := 0
 	currentNode := urlTree.Root
 
-	for _, urlPart := range splitURL {
+	var classifiers []SegmentClassifier
+	if urlTree.assumedPathParamsEnabled && !declaredURL {
+		classifiers = urlTree.segmentClassifiers(strings.SplitN(trimURL(url), "/", 2)[0])
+	}
+	detectedParamNames := map[string]struct{}{}
+
+	for partIndex, urlPart := range splitURL {
 		// Handle wildcard first
 		if urlPart.Value == wildcard {
 			currentNode.WildcardChild = &Node[T]{
@@ -99,6 +106,28 @@ func (urlTree *URLTree[T]) insertWithConvergenceIndication(
 			continue
 		}
 
+		// Parameterize identifiers recognized by their format right away
+		if classifier, detected := classifyPathPart(splitURL, partIndex, classifiers); detected {
+			pathParamCount++
+			if currentNode.ParametricChild.Child == nil {
+				name, named := buildDetectedPathParamName(
+					previousConstantPathPart(splitURL, partIndex, classifiers),
+					classifier,
+				)
+				if _, taken := detectedParamNames[name]; !named || taken {
+					name = buildAssumedPathParamName(pathParamCount)
+				}
+				detectedParamNames[name] = struct{}{}
+
+				child, converged := convergeClassifiedChildren(currentNode, classifiers, pathParamCount)
+				convergenceOccurred = convergenceOccurred || converged
+				currentNode.ParametricChild = ParametricChild[T]{Name: name, Child: child}
+				log.Trace().Str("original-url", url).Msgf("detected path parameter %v", name)
+			}
+			currentNode = currentNode.ParametricChild.Child
+			continue
+		}
+
 		// Preparation for convergence if needed
 		currentConstantPathOnlyChildNodes := []*Node[T]{}
 		currentConstantHostOnlyChildNodes := map[string]*Node[T]{}
@@ -239,6 +268,70 @@ func convergeNodesPaths[T any](nodes []*Node[T], paramIndex int) *Node[T] {
 	}
 }
 
+// convergeClassifiedChildren moves the constant path children which the classifiers
+// recognize, e.g. inserted before detection was configured, under a new parametric child
+func convergeClassifiedChildren[T any](
+	node *Node[T],
+	classifiers []SegmentClassifier,
+	paramIndex int,
+) (*Node[T], bool) {
+	classifiedChildren := []*Node[T]{}
+	for part, child := range node.ConstantChildren {
+		if child.IsPartOfHost {
+			continue
+		}
+		if _, classified := ClassifySegment(part, classifiers); classified {
+			classifiedChildren = append(classifiedChildren, child)
+			delete(node.ConstantChildren, part)
+		}
+	}
+	if len(classifiedChildren) == 0 {
+		return &Node[T]{}, false
+	}
+	return convergeNodesPaths(append(classifiedChildren, &Node[T]{}), paramIndex), true
+}
+
+// classifyPathPart classifies the path segment at the given index.
+// Numbers are only detected following a collection, as in /users/42,
+// since elsewhere they are usually versions, e.g. /api/2/users.
+func classifyPathPart(
+	splitURL []urlPart,
+	partIndex int,
+	classifiers []SegmentClassifier,
+) (SegmentClassifier, bool) {
+	urlPart := splitURL[partIndex]
+	if urlPart.IsPartOfHost || len(classifiers) == 0 {
+		return "", false
+	}
+	classifier, classified := ClassifySegment(urlPart.Value, classifiers)
+	if classified && classifier == NumericSegment &&
+		!isCollectionName(previousConstantPathPart(splitURL, partIndex, classifiers)) {
+		return "", false
+	}
+	return classifier, classified
+}
+
+// previousConstantPathPart returns the path segment preceding the given one,
+// unless it is a parameter itself
+func previousConstantPathPart(
+	splitURL []urlPart,
+	partIndex int,
+	classifiers []SegmentClassifier,
+) string {
+	if partIndex == 0 {
+		return ""
+	}
+	previous := splitURL[partIndex-1]
+	if _, isPathParam := TryExtractPathParameter(previous.Value); isPathParam ||
+		previous.IsPartOfHost {
+		return ""
+	}
+	if _, detected := classifyPathPart(splitURL, partIndex-1, classifiers); detected {
+		return ""
+	}
+	return previous.Value
+}
+
 func buildAssumedPathParamName(paramIndex int) string {
 	return fmt.Sprintf("_param_%v", paramIndex)
 }
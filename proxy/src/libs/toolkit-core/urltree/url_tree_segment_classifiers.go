@@ -0,0 +1,168 @@
+package urltree
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SegmentClassifier recognizes path segments which are identifiers by their format,
+// so they can be parameterized as soon as they are seen
+type SegmentClassifier string
+
+const (
+	UUIDSegment    SegmentClassifier = "uuid"
+	NumericSegment SegmentClassifier = "numeric"
+	HexSegment     SegmentClassifier = "hex"
+	ULIDSegment    SegmentClassifier = "ulid"
+	KSUIDSegment   SegmentClassifier = "ksuid"
+	Base64Segment  SegmentClassifier = "base64"
+	EmailSegment   SegmentClassifier = "email"
+
+	minHexSegmentLength    = 16
+	minBase64SegmentLength = 16
+)
+
+// HostPathParamDetection sets the segment classifiers used for a host.
+// Disabled excludes a host from a detection given for all hosts.
+type HostPathParamDetection struct {
+	Disabled bool
+	// Classifiers restricts detection to the given classifiers, all are used when empty
+	Classifiers []SegmentClassifier
+}
+
+// AllSegmentClassifiers are ordered from the most to the least specific format
+var AllSegmentClassifiers = []SegmentClassifier{
+	UUIDSegment,
+	NumericSegment,
+	HexSegment,
+	ULIDSegment,
+	KSUIDSegment,
+	Base64Segment,
+	EmailSegment,
+}
+
+var (
+	uuidPattern = regexp.MustCompile(
+		`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numericPattern = regexp.MustCompile(`^[0-9]+$`)
+	yearPattern    = regexp.MustCompile(`^(19|20)[0-9]{2}$`)
+	hexPattern     = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	// ULIDs are Crockford base32 and start with a 48 bit timestamp
+	ulidPattern   = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Za-hjkmnp-tv-z]{25}$`)
+	ksuidPattern  = regexp.MustCompile(`^[0-9A-Za-z]{27}$`)
+	base64Pattern = regexp.MustCompile(`^[0-9A-Za-z+_-]+(={0,2}|(%3[dD]){0,2})$`)
+	emailPattern  = regexp.MustCompile(`^[^@\s]+(@|%40)[^@\s]+\.[^@\s]+$`)
+
+	paramNameInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ParseSegmentClassifier returns the classifier with the given name
+func ParseSegmentClassifier(name string) (SegmentClassifier, error) {
+	for _, classifier := range AllSegmentClassifiers {
+		if string(classifier) == name {
+			return classifier, nil
+		}
+	}
+	return "", fmt.Errorf("unknown path segment classifier '%v'", name)
+}
+
+// ClassifySegment returns the first of the given classifiers which recognizes the segment
+func ClassifySegment(
+	segment string,
+	classifiers []SegmentClassifier,
+) (SegmentClassifier, bool) {
+	for _, classifier := range classifiers {
+		if classifier.matches(segment) {
+			return classifier, true
+		}
+	}
+	return "", false
+}
+
+func (classifier SegmentClassifier) matches(segment string) bool {
+	switch classifier {
+	case UUIDSegment:
+		return uuidPattern.MatchString(segment)
+	case NumericSegment:
+		// Years are usually constant segments, e.g. /reports/2024
+		return numericPattern.MatchString(segment) && !yearPattern.MatchString(segment)
+	case HexSegment:
+		// Requiring a digit keeps words such as 'acceptedfeedback' constant
+		return len(segment) >= minHexSegmentLength &&
+			hexPattern.MatchString(segment) &&
+			strings.ContainsAny(segment, "0123456789")
+	case ULIDSegment:
+		return ulidPattern.MatchString(segment)
+	case KSUIDSegment:
+		return ksuidPattern.MatchString(segment) && hasMixedCharacters(segment)
+	case Base64Segment:
+		return len(segment) >= minBase64SegmentLength &&
+			base64Pattern.MatchString(segment) &&
+			hasMixedCharacters(segment)
+	case EmailSegment:
+		return emailPattern.MatchString(segment)
+	}
+	return false
+}
+
+// hasMixedCharacters tells encoded identifiers apart from long words,
+// as they almost always mix digits, lower and upper case letters
+func hasMixedCharacters(segment string) bool {
+	return strings.ContainsAny(segment, "0123456789") &&
+		strings.ContainsAny(segment, "abcdefghijklmnopqrstuvwxyz") &&
+		strings.ContainsAny(segment, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+// buildDetectedPathParamName names a detected path param after the segment preceding it,
+// e.g. /users/{user_id} or /users/{user_email}
+func buildDetectedPathParamName(
+	previousSegment string,
+	classifier SegmentClassifier,
+) (string, bool) {
+	resource := paramNameInvalidChars.ReplaceAllString(strings.ToLower(previousSegment), "_")
+	resource = singularize(strings.Trim(resource, "_"))
+	if resource == "" {
+		return "", false
+	}
+
+	if classifier == EmailSegment {
+		return resource + "_email", true
+	}
+	return resource + "_id", true
+}
+
+// isCollectionName returns true for plural segments, such as the 'users' of /users/42
+func isCollectionName(segment string) bool {
+	resource := strings.ToLower(segment)
+	return resource != "" && singularize(resource) != resource
+}
+
+func singularize(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 3:
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "sses"),
+		strings.HasSuffix(word, "xes"),
+		strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && len(word) > 1:
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+func (urlTree *URLTree[T]) segmentClassifiers(host string) []SegmentClassifier {
+	override, found := urlTree.pathParamDetectionHosts[host]
+	if !found {
+		override, found = urlTree.pathParamDetectionHosts[wildcard]
+	}
+	if !found || override.Disabled {
+		return nil
+	}
+	if len(override.Classifiers) == 0 {
+		return AllSegmentClassifiers
+	}
+	return override.Classifiers
+}
@@ -0,0 +1,157 @@
+package urltree_test
+
+import (
+	"lunar/toolkit-core/urltree"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var allHosts = map[string]urltree.HostPathParamDetection{"*": {}}
+
+func TestClassifySegment(t *testing.T) {
+	t.Parallel()
+	tests := map[string]urltree.SegmentClassifier{
+		"3f2c1a9e-8b7d-4c6e-9f01-23456789abcd": urltree.UUIDSegment,
+		"1234":                                 urltree.NumericSegment,
+		"9f86d081884c7d659a2feaa0c55ad015":     urltree.HexSegment,
+		"01ARZ3NDEKTSV4RRFFQ69G5FAV":           urltree.ULIDSegment,
+		"0ujsszwN8NRY24YaXiTIE2VWDTS":          urltree.KSUIDSegment,
+		"dGhpcyBpcyBhIHRva2Vu":                 urltree.Base64Segment,
+		"jane.doe@example.com":                 urltree.EmailSegment,
+		"jane.doe%40example.com":               urltree.EmailSegment,
+	}
+	for segment, want := range tests {
+		classifier, classified := urltree.ClassifySegment(segment, urltree.AllSegmentClassifiers)
+		assert.True(t, classified, segment)
+		assert.Equal(t, want, classifier, segment)
+	}
+
+	for _, segment := range []string{
+		"users", "v1", "2024", "acceptedfeedback", "internationalization", "me", "api-keys",
+	} {
+		_, classified := urltree.ClassifySegment(segment, urltree.AllSegmentClassifiers)
+		assert.False(t, classified, segment)
+	}
+}
+
+func TestParseSegmentClassifier(t *testing.T) {
+	t.Parallel()
+	classifier, err := urltree.ParseSegmentClassifier("uuid")
+	require.NoError(t, err)
+	assert.Equal(t, urltree.UUIDSegment, classifier)
+
+	_, err = urltree.ParseSegmentClassifier("guid")
+	assert.Error(t, err)
+}
+
+func TestDetectedPathParamsAreNamedAfterThePrecedingSegment(t *testing.T) {
+	t.Parallel()
+	wantValue := &TestStruct{Data: 1}
+	urlTree := urltree.NewURLTree[TestStruct](true, 50).WithPathParamDetection(allHosts)
+
+	err := urlTree.Insert("api.com/users/1234/addresses/jane@doe.com", wantValue)
+	require.NoError(t, err)
+
+	lookupResult := urlTree.Lookup("api.com/users/42/addresses/john@doe.com")
+	assert.True(t, lookupResult.Match)
+	assert.Equal(t, wantValue, lookupResult.Value)
+	assert.Equal(t, "api.com/users/{user_id}/addresses/{address_email}",
+		lookupResult.NormalizedURL)
+	assert.Equal(t, map[string]string{
+		"user_id":       "42",
+		"address_email": "john@doe.com",
+	}, lookupResult.PathParams)
+}
+
+func TestDetectedPathParamsFallBackToAssumedNames(t *testing.T) {
+	t.Parallel()
+	urlTree := urltree.NewURLTree[TestStruct](true, 50).WithPathParamDetection(allHosts)
+
+	err := urlTree.Insert(
+		"api.com/3f2c1a9e-8b7d-4c6e-9f01-23456789abcd/01ARZ3NDEKTSV4RRFFQ69G5FAV", &TestStruct{})
+	require.NoError(t, err)
+
+	lookupResult := urlTree.Lookup(
+		"api.com/0c2f1a9e-8b7d-4c6e-9f01-23456789abcd/01BX5ZZKBKACTAV9WEVGEMMVRZ")
+	assert.Equal(t, "api.com/{_param_1}/{_param_2}", lookupResult.NormalizedURL)
+}
+
+func TestDetectionConvergesPreviouslyInsertedIdentifiers(t *testing.T) {
+	t.Parallel()
+	urlTree := urltree.NewURLTree[TestStruct](true, 50)
+	require.NoError(t, urlTree.Insert("api.com/orders/1/items", &TestStruct{}))
+	require.NoError(t, urlTree.Insert("api.com/orders/pending", &TestStruct{}))
+
+	urlTree.WithPathParamDetection(allHosts)
+	converged, err := urlTree.InsertWithConvergenceIndication("api.com/orders/2", &TestStruct{})
+	require.NoError(t, err)
+	assert.True(t, converged)
+
+	assert.Equal(t, "api.com/orders/{order_id}/items",
+		urlTree.Lookup("api.com/orders/3/items").NormalizedURL)
+	assert.Equal(t, "api.com/orders/pending",
+		urlTree.Lookup("api.com/orders/pending").NormalizedURL)
+}
+
+func TestDetectionRespectsHostOverrides(t *testing.T) {
+	t.Parallel()
+	urlTree := urltree.NewURLTree[TestStruct](true, 50).WithPathParamDetection(
+		map[string]urltree.HostPathParamDetection{
+			"*":          {},
+			"legacy.com": {Disabled: true},
+			"api.com":    {Classifiers: []urltree.SegmentClassifier{urltree.UUIDSegment}},
+		},
+	)
+	for _, url := range []string{
+		"legacy.com/users/1234",
+		"api.com/users/1234",
+		"api.com/users/1234/keys/3f2c1a9e-8b7d-4c6e-9f01-23456789abcd",
+	} {
+		require.NoError(t, urlTree.Insert(url, &TestStruct{}))
+	}
+
+	assert.Equal(t, "legacy.com/users/1234",
+		urlTree.Lookup("legacy.com/users/1234").NormalizedURL)
+	assert.False(t, urlTree.Lookup("legacy.com/users/42").Match)
+	assert.Equal(t, "api.com/users/1234/keys/{key_id}",
+		urlTree.Lookup("api.com/users/1234/keys/0c2f1a9e-8b7d-4c6e-9f01-23456789abcd").
+			NormalizedURL)
+}
+
+func TestDeclaredURLsAreNotDetected(t *testing.T) {
+	t.Parallel()
+	urlTree := urltree.NewURLTree[TestStruct](true, 50).WithPathParamDetection(allHosts)
+
+	require.NoError(t, urlTree.InsertDeclaredURL("api.com/v1/users/1234", &TestStruct{}))
+	require.NoError(t, urlTree.Insert("api.com/v1/users/1234", &TestStruct{}))
+
+	assert.Equal(t, "api.com/v1/users/1234",
+		urlTree.Lookup("api.com/v1/users/1234").NormalizedURL)
+}
+
+func TestDetectionOnlyForConfiguredHosts(t *testing.T) {
+	t.Parallel()
+	urlTree := urltree.NewURLTree[TestStruct](true, 50).WithPathParamDetection(
+		map[string]urltree.HostPathParamDetection{"api.com": {}},
+	)
+	require.NoError(t, urlTree.Insert("api.com/users/1234", &TestStruct{}))
+	require.NoError(t, urlTree.Insert("other.com/users/1234", &TestStruct{}))
+
+	assert.Equal(t, "api.com/users/{user_id}", urlTree.Lookup("api.com/users/42").NormalizedURL)
+	assert.False(t, urlTree.Lookup("other.com/users/42").Match)
+}
+
+func TestNumbersDetectedOnlyAfterCollections(t *testing.T) {
+	t.Parallel()
+	urlTree := urltree.NewURLTree[TestStruct](true, 50).WithPathParamDetection(allHosts)
+	for _, url := range []string{
+		"api.com/2/users",
+		"api.com/account/1234",
+		"api.com/reports/2024",
+	} {
+		require.NoError(t, urlTree.Insert(url, &TestStruct{}))
+		assert.Equal(t, url, urlTree.Lookup(url).NormalizedURL)
+	}
+}
@@ -20,6 +20,17 @@ func NewURLTree[T any](
 	return &urlTree
 }
 
+// WithPathParamDetection makes assumed path params parameterize segments recognized by
+// the segment classifiers immediately, instead of waiting for the split threshold.
+// Detection is keyed by host, only the given hosts are detected,
+// or all hosts if '*' is given.
+func (urlTree *URLTree[T]) WithPathParamDetection(
+	hosts map[string]HostPathParamDetection,
+) *URLTree[T] {
+	urlTree.pathParamDetectionHosts = hosts
+	return urlTree
+}
+
 func (urlTreeNode *Node[T]) hasValue() bool {
 	return urlTreeNode != nil && urlTreeNode.Value != nil
 }
@@ -53,6 +53,15 @@ func BuildTree(
 	maxSplitThreshold int,
 ) (*SimpleURLTree, error) {
 	tree := urltree.NewURLTree[EmptyStruct](true, maxSplitThreshold)
+	if len(endpoints.PathParamDetection) > 0 {
+		detectionHosts, err := sharedDiscovery.ConvertPathParamDetection(
+			endpoints.PathParamDetection,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tree.WithPathParamDetection(detectionHosts)
+	}
 	emptyStruct := EmptyStruct{}
 	for _, endpoint := range endpoints.Endpoints {
 		log.Trace().Msgf("BuildTree: Inserting %v into initial tree", endpoint.URL)
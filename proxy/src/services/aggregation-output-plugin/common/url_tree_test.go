@@ -0,0 +1,48 @@
+package common_test
+
+import (
+	"lunar/aggregation-plugin/common"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTreeAppliesPathParamDetectionRules(t *testing.T) {
+	t.Parallel()
+	tree, err := common.BuildTree(sharedDiscovery.KnownEndpoints{
+		PathParamDetection: []sharedDiscovery.PathParamDetectionRule{
+			{Host: "*"},
+			{Host: "legacy.com", Disabled: true},
+		},
+	}, 50)
+	require.NoError(t, err)
+
+	_, err = common.NormalizeTree(tree, []string{"api.com/users/1", "legacy.com/users/1"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "api.com/users/{user_id}", common.NormalizeURL(tree, "api.com/users/2"))
+	assert.Equal(t, "legacy.com/users/2", common.NormalizeURL(tree, "legacy.com/users/2"))
+}
+
+func TestBuildTreeDetectsPathParamsOnlyWhenConfigured(t *testing.T) {
+	t.Parallel()
+	tree, err := common.BuildTree(sharedDiscovery.KnownEndpoints{}, 50)
+	require.NoError(t, err)
+
+	_, err = common.NormalizeTree(tree, []string{"api.com/users/1"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "api.com/users/2", common.NormalizeURL(tree, "api.com/users/2"))
+}
+
+func TestBuildTreeRejectsUnknownSegmentClassifiers(t *testing.T) {
+	t.Parallel()
+	_, err := common.BuildTree(sharedDiscovery.KnownEndpoints{
+		PathParamDetection: []sharedDiscovery.PathParamDetectionRule{
+			{Host: "api.com", Classifiers: []string{"guid"}},
+		},
+	}, 50)
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package discovery
 import (
 	"lunar/aggregation-plugin/common"
 	sharedDiscovery "lunar/shared-model/discovery"
+	"sort"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -42,9 +43,17 @@ func ExtractAggs(
 		},
 	)
 
+	history := lo.MapValues(
+		byEndpoint,
+		func(accessLogs []AccessLog, _ sharedDiscovery.Endpoint) sharedDiscovery.EndpointHistory {
+			return extractEndpointHistory(accessLogs)
+		},
+	)
+
 	return Agg{
 		Endpoints: mapByEndpoint,
 		Consumers: mapByConsumer,
+		History:   history,
 		Interceptors: lo.MapValues(
 			byInterceptor,
 			func(accessLogs []AccessLog,
@@ -134,6 +143,13 @@ func extractEndpointAgg(records []AccessLog) sharedDiscovery.EndpointAgg {
 		)) / float32(count)
 	}
 
+	durationSketch := sharedDiscovery.NewLatencySketch()
+	totalDurationSketch := sharedDiscovery.NewLatencySketch()
+	for _, record := range records {
+		durationSketch.Add(float64(record.Duration))
+		totalDurationSketch.Add(float64(record.TotalDuration))
+	}
+
 	return sharedDiscovery.EndpointAgg{
 		MinTime:              minTime,
 		MaxTime:              maxTime,
@@ -141,7 +157,45 @@ func extractEndpointAgg(records []AccessLog) sharedDiscovery.EndpointAgg {
 		StatusCodes:          statusCodes,
 		AverageDuration:      averageDuration,
 		AverageTotalDuration: averageTotalDuration,
+		DurationSketch:       durationSketch,
+		TotalDurationSketch:  totalDurationSketch,
+	}
+}
+
+// extractEndpointHistory counts the records into per minute buckets,
+// they are downsampled once combined with the existing history
+func extractEndpointHistory(records []AccessLog) sharedDiscovery.EndpointHistory {
+	byMinute := lo.GroupBy(records, func(accessLog AccessLog) int64 {
+		return sharedDiscovery.MinuteBucket.BucketStart(accessLog.Timestamp)
+	})
+
+	buckets := make([]sharedDiscovery.HistoryBucket, 0, len(byMinute))
+	for start, minuteRecords := range byMinute {
+		count := len(minuteRecords)
+		durationSketch := sharedDiscovery.NewLatencySketch()
+		totalDurationSketch := sharedDiscovery.NewLatencySketch()
+		for _, record := range minuteRecords {
+			durationSketch.Add(float64(record.Duration))
+			totalDurationSketch.Add(float64(record.TotalDuration))
+		}
+		buckets = append(buckets, sharedDiscovery.HistoryBucket{
+			Start:       start,
+			Count:       count,
+			StatusCodes: convertMapOfCountToInt(countStatusCodes(minuteRecords)),
+			AverageDuration: float32(lo.SumBy(
+				minuteRecords,
+				func(accessLog AccessLog) int { return accessLog.Duration },
+			)) / float32(count),
+			AverageTotalDuration: float32(lo.SumBy(
+				minuteRecords,
+				func(accessLog AccessLog) int { return accessLog.TotalDuration },
+			)) / float32(count),
+			DurationSketch:      durationSketch,
+			TotalDurationSketch: totalDurationSketch,
+		})
 	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start < buckets[j].Start })
+	return sharedDiscovery.EndpointHistory{Minutes: buckets}
 }
 
 func countStatusCodes(records []AccessLog) map[int]sharedDiscovery.Count {
@@ -24,6 +24,7 @@ func (aggA Agg) Combine(aggB Agg) Agg {
 			aggA.Consumers,
 			aggB.Consumers,
 		),
+		History: aggA.History.Combine(aggB.History),
 	}
 }
 
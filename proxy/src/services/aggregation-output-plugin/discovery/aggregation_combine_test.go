@@ -319,6 +319,7 @@ func TestCombineAggMapsWhenBothEmptyItReturnsEmptyMap(t *testing.T) {
 		Endpoints:    make(map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg),
 		Interceptors: make(map[common.Interceptor]discovery.InterceptorAgg),
 		Consumers:    make(map[string]sharedDiscovery.EndpointMapping),
+		History:      make(sharedDiscovery.HistoryMapping),
 	}
 
 	combined := discovery.CombineAggregation(empty, empty)
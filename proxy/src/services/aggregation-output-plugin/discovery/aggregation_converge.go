@@ -51,9 +51,23 @@ func ConvergeAggregation(
 		consumerAgg[consumer] = normMapping
 	}
 
+	history := sharedDiscovery.HistoryMapping{}
+	for endpoint, endpointHistory := range aggregation.History {
+		normEndpoint := sharedDiscovery.Endpoint{
+			Method: endpoint.Method,
+			URL:    common.NormalizeURL(tree, endpoint.URL),
+		}
+		if _, exists := history[normEndpoint]; !exists {
+			history[normEndpoint] = endpointHistory
+			continue
+		}
+		history[normEndpoint] = history[normEndpoint].Combine(endpointHistory)
+	}
+
 	return Agg{
 		Interceptors: aggregation.Interceptors,
 		Endpoints:    endpointsAgg,
 		Consumers:    consumerAgg,
+		History:      history,
 	}, nil
 }
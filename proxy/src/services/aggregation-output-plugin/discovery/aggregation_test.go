@@ -11,6 +11,14 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func latencySketch(latencies ...float64) *sharedDiscovery.LatencySketch {
+	sketch := sharedDiscovery.NewLatencySketch()
+	for _, latency := range latencies {
+		sketch.Add(latency)
+	}
+	return sketch
+}
+
 func TestExtractAggs(t *testing.T) {
 	t.Parallel()
 	endpointA := sharedDiscovery.Endpoint{
@@ -102,6 +110,8 @@ func TestExtractAggs(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{200: 1, 400: 1},
 		AverageDuration:      7.5,
 		AverageTotalDuration: 4,
+		DurationSketch:       latencySketch(10, 5),
+		TotalDurationSketch:  latencySketch(5, 3),
 	}
 
 	wantEndpointBAgg := sharedDiscovery.EndpointAgg{
@@ -111,6 +121,8 @@ func TestExtractAggs(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{401: 1},
 		AverageDuration:      58,
 		AverageTotalDuration: 50,
+		DurationSketch:       latencySketch(58),
+		TotalDurationSketch:  latencySketch(50),
 	}
 	wantEndpointCAgg := sharedDiscovery.EndpointAgg{
 		MinTime:              1687675938000,
@@ -119,6 +131,8 @@ func TestExtractAggs(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{404: 1},
 		AverageDuration:      298,
 		AverageTotalDuration: 200,
+		DurationSketch:       latencySketch(298),
+		TotalDurationSketch:  latencySketch(200),
 	}
 
 	wantInterceptorAAgg := discovery.InterceptorAgg{
@@ -221,6 +235,8 @@ func TestExtractAggsWithParametericPathParts(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{200: 1, 400: 1},
 		AverageDuration:      7.5,
 		AverageTotalDuration: 4,
+		DurationSketch:       latencySketch(10, 5),
+		TotalDurationSketch:  latencySketch(5, 3),
 	}
 
 	wantEndpointBAgg := sharedDiscovery.EndpointAgg{
@@ -230,6 +246,8 @@ func TestExtractAggsWithParametericPathParts(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{401: 1},
 		AverageDuration:      58,
 		AverageTotalDuration: 50,
+		DurationSketch:       latencySketch(58),
+		TotalDurationSketch:  latencySketch(50),
 	}
 
 	res := discovery.ExtractAggs(accessLogs, tree)
@@ -301,6 +319,8 @@ func TestExtractAggsWithPathParamsAndOverlappingConstantPart(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{200: 1, 400: 1},
 		AverageDuration:      7.5,
 		AverageTotalDuration: 4,
+		DurationSketch:       latencySketch(10, 5),
+		TotalDurationSketch:  latencySketch(5, 3),
 	}
 
 	wantEndpointBAgg := sharedDiscovery.EndpointAgg{
@@ -310,6 +330,8 @@ func TestExtractAggsWithPathParamsAndOverlappingConstantPart(t *testing.T) {
 		StatusCodes:          map[int]sharedDiscovery.Count{401: 1},
 		AverageDuration:      58,
 		AverageTotalDuration: 50,
+		DurationSketch:       latencySketch(58),
+		TotalDurationSketch:  latencySketch(50),
 	}
 
 	res := discovery.ExtractAggs(accessLogs, tree)
@@ -19,6 +19,7 @@ type (
 		Interceptors map[common.Interceptor]InterceptorAgg
 		Endpoints    map[shared_discovery.Endpoint]shared_discovery.EndpointAgg
 		Consumers    map[string]shared_discovery.EndpointMapping
+		History      shared_discovery.HistoryMapping
 	}
 
 	InterceptorAgg struct {
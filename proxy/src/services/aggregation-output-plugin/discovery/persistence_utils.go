@@ -14,6 +14,7 @@ func ConvertToPersisted(aggregations Agg) sharedDiscovery.Output {
 		Interceptors: []sharedDiscovery.InterceptorOutput{},
 		Endpoints:    map[string]sharedDiscovery.EndpointOutput{},
 		Consumers:    map[string]map[string]sharedDiscovery.EndpointOutput{},
+		History:      map[string]sharedDiscovery.EndpointHistory{},
 	}
 
 	for endpoint, agg := range aggregations.Endpoints {
@@ -29,6 +30,10 @@ func ConvertToPersisted(aggregations Agg) sharedDiscovery.Output {
 		}
 	}
 
+	for endpoint, history := range aggregations.History {
+		output.History[dumpEndpoint(endpoint)] = history
+	}
+
 	for interceptor, agg := range aggregations.Interceptors {
 		output.Interceptors = append(output.Interceptors, sharedDiscovery.InterceptorOutput{
 			Type:    interceptor.Type,
@@ -38,6 +43,7 @@ func ConvertToPersisted(aggregations Agg) sharedDiscovery.Output {
 		})
 	}
 
+	output.StoreSketches()
 	return output
 }
 
@@ -48,8 +54,10 @@ func ConvertFromPersisted(output sharedDiscovery.Output) *Agg {
 		Consumers:    map[string]sharedDiscovery.EndpointMapping{},
 	}
 
+	output.LoadSketches()
 	aggregations.Endpoints = sharedDiscovery.ConvertEndpointsFromPersisted(output.Endpoints)
 	aggregations.Consumers = sharedDiscovery.ConvertConsumersFromPersisted(output.Consumers)
+	aggregations.History = sharedDiscovery.ConvertHistoryFromPersisted(output.History)
 
 	for _, interceptor := range output.Interceptors {
 		timestamp, err := sharedActions.TimestampFromStringToInt64(interceptor.LastTransactionDate)
@@ -88,5 +96,10 @@ func convertEndpointToPersisted(agg sharedDiscovery.EndpointAgg) sharedDiscovery
 		StatusCodes:          convertMapOfCountToInt(agg.StatusCodes),
 		AverageDuration:      agg.AverageDuration,
 		AverageTotalDuration: agg.AverageTotalDuration,
+
+		DurationPercentiles:      agg.DurationSketch.Percentiles(),
+		TotalDurationPercentiles: agg.TotalDurationSketch.Percentiles(),
+		DurationSketch:           agg.DurationSketch,
+		TotalDurationSketch:      agg.TotalDurationSketch,
 	}
 }
@@ -6,6 +6,7 @@ import (
 	sharedDiscovery "lunar/shared-model/discovery"
 	"testing"
 
+	"github.com/goccy/go-json"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -83,7 +84,91 @@ func TestItConvertsAggregationAndAddRequiredRatiosFromTotalCount(t *testing.T) {
 				},
 			},
 		},
+		History: map[string]sharedDiscovery.EndpointHistory{},
 	}
 
 	assert.Equal(t, wantDiscoveryOutput, outputAgg)
 }
+
+func TestItPersistsLatencySketchesAcrossFlushes(t *testing.T) {
+	endpoint := sharedDiscovery.Endpoint{Method: "GET", URL: "foo.org/bar"}
+	tree, err := common.BuildTree(
+		sharedDiscovery.KnownEndpoints{Endpoints: []sharedDiscovery.Endpoint{endpoint}}, 2)
+	assert.Nil(t, err)
+
+	flush := func(latency, count int) discovery.Agg {
+		accessLogs := make([]discovery.AccessLog, 0, count)
+		for range count {
+			accessLogs = append(accessLogs, discovery.AccessLog{
+				ConsumerTag:   "consumerA",
+				Timestamp:     1687762338000,
+				Duration:      latency,
+				TotalDuration: latency + 1,
+				StatusCode:    200,
+				Method:        endpoint.Method,
+				URL:           endpoint.URL,
+			})
+		}
+		return discovery.ExtractAggs(accessLogs, tree)
+	}
+
+	first := flush(50, 90)
+	bytes, err := json.Marshal(discovery.ConvertToPersisted(first))
+	assert.Nil(t, err)
+
+	var output sharedDiscovery.Output
+	assert.Nil(t, json.Unmarshal(bytes, &output))
+	restored := discovery.ConvertFromPersisted(output)
+
+	combined := discovery.ConvertToPersisted(restored.Combine(flush(1000, 10)))
+	for _, endpointOutput := range []sharedDiscovery.EndpointOutput{
+		combined.Endpoints["GET:::foo.org/bar"],
+		combined.Consumers["consumerA"]["GET:::foo.org/bar"],
+	} {
+		assert.Equal(t, 100, endpointOutput.Count)
+		assert.InEpsilon(t, 50, endpointOutput.DurationPercentiles.P50, 0.01)
+		assert.InEpsilon(t, 50, endpointOutput.DurationPercentiles.P90, 0.01)
+		assert.InEpsilon(t, 1000, endpointOutput.DurationPercentiles.P95, 0.01)
+		assert.InEpsilon(t, 1000, endpointOutput.DurationPercentiles.P99, 0.01)
+		assert.InEpsilon(t, 1001, endpointOutput.TotalDurationPercentiles.P99, 0.01)
+	}
+}
+
+func TestItPersistsHistoryAcrossFlushes(t *testing.T) {
+	endpoint := sharedDiscovery.Endpoint{Method: "GET", URL: "foo.org/bar"}
+	tree, err := common.BuildTree(
+		sharedDiscovery.KnownEndpoints{Endpoints: []sharedDiscovery.Endpoint{endpoint}}, 2)
+	assert.Nil(t, err)
+
+	flush := func(timestamp int64, statusCode int) discovery.Agg {
+		return discovery.ExtractAggs([]discovery.AccessLog{{
+			Timestamp:  timestamp,
+			Duration:   10,
+			StatusCode: statusCode,
+			Method:     endpoint.Method,
+			URL:        endpoint.URL,
+		}}, tree)
+	}
+
+	const hour = int64(60 * 60 * 1000)
+	start := int64(1687762320000) // Mon, 26 Jun 2023 06:52:00 GMT
+	bytes, err := json.Marshal(discovery.ConvertToPersisted(
+		flush(start, 200).Combine(flush(start+1000, 500))))
+	assert.Nil(t, err)
+
+	var output sharedDiscovery.Output
+	assert.Nil(t, json.Unmarshal(bytes, &output))
+	restored := discovery.ConvertFromPersisted(output)
+
+	combined := discovery.ConvertToPersisted(restored.Combine(flush(start+3*hour, 200)))
+	history := combined.History["GET:::foo.org/bar"]
+	assert.Len(t, history.Minutes, 1)
+	assert.Equal(t, start+3*hour, history.Minutes[0].Start)
+	// the first flush is older than 2 hours, so it was downsampled into its hour
+	assert.Len(t, history.Hours, 1)
+	assert.Equal(t, int64(1687759200000), history.Hours[0].Start)
+	assert.Equal(t, map[int]int{200: 1, 500: 1}, history.Hours[0].StatusCodes)
+
+	endpoints := sharedDiscovery.EndpointsInRange(combined.History, start, start+hour)
+	assert.Equal(t, 2, endpoints["GET:::foo.org/bar"].Count)
+}
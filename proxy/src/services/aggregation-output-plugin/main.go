@@ -5,6 +5,7 @@ import (
 	"lunar/aggregation-plugin/common"
 	"lunar/aggregation-plugin/discovery"
 	"lunar/aggregation-plugin/remedy"
+	"lunar/aggregation-plugin/schemas"
 	"lunar/toolkit-core/logging"
 	"unsafe"
 
@@ -22,17 +23,22 @@ const (
 	PluginDesc               = "Aggregation"
 	appName                  = "aggregation-output-plugin"
 	urlTreeMaxSplitThreshold = 50
+	// bodySamplesTag is the tag of the body samples exported by the engine,
+	// all other records are access logs
+	bodySamplesTag = "discovery_samples"
 )
 
 var (
 	discoveryStateLocation   = os.Getenv("DISCOVERY_STATE_LOCATION")
 	remedyStatsStateLocation = os.Getenv("REMEDY_STATE_LOCATION")
+	schemasStateLocation     = os.Getenv("SCHEMAS_STATE_LOCATION")
 )
 
 type PluginContext struct {
 	endpointTree     *common.SimpleURLTree
 	discoveryState   *discovery.State
 	remedyStatsState *remedy.State
+	schemasState     *schemas.State
 	clock            clock.Clock
 }
 
@@ -73,6 +79,17 @@ func FLBPluginInit(plugin unsafe.Pointer) int {
 		}
 	}
 
+	// The schemas are an addition to the discovery, failing to keep them does not fail the plugin
+	var schemasState *schemas.State
+	if schemasStateLocation != "" {
+		schemasState = &schemas.State{Filepath: schemasStateLocation}
+		if err = schemasState.InitializeState(); err != nil {
+			log.Error().Err(err).Msg("Failed to initialize the schemas state, " +
+				"schemas will not be inferred from body samples")
+			schemasState = nil
+		}
+	}
+
 	lastModified, err := common.GetPoliciesLastModifiedTime()
 	if err != nil {
 		log.Error().Stack().
@@ -108,6 +125,7 @@ func FLBPluginInit(plugin unsafe.Pointer) int {
 		endpointTree:     currentTree,
 		remedyStatsState: &remedyStatsState,
 		discoveryState:   &discoveryState,
+		schemasState:     schemasState,
 		clock:            clock.NewRealClock(),
 	}
 	treeRefreshInterval := getTreeRefreshRate()
@@ -135,7 +153,7 @@ func FLBPluginInit(plugin unsafe.Pointer) int {
 func FLBPluginFlushCtx(
 	ctx, data unsafe.Pointer,
 	length C.int,
-	_ *C.char,
+	tag *C.char,
 ) int {
 	context, valid := output.FLBPluginGetContext(ctx).(PluginContext)
 	var tree *common.SimpleURLTree
@@ -151,6 +169,10 @@ func FLBPluginFlushCtx(
 				len(tree.Root.ConstantChildren), tree.Root.ConstantChildren,
 			)
 	}
+	if C.GoString(tag) == bodySamplesTag {
+		return flushBodySamples(context.schemasState, data, int(length), tree)
+	}
+
 	records := discovery.DecodeRecords(data, int(length))
 
 	err := discovery.Run(context.discoveryState, records, tree)
@@ -171,6 +193,26 @@ func FLBPluginFlushCtx(
 	return output.FLB_OK
 }
 
+func flushBodySamples(
+	state *schemas.State,
+	data unsafe.Pointer,
+	length int,
+	tree *common.SimpleURLTree,
+) int {
+	if state == nil {
+		return output.FLB_OK
+	}
+
+	samples := schemas.DecodeRecords(data, length)
+	if err := schemas.Run(state, samples, tree); err != nil {
+		log.Error().Stack().Err(err).Msg("Schemas processing failed")
+		return output.FLB_ERROR
+	}
+
+	log.Trace().Msgf("✍️ successfully updated schemas from %d body samples", len(samples))
+	return output.FLB_OK
+}
+
 //export FLBPluginExit
 func FLBPluginExit() int {
 	log.Info().Msg("Starting shutdown...")
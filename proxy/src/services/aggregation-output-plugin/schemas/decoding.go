@@ -0,0 +1,52 @@
+package schemas
+
+import (
+	"C"
+	"fmt"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"unsafe"
+
+	"github.com/fluent/fluent-bit-go/output"
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+)
+
+const messageKey = "message"
+
+// DecodeRecords decodes the body samples exported by the engine
+func DecodeRecords(data unsafe.Pointer, length int) []sharedDiscovery.BodySample {
+	decoder := output.NewDecoder(data, length)
+	samples := []sharedDiscovery.BodySample{}
+
+	for {
+		ret, _, record := output.GetRecord(decoder)
+		// only ret == 0 means there are more records to process
+		if ret != 0 {
+			break
+		}
+		sample, err := decodeRecord(record)
+		if err != nil {
+			log.Debug().Err(err).Msg("Could not decode body sample")
+			continue
+		}
+		samples = append(samples, *sample)
+	}
+
+	return samples
+}
+
+func decodeRecord(record map[any]any) (*sharedDiscovery.BodySample, error) {
+	raw, valid := record[messageKey].([]byte)
+	if !valid {
+		return nil, fmt.Errorf("key `%v` not found or not a byte array", messageKey)
+	}
+
+	var sample sharedDiscovery.BodySample
+	if err := json.Unmarshal(raw, &sample); err != nil {
+		return nil, fmt.Errorf("failed parsing body sample: %w", err)
+	}
+	if sample.Method == "" || sample.URL == "" {
+		return nil, fmt.Errorf("body sample is missing its endpoint")
+	}
+	return &sample, nil
+}
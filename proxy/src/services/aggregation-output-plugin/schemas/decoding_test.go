@@ -0,0 +1,41 @@
+package schemas
+
+import (
+	"testing"
+
+	sharedDiscovery "lunar/shared-model/discovery"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRecord(t *testing.T) {
+	record := map[any]any{
+		"time":     []byte("2024-05-20T15:30:00.000+0000"),
+		"exporter": []byte("discovery_samples"),
+		"message": []byte(`{"method":"POST","url":"api.com/users","status_code":201,` +
+			`"request_body":{"name":"a"},"response_body":{"id":1}}`),
+	}
+
+	sample, err := decodeRecord(record)
+	require.NoError(t, err)
+	assert.Equal(t, &sharedDiscovery.BodySample{
+		Method:       "POST",
+		URL:          "api.com/users",
+		StatusCode:   201,
+		RequestBody:  []byte(`{"name":"a"}`),
+		ResponseBody: []byte(`{"id":1}`),
+	}, sample)
+}
+
+func TestDecodeRecordFailsOnInvalidSamples(t *testing.T) {
+	for _, record := range []map[any]any{
+		{},
+		{"message": "not bytes"},
+		{"message": []byte(`not json`)},
+		{"message": []byte(`{"status_code":200}`)},
+	} {
+		_, err := decodeRecord(record)
+		assert.Error(t, err)
+	}
+}
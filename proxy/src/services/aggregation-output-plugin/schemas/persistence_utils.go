@@ -0,0 +1,34 @@
+package schemas
+
+import (
+	sharedDiscovery "lunar/shared-model/discovery"
+	"strings"
+)
+
+func ConvertToPersisted(
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas,
+) sharedDiscovery.SchemasOutput {
+	output := sharedDiscovery.SchemasOutput{
+		Endpoints: make(map[string]sharedDiscovery.EndpointSchemas, len(endpoints)),
+	}
+	for endpoint, schemas := range endpoints {
+		key := strings.Join(
+			[]string{endpoint.Method, endpoint.URL}, sharedDiscovery.EndpointDelimiter)
+		output.Endpoints[key] = schemas
+	}
+	return output
+}
+
+func ConvertFromPersisted(
+	output sharedDiscovery.SchemasOutput,
+) map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas {
+	endpoints := make(map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas)
+	for key, schemas := range output.Endpoints {
+		method, url, found := strings.Cut(key, sharedDiscovery.EndpointDelimiter)
+		if !found {
+			continue
+		}
+		endpoints[sharedDiscovery.Endpoint{Method: method, URL: url}] = schemas
+	}
+	return endpoints
+}
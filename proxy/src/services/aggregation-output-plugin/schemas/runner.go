@@ -0,0 +1,57 @@
+package schemas
+
+import (
+	"errors"
+	"lunar/aggregation-plugin/common"
+	sharedDiscovery "lunar/shared-model/discovery"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrCouldNotDumpSchemas = errors.New("could not dump inferred schemas")
+
+// Run merges the schemas of the sampled bodies into the schemas of their endpoints
+func Run(
+	state *State,
+	samples []sharedDiscovery.BodySample,
+	tree common.SimpleURLTreeI,
+) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	endpoints := UpdateSchemas(state.endpoints, samples, tree)
+	log.Trace().Msgf("📐 [schemas] Updated schemas of %d endpoints", len(endpoints))
+
+	if err := state.update(endpoints); err != nil {
+		return errors.Join(ErrCouldNotDumpSchemas, err)
+	}
+	return nil
+}
+
+// UpdateSchemas returns the schemas of the endpoints along with the schemas of the samples.
+// The endpoints are normalized again, since the tree may have converged since they were stored.
+func UpdateSchemas(
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas,
+	samples []sharedDiscovery.BodySample,
+	tree common.SimpleURLTreeI,
+) map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas {
+	normalize := func(method, url string) sharedDiscovery.Endpoint {
+		return sharedDiscovery.Endpoint{Method: method, URL: common.NormalizeURL(tree, url)}
+	}
+
+	res := make(map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas, len(endpoints))
+	for endpoint, schemas := range endpoints {
+		normEndpoint := normalize(endpoint.Method, endpoint.URL)
+		if existing, found := res[normEndpoint]; found {
+			schemas = existing.Combine(schemas)
+		}
+		res[normEndpoint] = schemas
+	}
+
+	for _, sample := range samples {
+		endpoint := normalize(sample.Method, sample.URL)
+		res[endpoint] = res[endpoint].AddSample(sample)
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+package schemas_test
+
+import (
+	"lunar/aggregation-plugin/common"
+	"lunar/aggregation-plugin/schemas"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convergedTree(t *testing.T) common.SimpleURLTreeI {
+	tree, err := common.BuildTree(sharedDiscovery.KnownEndpoints{
+		Endpoints: []sharedDiscovery.Endpoint{
+			{Method: "GET", URL: "api.com/user/1"},
+			{Method: "GET", URL: "api.com/user/2"},
+		},
+	}, 2)
+	require.NoError(t, err)
+	converged, err := common.NormalizeTree(tree, []string{"api.com/user/3"})
+	require.NoError(t, err)
+	require.True(t, converged)
+	return tree
+}
+
+func TestUpdateSchemasNormalizesEndpoints(t *testing.T) {
+	stored := map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas{
+		{Method: "GET", URL: "api.com/user/1"}: sharedDiscovery.EndpointSchemas{}.AddSample(
+			sharedDiscovery.BodySample{
+				StatusCode:   200,
+				ResponseBody: []byte(`{"id": 1, "name": "a"}`),
+			}),
+	}
+	samples := []sharedDiscovery.BodySample{{
+		Method:       "GET",
+		URL:          "api.com/user/3",
+		StatusCode:   200,
+		ResponseBody: []byte(`{"id": 3, "email": "a@b.c"}`),
+	}}
+
+	updated := schemas.UpdateSchemas(stored, samples, convergedTree(t))
+
+	require.Len(t, updated, 1)
+	user := updated[sharedDiscovery.Endpoint{Method: "GET", URL: "api.com/user/{_param_1}"}]
+	assert.Equal(t, 2, user.Samples)
+	assert.Equal(t, []string{"id"}, user.Responses[200].Required)
+	assert.Contains(t, user.Responses[200].Properties, "name")
+	assert.Contains(t, user.Responses[200].Properties, "email")
+}
+
+func TestItPersistsSchemas(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "schemas.json")
+	state := &schemas.State{Filepath: location}
+	require.NoError(t, state.InitializeState())
+
+	tree := convergedTree(t)
+	require.NoError(t, schemas.Run(state, []sharedDiscovery.BodySample{{
+		Method:      "POST",
+		URL:         "api.com/user/3",
+		StatusCode:  201,
+		RequestBody: []byte(`{"name": "a"}`),
+	}}, tree))
+
+	restored := &schemas.State{Filepath: location}
+	require.NoError(t, restored.InitializeState())
+	require.NoError(t, schemas.Run(restored, []sharedDiscovery.BodySample{{
+		Method:      "POST",
+		URL:         "api.com/user/4",
+		StatusCode:  201,
+		RequestBody: []byte(`{"name": "b", "age": 3}`),
+	}}, tree))
+
+	bytes, err := os.ReadFile(location)
+	require.NoError(t, err)
+	output := sharedDiscovery.SchemasOutput{}
+	require.NoError(t, json.Unmarshal(bytes, &output))
+
+	user := output.Endpoints["POST:::api.com/user/{_param_1}"]
+	assert.Equal(t, 2, user.Samples)
+	assert.Equal(t, []string{"name"}, user.Request.Required)
+	assert.Equal(t, sharedDiscovery.SchemaTypeInteger, user.Request.Properties["age"].Type)
+}
@@ -0,0 +1,47 @@
+package schemas
+
+import (
+	"errors"
+	"os"
+
+	sharedDiscovery "lunar/shared-model/discovery"
+
+	"github.com/goccy/go-json"
+)
+
+type State struct {
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas
+	Filepath  string
+}
+
+func (state *State) InitializeState() error {
+	state.endpoints = map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas{}
+
+	bytes, err := os.ReadFile(state.Filepath)
+	if errors.Is(err, os.ErrNotExist) {
+		// If the file does not exist, create it with no schemas
+		return state.update(state.endpoints)
+	}
+	if err != nil {
+		return err
+	}
+
+	output := sharedDiscovery.SchemasOutput{}
+	if err := json.Unmarshal(bytes, &output); err != nil {
+		return err
+	}
+	state.endpoints = ConvertFromPersisted(output)
+	return nil
+}
+
+func (state *State) update(
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointSchemas,
+) error {
+	state.endpoints = endpoints
+
+	bytes, err := json.Marshal(ConvertToPersisted(endpoints))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(state.Filepath, bytes, 0o644)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -14,15 +15,35 @@ const (
 	asyncServiceBindPortEnvKey                = "ASYNC_SERVICE_PORT"
 	asyncServiceWorkersEnvKey                 = "ASYNC_SERVICE_WORKERS"
 	AsyncServiceIdleSecEnvKey                 = "ASYNC_SERVICE_IDLE_SEC"
+	asyncServiceRemovePendingRequestsEnvKey   = "ASYNC_SERVICE_REMOVE_PENDING_REQUESTS_AFTER_MIN"
 	asyncServiceRemoveCompletedRequestsEnvKey = "ASYNC_SERVICE_REMOVE_COMPLETED_REQUESTS_AFTER_MIN"
 	asyncServiceRemoveRetrievedResponseEnvKey = "ASYNC_SERVICE_REMOVE_RETRIEVED_RESPONSE_AFTER_MIN"
+	asyncServiceStoreEnvKey                   = "ASYNC_SERVICE_STORE"
+	asyncServiceStoreDirEnvKey                = "ASYNC_SERVICE_STORE_DIR"
+	asyncServiceMaxJobsEnvKey                 = "ASYNC_SERVICE_MAX_JOBS"
+	asyncServiceWebhookSecretEnvKey           = "ASYNC_SERVICE_WEBHOOK_SECRET"
+	asyncServiceWebhookMaxAttemptsEnvKey      = "ASYNC_SERVICE_WEBHOOK_MAX_ATTEMPTS"
+	asyncServiceWebhookBackoffSecEnvKey       = "ASYNC_SERVICE_WEBHOOK_BACKOFF_SEC"
+	asyncServiceWebhookTimeoutSecEnvKey       = "ASYNC_SERVICE_WEBHOOK_TIMEOUT_SEC"
+	asyncServiceWebhookAllowedHostsEnvKey     = "ASYNC_SERVICE_WEBHOOK_ALLOWED_HOSTS"
+
+	// AsyncServiceStoreMemory keeps the async jobs of the community edition in memory
+	AsyncServiceStoreMemory = "memory"
+	// AsyncServiceStoreFile keeps the async jobs of the community edition in files
+	AsyncServiceStoreFile = "file"
 
 	defaultAsyncServiceBindPort       = "8010"
 	defaultEngineBindPort             = "8000"
 	defaultWorkers                    = 10
 	defaultIdleSec                    = 60
+	defaultRemovePendingRequestsMin   = 24 * 60
 	defaultRemoveCompletedRequestsMin = 60
 	defaultRemoveRetrievedResponseMin = 60
+	defaultStoreDir                   = "/etc/lunar-proxy-internal/async-service"
+	defaultMaxJobs                    = 10000
+	defaultWebhookMaxAttempts         = 5
+	defaultWebhookBackoffSec          = 1
+	defaultWebhookTimeoutSec          = 10
 )
 
 func GetEngineBindPort() string {
@@ -35,6 +56,16 @@ func GetEngineBindPort() string {
 	return port
 }
 
+// GetAsyncServiceRemovePendingRequests returns how long a registered request may wait
+// to be dispatched, zero keeps it until it is dispatched
+func GetAsyncServiceRemovePendingRequests() time.Duration {
+	removePendingRequests, err := GetEnvInt(asyncServiceRemovePendingRequestsEnvKey)
+	if err != nil || removePendingRequests < 0 {
+		removePendingRequests = defaultRemovePendingRequestsMin
+	}
+	return time.Duration(removePendingRequests) * time.Minute
+}
+
 func GetAsyncServiceRemoveCompletedRequests() time.Duration {
 	removeCompletedRequests, err := GetEnvInt(asyncServiceRemoveCompletedRequestsEnvKey)
 	if err != nil {
@@ -44,7 +75,7 @@ func GetAsyncServiceRemoveCompletedRequests() time.Duration {
 				asyncServiceRemoveCompletedRequestsEnvKey, defaultRemoveCompletedRequests)
 		return defaultRemoveCompletedRequests
 	}
-	return time.Duration(removeCompletedRequests) * time.Second
+	return time.Duration(removeCompletedRequests) * time.Minute
 }
 
 func GetAsyncServiceRemoveRetrievedResponse() time.Duration {
@@ -91,6 +122,77 @@ func GetAsyncServiceIdle() time.Duration {
 	return time.Duration(idle) * time.Second
 }
 
+func GetAsyncServiceStore() string {
+	store, err := GetEnv(asyncServiceStoreEnvKey)
+	if err != nil {
+		return AsyncServiceStoreMemory
+	}
+	return store
+}
+
+func GetAsyncServiceStoreDir() string {
+	dir, err := GetEnv(asyncServiceStoreDirEnvKey)
+	if err != nil {
+		return defaultStoreDir
+	}
+	return dir
+}
+
+// GetAsyncServiceMaxJobs returns the number of jobs the community edition holds,
+// beyond which requests are no longer registered. Zero means no limit.
+func GetAsyncServiceMaxJobs() int {
+	maxJobs, err := GetEnvInt(asyncServiceMaxJobsEnvKey)
+	if err != nil || maxJobs < 0 {
+		return defaultMaxJobs
+	}
+	return maxJobs
+}
+
+// GetAsyncServiceWebhookSecret returns the key webhooks are signed with
+func GetAsyncServiceWebhookSecret() string {
+	secret, err := GetEnv(asyncServiceWebhookSecretEnvKey)
+	if err != nil {
+		return ""
+	}
+	return secret
+}
+
+func GetAsyncServiceWebhookMaxAttempts() int {
+	maxAttempts, err := GetEnvInt(asyncServiceWebhookMaxAttemptsEnvKey)
+	if err != nil || maxAttempts < 1 {
+		return defaultWebhookMaxAttempts
+	}
+	return maxAttempts
+}
+
+// GetAsyncServiceWebhookBackoff returns the time to wait after the first failed delivery,
+// which doubles with every failed delivery
+func GetAsyncServiceWebhookBackoff() time.Duration {
+	backoff, err := GetEnvInt(asyncServiceWebhookBackoffSecEnvKey)
+	if err != nil || backoff < 1 {
+		backoff = defaultWebhookBackoffSec
+	}
+	return time.Duration(backoff) * time.Second
+}
+
+func GetAsyncServiceWebhookTimeout() time.Duration {
+	timeout, err := GetEnvInt(asyncServiceWebhookTimeoutSecEnvKey)
+	if err != nil || timeout < 1 {
+		timeout = defaultWebhookTimeoutSec
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// GetAsyncServiceWebhookAllowedHosts returns the only hosts webhooks may be posted to,
+// given as a comma separated list. When empty, webhooks may be posted to public addresses only.
+func GetAsyncServiceWebhookAllowedHosts() []string {
+	allowedHosts, err := GetEnv(asyncServiceWebhookAllowedHostsEnvKey)
+	if err != nil || strings.TrimSpace(allowedHosts) == "" {
+		return nil
+	}
+	return strings.Split(allowedHosts, ",")
+}
+
 func GetEnvInt(key string) (int, error) {
 	val, err := GetEnv(key)
 	if err != nil {
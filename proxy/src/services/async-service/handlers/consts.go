@@ -1,5 +1,3 @@
-//go:build pro
-
 package handlers
 
 const (
@@ -10,6 +8,15 @@ const (
 	AsyncServiceHeaderName         = "X-Lunar-Async"
 	AsyncServiceEnqueuedHeaderName = "X-Lunar-Enqueued"
 
+	// The delivery of the webhook of a request is reported on retrieve with these headers
+	AsyncWebhookStateHeaderName      = "X-Lunar-Async-Webhook-State"
+	AsyncWebhookAttemptsHeaderName   = "X-Lunar-Async-Webhook-Attempts"
+	AsyncWebhookLastStatusHeaderName = "X-Lunar-Async-Webhook-Last-Status"
+	AsyncWebhookLastErrorHeaderName  = "X-Lunar-Async-Webhook-Last-Error"
+	// Webhooks are signed with these headers, see SignWebhook
+	WebhookSignatureHeaderName = "X-Lunar-Signature"
+	WebhookTimestampHeaderName = "X-Lunar-Signature-Timestamp"
+
 	asyncServiceFlowIndicatorHeaderName      = "X-Lunar-Async-Flow"
 	asyncServiceResponseNotAllowedHeaderName = "X-Lunar-Async-State"
 	asyncServiceResponseRegister             = "register"
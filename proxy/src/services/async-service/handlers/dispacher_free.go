@@ -0,0 +1,219 @@
+//go:build !pro
+
+package handlers
+
+import (
+	"lunar/async-service/config"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
+	stream_types "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"maps"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// maxWebhookBackoff bounds the time between two deliveries of a webhook
+const maxWebhookBackoff = 10 * time.Minute
+
+type requestSender func(*stream_types.OnRequest) (*stream_types.OnResponse, error)
+
+// Dispatcher sends the jobs of the store to the gateway.
+// The gateway flows decide whether a job reaches the provider now or is dispatched again later.
+// The responses of jobs registered with a callback URL are then posted to it.
+type Dispatcher struct {
+	store          storage.JobStoreI
+	numWorkers     int64
+	idle           time.Duration
+	runningWorkers atomic.Int64
+	sendRequest    requestSender
+	done           chan bool
+
+	webhooks           *WebhookSender
+	webhookMaxAttempts int
+	webhookBackoff     time.Duration
+}
+
+func NewDispatcher(store storage.JobStoreI) *Dispatcher {
+	webhookSecret := config.GetAsyncServiceWebhookSecret()
+	if webhookSecret == "" {
+		log.Warn().Msg("No webhook secret is set, webhooks will not be signed")
+	}
+
+	return &Dispatcher{
+		store:       store,
+		numWorkers:  config.GetAsyncServiceWorkers(),
+		idle:        config.GetAsyncServiceIdle(),
+		sendRequest: utils.MakeRequest,
+		done:        make(chan bool),
+		webhooks: NewWebhookSender(webhookSecret, config.GetAsyncServiceWebhookTimeout(),
+			NewWebhookTargets(config.GetAsyncServiceWebhookAllowedHosts()),
+			context_manager.Get().GetClock()),
+		webhookMaxAttempts: config.GetAsyncServiceWebhookMaxAttempts(),
+		webhookBackoff:     config.GetAsyncServiceWebhookBackoff(),
+	}
+}
+
+func (d *Dispatcher) Start() {
+	log.Debug().Msgf("Dispatcher started with %d workers", d.numWorkers)
+	go d.start()
+}
+
+func (d *Dispatcher) Stop() {
+	d.done <- true
+	log.Debug().Msgf("Dispatcher stopped")
+}
+
+func (d *Dispatcher) start() {
+	clock := context_manager.Get().GetClock()
+
+	for {
+		select {
+		case <-clock.After(d.idle):
+			d.dispatchDueJobs()
+			d.deliverDueWebhooks()
+			if removed := d.store.RemoveExpired(); removed > 0 {
+				log.Trace().Msgf("Removed %d expired async jobs", removed)
+			}
+		case <-d.done:
+			log.Debug().Msg("Received done signal, exiting")
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) dispatchDueJobs() {
+	availableWorkers := d.numWorkers - d.runningWorkers.Load()
+	if availableWorkers <= 0 {
+		return
+	}
+
+	for _, job := range d.store.ClaimDue(int(availableWorkers)) {
+		d.runningWorkers.Add(1)
+		go func(job *storage.Job) {
+			defer d.runningWorkers.Add(-1)
+			d.process(job)
+		}(job)
+	}
+}
+
+func (d *Dispatcher) deliverDueWebhooks() {
+	availableWorkers := d.numWorkers - d.runningWorkers.Load()
+	if availableWorkers <= 0 {
+		return
+	}
+
+	for _, job := range d.store.ClaimDueWebhooks(int(availableWorkers)) {
+		d.runningWorkers.Add(1)
+		go func(job *storage.Job) {
+			defer d.runningWorkers.Add(-1)
+			d.deliver(job)
+		}(job)
+	}
+}
+
+func (d *Dispatcher) process(job *storage.Job) {
+	IDLogger := log.With().Str("request_id", job.ID).Logger()
+
+	request := *job.Request
+	request.Headers = maps.Clone(job.Request.Headers)
+	if request.Headers == nil {
+		request.Headers = make(map[string]string)
+	}
+	request.Headers[AsyncServiceHeaderName] = "true"
+
+	response, err := d.sendRequest(&request)
+	if err != nil {
+		IDLogger.Trace().Err(err).Msg("Error making request")
+		d.requeue(job, IDLogger)
+		return
+	}
+
+	if response == nil {
+		IDLogger.Trace().Msg("Response is nil")
+		d.requeue(job, IDLogger)
+		return
+	} else if response.ID == "" {
+		response.ID = job.ID
+		response.SequenceID = job.ID
+	}
+
+	if getJobOperation(response, IDLogger) != addResponse {
+		d.requeue(job, IDLogger)
+		return
+	}
+
+	if err = d.store.Complete(job.ID, response); err != nil {
+		IDLogger.Debug().Err(err).Msg("Error storing response")
+		return
+	}
+	IDLogger.Trace().Msgf("Finished processing after %d attempts", job.Attempts)
+}
+
+// deliver posts the response of the job to its callback URL,
+// failed deliveries are retried with an exponential backoff until the attempts run out
+func (d *Dispatcher) deliver(job *storage.Job) {
+	IDLogger := log.With().Str("request_id", job.ID).Logger()
+
+	attempt := storage.WebhookAttempt{}
+	attempt.Status, attempt.Err = d.webhooks.Send(job)
+	if !attempt.Succeeded() {
+		attempt.RetryIn = d.getWebhookRetryIn(job.Webhook.Attempts)
+		IDLogger.Debug().Err(attempt.Err).
+			Msgf("Webhook delivery %d failed with status %d, retrying in %s",
+				job.Webhook.Attempts, attempt.Status, attempt.RetryIn)
+	}
+
+	if err := d.store.RecordWebhookAttempt(job.ID, attempt); err != nil {
+		IDLogger.Debug().Err(err).Msg("Error storing webhook delivery")
+	}
+}
+
+// getWebhookRetryIn returns the time to wait after the failed delivery,
+// zero when the attempts ran out
+func (d *Dispatcher) getWebhookRetryIn(attempts int) time.Duration {
+	if attempts >= d.webhookMaxAttempts {
+		return 0
+	}
+	backoff := d.webhookBackoff
+	for i := 1; i < attempts && backoff < maxWebhookBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxWebhookBackoff)
+}
+
+func (d *Dispatcher) requeue(job *storage.Job, IDLogger zerolog.Logger) {
+	if err := d.store.Requeue(job.ID, d.idle); err != nil {
+		IDLogger.Debug().Err(err).Msg("Error requeuing request")
+	}
+}
+
+// getJobOperation tells whether the response completes the job,
+// the jobs the gateway did not let through are dispatched again
+func getJobOperation(
+	response *stream_types.OnResponse,
+	IDLogger zerolog.Logger,
+) workerResult {
+	if response.Status != http.StatusAccepted {
+		return addResponse
+	}
+
+	headerVal, found := response.Headers[asyncServiceResponseNotAllowedHeaderName]
+	if !found {
+		return addResponse
+	}
+
+	switch headerVal {
+	case asyncServiceResponseRegister, asyncServiceResponseBlocked:
+		return addToPending
+	case asyncServiceResponseError, asyncServiceResponseRetry:
+		return addToIdle
+	default:
+		IDLogger.Debug().Msgf("Unknown header value: %s", headerVal)
+		return noOperation
+	}
+}
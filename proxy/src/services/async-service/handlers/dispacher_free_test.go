@@ -0,0 +1,170 @@
+//go:build !pro
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"lunar/async-service/storage"
+	stream_types "lunar/engine/streams/types"
+	"lunar/toolkit-core/clock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDispatcher(
+	t *testing.T,
+	responses ...*stream_types.OnResponse,
+) (*Dispatcher, storage.JobStoreI, *clock.MockClock) {
+	mockClock := clock.NewMockClock()
+	store := storage.NewMemoryStore(mockClock, storage.Retention{})
+	require.NoError(t, store.Add(&stream_types.OnRequest{
+		ID:         "seq-1",
+		SequenceID: "seq-1",
+		Method:     http.MethodGet,
+		Path:       "/items",
+		Headers:    map[string]string{"X-Lunar-Sequence-Id": "seq-1"},
+	}, ""))
+
+	dispatcher := &Dispatcher{
+		store:      store,
+		numWorkers: 1,
+		idle:       time.Second,
+		sendRequest: func(request *stream_types.OnRequest) (*stream_types.OnResponse, error) {
+			require.Equal(t, "true", request.Headers[AsyncServiceHeaderName])
+			if len(responses) == 0 {
+				return nil, errors.New("connection refused")
+			}
+			response := responses[0]
+			responses = responses[1:]
+			return response, nil
+		},
+	}
+	return dispatcher, store, mockClock
+}
+
+func dispatchOnce(t *testing.T, dispatcher *Dispatcher, store storage.JobStoreI) storage.JobState {
+	jobs := store.ClaimDue(1)
+	require.Len(t, jobs, 1)
+	dispatcher.process(jobs[0])
+
+	job, err := store.Get("seq-1")
+	require.NoError(t, err)
+	return job.State
+}
+
+func TestDispatcherRequeuesUntilTheGatewayLetsTheRequestThrough(t *testing.T) {
+	blocked := &stream_types.OnResponse{
+		Status:  http.StatusAccepted,
+		Headers: map[string]string{asyncServiceResponseNotAllowedHeaderName: "blocked"},
+	}
+	retry := &stream_types.OnResponse{
+		Status:  http.StatusAccepted,
+		Headers: map[string]string{asyncServiceResponseNotAllowedHeaderName: "retry"},
+	}
+	completed := &stream_types.OnResponse{Status: http.StatusOK, Body: "done"}
+	dispatcher, store, mockClock := newTestDispatcher(t, blocked, retry, completed)
+
+	require.Equal(t, storage.JobPending, dispatchOnce(t, dispatcher, store))
+	// requeued jobs wait for the idle time before they are dispatched again
+	require.Empty(t, store.ClaimDue(1))
+
+	for _, expected := range []storage.JobState{storage.JobPending, storage.JobCompleted} {
+		mockClock.AdvanceTime(time.Second)
+		require.Equal(t, expected, dispatchOnce(t, dispatcher, store))
+	}
+
+	job, err := store.Get("seq-1")
+	require.NoError(t, err)
+	require.Equal(t, "done", job.Response.Body)
+	require.Equal(t, "seq-1", job.Response.SequenceID)
+	require.Equal(t, 3, job.Attempts)
+}
+
+func TestDispatcherRequeuesOnRequestErrors(t *testing.T) {
+	dispatcher, store, _ := newTestDispatcher(t)
+	require.Equal(t, storage.JobPending, dispatchOnce(t, dispatcher, store))
+}
+
+func TestDispatcherDeliversWebhooksWithBackoff(t *testing.T) {
+	secret := "webhook-secret"
+	var received []WebhookPayload
+	statuses := []int{http.StatusServiceUnavailable, http.StatusOK}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		signature := SignWebhook([]byte(secret), r.Header.Get(WebhookTimestampHeaderName), body)
+		require.Equal(t, signature, r.Header.Get(WebhookSignatureHeaderName))
+
+		var payload WebhookPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		received = append(received, payload)
+		w.WriteHeader(statuses[len(received)-1])
+	}))
+	defer receiver.Close()
+
+	mockClock := clock.NewMockClock()
+	store := storage.NewMemoryStore(mockClock, storage.Retention{})
+	require.NoError(t, store.Add(&stream_types.OnRequest{SequenceID: "seq-1"}, receiver.URL))
+	require.NoError(t, store.Complete("seq-1", &stream_types.OnResponse{
+		Status:  http.StatusCreated,
+		Headers: map[string]string{"Content-Type": "text/plain"},
+		Body:    "done",
+	}))
+
+	// the local receiver is only reachable once allowed
+	targets := NewWebhookTargets([]string{"127.0.0.1"})
+	dispatcher := &Dispatcher{
+		store:              store,
+		numWorkers:         1,
+		webhooks:           NewWebhookSender(secret, time.Second, targets, mockClock),
+		webhookMaxAttempts: 3,
+		webhookBackoff:     2 * time.Second,
+	}
+
+	deliverOnce := func() *storage.Webhook {
+		jobs := store.ClaimDueWebhooks(1)
+		require.Len(t, jobs, 1)
+		dispatcher.deliver(jobs[0])
+		job, err := store.Get("seq-1")
+		require.NoError(t, err)
+		return job.Webhook
+	}
+
+	webhook := deliverOnce()
+	require.Equal(t, storage.WebhookPending, webhook.State)
+	require.Equal(t, http.StatusServiceUnavailable, webhook.LastStatus)
+	// failed deliveries wait for the backoff before they are sent again
+	require.Empty(t, store.ClaimDueWebhooks(1))
+
+	mockClock.AdvanceTime(2 * time.Second)
+	webhook = deliverOnce()
+	require.Equal(t, storage.WebhookDelivered, webhook.State)
+	require.Equal(t, 2, webhook.Attempts)
+
+	require.Len(t, received, 2)
+	require.Equal(t, WebhookPayload{
+		SequenceID: "seq-1",
+		Status:     http.StatusCreated,
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       "done",
+	}, received[1])
+}
+
+func TestDispatcherWebhookBackoff(t *testing.T) {
+	dispatcher := &Dispatcher{webhookMaxAttempts: 12, webhookBackoff: time.Second}
+	for attempts, retryIn := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		11: maxWebhookBackoff,
+		12: 0,
+	} {
+		require.Equal(t, retryIn, dispatcher.getWebhookRetryIn(attempts), attempts)
+	}
+}
@@ -1,10 +1,10 @@
-//go:build pro
-
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"lunar/async-service/config"
+	"lunar/async-service/storage"
 	"lunar/async-service/utils"
 	stream_types "lunar/engine/streams/types"
 	"net/http"
@@ -68,6 +68,9 @@ func (l *AsyncListener) retrieveHandler(writer http.ResponseWriter, req *http.Re
 	}
 
 	onResponse := l.onAsyncRetrieveFunc(&OnRetrieve{Request: req, SeqID: seqID})
+	for key, value := range onResponse.Headers {
+		writer.Header().Set(key, value)
+	}
 
 	switch onResponse.State {
 	case ResponseNotFound:
@@ -91,8 +94,11 @@ func (l *AsyncListener) registerHandler(writer http.ResponseWriter, req *http.Re
 
 	onRegister := &OnRegister{Request: req}
 	if err := l.onAsyncRegisterFunc(onRegister); err != nil {
-		handleError(writer,
-			fmt.Sprintf("Error in async register function: %s", err), http.StatusInternalServerError, nil)
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrStoreFull) {
+			status = http.StatusServiceUnavailable
+		}
+		handleError(writer, fmt.Sprintf("Error in async register function: %s", err), status, nil)
 		return
 	}
 	seqID := req.Header.Get(utils.HeaderLunarRequestID)
@@ -1,5 +1,3 @@
-//go:build pro
-
 package handlers
 
 import (
@@ -26,6 +24,8 @@ type OnResponse struct {
 	Response *stream_types.OnResponse
 	Msg      string
 	State    OnResponseState
+	// Headers are added to the retrieve response, whatever the state is
+	Headers map[string]string
 }
 
 type OnRetrieve struct {
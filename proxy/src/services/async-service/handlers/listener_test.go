@@ -1,5 +1,3 @@
-//go:build pro
-
 package handlers
 
 import (
@@ -49,6 +47,7 @@ func TestAsyncListener_RetrieveHandler_ValidSeqID(t *testing.T) {
 			State:    ResponseCompleted,
 			Msg:      "Success",
 			Response: &stream_types.OnResponse{Status: http.StatusOK, Body: "Response body"},
+			Headers:  map[string]string{AsyncWebhookStateHeaderName: "delivered"},
 		}
 	})
 
@@ -59,6 +58,7 @@ func TestAsyncListener_RetrieveHandler_ValidSeqID(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 	assert.Contains(t, rec.Body.String(), "Response body")
+	assert.Equal(t, "delivered", rec.Header().Get(AsyncWebhookStateHeaderName))
 }
 
 func TestAsyncListener_RegisterHandler_NoRegisterFunc(t *testing.T) {
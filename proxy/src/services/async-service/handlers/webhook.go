@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
+	"lunar/toolkit-core/clock"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const webhookSignaturePrefix = "sha256="
+
+// WebhookPayload is the body posted to the callback URL of a completed request
+type WebhookPayload struct {
+	SequenceID string            `json:"sequence_id"`
+	Status     int               `json:"status"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// WebhookSender posts the responses of completed requests to their callback URLs,
+// connecting only to the hosts allowed by the targets
+type WebhookSender struct {
+	client *http.Client
+	secret []byte
+	clock  clock.Clock
+}
+
+func NewWebhookSender(
+	secret string,
+	timeout time.Duration,
+	targets *WebhookTargets,
+	clock clock.Clock,
+) *WebhookSender {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would connect to the webhook host on our behalf, skipping the checks of the targets
+	transport.Proxy = nil
+	transport.DialContext = targets.DialContext
+
+	return &WebhookSender{
+		client: &http.Client{Timeout: timeout, Transport: transport},
+		secret: []byte(secret),
+		clock:  clock,
+	}
+}
+
+// Send posts the response of the job to its callback URL
+// and returns the status the callback URL answered with
+func (s *WebhookSender) Send(job *storage.Job) (int, error) {
+	if job.Webhook == nil || job.Response == nil {
+		return 0, fmt.Errorf("job %s has no webhook to send", job.ID)
+	}
+
+	body, err := json.Marshal(WebhookPayload{
+		SequenceID: job.ID,
+		Status:     job.Response.Status,
+		Headers:    job.Response.Headers,
+		Body:       job.Response.Body,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling webhook: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, job.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating webhook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(utils.HeaderLunarRequestID, job.ID)
+	if len(s.secret) > 0 {
+		timestamp := strconv.FormatInt(s.clock.Now().Unix(), 10)
+		request.Header.Set(WebhookTimestampHeaderName, timestamp)
+		request.Header.Set(WebhookSignatureHeaderName, SignWebhook(s.secret, timestamp, body))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("error sending webhook: %w", err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	return response.StatusCode, nil
+}
+
+// SignWebhook returns the signature of a webhook body sent at the given Unix timestamp.
+// Receivers verify it by computing the HMAC-SHA256 of "<timestamp>.<body>" with the shared
+// secret, and reject old timestamps to prevent replays.
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// WebhookTargets restricts the hosts webhooks are posted to.
+// Callback URLs are given by the clients, so without it the gateway could be made to post
+// responses into its own network, e.g. to a cloud metadata address such as 169.254.169.254.
+// When allowed hosts are configured only they are posted to, as given.
+// Otherwise any host is posted to, as long as all its addresses are public.
+type WebhookTargets struct {
+	allowedHosts map[string]struct{}
+	resolver     *net.Resolver
+	dialer       *net.Dialer
+}
+
+func NewWebhookTargets(allowedHosts []string) *WebhookTargets {
+	targets := &WebhookTargets{
+		allowedHosts: make(map[string]struct{}),
+		resolver:     net.DefaultResolver,
+		dialer:       &net.Dialer{},
+	}
+	for _, host := range allowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			targets.allowedHosts[host] = struct{}{}
+		}
+	}
+	return targets
+}
+
+// ValidateURL checks the callback URL on registration.
+// Host names that cannot be resolved yet are accepted,
+// since their addresses are checked again on every delivery.
+func (t *WebhookTargets) ValidateURL(callbackURL string) error {
+	parsedURL, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("invalid callback URL %s: %w", callbackURL, err)
+	}
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return fmt.Errorf("invalid callback URL %s, should be an absolute HTTP URL", callbackURL)
+	}
+
+	host := parsedURL.Hostname()
+	allowed, err := t.isAllowedHost(host)
+	if err != nil || allowed {
+		return err
+	}
+	var dnsErr *net.DNSError
+	_, err = t.resolvePublicHost(context.Background(), host)
+	if err != nil && !errors.As(err, &dnsErr) {
+		return fmt.Errorf("invalid callback URL %s: %w", callbackURL, err)
+	}
+	return nil
+}
+
+// DialContext connects to the webhook host, after checking the addresses it resolves to.
+// The connection is made to the checked address, so the host cannot resolve differently
+// in between.
+func (t *WebhookTargets) DialContext(
+	ctx context.Context,
+	network string,
+	address string,
+) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := t.isAllowedHost(host)
+	if err != nil {
+		return nil, err
+	} else if allowed {
+		return t.dialer.DialContext(ctx, network, address)
+	}
+
+	addresses, err := t.resolvePublicHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErrors []error
+	for _, ipAddress := range addresses {
+		conn, err := t.dialer.DialContext(ctx, network,
+			net.JoinHostPort(ipAddress.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErrors = append(dialErrors, err)
+	}
+	return nil, errors.Join(dialErrors...)
+}
+
+// resolvePublicHost returns the addresses of the host, as long as all of them are public
+func (t *WebhookTargets) resolvePublicHost(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addresses, err := t.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("webhook host %s has no addresses", host)
+	}
+	for _, ipAddress := range addresses {
+		if !isPublicIP(ipAddress.IP) {
+			return nil, fmt.Errorf("webhook host %s resolves to %s, which is not a public address",
+				host, ipAddress.IP)
+		}
+	}
+	return addresses, nil
+}
+
+// isAllowedHost returns true if the host is configured as allowed,
+// and an error if other hosts are configured
+func (t *WebhookTargets) isAllowedHost(host string) (bool, error) {
+	if len(t.allowedHosts) == 0 {
+		return false, nil
+	}
+	if _, found := t.allowedHosts[strings.ToLower(host)]; !found {
+		return false, fmt.Errorf("%s is not an allowed webhook host", host)
+	}
+	return true, nil
+}
+
+// isPublicIP returns false for loopback, private, link-local, multicast and unspecified addresses
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
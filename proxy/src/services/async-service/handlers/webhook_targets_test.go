@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"lunar/async-service/storage"
+	stream_types "lunar/engine/streams/types"
+	"lunar/toolkit-core/clock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookTargetsValidateURL(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		allowedHosts []string
+		callbackURL  string
+		valid        bool
+	}{
+		{"public host", nil, "https://client.example.com/hook", true},
+		{"public address", nil, "http://93.184.215.14/hook", true},
+		{"relative", nil, "client.example.com/hook", false},
+		{"not http", nil, "ftp://client.example.com/hook", false},
+		{"loopback", nil, "http://127.0.0.1:8000/hook", false},
+		{"loopback ipv6", nil, "http://[::1]/hook", false},
+		{"private", nil, "http://10.1.2.3/hook", false},
+		{"metadata", nil, "http://169.254.169.254/latest/meta-data", false},
+		{"unspecified", nil, "http://0.0.0.0/hook", false},
+		{"allowed host", []string{"Hooks.example.com"}, "https://hooks.example.com/hook", true},
+		{"allowed address", []string{"10.1.2.3"}, "http://10.1.2.3/hook", true},
+		{"not allowed host", []string{"hooks.example.com"}, "https://client.example.com/hook", false},
+	} {
+		err := NewWebhookTargets(test.allowedHosts).ValidateURL(test.callbackURL)
+		require.Equal(t, test.valid, err == nil, test.name)
+	}
+}
+
+func TestWebhookSenderConnectsToAllowedTargetsOnly(t *testing.T) {
+	delivered := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		delivered++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	job := &storage.Job{
+		ID:       "seq-1",
+		Response: &stream_types.OnResponse{Status: http.StatusOK},
+		Webhook:  &storage.Webhook{URL: receiver.URL},
+	}
+	mockClock := clock.NewMockClock()
+
+	// the receiver listens on a loopback address
+	for _, allowedHosts := range [][]string{nil, {"hooks.example.com"}} {
+		sender := NewWebhookSender("", time.Second, NewWebhookTargets(allowedHosts), mockClock)
+		_, err := sender.Send(job)
+		require.Error(t, err)
+	}
+	require.Zero(t, delivered)
+
+	sender := NewWebhookSender("", time.Second, NewWebhookTargets([]string{"127.0.0.1"}), mockClock)
+	status, err := sender.Send(job)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, 1, delivered)
+}
@@ -2,18 +2,148 @@
 
 package runner
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"lunar/async-service/config"
+	"lunar/async-service/handlers"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
+	context_manager "lunar/toolkit-core/context-manager"
+	"strconv"
+	"strings"
 
-type FreeRunner struct{}
+	"github.com/rs/zerolog/log"
+)
+
+// FreeRunner serves the async requests of the community edition,
+// the jobs are kept in memory or in files instead of Redis
+type FreeRunner struct {
+	store          storage.JobStoreI
+	listener       *handlers.AsyncListener
+	dispatcher     *handlers.Dispatcher
+	webhookTargets *handlers.WebhookTargets
+}
 
 func newRunner() (AsyncServiceI, error) {
-	return &FreeRunner{}, nil
+	store, err := newJobStore()
+	if err != nil {
+		return nil, err
+	}
+	return newFreeRunner(store), nil
+}
+
+func newFreeRunner(store storage.JobStoreI) *FreeRunner {
+	runner := &FreeRunner{
+		store:          store,
+		listener:       handlers.NewListener(),
+		dispatcher:     handlers.NewDispatcher(store),
+		webhookTargets: handlers.NewWebhookTargets(config.GetAsyncServiceWebhookAllowedHosts()),
+	}
+	runner.listener.SetOnAsyncRegisterFunc(runner.onRegister)
+	runner.listener.SetOnAsyncRetrieveFunc(runner.onRetrieve)
+	return runner
+}
+
+func newJobStore() (storage.JobStoreI, error) {
+	clock := context_manager.Get().GetClock()
+	retention := storage.Retention{
+		Pending:   config.GetAsyncServiceRemovePendingRequests(),
+		Completed: config.GetAsyncServiceRemoveCompletedRequests(),
+		Retrieved: config.GetAsyncServiceRemoveRetrievedResponse(),
+		MaxJobs:   config.GetAsyncServiceMaxJobs(),
+	}
+
+	switch store := config.GetAsyncServiceStore(); store {
+	case config.AsyncServiceStoreMemory:
+		return storage.NewMemoryStore(clock, retention), nil
+	case config.AsyncServiceStoreFile:
+		return storage.NewFileStore(config.GetAsyncServiceStoreDir(), clock, retention)
+	default:
+		return nil, fmt.Errorf("unknown async service store %s, should be %s or %s",
+			store, config.AsyncServiceStoreMemory, config.AsyncServiceStoreFile)
+	}
 }
 
 func (r *FreeRunner) Run() error {
-	return fmt.Errorf("this module is not available in the community edition")
+	r.dispatcher.Start()
+	return r.listener.Start()
 }
 
 func (r *FreeRunner) Stop() {
-	// No-op for FreeRunner
+	r.listener.Stop()
+	r.dispatcher.Stop()
+}
+
+func (r *FreeRunner) onRegister(onRegister *handlers.OnRegister) error {
+	// The callback URL is meant for the async service, not for the provider
+	callbackURL := onRegister.Request.Header.Get(utils.HeaderAsyncCallbackURL)
+	onRegister.Request.Header.Del(utils.HeaderAsyncCallbackURL)
+	if callbackURL != "" {
+		if err := r.webhookTargets.ValidateURL(callbackURL); err != nil {
+			return err
+		}
+	}
+	return r.store.Add(utils.ToRequestMessage(onRegister.Request), callbackURL)
+}
+
+func (r *FreeRunner) onRetrieve(onRetrieve *handlers.OnRetrieve) *handlers.OnResponse {
+	seqID := onRetrieve.SeqID
+	if seqID == "" {
+		seqID = onRetrieve.Request.Header.Get(utils.HeaderAsyncRetrieve)
+	}
+
+	job, err := r.store.Get(seqID)
+	if errors.Is(err, storage.ErrJobNotFound) {
+		return &handlers.OnResponse{State: handlers.ResponseNotFound, Msg: "Request not found"}
+	} else if err != nil {
+		return &handlers.OnResponse{State: handlers.ResponseError, Msg: err.Error()}
+	}
+
+	headers := getWebhookHeaders(job)
+	switch job.State {
+	case storage.JobPending:
+		return &handlers.OnResponse{
+			State:   handlers.ResponsePending,
+			Msg:     "Request is pending",
+			Headers: headers,
+		}
+	case storage.JobProcessing:
+		return &handlers.OnResponse{
+			State:   handlers.ResponseProcessing,
+			Msg:     "Request is being processed",
+			Headers: headers,
+		}
+	}
+
+	if err := r.store.MarkRetrieved(seqID); err != nil {
+		log.Debug().Err(err).Msgf("Failed to mark response %s as retrieved", seqID)
+	}
+	return &handlers.OnResponse{
+		State:    handlers.ResponseCompleted,
+		Msg:      "Response retrieved successfully",
+		Response: job.Response,
+		Headers:  headers,
+	}
+}
+
+// getWebhookHeaders reports the delivery of the webhook of the job, if it has one,
+// along with the outcome of its last attempt
+func getWebhookHeaders(job *storage.Job) map[string]string {
+	if job.Webhook == nil {
+		return nil
+	}
+	headers := map[string]string{
+		handlers.AsyncWebhookStateHeaderName:    job.Webhook.State.String(),
+		handlers.AsyncWebhookAttemptsHeaderName: strconv.Itoa(job.Webhook.Attempts),
+	}
+	if job.Webhook.LastStatus != 0 {
+		headers[handlers.AsyncWebhookLastStatusHeaderName] = strconv.Itoa(job.Webhook.LastStatus)
+	}
+	if job.Webhook.LastError != "" {
+		// header values cannot hold line breaks
+		headers[handlers.AsyncWebhookLastErrorHeaderName] = strings.Join(
+			strings.Fields(job.Webhook.LastError), " ")
+	}
+	return headers
 }
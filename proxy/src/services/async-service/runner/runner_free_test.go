@@ -0,0 +1,121 @@
+//go:build !pro
+
+package runner
+
+import (
+	"errors"
+	"lunar/async-service/handlers"
+	"lunar/async-service/storage"
+	"lunar/async-service/utils"
+	stream_types "lunar/engine/streams/types"
+	"lunar/toolkit-core/clock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeRunnerRegisterAndRetrieve(t *testing.T) {
+	store := storage.NewMemoryStore(clock.NewMockClock(), storage.Retention{Retrieved: time.Minute})
+	runner := newFreeRunner(store)
+
+	request := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(`{"id":1}`))
+	request.Header.Set(utils.HeaderLunarRequestID, "seq-1")
+	require.NoError(t, runner.onRegister(&handlers.OnRegister{Request: request}))
+
+	retrieve := func(seqID string, header string) *handlers.OnResponse {
+		request := httptest.NewRequest(http.MethodGet, handlers.RetrievePath, nil)
+		if header != "" {
+			request.Header.Set(utils.HeaderAsyncRetrieve, header)
+		}
+		return runner.onRetrieve(&handlers.OnRetrieve{Request: request, SeqID: seqID})
+	}
+
+	require.Equal(t, handlers.ResponseNotFound, retrieve("seq-2", "").State)
+	require.Equal(t, handlers.ResponsePending, retrieve("seq-1", "").State)
+
+	jobs := store.ClaimDue(1)
+	require.Len(t, jobs, 1)
+	require.Equal(t, `{"id":1}`, jobs[0].Request.Body)
+	require.Equal(t, handlers.ResponseProcessing, retrieve("seq-1", "").State)
+
+	require.NoError(t, store.Complete("seq-1", &stream_types.OnResponse{Status: 200, Body: "done"}))
+	response := retrieve("", "seq-1")
+	require.Equal(t, handlers.ResponseCompleted, response.State)
+	require.Equal(t, "done", response.Response.Body)
+
+	job, err := store.Get("seq-1")
+	require.NoError(t, err)
+	require.False(t, job.RetrievedAt.IsZero())
+}
+
+func TestFreeRunnerRegisterWithCallbackURL(t *testing.T) {
+	t.Setenv("ASYNC_SERVICE_WEBHOOK_ALLOWED_HOSTS", "")
+	store := storage.NewMemoryStore(clock.NewMockClock(), storage.Retention{})
+	runner := newFreeRunner(store)
+
+	register := func(seqID, callbackURL string) error {
+		request := httptest.NewRequest(http.MethodPost, "/jobs", nil)
+		request.Header.Set(utils.HeaderLunarRequestID, seqID)
+		request.Header.Set(utils.HeaderAsyncCallbackURL, callbackURL)
+		return runner.onRegister(&handlers.OnRegister{Request: request})
+	}
+
+	require.Error(t, register("seq-1", "client.example.com/hook"))
+	// the gateway must not be made to post responses into its own network
+	require.Error(t, register("seq-1", "http://169.254.169.254/latest/meta-data"))
+	require.Error(t, register("seq-1", "http://localhost:8000/hook"))
+	require.NoError(t, register("seq-1", "https://client.example.com/hook"))
+
+	job, err := store.Get("seq-1")
+	require.NoError(t, err)
+	require.Equal(t, "https://client.example.com/hook", job.Webhook.URL)
+	require.NotContains(t, job.Request.Headers, utils.HeaderAsyncCallbackURL)
+
+	response := runner.onRetrieve(&handlers.OnRetrieve{
+		Request: httptest.NewRequest(http.MethodGet, handlers.RetrievePath, nil),
+		SeqID:   "seq-1",
+	})
+	require.Equal(t, "pending", response.Headers[handlers.AsyncWebhookStateHeaderName])
+	require.Equal(t, "0", response.Headers[handlers.AsyncWebhookAttemptsHeaderName])
+	require.NotContains(t, response.Headers, handlers.AsyncWebhookLastStatusHeaderName)
+	require.NotContains(t, response.Headers, handlers.AsyncWebhookLastErrorHeaderName)
+
+	// the outcome of the last failed attempt is reported along with the response
+	store.ClaimDue(1)
+	require.NoError(t, store.Complete("seq-1", &stream_types.OnResponse{Status: 200}))
+	require.Len(t, store.ClaimDueWebhooks(1), 1)
+	require.NoError(t, store.RecordWebhookAttempt("seq-1", storage.WebhookAttempt{
+		Status:  502,
+		Err:     errors.New("bad gateway\nfrom the client"),
+		RetryIn: time.Minute,
+	}))
+	response = runner.onRetrieve(&handlers.OnRetrieve{
+		Request: httptest.NewRequest(http.MethodGet, handlers.RetrievePath, nil),
+		SeqID:   "seq-1",
+	})
+	require.Equal(t, "pending", response.Headers[handlers.AsyncWebhookStateHeaderName])
+	require.Equal(t, "1", response.Headers[handlers.AsyncWebhookAttemptsHeaderName])
+	require.Equal(t, "502", response.Headers[handlers.AsyncWebhookLastStatusHeaderName])
+	require.Equal(t, "bad gateway from the client",
+		response.Headers[handlers.AsyncWebhookLastErrorHeaderName])
+}
+
+func TestFreeRunnerRegisterWithAllowedCallbackHosts(t *testing.T) {
+	t.Setenv("ASYNC_SERVICE_WEBHOOK_ALLOWED_HOSTS", "hooks.example.com, internal-hooks")
+	runner := newFreeRunner(storage.NewMemoryStore(clock.NewMockClock(), storage.Retention{}))
+
+	register := func(seqID, callbackURL string) error {
+		request := httptest.NewRequest(http.MethodPost, "/jobs", nil)
+		request.Header.Set(utils.HeaderLunarRequestID, seqID)
+		request.Header.Set(utils.HeaderAsyncCallbackURL, callbackURL)
+		return runner.onRegister(&handlers.OnRegister{Request: request})
+	}
+
+	require.Error(t, register("seq-1", "https://client.example.com/hook"))
+	require.NoError(t, register("seq-1", "https://hooks.example.com/hook"))
+	require.NoError(t, register("seq-2", "http://internal-hooks:8080/hook"))
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	stream_types "lunar/engine/streams/types"
+)
+
+type JobState int
+
+const (
+	// JobPending jobs are waiting to be dispatched
+	JobPending JobState = iota
+	// JobProcessing jobs were claimed by a worker and are being dispatched
+	JobProcessing
+	// JobCompleted jobs hold the response of the provider
+	JobCompleted
+)
+
+type WebhookState int
+
+const (
+	// WebhookPending webhooks are waiting to be delivered
+	WebhookPending WebhookState = iota
+	// WebhookDelivering webhooks were claimed by a worker and are being delivered
+	WebhookDelivering
+	// WebhookDelivered webhooks were accepted by the callback URL
+	WebhookDelivered
+	// WebhookFailed webhooks ran out of attempts
+	WebhookFailed
+)
+
+func (s WebhookState) String() string {
+	switch s {
+	case WebhookPending:
+		return "pending"
+	case WebhookDelivering:
+		return "delivering"
+	case WebhookDelivered:
+		return "delivered"
+	case WebhookFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	// ErrStoreFull is returned when a request is registered with a store holding its maximum jobs
+	ErrStoreFull = errors.New("job store is full")
+)
+
+// Job is a request registered with the async service and its response, once completed
+type Job struct {
+	ID          string                   `json:"id"`
+	State       JobState                 `json:"state"`
+	Request     *stream_types.OnRequest  `json:"request"`
+	Response    *stream_types.OnResponse `json:"response,omitempty"`
+	Attempts    int                      `json:"attempts"`
+	CreatedAt   time.Time                `json:"created_at"`
+	DueAt       time.Time                `json:"due_at"`
+	CompletedAt time.Time                `json:"completed_at,omitempty"`
+	RetrievedAt time.Time                `json:"retrieved_at,omitempty"`
+	// Webhook is set for the jobs registered with a callback URL
+	Webhook *Webhook `json:"webhook,omitempty"`
+}
+
+// Webhook is the delivery of a completed job to the callback URL of the client
+type Webhook struct {
+	URL        string       `json:"url"`
+	State      WebhookState `json:"state"`
+	Attempts   int          `json:"attempts"`
+	DueAt      time.Time    `json:"due_at"`
+	LastStatus int          `json:"last_status,omitempty"`
+	LastError  string       `json:"last_error,omitempty"`
+}
+
+// WebhookAttempt is the outcome of a delivery attempt
+type WebhookAttempt struct {
+	Status int
+	Err    error
+	// RetryIn is the time to wait before the next attempt, zero when attempts ran out
+	RetryIn time.Duration
+}
+
+// Succeeded returns true if the callback URL accepted the webhook
+func (a WebhookAttempt) Succeeded() bool {
+	return a.Err == nil && a.Status >= 200 && a.Status < 300
+}
+
+// Retention tells how long jobs are kept and how many of them
+type Retention struct {
+	// Pending is how long a job may wait to be dispatched since it was registered,
+	// zero keeps it until it is dispatched
+	Pending time.Duration
+	// Completed is how long a response is kept when it is not retrieved
+	Completed time.Duration
+	// Retrieved is how long a response is kept after it was retrieved
+	Retrieved time.Duration
+	// MaxJobs is the number of jobs beyond which requests are no longer registered,
+	// zero means no limit
+	MaxJobs int
+}
+
+// JobStoreI holds the async jobs of the community edition
+type JobStoreI interface {
+	// Add registers a request to be dispatched as soon as possible,
+	// its response is delivered to the callback URL when one is given
+	Add(*stream_types.OnRequest, string) error
+	// Get returns a copy of the job
+	Get(string) (*Job, error)
+	// ClaimDue moves up to the given number of due jobs to processing and returns them,
+	// the jobs which are due the longest are claimed first
+	ClaimDue(int) []*Job
+	// Requeue moves a processing job back to pending, to be dispatched after the delay
+	Requeue(string, time.Duration) error
+	// Complete stores the response of a job
+	Complete(string, *stream_types.OnResponse) error
+	// ClaimDueWebhooks moves up to the given number of due webhooks to delivering
+	// and returns their jobs
+	ClaimDueWebhooks(int) []*Job
+	// RecordWebhookAttempt stores the outcome of a delivery attempt
+	RecordWebhookAttempt(string, WebhookAttempt) error
+	// MarkRetrieved starts the retention of a response which was retrieved
+	MarkRetrieved(string) error
+	// RemoveExpired removes the pending jobs and the completed jobs which outlived
+	// their retention and are not being delivered, and returns how many were removed
+	RemoveExpired() int
+}
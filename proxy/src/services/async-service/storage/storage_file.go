@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lunar/toolkit-core/clock"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const jobFileExtension = ".json"
+
+// fileStore keeps every job in a JSON file of its own,
+// so registered requests and their responses survive a restart of the async service
+type fileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string, clock clock.Clock, retention Retention) (JobStoreI, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory %s: %w", dir, err)
+	}
+
+	persistence := &fileStore{dir: dir}
+	store := newMemoryStore(clock, retention, persistence)
+	if err := persistence.load(store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// load reads the stored jobs, the jobs and webhooks which were in flight are sent again
+func (f *fileStore) load(store *memoryStore) error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read job store directory %s: %w", f.dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != jobFileExtension {
+			continue
+		}
+		path := filepath.Join(f.dir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read job file %s: %w", path, err)
+		}
+
+		job := &Job{}
+		if err := json.Unmarshal(content, job); err != nil {
+			log.Warn().Err(err).Msgf("Skipping invalid job file %s", path)
+			continue
+		}
+		if job.State == JobProcessing {
+			job.State = JobPending
+		}
+		if job.Webhook != nil && job.Webhook.State == WebhookDelivering {
+			job.Webhook.State = WebhookPending
+		}
+		store.jobs[job.ID] = job
+	}
+	log.Debug().Msgf("Loaded %d async jobs from %s", len(store.jobs), f.dir)
+	return nil
+}
+
+func (f *fileStore) save(job *Job) error {
+	path, err := f.getPath(job.ID)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job %s: %w", job.ID, err)
+	}
+
+	// Write to a temporary file first, so a crash never leaves a partial job behind
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, content, 0o600); err != nil {
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func (f *fileStore) remove(id string) error {
+	path, err := f.getPath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove job %s: %w", id, err)
+	}
+	return nil
+}
+
+func (f *fileStore) getPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid job ID %q", id)
+	}
+	return filepath.Join(f.dir, id+jobFileExtension), nil
+}
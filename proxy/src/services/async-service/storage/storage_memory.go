@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"fmt"
+	"lunar/toolkit-core/clock"
+	"sort"
+	"sync"
+	"time"
+
+	stream_types "lunar/engine/streams/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+// jobPersistence keeps the jobs of a store beyond the lifetime of the process.
+// Jobs are saved on the transitions which outlive a restart, claims are not saved
+// since the jobs and webhooks in flight are sent again once loaded.
+type jobPersistence interface {
+	save(*Job) error
+	remove(string) error
+}
+
+type memoryStore struct {
+	mutex       sync.Mutex
+	jobs        map[string]*Job
+	clock       clock.Clock
+	retention   Retention
+	persistence jobPersistence
+}
+
+func NewMemoryStore(clock clock.Clock, retention Retention) JobStoreI {
+	return newMemoryStore(clock, retention, nil)
+}
+
+func newMemoryStore(
+	clock clock.Clock,
+	retention Retention,
+	persistence jobPersistence,
+) *memoryStore {
+	return &memoryStore{
+		jobs:        make(map[string]*Job),
+		clock:       clock,
+		retention:   retention,
+		persistence: persistence,
+	}
+}
+
+func (s *memoryStore) Add(request *stream_types.OnRequest, callbackURL string) error {
+	if request == nil || request.SequenceID == "" {
+		return fmt.Errorf("request has no sequence ID")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.jobs[request.SequenceID]; found {
+		return fmt.Errorf("request %s is already registered", request.SequenceID)
+	}
+	if s.retention.MaxJobs > 0 && len(s.jobs) >= s.retention.MaxJobs {
+		return ErrStoreFull
+	}
+
+	now := s.clock.Now()
+	job := &Job{
+		ID:        request.SequenceID,
+		State:     JobPending,
+		Request:   request,
+		CreatedAt: now,
+		DueAt:     now,
+	}
+	if callbackURL != "" {
+		job.Webhook = &Webhook{URL: callbackURL, State: WebhookPending}
+	}
+	if err := s.save(job); err != nil {
+		return err
+	}
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (*Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, found := s.jobs[id]
+	if !found {
+		return nil, ErrJobNotFound
+	}
+	return copyJob(job), nil
+}
+
+func (s *memoryStore) ClaimDue(limit int) []*Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	var dueJobs []*Job
+	for _, job := range s.jobs {
+		if job.State == JobPending && !job.DueAt.After(now) {
+			dueJobs = append(dueJobs, job)
+		}
+	}
+	sort.Slice(dueJobs, func(i, j int) bool {
+		return dueJobs[i].DueAt.Before(dueJobs[j].DueAt)
+	})
+
+	claimed := make([]*Job, 0, min(limit, len(dueJobs)))
+	for _, job := range dueJobs {
+		if len(claimed) >= limit {
+			break
+		}
+		job.State = JobProcessing
+		job.Attempts++
+		claimed = append(claimed, copyJob(job))
+	}
+	return claimed
+}
+
+func (s *memoryStore) Requeue(id string, delay time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, found := s.jobs[id]
+	if !found {
+		return ErrJobNotFound
+	}
+	job.State = JobPending
+	job.DueAt = s.clock.Now().Add(delay)
+	return nil
+}
+
+func (s *memoryStore) Complete(id string, response *stream_types.OnResponse) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, found := s.jobs[id]
+	if !found {
+		return ErrJobNotFound
+	}
+	job.State = JobCompleted
+	job.Response = response
+	job.CompletedAt = s.clock.Now()
+	if job.Webhook != nil {
+		job.Webhook.DueAt = job.CompletedAt
+	}
+	return s.save(job)
+}
+
+func (s *memoryStore) ClaimDueWebhooks(limit int) []*Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	var dueJobs []*Job
+	for _, job := range s.jobs {
+		if job.State == JobCompleted && job.Webhook != nil &&
+			job.Webhook.State == WebhookPending && !job.Webhook.DueAt.After(now) {
+			dueJobs = append(dueJobs, job)
+		}
+	}
+	sort.Slice(dueJobs, func(i, j int) bool {
+		return dueJobs[i].Webhook.DueAt.Before(dueJobs[j].Webhook.DueAt)
+	})
+
+	claimed := make([]*Job, 0, min(limit, len(dueJobs)))
+	for _, job := range dueJobs {
+		if len(claimed) >= limit {
+			break
+		}
+		job.Webhook.State = WebhookDelivering
+		job.Webhook.Attempts++
+		claimed = append(claimed, copyJob(job))
+	}
+	return claimed
+}
+
+func (s *memoryStore) RecordWebhookAttempt(id string, attempt WebhookAttempt) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, found := s.jobs[id]
+	if !found || job.Webhook == nil {
+		return ErrJobNotFound
+	}
+
+	webhook := job.Webhook
+	webhook.LastStatus = attempt.Status
+	webhook.LastError = ""
+	if attempt.Err != nil {
+		webhook.LastError = attempt.Err.Error()
+	}
+
+	switch {
+	case attempt.Succeeded():
+		webhook.State = WebhookDelivered
+	case attempt.RetryIn > 0:
+		webhook.State = WebhookPending
+		webhook.DueAt = s.clock.Now().Add(attempt.RetryIn)
+	default:
+		webhook.State = WebhookFailed
+	}
+	return s.save(job)
+}
+
+func (s *memoryStore) MarkRetrieved(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, found := s.jobs[id]
+	if !found {
+		return ErrJobNotFound
+	}
+	if job.State != JobCompleted || !job.RetrievedAt.IsZero() {
+		return nil
+	}
+	job.RetrievedAt = s.clock.Now()
+	return s.save(job)
+}
+
+func (s *memoryStore) RemoveExpired() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	removed := 0
+	for id, job := range s.jobs {
+		if !s.isExpired(job, now) {
+			continue
+		}
+		if s.persistence != nil {
+			if err := s.persistence.remove(id); err != nil {
+				log.Warn().Err(err).Msgf("Failed to remove job %s", id)
+				continue
+			}
+		}
+		delete(s.jobs, id)
+		removed++
+	}
+	return removed
+}
+
+func (s *memoryStore) isExpired(job *Job, now time.Time) bool {
+	switch job.State {
+	case JobPending:
+		return s.retention.Pending > 0 && now.Sub(job.CreatedAt) >= s.retention.Pending
+	case JobProcessing:
+		return false
+	}
+	if job.Webhook != nil &&
+		(job.Webhook.State == WebhookPending || job.Webhook.State == WebhookDelivering) {
+		return false
+	}
+	if !job.RetrievedAt.IsZero() {
+		return now.Sub(job.RetrievedAt) >= s.retention.Retrieved
+	}
+	return now.Sub(job.CompletedAt) >= s.retention.Completed
+}
+
+func copyJob(job *Job) *Job {
+	jobCopy := *job
+	if job.Webhook != nil {
+		webhookCopy := *job.Webhook
+		jobCopy.Webhook = &webhookCopy
+	}
+	return &jobCopy
+}
+
+func (s *memoryStore) save(job *Job) error {
+	if s.persistence == nil {
+		return nil
+	}
+	return s.persistence.save(job)
+}
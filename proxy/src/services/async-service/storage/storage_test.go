@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"errors"
+	"lunar/toolkit-core/clock"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	stream_types "lunar/engine/streams/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testRetention = Retention{Completed: 10 * time.Minute, Retrieved: time.Minute}
+
+func newTestRequest(seqID string) *stream_types.OnRequest {
+	return &stream_types.OnRequest{
+		ID:         seqID,
+		SequenceID: seqID,
+		Method:     "POST",
+		Path:       "/jobs",
+		Headers:    map[string]string{"X-Lunar-Sequence-Id": seqID},
+		Body:       `{"job":"` + seqID + `"}`,
+	}
+}
+
+func requireState(t *testing.T, store JobStoreI, id string, state JobState) {
+	job, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, state, job.State, id)
+}
+
+func TestJobStoreLifecycle(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	store := NewMemoryStore(mockClock, testRetention)
+
+	require.NoError(t, store.Add(newTestRequest("first"), ""))
+	mockClock.AdvanceTime(time.Second)
+	require.NoError(t, store.Add(newTestRequest("second"), ""))
+	require.Error(t, store.Add(newTestRequest("first"), ""))
+
+	// the job which is due the longest is claimed first
+	claimed := store.ClaimDue(1)
+	require.Len(t, claimed, 1)
+	require.Equal(t, "first", claimed[0].ID)
+	require.Equal(t, 1, claimed[0].Attempts)
+	requireState(t, store, "first", JobProcessing)
+
+	require.NoError(t, store.Requeue("first", time.Minute))
+	claimed = store.ClaimDue(10)
+	require.Len(t, claimed, 1)
+	require.Equal(t, "second", claimed[0].ID)
+
+	mockClock.AdvanceTime(time.Minute)
+	claimed = store.ClaimDue(10)
+	require.Len(t, claimed, 1)
+	require.Equal(t, 2, claimed[0].Attempts)
+
+	require.NoError(t, store.Complete("first", &stream_types.OnResponse{Status: 201}))
+	require.NoError(t, store.Complete("second", &stream_types.OnResponse{Status: 200}))
+	require.NoError(t, store.MarkRetrieved("first"))
+
+	// retrieved responses are removed before the responses nobody retrieved
+	mockClock.AdvanceTime(time.Minute)
+	require.Equal(t, 1, store.RemoveExpired())
+	_, err := store.Get("first")
+	require.ErrorIs(t, err, ErrJobNotFound)
+
+	mockClock.AdvanceTime(10 * time.Minute)
+	require.Equal(t, 1, store.RemoveExpired())
+	_, err = store.Get("second")
+	require.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, mockClock, testRetention)
+	require.NoError(t, err)
+
+	for _, seqID := range []string{"pending", "processing", "completed"} {
+		require.NoError(t, store.Add(newTestRequest(seqID), ""))
+		mockClock.AdvanceTime(time.Second)
+	}
+	require.Len(t, store.ClaimDue(2), 2)
+	require.NoError(t, store.Requeue("pending", 0))
+	require.NoError(t, store.Complete("completed", &stream_types.OnResponse{
+		Status: 200,
+		Body:   "done",
+	}))
+	require.Error(t, store.Add(newTestRequest("../escape"), ""))
+
+	restored, err := NewFileStore(dir, mockClock, testRetention)
+	require.NoError(t, err)
+
+	// jobs which were being dispatched are dispatched again
+	requireState(t, restored, "pending", JobPending)
+	requireState(t, restored, "processing", JobPending)
+	requireState(t, restored, "completed", JobCompleted)
+
+	job, err := restored.Get("processing")
+	require.NoError(t, err)
+	require.Equal(t, `{"job":"processing"}`, job.Request.Body)
+	job, err = restored.Get("completed")
+	require.NoError(t, err)
+	require.Equal(t, "done", job.Response.Body)
+
+	mockClock.AdvanceTime(testRetention.Completed)
+	require.Equal(t, 1, restored.RemoveExpired())
+	_, err = os.Stat(filepath.Join(dir, "completed"+jobFileExtension))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWebhookDeliveryKeepsTheJob(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	store := NewMemoryStore(mockClock, testRetention)
+	require.NoError(t, store.Add(newTestRequest("seq-1"), "http://client.example.com/hook"))
+	require.Empty(t, store.ClaimDueWebhooks(1))
+
+	require.NoError(t, store.Complete("seq-1", &stream_types.OnResponse{Status: 200}))
+	jobs := store.ClaimDueWebhooks(1)
+	require.Len(t, jobs, 1)
+	require.NoError(t, store.RecordWebhookAttempt("seq-1", WebhookAttempt{
+		Status:  500,
+		RetryIn: time.Hour,
+	}))
+
+	// jobs are kept until their webhook is delivered or runs out of attempts
+	mockClock.AdvanceTime(testRetention.Completed)
+	require.Zero(t, store.RemoveExpired())
+
+	mockClock.AdvanceTime(time.Hour)
+	require.Len(t, store.ClaimDueWebhooks(1), 1)
+	require.NoError(t, store.RecordWebhookAttempt("seq-1", WebhookAttempt{
+		Err: errors.New("connection refused"),
+	}))
+	job, err := store.Get("seq-1")
+	require.NoError(t, err)
+	require.Equal(t, WebhookFailed, job.Webhook.State)
+	require.Equal(t, "connection refused", job.Webhook.LastError)
+	require.Equal(t, 1, store.RemoveExpired())
+}
+
+func TestPendingJobsExpire(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	retention := testRetention
+	retention.Pending = time.Hour
+	store := NewMemoryStore(mockClock, retention)
+
+	require.NoError(t, store.Add(newTestRequest("pending"), ""))
+	require.NoError(t, store.Add(newTestRequest("processing"), ""))
+	require.NoError(t, store.Add(newTestRequest("requeued"), ""))
+	require.Len(t, store.ClaimDue(2), 2)
+	require.NoError(t, store.Requeue("requeued", time.Minute))
+
+	mockClock.AdvanceTime(time.Hour)
+	// jobs being dispatched are kept, requeued jobs expire since they were registered
+	require.Equal(t, 2, store.RemoveExpired())
+	requireState(t, store, "processing", JobProcessing)
+}
+
+func TestMaxJobs(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	retention := testRetention
+	retention.MaxJobs = 2
+	store := NewMemoryStore(mockClock, retention)
+
+	require.NoError(t, store.Add(newTestRequest("first"), ""))
+	require.NoError(t, store.Add(newTestRequest("second"), ""))
+	require.ErrorIs(t, store.Add(newTestRequest("third"), ""), ErrStoreFull)
+
+	// removed jobs make room for new ones
+	require.Len(t, store.ClaimDue(1), 1)
+	require.NoError(t, store.Complete("first", &stream_types.OnResponse{Status: 200}))
+	mockClock.AdvanceTime(testRetention.Completed)
+	require.Equal(t, 1, store.RemoveExpired())
+	require.NoError(t, store.Add(newTestRequest("third"), ""))
+}
+
+func TestFileStorePersistsStateTransitionsOnly(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, mockClock, testRetention)
+	require.NoError(t, err)
+	require.NoError(t, store.Add(newTestRequest("seq-1"), ""))
+
+	path := filepath.Join(dir, "seq-1"+jobFileExtension)
+	registered, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// claims are not written, in flight jobs are dispatched again once loaded
+	require.Len(t, store.ClaimDue(1), 1)
+	require.NoError(t, store.Requeue("seq-1", time.Minute))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, registered, content)
+
+	mockClock.AdvanceTime(time.Minute)
+	require.Len(t, store.ClaimDue(1), 1)
+	require.NoError(t, store.Complete("seq-1", &stream_types.OnResponse{Status: 200}))
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotEqual(t, registered, content)
+}
@@ -10,4 +10,7 @@ var (
 	HeaderLunarRequestID = http.CanonicalHeaderKey("x-lunar-sequence-id")
 	HeaderLunarScheme    = http.CanonicalHeaderKey("x-lunar-scheme")
 	HeaderAsyncRetrieve  = http.CanonicalHeaderKey("x-lunar-async-retrieve")
+	// HeaderAsyncCallbackURL is given on registration to get the response posted to a URL.
+	// Only the community edition dispatcher posts webhooks, the header is ignored otherwise.
+	HeaderAsyncCallbackURL = http.CanonicalHeaderKey("x-lunar-async-callback-url")
 )
@@ -270,6 +270,10 @@ func (hub *HubCommunication) startDiscoveryWorker() {
 					continue
 				}
 				output.CreatedAt = sharedActions.TimestampToStringFromTime(hub.nextReportTime)
+				// The history is only served by the admin API, it is not reported,
+				// and the sketches are only kept to combine the percentiles
+				output.History = nil
+				output.Sketches = nil
 				message := network.DiscoveryMessage{
 					Event: network.WebSocketEventDiscovery,
 					Data:  output,
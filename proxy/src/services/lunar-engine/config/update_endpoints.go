@@ -49,6 +49,8 @@ var (
 	haproxyBodyFormAll          string
 	haproxyReqCaptureNeededFrom string
 	haproxyReqCaptureFormAll    string
+	haproxyNetworkErrorFrom     string
+	haproxyNetworkErrorFromAll  string
 )
 
 func init() {
@@ -65,6 +67,8 @@ func init() {
 	haproxyBodyFormAll = "http://localhost:" + haproxyManagePort + "/include_body_from_all"
 	haproxyReqCaptureNeededFrom = "http://localhost:" + haproxyManagePort + "/capture_req_from"
 	haproxyReqCaptureFormAll = "http://localhost:" + haproxyManagePort + "/capture_req_all"
+	haproxyNetworkErrorFrom = "http://localhost:" + haproxyManagePort + "/network_errors_from"
+	haproxyNetworkErrorFromAll = "http://localhost:" + haproxyManagePort + "/network_errors_from_all"
 }
 
 var regexToFindPathParameters = regexp.MustCompile(`/\{[a-zA-Z0-9-_]+\}`)
@@ -75,10 +79,11 @@ type HAProxyEndpointData struct {
 }
 
 type HAProxyEndpointsRequest struct {
-	ManageAll        bool
-	BodyNeededForAll bool
-	ReqCaptureForAll bool
-	ManagedEndpoints []*HAProxyEndpointData
+	ManageAll          bool
+	BodyNeededForAll   bool
+	ReqCaptureForAll   bool
+	NetworkErrorForAll bool
+	ManagedEndpoints   []*HAProxyEndpointData
 }
 
 func BuildHAProxyEndpointsRequest(
@@ -204,6 +209,12 @@ func unmanageHAProxyEndpoints(unmanagedEndpoints []string) error {
 				unmanagedEndpoint, err)
 		}
 
+		err = operateEndpoint(unmanagedEndpoint, http.MethodDelete, haproxyNetworkErrorFrom)
+		if err != nil {
+			return fmt.Errorf("failed to stop sending network errors for endpoint '%v', error: %v",
+				unmanagedEndpoint, err)
+		}
+
 	}
 
 	log.Debug().Msg("✍️  Successfully unmanaged endpoints")
@@ -223,6 +234,12 @@ func updateHAProxyEndpoints(haproxyEndpoints *HAProxyEndpointsRequest) error {
 		}
 	}
 
+	if haproxyEndpoints.NetworkErrorForAll {
+		if err := networkErrorFromAll(); err != nil {
+			log.Warn().Err(err).Msg("Failed to send network errors of all endpoints")
+		}
+	}
+
 	if haproxyEndpoints.ManageAll {
 		if err := manageAll(); err != nil {
 			log.Warn().Err(err).Msg("Failed to manage all endpoints")
@@ -252,6 +269,14 @@ func updateHAProxyEndpoints(haproxyEndpoints *HAProxyEndpointsRequest) error {
 			}
 		}
 
+		if managedEndpoint.Requirements.IsNetworkErrorRequired {
+			err = operateEndpoint(managedEndpoint.Endpoint, http.MethodPut, haproxyNetworkErrorFrom)
+			if err != nil {
+				return fmt.Errorf("failed to send network errors of endpoint '%v', error: %v",
+					managedEndpoint, err)
+			}
+		}
+
 	}
 	return nil
 }
@@ -284,6 +309,10 @@ func reqCaptureFromAll() error {
 	return applyAllRequest(http.MethodPut, haproxyReqCaptureFormAll)
 }
 
+func networkErrorFromAll() error {
+	return applyAllRequest(http.MethodPut, haproxyNetworkErrorFromAll)
+}
+
 func manageAll() error {
 	return applyAllRequest(http.MethodPut, haproxyManageAllURL)
 }
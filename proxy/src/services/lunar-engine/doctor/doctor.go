@@ -4,6 +4,7 @@ package doctor
 
 import (
 	"lunar/engine/config"
+	"lunar/engine/metrics"
 	"lunar/engine/utils/obfuscation"
 	"lunar/toolkit-core/clock"
 	context_manager "lunar/toolkit-core/context-manager"
@@ -23,6 +24,8 @@ type Doctor struct {
 	getTxnPoliciesAccessor            func() *config.TxnPoliciesAccessor
 	getLoadedStreamsConfigF           func() *network.ConfigurationData
 	getLastSuccessfulHubCommunication TimestampAccessF
+	getQuotaOveragesF                 func() map[string]map[string]int64
+	getSLOStatusesF                   func() []metrics.SLOStatus
 	hasher                            obfuscation.MD5Hasher // TODO: move somewhere more generic
 }
 
@@ -71,6 +74,22 @@ func (dr *Doctor) WithPolicies(getTxnPoliciesAccessor func() *config.TxnPolicies
 	return dr
 }
 
+func (dr *Doctor) WithQuotaOverages(
+	getQuotaOveragesF func() map[string]map[string]int64,
+) *Doctor {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+	dr.getQuotaOveragesF = getQuotaOveragesF
+	return dr
+}
+
+func (dr *Doctor) WithSLOStatuses(getSLOStatusesF func() []metrics.SLOStatus) *Doctor {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+	dr.getSLOStatusesF = getSLOStatusesF
+	return dr
+}
+
 func (dr *Doctor) Run() Report {
 	dr.mutex.Lock()
 	defer dr.mutex.Unlock()
@@ -89,6 +108,8 @@ func (dr *Doctor) Run() Report {
 		ActivePolicies:      dr.getActivePolicies(),
 		LoadedStreamsConfig: dr.getLoadedStreamsConfig(),
 		Hub:                 getHubReport(dr.getLastSuccessfulHubCommunication),
+		Quotas:              dr.getQuotasReport(),
+		SLOs:                dr.getSLOsReport(),
 	}
 }
 
@@ -101,6 +122,20 @@ func (dr *Doctor) getClusterReport() *ClusterReport {
 	return &ClusterReport{Peers: clusterLiveness.GetPeerIDs()}
 }
 
+func (dr *Doctor) getQuotasReport() *QuotasReport {
+	if dr.getQuotaOveragesF == nil {
+		return nil
+	}
+	return &QuotasReport{Overages: dr.getQuotaOveragesF()}
+}
+
+func (dr *Doctor) getSLOsReport() []metrics.SLOStatus {
+	if dr.getSLOStatusesF == nil {
+		return nil
+	}
+	return dr.getSLOStatusesF()
+}
+
 func (dr *Doctor) getActivePolicies() *ActivePolicies {
 	if !dr.isStreamsEnabled {
 		res := getActivePolicies(dr.getTxnPoliciesAccessor, dr.logger, dr.hasher)
@@ -1,6 +1,9 @@
 package doctor
 
-import "time"
+import (
+	"lunar/engine/metrics"
+	"time"
+)
 
 type ClusterReport struct {
 	Peers []string `json:"peers"`
@@ -44,6 +47,10 @@ type HubReport struct {
 	MinutesSinceLastSuccessfulCommunication *float64   `json:"minutes_since_last_successful_communication"` //nolint:lll
 }
 
+type QuotasReport struct {
+	Overages map[string]map[string]int64 `json:"overages"` // quota ID -> group -> overage
+}
+
 type Report struct {
 	RunAt               time.Time            `json:"run_at"`
 	Env                 map[string]*string   `json:"env"`
@@ -53,4 +60,6 @@ type Report struct {
 	ActivePolicies      *ActivePolicies      `json:"active_policies,omitempty"`
 	LoadedStreamsConfig *LoadedStreamsConfig `json:"loaded_streams_config,omitempty"`
 	Hub                 HubReport            `json:"hub"`
+	Quotas              *QuotasReport        `json:"quotas,omitempty"`
+	SLOs                []metrics.SLOStatus  `json:"slos,omitempty"`
 }
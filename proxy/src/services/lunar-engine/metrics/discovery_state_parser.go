@@ -77,6 +77,7 @@ func (d *discoveryStateParser) ReadAndParseDiscovery() (*parsingResult, error) {
 		return nil, fmt.Errorf("failed to unmarshal JSON data: %w", err)
 	}
 
+	discoveryOutput.LoadSketches()
 	parsedEndpointData := sharedDiscovery.ConvertEndpointsFromPersisted(discoveryOutput.Endpoints)
 	parsedConsumerData := sharedDiscovery.ConvertConsumersFromPersisted(discoveryOutput.Consumers)
 
@@ -1,8 +1,10 @@
 package metrics
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"lunar/engine/utils/environment"
 	"lunar/toolkit-core/otel"
 	"sync"
 
@@ -23,6 +25,7 @@ type MetricManager struct {
 	labelManager              *LabelManager
 	apiCallMetricMng          *apiCallCountMetricManager
 	transactionMetricsManager *transactionMetricsManager
+	sloTracker                *sloTracker
 	providerData              *metricsProviderData
 
 	metricManagerActive bool
@@ -60,6 +63,10 @@ func NewMetricManager() (*MetricManager, error) {
 		return mng, fmt.Errorf("failed to initialize transaction metrics: %w", err)
 	}
 
+	mng.sloTracker = newSLOTracker(config.SLOs)
+	mng.sloTracker.start(environment.GetAccessLogMetricsCollectTimeInterval())
+	activeSLOTracker.Store(mng.sloTracker)
+
 	// general metrics
 	if err := mng.initializeGeneralMetrics(); err != nil {
 		return mng, fmt.Errorf("failed to initialize general metrics: %w", err)
@@ -110,6 +117,11 @@ func (m *MetricManager) ReloadMetricsConfig() error {
 		}
 	}
 
+	if !config.EqualSLOs(*m.config) && m.sloTracker != nil {
+		log.Info().Msg("Reloading SLOs")
+		m.sloTracker.setSLOs(config.SLOs)
+	}
+
 	if !config.EqualSystemMetrics(*m.config) {
 		log.Info().Msg("Reloading system metrics")
 		if err = m.initializeSystemMetrics(); err != nil {
@@ -145,6 +157,23 @@ func (m *MetricManager) UpdateMetricsForFlow(provider FlowMetricsProviderI) {
 	m.providerData.UpdateFlowData(provider)
 }
 
+// GetSLOStatuses returns the error budget and burn rates of the configured SLOs
+func (m *MetricManager) GetSLOStatuses() []SLOStatus {
+	if m == nil || m.sloTracker == nil {
+		return nil
+	}
+	return m.sloTracker.getStatuses()
+}
+
+// Stop stops collecting the calls of the SLOs, their burn rates are no longer served
+func (m *MetricManager) Stop() {
+	if m == nil || m.sloTracker == nil {
+		return
+	}
+	m.sloTracker.stop()
+	activeSLOTracker.CompareAndSwap(m.sloTracker, nil)
+}
+
 // initializeMetrics initializes the metrics by parsing
 func (m *MetricManager) initializeMetrics(metrics []MetricValue) ([]metric.Observable, error) {
 	log.Info().Msgf("Initializing metrics: %+v", metrics)
@@ -225,6 +254,10 @@ func (m *MetricManager) observeSystemMetrics(_ context.Context, observer metric.
 		}
 	}
 
+	m.observeQuotaMetrics(data.GetQuotaGroupsData(), observer)
+	m.observeQueueMetrics(data.GetQueuesData(), observer)
+	m.observeSLOMetrics(observer)
+
 	procExecutionData := data.GetProcessorExecutionData()
 	for processorKey, procData := range procExecutionData.ProcExecutionData {
 		for _, executionData := range procData.Executions {
@@ -250,6 +283,104 @@ func (m *MetricManager) observeSystemMetrics(_ context.Context, observer metric.
 	return nil
 }
 
+// observeQuotaMetrics observes the state of each quota group.
+// Groups are often per consumer, so only the groups using the most of each quota are
+// observed, up to LUNAR_QUOTA_METRICS_MAX_GROUPS.
+func (m *MetricManager) observeQuotaMetrics(data *MetricData, observer metric.Observer) {
+	quotaGroups := limitQuotaGroups(data.QuotaGroups, environment.GetQuotaMetricsMaxGroups())
+	for _, quotaGroup := range quotaGroups {
+		attributes := []attribute.KeyValue{
+			attribute.String(QuotaID, quotaGroup.QuotaID),
+			attribute.String(GroupID, quotaGroup.GroupID),
+		}
+		values := map[Metric]float64{
+			QuotaUsedMetric:             float64(quotaGroup.Used),
+			QuotaLimitMetric:            float64(quotaGroup.Limit),
+			QuotaRemainingMetric:        float64(quotaGroup.GetRemaining()),
+			QuotaResetInMetric:          quotaGroup.ResetIn.Seconds(),
+			QuotaSpilloverBalanceMetric: float64(quotaGroup.SpilloverBalance),
+		}
+		for metricName, value := range values {
+			if err := observeMetric(m, metricName, value, observer, attributes...); err != nil {
+				log.Trace().Err(err).Msgf("Failed to observe %v, quota %s",
+					metricName, quotaGroup.QuotaID)
+			}
+		}
+	}
+}
+
+// observeQueueMetrics observes the state of each queue
+func (m *MetricManager) observeQueueMetrics(data *MetricData, observer metric.Observer) {
+	for _, queue := range data.Queues {
+		attributes := []attribute.KeyValue{
+			attribute.String(ProcessorKey, queue.ProcessorKey),
+			attribute.String(QueueGroup, queue.Group),
+		}
+		values := map[Metric]float64{
+			QueueSizeMetric:          float64(queue.Size),
+			QueueOldestItemAgeMetric: queue.OldestItemAge.Seconds(),
+			QueueDroppedOnTTLMetric:  float64(queue.DroppedOnTTL),
+		}
+		for metricName, value := range values {
+			if err := observeMetric(m, metricName, value, observer, attributes...); err != nil {
+				log.Trace().Err(err).Msgf("Failed to observe %v, processor %s",
+					metricName, queue.ProcessorKey)
+			}
+		}
+	}
+}
+
+// observeSLOMetrics observes the error budget and burn rates of each SLO objective
+func (m *MetricManager) observeSLOMetrics(observer metric.Observer) {
+	for _, status := range m.GetSLOStatuses() {
+		attributes := []attribute.KeyValue{
+			attribute.String(SLOName, status.Name),
+			attribute.String(Objective, string(status.Objective)),
+		}
+		if err := observeMetric(m, SLOErrorBudgetConsumedMetric, status.ErrorBudgetConsumed,
+			observer, attributes...); err != nil {
+			log.Trace().Err(err).Msgf("Failed to observe %v, SLO %s",
+				SLOErrorBudgetConsumedMetric, status.Name)
+		}
+
+		for _, burnRate := range status.BurnRates {
+			windowAttributes := append(slices.Clone(attributes),
+				attribute.Int64(SLOWindow, burnRate.WindowSeconds))
+			if err := observeMetric(m, SLOBurnRateMetric, burnRate.BurnRate,
+				observer, windowAttributes...); err != nil {
+				log.Trace().Err(err).Msgf("Failed to observe %v, SLO %s",
+					SLOBurnRateMetric, status.Name)
+			}
+		}
+	}
+}
+
+// limitQuotaGroups keeps the given number of groups per quota, by the quota they used
+func limitQuotaGroups(quotaGroups []*QuotaGroupData, maxGroups int) []*QuotaGroupData {
+	sorted := slices.Clone(quotaGroups)
+	slices.SortFunc(sorted, func(a, b *QuotaGroupData) int {
+		if a.Used != b.Used {
+			return cmp.Compare(b.Used, a.Used)
+		}
+		return cmp.Compare(a.GroupID, b.GroupID)
+	})
+
+	limited := make([]*QuotaGroupData, 0, len(sorted))
+	groupsPerQuota := make(map[string]int)
+	for _, quotaGroup := range sorted {
+		if groupsPerQuota[quotaGroup.QuotaID] >= maxGroups {
+			continue
+		}
+		groupsPerQuota[quotaGroup.QuotaID]++
+		limited = append(limited, quotaGroup)
+	}
+	if skipped := len(sorted) - len(limited); skipped > 0 {
+		log.Trace().Msgf("Skipped observing %d quota groups above the limit of %d per quota",
+			skipped, maxGroups)
+	}
+	return limited
+}
+
 func observeMetric[T int | int64 | float64](
 	mng *MetricManager,
 	metricName Metric,
@@ -1,14 +1,18 @@
 package metrics
 
 import (
+	"context"
 	publictypes "lunar/engine/streams/public-types"
 	"lunar/engine/utils/environment"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/metric"
+	sdkMetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
 
 func TestNewMetricManager(t *testing.T) {
@@ -222,3 +226,126 @@ func (m *MockAPICallMetricsProviderI) GetBody() string {
 	args := m.Called()
 	return args.String(0)
 }
+
+type testFlowMetricsProvider struct {
+	data *MetricData
+}
+
+func (p *testFlowMetricsProvider) GetActiveFlows() *MetricData            { return p.data }
+func (p *testFlowMetricsProvider) GetFlowInvocations() *MetricData        { return p.data }
+func (p *testFlowMetricsProvider) GetRequestsThroughFlows() *MetricData   { return p.data }
+func (p *testFlowMetricsProvider) GetAvgFlowExecutionTime() *MetricData   { return p.data }
+func (p *testFlowMetricsProvider) GetProcessorExecutionData() *MetricData { return p.data }
+func (p *testFlowMetricsProvider) GetQuotaGroupsData() *MetricData        { return p.data }
+func (p *testFlowMetricsProvider) GetQueuesData() *MetricData             { return p.data }
+
+func TestMetricManagerObservesConfiguredQuotaAndQueueMetrics(t *testing.T) {
+	reader := sdkMetric.NewManualReader()
+	mng := &MetricManager{
+		config: &Config{SystemMetrics: []MetricValue{
+			{Name: QuotaRemainingMetric},
+			{Name: QuotaResetInMetric},
+			{Name: QueueDroppedOnTTLMetric},
+		}},
+		meter:         sdkMetric.NewMeterProvider(sdkMetric.WithReader(reader)).Meter("test"),
+		metricObjects: make(map[Metric]interface{}),
+		providerData:  newMetricsProviderData(),
+	}
+	mng.providerData.UpdateFlowData(&testFlowMetricsProvider{data: &MetricData{
+		RequestsThroughFlows: NewFlowsLabelsData(),
+		QuotaGroups: []*QuotaGroupData{
+			{QuotaID: "quota-1", GroupID: "acme", Used: 12, Limit: 10, ResetIn: 30 * time.Second},
+		},
+		Queues: []*QueueData{{ProcessorKey: "queue-1", Group: "default", DroppedOnTTL: 4}},
+	}})
+	require.NoError(t, mng.initializeSystemMetrics())
+
+	var collected metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &collected))
+	require.Len(t, collected.ScopeMetrics, 1)
+
+	values := map[string]float64{}
+	for _, collectedMetric := range collected.ScopeMetrics[0].Metrics {
+		switch data := collectedMetric.Data.(type) {
+		case metricdata.Gauge[int64]:
+			values[collectedMetric.Name] = float64(data.DataPoints[0].Value)
+		case metricdata.Gauge[float64]:
+			values[collectedMetric.Name] = data.DataPoints[0].Value
+		case metricdata.Sum[int64]:
+			values[collectedMetric.Name] = float64(data.DataPoints[0].Value)
+		}
+	}
+	// Metrics which are not configured are not observed
+	require.Equal(t, map[string]float64{
+		string(QuotaRemainingMetric):    0,
+		string(QuotaResetInMetric):      30,
+		string(QueueDroppedOnTTLMetric): 4,
+	}, values)
+}
+
+func TestMetricManagerObservesSLOMetrics(t *testing.T) {
+	reader := sdkMetric.NewManualReader()
+	mng := &MetricManager{
+		config: &Config{SystemMetrics: []MetricValue{
+			{Name: SLOErrorBudgetConsumedMetric},
+			{Name: SLOBurnRateMetric},
+		}},
+		meter:         sdkMetric.NewMeterProvider(sdkMetric.WithReader(reader)).Meter("test"),
+		metricObjects: make(map[Metric]interface{}),
+		providerData:  newMetricsProviderData(),
+		sloTracker: newSLOTracker([]SLOConfig{{
+			Name:                   "charges",
+			Endpoint:               chargesEndpoint.URL,
+			Availability:           99,
+			BurnRateWindowsSeconds: []int64{300, 3600},
+		}}),
+	}
+	mng.providerData.UpdateFlowData(&testFlowMetricsProvider{data: &MetricData{
+		RequestsThroughFlows: NewFlowsLabelsData(),
+	}})
+	start := time.Now()
+	mng.sloTracker.update(start, chargesCalls(0, 0))
+	mng.sloTracker.update(start.Add(time.Minute), chargesCalls(95, 5))
+	require.NoError(t, mng.initializeSystemMetrics())
+
+	var collected metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &collected))
+	require.Len(t, collected.ScopeMetrics, 1)
+
+	values := map[string]float64{}
+	for _, collectedMetric := range collected.ScopeMetrics[0].Metrics {
+		gauge, ok := collectedMetric.Data.(metricdata.Gauge[float64])
+		require.True(t, ok)
+		for _, dataPoint := range gauge.DataPoints {
+			objective, _ := dataPoint.Attributes.Value(Objective)
+			require.Equal(t, string(SLOAvailability), objective.AsString())
+			name := collectedMetric.Name
+			if window, found := dataPoint.Attributes.Value(SLOWindow); found {
+				name += "/" + window.Emit()
+			}
+			values[name] = dataPoint.Value
+		}
+	}
+	require.Len(t, values, 3)
+	for _, name := range []string{
+		string(SLOBurnRateMetric) + "/300",
+		string(SLOBurnRateMetric) + "/3600",
+	} {
+		require.Contains(t, values, name)
+		require.InDelta(t, 5, values[name], 0.001)
+	}
+	// a minute of the 30 days period burnt at 5 times the rate of the budget
+	require.InDelta(t, 5.0/(30*24*60), values[string(SLOErrorBudgetConsumedMetric)], 0.000001)
+}
+
+func TestLimitQuotaGroupsKeepsTheMostUsedGroupsPerQuota(t *testing.T) {
+	quotaGroups := []*QuotaGroupData{
+		{QuotaID: "quota-1", GroupID: "acme", Used: 2},
+		{QuotaID: "quota-1", GroupID: "globex", Used: 9},
+		{QuotaID: "quota-1", GroupID: "initech", Used: 5},
+		{QuotaID: "quota-2", GroupID: "acme", Used: 1},
+	}
+
+	limited := limitQuotaGroups(quotaGroups, 2)
+	require.Equal(t, []*QuotaGroupData{quotaGroups[1], quotaGroups[2], quotaGroups[3]}, limited)
+}
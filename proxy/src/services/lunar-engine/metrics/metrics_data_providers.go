@@ -3,6 +3,7 @@ package metrics
 import (
 	publictypes "lunar/engine/streams/public-types"
 	"sync"
+	"time"
 )
 
 type APICallMetricsProviderI interface {
@@ -45,12 +46,36 @@ type ProcData struct {
 	Executions       []*ProcExecution
 }
 
+type QuotaGroupData struct {
+	QuotaID          string
+	GroupID          string
+	Used             int64
+	Limit            int64
+	ResetIn          time.Duration
+	SpilloverBalance int64
+}
+
+// GetRemaining returns the quota left in the group, zero once the limit is exceeded
+func (q *QuotaGroupData) GetRemaining() int64 {
+	return max(q.Limit-q.Used, 0)
+}
+
+type QueueData struct {
+	ProcessorKey  string
+	Group         string
+	Size          int64
+	OldestItemAge time.Duration
+	DroppedOnTTL  int64
+}
+
 type MetricData struct {
 	ActiveFlows          []string
 	FlowInvocations      map[string]*LabelsExecutionData // key - flow ID
 	AvgFlowExecutionTime map[string]float64              // key - flow ID
 	ProcExecutionData    map[string]*ProcData            // key - processor key
 	RequestsThroughFlows *LabelsExecutionData
+	QuotaGroups          []*QuotaGroupData
+	Queues               []*QueueData
 }
 
 type FlowMetricsProviderI interface {
@@ -59,6 +84,8 @@ type FlowMetricsProviderI interface {
 	GetRequestsThroughFlows() *MetricData
 	GetAvgFlowExecutionTime() *MetricData
 	GetProcessorExecutionData() *MetricData
+	GetQuotaGroupsData() *MetricData
+	GetQueuesData() *MetricData
 }
 
 type metricsProviderData struct {
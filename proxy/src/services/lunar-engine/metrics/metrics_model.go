@@ -16,4 +16,28 @@ type Config struct {
 	GeneralMetrics   GeneralMetrics `yaml:"general_metrics"`
 	SystemMetrics    []MetricValue  `yaml:"system_metrics"`
 	LabeledEndpoints []string       `yaml:"labeled_endpoints"`
+	SLOs             []SLOConfig    `yaml:"slos,omitempty"`
+}
+
+// LatencyObjective expects the given percentage of the calls to be faster than the threshold
+type LatencyObjective struct {
+	ThresholdMs float64 `yaml:"threshold_ms"`
+	Percentage  float64 `yaml:"percentage"`
+}
+
+// SLOConfig declares the objectives of a provider endpoint
+type SLOConfig struct {
+	Name string `yaml:"name"`
+	// Endpoint is the host and path of the endpoint, path params are set as "{param}"
+	Endpoint string `yaml:"endpoint"`
+	// Method narrows the SLO to a single method, all methods are included when not set
+	Method string `yaml:"method,omitempty"`
+	// Availability is the percentage of the calls expected not to fail with a 5xx status code
+	Availability float64           `yaml:"availability,omitempty"`
+	Latency      *LatencyObjective `yaml:"latency,omitempty"`
+	// PeriodSeconds is the period of the error budget, 30 days when not set
+	PeriodSeconds int64 `yaml:"period_seconds,omitempty"`
+	// BurnRateWindowsSeconds are the windows the burn rates are reported for,
+	// 5 minutes, 1 hour and 6 hours when not set
+	BurnRateWindowsSeconds []int64 `yaml:"burn_rate_windows_seconds,omitempty"`
 }
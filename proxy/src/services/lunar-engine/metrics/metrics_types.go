@@ -30,6 +30,12 @@ const (
 	StatusCode   = "status_code"
 	ConsumerTag  = "consumer_tag"
 	Success      = "success"
+	QuotaID      = "quota_id"
+	GroupID      = "group_id"
+	QueueGroup   = "group"
+	SLOName      = "slo"
+	Objective    = "objective"
+	SLOWindow    = "window_seconds"
 
 	APICallCountMetric              Metric = "api_call_count"
 	APICallSizeMetric               Metric = "api_call_size"
@@ -41,6 +47,16 @@ const (
 	AvgFlowExecutionTimeMetric      Metric = "avg_flow_execution_time"
 	AvgProcessorExecutionTimeMetric Metric = "avg_processor_execution_time"
 	ProcessorInvocation             Metric = "processor_invocation"
+	QuotaUsedMetric                 Metric = "quota_used"
+	QuotaLimitMetric                Metric = "quota_limit"
+	QuotaRemainingMetric            Metric = "quota_remaining"
+	QuotaResetInMetric              Metric = "quota_reset_in_seconds"
+	QuotaSpilloverBalanceMetric     Metric = "quota_spillover_balance"
+	QueueSizeMetric                 Metric = "queue_size"
+	QueueOldestItemAgeMetric        Metric = "queue_oldest_item_age_seconds"
+	QueueDroppedOnTTLMetric         Metric = "queue_dropped_on_ttl"
+	SLOErrorBudgetConsumedMetric    Metric = "slo_error_budget_consumed"
+	SLOBurnRateMetric               Metric = "slo_burn_rate"
 
 	CustomMetric Metric = "custom"
 
@@ -60,6 +76,16 @@ var labelsToInclude = []string{
 	"avg_flow_execution_time",
 	"avg_processor_execution_time",
 	"processor_invocation",
+	"quota_used",
+	"quota_limit",
+	"quota_remaining",
+	"quota_reset_in_seconds",
+	"quota_spillover_balance",
+	"queue_size",
+	"queue_oldest_item_age_seconds",
+	"queue_dropped_on_ttl",
+	"slo_error_budget_consumed",
+	"slo_burn_rate",
 }
 
 // metrics that based on access logs and handled by their own managers that parse discover file
@@ -78,6 +104,16 @@ var metricsObservableRegistry = map[Metric]MetricType{
 	AvgFlowExecutionTimeMetric:      Float64ObservableGauge,
 	AvgProcessorExecutionTimeMetric: Float64ObservableGauge,
 	ProcessorInvocation:             Int64ObservableCounter,
+	QuotaUsedMetric:                 Int64ObservableGauge,
+	QuotaLimitMetric:                Int64ObservableGauge,
+	QuotaRemainingMetric:            Int64ObservableGauge,
+	QuotaResetInMetric:              Float64ObservableGauge,
+	QuotaSpilloverBalanceMetric:     Int64ObservableGauge,
+	QueueSizeMetric:                 Int64ObservableGauge,
+	QueueOldestItemAgeMetric:        Float64ObservableGauge,
+	QueueDroppedOnTTLMetric:         Int64ObservableCounter,
+	SLOErrorBudgetConsumedMetric:    Float64ObservableGauge,
+	SLOBurnRateMetric:               Float64ObservableGauge,
 }
 
 func NewRequestLabelSet(apiStream public_types.APIStreamI) *LabelSet {
@@ -10,6 +10,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/exp/slices"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
@@ -82,6 +83,34 @@ func (c Config) EqualLabeledEndpoints(other *Config) bool {
 	return true
 }
 
+// EqualSLOs compares only the SLOs slice in Config.
+func (c Config) EqualSLOs(other Config) bool {
+	if len(c.SLOs) != len(other.SLOs) {
+		return false
+	}
+	for i := range c.SLOs {
+		if !c.SLOs[i].Equal(other.SLOs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal compares two SLOConfig structs.
+func (s SLOConfig) Equal(other SLOConfig) bool {
+	if s.Name != other.Name || s.Endpoint != other.Endpoint || s.Method != other.Method ||
+		s.Availability != other.Availability || s.PeriodSeconds != other.PeriodSeconds {
+		return false
+	}
+
+	if (s.Latency == nil) != (other.Latency == nil) ||
+		(s.Latency != nil && *s.Latency != *other.Latency) {
+		return false
+	}
+
+	return slices.Equal(s.BurnRateWindowsSeconds, other.BurnRateWindowsSeconds)
+}
+
 // registerObservableMetric registers an observable metric with the given meter
 func registerObservableMetric(
 	meter metric.Meter,
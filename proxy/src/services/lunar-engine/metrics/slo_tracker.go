@@ -0,0 +1,422 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sharedDiscovery "lunar/shared-model/discovery"
+
+	"github.com/rs/zerolog/log"
+)
+
+type SLOObjective string
+
+const (
+	SLOAvailability SLOObjective = "availability"
+	SLOLatency      SLOObjective = "latency"
+
+	defaultSLOPeriod = 30 * 24 * time.Hour
+	// sloSnapshotsPerWindow is the number of snapshots kept along the shortest burn rate window,
+	// the snapshots in between are overwritten by the latest one
+	sloSnapshotsPerWindow = 10
+)
+
+var (
+	defaultBurnRateWindows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour}
+
+	// activeSLOTracker is the tracker of the metric manager, queried by the flow filters
+	activeSLOTracker atomic.Pointer[sloTracker]
+)
+
+type SLOBurnRate struct {
+	WindowSeconds int64   `json:"window_seconds"`
+	BurnRate      float64 `json:"burn_rate"`
+}
+
+// SLOStatus is the state of an objective of an SLO, the calls are counted since the start
+// of its period or since the engine started, whichever is later
+type SLOStatus struct {
+	Name      string       `json:"name"`
+	Objective SLOObjective `json:"objective"`
+	Endpoint  string       `json:"endpoint"`
+	Method    string       `json:"method,omitempty"`
+	// Target is the percentage of the calls expected to be good
+	Target        float64 `json:"target"`
+	PeriodSeconds int64   `json:"period_seconds"`
+	Calls         int64   `json:"calls"`
+	BadCalls      int64   `json:"bad_calls"`
+	// ErrorBudgetConsumed is the share of the error budget of the period used so far,
+	// 1 once the budget is exhausted
+	ErrorBudgetConsumed float64       `json:"error_budget_consumed"`
+	BurnRates           []SLOBurnRate `json:"burn_rates"`
+}
+
+// sloCounters are the cumulative calls to the endpoints of an objective at a point in time
+type sloCounters struct {
+	at    time.Time
+	calls int64
+	bad   int64
+}
+
+type sloObjectiveTracker struct {
+	slo       SLOConfig
+	objective SLOObjective
+	// target is the fraction of the calls expected to be good
+	target          float64
+	endpointPattern *regexp.Regexp
+	period          time.Duration
+	windows         []time.Duration
+	snapshotSpacing time.Duration
+	// snapshots are sorted by time, the last one is always the latest
+	snapshots []sloCounters
+}
+
+// sloTracker computes the error budget and burn rates of the configured SLOs
+// from the calls counted in the discovery state
+type sloTracker struct {
+	mu              sync.RWMutex
+	objectives      []*sloObjectiveTracker
+	discoveryParser *discoveryStateParser
+	ticker          *time.Ticker
+	done            chan struct{}
+}
+
+func newSLOTracker(slos []SLOConfig) *sloTracker {
+	tracker := &sloTracker{}
+	tracker.setSLOs(slos)
+	return tracker
+}
+
+// GetSLOBurnRate returns the highest burn rate of the objectives of an SLO over the window,
+// a non empty objective narrows it to that objective
+func GetSLOBurnRate(
+	sloName string,
+	objective SLOObjective,
+	window time.Duration,
+) (float64, bool) {
+	tracker := activeSLOTracker.Load()
+	if tracker == nil {
+		return 0, false
+	}
+	return tracker.getBurnRate(sloName, objective, window)
+}
+
+// start collects the calls of the SLOs every interval, until the tracker is stopped
+func (t *sloTracker) start(interval time.Duration) {
+	t.ticker = time.NewTicker(interval)
+	t.done = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-t.ticker.C:
+				t.collect()
+			case <-t.done:
+				return
+			}
+		}
+	}()
+}
+
+func (t *sloTracker) stop() {
+	if t.ticker == nil {
+		return
+	}
+	t.ticker.Stop()
+	close(t.done)
+	t.ticker = nil
+}
+
+// setSLOs replaces the tracked SLOs, the calls of the unchanged ones are kept
+func (t *sloTracker) setSLOs(slos []SLOConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous := make(map[string]*sloObjectiveTracker, len(t.objectives))
+	for _, objective := range t.objectives {
+		previous[objective.key()] = objective
+	}
+
+	t.objectives = nil
+	for _, slo := range slos {
+		objectives, err := newSLOObjectiveTrackers(slo)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Skipping invalid SLO %s", slo.Name)
+			continue
+		}
+		for _, objective := range objectives {
+			if existing, found := previous[objective.key()]; found && existing.slo.Equal(slo) {
+				objective = existing
+			}
+			t.objectives = append(t.objectives, objective)
+		}
+	}
+	log.Info().Msgf("Tracking %d SLO objectives", len(t.objectives))
+}
+
+func (t *sloTracker) collect() {
+	t.mu.RLock()
+	hasObjectives := len(t.objectives) > 0
+	t.mu.RUnlock()
+	if !hasObjectives {
+		return
+	}
+
+	if t.discoveryParser == nil {
+		parser, err := newDiscoveryStateParser()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to initialize discovery state parser for SLOs")
+			return
+		}
+		t.discoveryParser = parser
+	}
+
+	data, err := t.discoveryParser.ReadAndParseDiscovery()
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to read discovery state for SLOs")
+		return
+	}
+	t.update(time.Now(), data.NewEndpointData)
+}
+
+// update records the cumulative calls of each objective at the given time
+func (t *sloTracker) update(
+	now time.Time,
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg,
+) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, objective := range t.objectives {
+		calls, bad := objective.count(endpoints)
+		objective.record(sloCounters{at: now, calls: calls, bad: bad})
+	}
+}
+
+func (t *sloTracker) getBurnRate(
+	sloName string,
+	objective SLOObjective,
+	window time.Duration,
+) (float64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var (
+		burnRate float64
+		found    bool
+	)
+	for _, tracked := range t.objectives {
+		if tracked.slo.Name != sloName || (objective != "" && tracked.objective != objective) {
+			continue
+		}
+		burnRate = max(burnRate, tracked.burnRate(window))
+		found = true
+	}
+	return burnRate, found
+}
+
+func (t *sloTracker) getStatuses() []SLOStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	statuses := make([]SLOStatus, 0, len(t.objectives))
+	for _, objective := range t.objectives {
+		statuses = append(statuses, objective.status())
+	}
+	return statuses
+}
+
+func newSLOObjectiveTrackers(slo SLOConfig) ([]*sloObjectiveTracker, error) {
+	if slo.Name == "" || slo.Endpoint == "" {
+		return nil, errors.New("name and endpoint are required")
+	}
+	if slo.Availability == 0 && slo.Latency == nil {
+		return nil, errors.New("availability or latency objective is required")
+	}
+	if slo.PeriodSeconds < 0 {
+		return nil, fmt.Errorf("invalid period %d", slo.PeriodSeconds)
+	}
+
+	period := defaultSLOPeriod
+	if slo.PeriodSeconds > 0 {
+		period = time.Duration(slo.PeriodSeconds) * time.Second
+	}
+	windows := defaultBurnRateWindows
+	if len(slo.BurnRateWindowsSeconds) > 0 {
+		windows = nil
+		for _, windowSeconds := range slo.BurnRateWindowsSeconds {
+			if windowSeconds <= 0 {
+				return nil, fmt.Errorf("invalid burn rate window %d", windowSeconds)
+			}
+			windows = append(windows, time.Duration(windowSeconds)*time.Second)
+		}
+	}
+	spacing := period
+	for _, window := range windows {
+		spacing = min(spacing, window)
+	}
+
+	targets := map[SLOObjective]float64{}
+	if slo.Availability != 0 {
+		targets[SLOAvailability] = slo.Availability
+	}
+	if slo.Latency != nil {
+		if slo.Latency.ThresholdMs <= 0 {
+			return nil, fmt.Errorf("invalid latency threshold %v", slo.Latency.ThresholdMs)
+		}
+		targets[SLOLatency] = slo.Latency.Percentage
+	}
+
+	var objectives []*sloObjectiveTracker
+	for _, objective := range []SLOObjective{SLOAvailability, SLOLatency} {
+		target, found := targets[objective]
+		if !found {
+			continue
+		}
+		if target <= 0 || target >= 100 {
+			return nil, fmt.Errorf("%s target must be between 0 and 100, got %v", objective, target)
+		}
+		objectives = append(objectives, &sloObjectiveTracker{
+			slo:             slo,
+			objective:       objective,
+			target:          target / 100,
+			endpointPattern: regexp.MustCompile(convertPatternToRegex(slo.Endpoint)),
+			period:          period,
+			windows:         windows,
+			snapshotSpacing: spacing / sloSnapshotsPerWindow,
+		})
+	}
+	return objectives, nil
+}
+
+func (o *sloObjectiveTracker) key() string {
+	return o.slo.Name + "/" + string(o.objective)
+}
+
+// count sums the cumulative calls to the endpoints of the objective and the bad ones among them
+func (o *sloObjectiveTracker) count(
+	endpoints map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg,
+) (calls int64, bad int64) {
+	for endpoint, agg := range endpoints {
+		if o.slo.Method != "" && !strings.EqualFold(o.slo.Method, endpoint.Method) {
+			continue
+		}
+		if !o.endpointPattern.MatchString(endpoint.URL) {
+			continue
+		}
+
+		switch o.objective {
+		case SLOAvailability:
+			for statusCode, count := range agg.StatusCodes {
+				calls += int64(count)
+				if statusCode >= 500 {
+					bad += int64(count)
+				}
+			}
+		case SLOLatency:
+			calls += int64(agg.DurationSketch.Count())
+			bad += int64(agg.DurationSketch.CountAbove(o.slo.Latency.ThresholdMs))
+		}
+	}
+	return calls, bad
+}
+
+// record appends the snapshot, overwriting the latest one while it is closer than the spacing
+// to the one before it, and drops the snapshots which left both the period and the windows
+func (o *sloObjectiveTracker) record(snapshot sloCounters) {
+	count := len(o.snapshots)
+	if count > 0 && (snapshot.calls < o.snapshots[count-1].calls ||
+		snapshot.bad < o.snapshots[count-1].bad) {
+		// The counters were reset, e.g. as the discovery state was cleared
+		o.snapshots = nil
+		count = 0
+	}
+
+	if count >= 2 && snapshot.at.Sub(o.snapshots[count-2].at) < o.snapshotSpacing {
+		o.snapshots[count-1] = snapshot
+	} else {
+		o.snapshots = append(o.snapshots, snapshot)
+	}
+
+	retention := o.period
+	for _, window := range o.windows {
+		retention = max(retention, window)
+	}
+	if first := o.baseIndex(retention); first > 0 {
+		o.snapshots = append([]sloCounters(nil), o.snapshots[first:]...)
+	}
+}
+
+// baseIndex returns the index of the latest snapshot taken at least the window before
+// the latest one, the oldest snapshot when the window goes beyond it
+func (o *sloObjectiveTracker) baseIndex(window time.Duration) int {
+	if len(o.snapshots) == 0 {
+		return 0
+	}
+	cutoff := o.snapshots[len(o.snapshots)-1].at.Add(-window)
+	index := sort.Search(len(o.snapshots), func(i int) bool {
+		return o.snapshots[i].at.After(cutoff)
+	})
+	return max(index-1, 0)
+}
+
+// within returns the calls and the bad calls during the window before the latest snapshot
+func (o *sloObjectiveTracker) within(window time.Duration) (calls int64, bad int64) {
+	if len(o.snapshots) == 0 {
+		return 0, 0
+	}
+	latest := o.snapshots[len(o.snapshots)-1]
+	base := o.snapshots[o.baseIndex(window)]
+	return latest.calls - base.calls, latest.bad - base.bad
+}
+
+// burnRate is the rate the error budget is used at during the window,
+// a burn rate of 1 uses exactly the whole budget along the period
+func (o *sloObjectiveTracker) burnRate(window time.Duration) float64 {
+	calls, bad := o.within(window)
+	if calls == 0 {
+		return 0
+	}
+	return float64(bad) / float64(calls) / (1 - o.target)
+}
+
+// errorBudgetConsumed is the share of the bad calls the target allows along the whole period
+// which were already made. The calls of the period are expected at the rate counted so far,
+// so burning at a rate of 2 exhausts the budget halfway through the period.
+func (o *sloObjectiveTracker) errorBudgetConsumed() float64 {
+	if len(o.snapshots) == 0 {
+		return 0
+	}
+	latest := o.snapshots[len(o.snapshots)-1]
+	base := o.snapshots[o.baseIndex(o.period)]
+	elapsed := min(latest.at.Sub(base.at), o.period)
+	consumed := o.burnRate(o.period) * elapsed.Seconds() / o.period.Seconds()
+	return min(max(consumed, 0), 1)
+}
+
+func (o *sloObjectiveTracker) status() SLOStatus {
+	calls, bad := o.within(o.period)
+	status := SLOStatus{
+		Name:                o.slo.Name,
+		Objective:           o.objective,
+		Endpoint:            o.slo.Endpoint,
+		Method:              o.slo.Method,
+		Target:              o.target * 100,
+		PeriodSeconds:       int64(o.period.Seconds()),
+		Calls:               calls,
+		BadCalls:            bad,
+		ErrorBudgetConsumed: o.errorBudgetConsumed(),
+	}
+	for _, window := range o.windows {
+		status.BurnRates = append(status.BurnRates, SLOBurnRate{
+			WindowSeconds: int64(window.Seconds()),
+			BurnRate:      o.burnRate(window),
+		})
+	}
+	return status
+}
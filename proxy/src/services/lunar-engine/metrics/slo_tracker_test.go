@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	sharedDiscovery "lunar/shared-model/discovery"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var chargesEndpoint = sharedDiscovery.Endpoint{
+	Method: "POST",
+	URL:    "api.payments.com/v1/charges/{charge_id}",
+}
+
+func chargesCalls(
+	okCalls, failedCalls int,
+	latencies ...float64,
+) map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg {
+	sketch := sharedDiscovery.NewLatencySketch()
+	for _, latency := range latencies {
+		sketch.Add(latency)
+	}
+	return map[sharedDiscovery.Endpoint]sharedDiscovery.EndpointAgg{
+		chargesEndpoint: {
+			StatusCodes: map[int]sharedDiscovery.Count{
+				200: sharedDiscovery.Count(okCalls),
+				503: sharedDiscovery.Count(failedCalls),
+			},
+			DurationSketch: sketch,
+		},
+		{Method: "GET", URL: "api.payments.com/v1/balance"}: {
+			StatusCodes: map[int]sharedDiscovery.Count{500: 1000},
+		},
+	}
+}
+
+func TestSLOTrackerComputesErrorBudgetAndBurnRates(t *testing.T) {
+	tracker := newSLOTracker([]SLOConfig{{
+		Name:                   "charges",
+		Endpoint:               "api.payments.com/v1/charges/{id}",
+		Method:                 "post",
+		Availability:           99,
+		PeriodSeconds:          int64((24 * time.Hour).Seconds()),
+		BurnRateWindowsSeconds: []int64{300, 3600},
+	}})
+	start := time.Now()
+
+	tracker.update(start, chargesCalls(1000, 0))
+	tracker.update(start.Add(time.Hour), chargesCalls(1990, 10))
+	// The last 5 minutes fail at a 10% error rate, 10 times the budget
+	tracker.update(start.Add(time.Hour+5*time.Minute), chargesCalls(2080, 20))
+
+	burnRate, found := GetSLOBurnRate("charges", "", 5*time.Minute)
+	assert.False(t, found, "only the tracker of the metric manager is queried")
+	assert.Zero(t, burnRate)
+
+	activeSLOTracker.Store(tracker)
+	t.Cleanup(func() { activeSLOTracker.Store(nil) })
+
+	burnRate, found = GetSLOBurnRate("charges", SLOAvailability, 5*time.Minute)
+	require.True(t, found)
+	assert.InDelta(t, 10, burnRate, 0.001)
+	_, found = GetSLOBurnRate("charges", SLOLatency, 5*time.Minute)
+	assert.False(t, found)
+
+	statuses := tracker.getStatuses()
+	require.Len(t, statuses, 1)
+	status := statuses[0]
+	assert.Equal(t, SLOAvailability, status.Objective)
+	assert.Equal(t, int64(1100), status.Calls)
+	assert.Equal(t, int64(20), status.BadCalls)
+	// 65 minutes of the day burnt at 20/11 the rate of the budget
+	assert.InDelta(t, 20.0/11*65/(24*60), status.ErrorBudgetConsumed, 0.0001)
+	require.Len(t, status.BurnRates, 2)
+	assert.Equal(t, int64(300), status.BurnRates[0].WindowSeconds)
+	assert.InDelta(t, 10, status.BurnRates[0].BurnRate, 0.001)
+	assert.Equal(t, int64(3600), status.BurnRates[1].WindowSeconds)
+	assert.InDelta(t, 20.0/11, status.BurnRates[1].BurnRate, 0.001)
+
+	// A cleared discovery state starts the counting over
+	tracker.update(start.Add(2*time.Hour), chargesCalls(10, 0))
+	status = tracker.getStatuses()[0]
+	assert.Zero(t, status.Calls)
+	assert.Zero(t, status.ErrorBudgetConsumed)
+}
+
+func TestSLOTrackerTracksLatencyObjectives(t *testing.T) {
+	tracker := newSLOTracker([]SLOConfig{{
+		Name:     "charges",
+		Endpoint: "api.payments.com/v1/charges/{id}",
+		Latency:  &LatencyObjective{ThresholdMs: 500, Percentage: 90},
+	}})
+	start := time.Now()
+
+	tracker.update(start, chargesCalls(0, 0))
+	tracker.update(start.Add(time.Minute), chargesCalls(0, 0, 100, 200, 300, 900, 1200))
+
+	status := tracker.getStatuses()[0]
+	assert.Equal(t, SLOLatency, status.Objective)
+	assert.Equal(t, int64(5), status.Calls)
+	assert.Equal(t, int64(2), status.BadCalls)
+	assert.InDelta(t, 4.0/(30*24*60), status.ErrorBudgetConsumed, 0.000001)
+	require.Len(t, status.BurnRates, len(defaultBurnRateWindows))
+}
+
+func TestSLOTrackerErrorBudgetConsumedAlongThePeriod(t *testing.T) {
+	tracker := newSLOTracker([]SLOConfig{{
+		Name:          "charges",
+		Endpoint:      "api.payments.com/v1/charges/{id}",
+		Availability:  99,
+		PeriodSeconds: 3600,
+	}})
+	start := time.Now()
+	tracker.update(start, chargesCalls(0, 0))
+
+	for _, test := range []struct {
+		elapsed  time.Duration
+		ok       int
+		failed   int
+		consumed float64
+	}{
+		// burning at the rate of the budget for a quarter of the period
+		{15 * time.Minute, 99, 1, 0.25},
+		// burning at twice the rate exhausts the budget halfway through the period
+		{30 * time.Minute, 196, 4, 1},
+		// the consumed budget is capped once exhausted
+		{45 * time.Minute, 250, 50, 1},
+	} {
+		tracker.update(start.Add(test.elapsed), chargesCalls(test.ok, test.failed))
+		status := tracker.getStatuses()[0]
+		assert.InDelta(t, test.consumed, status.ErrorBudgetConsumed, 0.001, test.elapsed)
+	}
+}
+
+func TestSLOTrackerKeepsBoundedSnapshots(t *testing.T) {
+	tracker := newSLOTracker([]SLOConfig{{
+		Name:                   "charges",
+		Endpoint:               "api.payments.com/v1/charges/{id}",
+		Availability:           99.9,
+		PeriodSeconds:          3600,
+		BurnRateWindowsSeconds: []int64{600},
+	}})
+	start := time.Now()
+
+	for second := 0; second <= 2*3600; second += 5 {
+		tracker.update(start.Add(time.Duration(second)*time.Second), chargesCalls(second, 0))
+	}
+
+	objective := tracker.objectives[0]
+	// About a snapshot per tenth of the shortest window is kept along the period,
+	// which bounds both the memory and the accuracy of the windows
+	assert.LessOrEqual(t, len(objective.snapshots), 70)
+	assert.InDelta(t, 3600, objective.status().Calls, 60)
+}
+
+func TestSLOTrackerKeepsCallsOfUnchangedSLOs(t *testing.T) {
+	charges := SLOConfig{Name: "charges", Endpoint: chargesEndpoint.URL, Availability: 99}
+	tracker := newSLOTracker([]SLOConfig{charges})
+	start := time.Now()
+	tracker.update(start, chargesCalls(0, 0))
+	tracker.update(start.Add(time.Minute), chargesCalls(90, 10))
+
+	tracker.setSLOs([]SLOConfig{
+		charges,
+		{Name: "no-objective", Endpoint: chargesEndpoint.URL},
+		{Name: "unreachable", Endpoint: chargesEndpoint.URL, Availability: 100},
+	})
+
+	require.Len(t, tracker.objectives, 1)
+	assert.Equal(t, int64(100), tracker.getStatuses()[0].Calls)
+}
+
+func TestSLOTrackerStops(t *testing.T) {
+	tracker := newSLOTracker(nil)
+	tracker.start(time.Hour)
+	tracker.stop()
+
+	select {
+	case <-tracker.done:
+	default:
+		t.Fatal("the collection of the tracker was not stopped")
+	}
+	// stopping again, or a tracker which never started, is harmless
+	tracker.stop()
+	newSLOTracker(nil).stop()
+}
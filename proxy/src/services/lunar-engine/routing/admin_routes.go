@@ -1,6 +1,7 @@
 package routing
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,8 +9,12 @@ import (
 	"lunar/engine/config"
 	"lunar/engine/doctor"
 	"lunar/engine/utils/writers"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"lunar/toolkit-core/clock"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -195,6 +200,177 @@ func HandleJSONFileRead(location string) func(
 	}
 }
 
+// HandleDiscoveryRead serves the discovery state, without its history. Given a `from` and/or
+// `to` query parameter (RFC3339 or Unix milliseconds), the endpoints are aggregated over that
+// time range out of the discovery history instead.
+func HandleDiscoveryRead(location string, clock clock.Clock) func(
+	http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(writer, "Unsupported Method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := req.URL.Query()
+		if !query.Has("from") && !query.Has("to") {
+			handleDiscoveryStateRead(writer, location)
+			return
+		}
+
+		from, to, err := parseTimeRange(query.Get("from"), query.Get("to"), clock.Now())
+		if err != nil {
+			handleError(writer, "Invalid time range", http.StatusBadRequest, err)
+			return
+		}
+
+		data, err := readJSONFile(location)
+		if err != nil {
+			handleError(writer,
+				fmt.Sprintf("Failed to read %s: %v", location, err),
+				http.StatusUnprocessableEntity, err)
+			return
+		}
+		output := sharedDiscovery.Output{}
+		if err := json.Unmarshal(data, &output); err != nil {
+			handleError(writer, "Failed to parse discovery state",
+				http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		rangeOutput := sharedDiscovery.Output{
+			CreatedAt:    output.CreatedAt,
+			Interceptors: output.Interceptors,
+			Endpoints: sharedDiscovery.EndpointsInRange(
+				output.History, from.UnixMilli(), to.UnixMilli()),
+			Consumers: map[string]map[string]sharedDiscovery.EndpointOutput{},
+		}
+		data, err = json.Marshal(rangeOutput)
+		if err != nil {
+			handleError(writer, "Failed to encode discovery state",
+				http.StatusInternalServerError, err)
+			return
+		}
+		handleJSONResponse(writer, data)
+	}
+}
+
+// handleDiscoveryStateRead serves the discovery state as stored, except for the history
+// which holds the time buckets of every endpoint and is only used for time range queries,
+// and the latency sketches which are only kept to combine the percentiles of later flushes
+func handleDiscoveryStateRead(writer http.ResponseWriter, location string) {
+	data, err := readJSONFile(location)
+	if err != nil {
+		handleError(writer,
+			fmt.Sprintf("Failed to read %s: %v", location, err),
+			http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// Nothing was discovered yet
+	if len(bytes.TrimSpace(data)) == 0 {
+		handleJSONResponse(writer, data)
+		return
+	}
+
+	state := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		handleError(writer, "Failed to parse discovery state",
+			http.StatusUnprocessableEntity, err)
+		return
+	}
+	delete(state, "history")
+	delete(state, "sketches")
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		handleError(writer, "Failed to encode discovery state",
+			http.StatusInternalServerError, err)
+		return
+	}
+	handleJSONResponse(writer, data)
+}
+
+// HandleOpenAPIRead serves the OpenAPI documents generated from the discovered traffic,
+// one per provider host. The `host` query parameter selects the document of a single host.
+func HandleOpenAPIRead(discoveryLocation, schemasLocation string) func(
+	http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(writer, "Unsupported Method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		discovered := sharedDiscovery.Output{}
+		if err := readJSONState(discoveryLocation, &discovered); err != nil {
+			handleError(writer,
+				fmt.Sprintf("Failed to read %s: %v", discoveryLocation, err),
+				http.StatusUnprocessableEntity, err)
+			return
+		}
+		// Schemas are only known once bodies were sampled, documents are generated without them
+		schemas := sharedDiscovery.SchemasOutput{}
+		if err := readJSONState(schemasLocation, &schemas); err != nil {
+			log.Debug().Err(err).Msg("Generating OpenAPI documents without body schemas")
+		}
+
+		documents := sharedDiscovery.BuildOpenAPIDocuments(discovered, schemas)
+		var document any = documents
+		if host := req.URL.Query().Get("host"); host != "" {
+			hostDocument, found := documents[host]
+			if !found {
+				handleError(writer, "No traffic was discovered for the host",
+					http.StatusNotFound, fmt.Errorf("unknown host %s", host))
+				return
+			}
+			document = hostDocument
+		}
+
+		data, err := json.Marshal(document)
+		if err != nil {
+			handleError(writer, "Failed to encode OpenAPI documents",
+				http.StatusInternalServerError, err)
+			return
+		}
+		handleJSONResponse(writer, data)
+	}
+}
+
+func readJSONState(location string, state any) error {
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, state)
+}
+
+// parseTimeRange parses the bounds of a time range, `from` defaults to the
+// beginning of time and `to` defaults to now
+func parseTimeRange(rawFrom, rawTo string, now time.Time) (time.Time, time.Time, error) {
+	from, to := time.UnixMilli(0), now
+	var err error
+	if rawFrom != "" {
+		if from, err = parseTime(rawFrom); err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if rawTo != "" {
+		if to, err = parseTime(rawTo); err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from should be before to")
+	}
+	return from, to, nil
+}
+
+func parseTime(raw string) (time.Time, error) {
+	if milliseconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(milliseconds), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
 func HandleHandshake() func(
 	http.ResponseWriter, *http.Request) {
 	return func(writer http.ResponseWriter, req *http.Request) {
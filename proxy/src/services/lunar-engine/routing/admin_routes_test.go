@@ -0,0 +1,148 @@
+package routing
+
+import (
+	"encoding/json"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"lunar/toolkit-core/clock"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeDiscoveryState(t *testing.T, now time.Time) string {
+	minute := func(at time.Time, statusCode int) sharedDiscovery.HistoryBucket {
+		sketch := sharedDiscovery.NewLatencySketch()
+		sketch.Add(float64(statusCode))
+		return sharedDiscovery.HistoryBucket{
+			Start:          at.Truncate(time.Minute).UnixMilli(),
+			Count:          1,
+			StatusCodes:    map[int]int{statusCode: 1},
+			DurationSketch: sketch,
+		}
+	}
+	sketch := sharedDiscovery.NewLatencySketch()
+	sketch.Add(100)
+	state := sharedDiscovery.Output{
+		Endpoints: map[string]sharedDiscovery.EndpointOutput{
+			"GET:::api.com/users": {
+				Count:          3,
+				StatusCodes:    map[int]int{200: 2, 500: 1},
+				DurationSketch: sketch,
+			},
+		},
+		History: map[string]sharedDiscovery.EndpointHistory{
+			"GET:::api.com/users": {Minutes: []sharedDiscovery.HistoryBucket{
+				minute(now.Add(-90*time.Minute), 200),
+				minute(now.Add(-10*time.Minute), 200),
+				minute(now.Add(-5*time.Minute), 500),
+			}},
+		},
+	}
+	state.StoreSketches()
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+
+	location := filepath.Join(t.TempDir(), "discovery.json")
+	require.NoError(t, os.WriteFile(location, data, 0o600))
+	return location
+}
+
+func getDiscovery(t *testing.T, handler http.HandlerFunc, target string) (
+	int, sharedDiscovery.Output,
+) {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+	output := sharedDiscovery.Output{}
+	if recorder.Code != http.StatusOK {
+		return recorder.Code, output
+	}
+	response := map[string]string{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	require.NoError(t, json.Unmarshal([]byte(response["data"]), &output))
+	return recorder.Code, output
+}
+
+func TestHandleDiscoveryReadTimeRange(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	now := mockClock.Now()
+	handler := HandleDiscoveryRead(writeDiscoveryState(t, now), mockClock)
+
+	status, output := getDiscovery(t, handler, "/discover")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, 3, output.Endpoints["GET:::api.com/users"].Count)
+	// the history is only used for time ranges, it is not served along with the state,
+	// neither are the sketches
+	require.Nil(t, output.History)
+	require.Nil(t, output.Sketches)
+
+	from := now.Add(-time.Hour).Format(time.RFC3339)
+	status, output = getDiscovery(t, handler, "/discover?from="+from)
+	require.Equal(t, http.StatusOK, status)
+	users := output.Endpoints["GET:::api.com/users"]
+	require.Equal(t, 2, users.Count)
+	require.Equal(t, map[int]int{200: 1, 500: 1}, users.StatusCodes)
+	require.InEpsilon(t, 200, users.DurationPercentiles.P50, 0.01)
+	require.Nil(t, output.History)
+
+	to := now.Add(-time.Hour).UnixMilli()
+	status, output = getDiscovery(t, handler, "/discover?to="+strconv.FormatInt(to, 10))
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, 1, output.Endpoints["GET:::api.com/users"].Count)
+}
+
+func TestHandleDiscoveryReadInvalidTimeRange(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	handler := HandleDiscoveryRead(writeDiscoveryState(t, mockClock.Now()), mockClock)
+
+	status, _ := getDiscovery(t, handler, "/discover?from=yesterday")
+	require.Equal(t, http.StatusBadRequest, status)
+
+	from := mockClock.Now().Add(time.Hour).Format(time.RFC3339)
+	status, _ = getDiscovery(t, handler, "/discover?from="+from)
+	require.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestHandleOpenAPIRead(t *testing.T) {
+	dir := t.TempDir()
+	discoveryLocation := filepath.Join(dir, "discovery.json")
+	data, err := json.Marshal(sharedDiscovery.Output{
+		Endpoints: map[string]sharedDiscovery.EndpointOutput{
+			"GET:::api.com/users/{_param_1}": {Count: 2, StatusCodes: map[int]int{200: 2}},
+			"GET:::other.com/status":         {Count: 1, StatusCodes: map[int]int{200: 1}},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(discoveryLocation, data, 0o600))
+	// The schemas are optional, no body was sampled yet
+	handler := HandleOpenAPIRead(discoveryLocation, filepath.Join(dir, "missing.json"))
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/openapi?host=api.com", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	response := map[string]string{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	document := sharedDiscovery.OpenAPIDocument{}
+	require.NoError(t, json.Unmarshal([]byte(response["data"]), &document))
+	require.Equal(t, "api.com", document.Info.Title)
+	require.Equal(t, 2, document.Paths["/users/{_param_1}"]["get"].CallCount)
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/openapi", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	documents := map[string]sharedDiscovery.OpenAPIDocument{}
+	require.NoError(t, json.Unmarshal([]byte(response["data"]), &documents))
+	require.Len(t, documents, 2)
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/openapi?host=unknown.com", nil))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
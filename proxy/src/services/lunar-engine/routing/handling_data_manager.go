@@ -10,6 +10,7 @@ import (
 	"lunar/engine/metrics"
 	"lunar/engine/runner"
 	"lunar/engine/services"
+	"lunar/engine/services/discovery"
 	"lunar/engine/streams"
 	stream_config "lunar/engine/streams/config"
 	configstate "lunar/engine/streams/config-state"
@@ -60,6 +61,7 @@ type HandlingDataManager struct {
 	proxyTimeout     time.Duration
 	policiesServices *services.PoliciesServices
 
+	bodySampler         *discovery.BodySampler
 	metricManager       *metrics.MetricManager
 	legacyMetricManager *metrics.LegacyMetricManager
 	doctor              *doctor.Doctor
@@ -79,6 +81,10 @@ func NewHandlingDataManager(
 		writer:       writers.Dial("tcp", syslogExporterEndpoint, ctxMng.GetClock()),
 	}
 	context_manager.Get().WithFileExporter(data.writer)
+	data.bodySampler = discovery.NewBodySampler(
+		environment.GetDiscoveryBodySampleRate(),
+		data.writer,
+	)
 	return data
 }
 
@@ -93,7 +99,9 @@ func (rd *HandlingDataManager) Setup(telemetryWriter *logging.LunarTelemetryWrit
 	if environment.IsStreamsEnabled() {
 		rd.isStreamsEnabled = true
 
-		rd.doctor.WithStreams(rd.GetLoadedStreamsConfig)
+		rd.doctor.WithStreams(rd.GetLoadedStreamsConfig).
+			WithQuotaOverages(rd.GetQuotaOverages).
+			WithSLOStatuses(rd.GetSLOStatuses)
 		err := rd.initializeStreams()
 		if err != nil {
 			return err
@@ -144,11 +152,27 @@ func (rd *HandlingDataManager) GetLoadedStreamsConfig() *network.ConfigurationDa
 	return nil
 }
 
+func (rd *HandlingDataManager) GetQuotaOverages() map[string]map[string]int64 {
+	if rd.isStreamsEnabled && rd.stream != nil {
+		return rd.stream.GetQuotaOverages()
+	}
+	return nil
+}
+
+func (rd *HandlingDataManager) GetSLOStatuses() []metrics.SLOStatus {
+	return rd.metricManager.GetSLOStatuses()
+}
+
+func (rd *HandlingDataManager) GetBodySampler() *discovery.BodySampler {
+	return rd.bodySampler
+}
+
 func (rd *HandlingDataManager) IsStreamsEnabled() bool {
 	return rd.isStreamsEnabled
 }
 
 func (rd *HandlingDataManager) Shutdown() {
+	rd.metricManager.Stop()
 	if rd.shutdown != nil {
 		rd.shutdown()
 	}
@@ -176,6 +200,10 @@ func (rd *HandlingDataManager) SetHandleRoutes(mux *http.ServeMux) {
 			"/configuration",
 			rd.handleConfiguration(),
 		)
+		mux.HandleFunc(
+			"/cache/purge",
+			rd.handleCachePurge(),
+		)
 	} else {
 		mux.HandleFunc(
 			"/apply_policies",
@@ -200,7 +228,18 @@ func (rd *HandlingDataManager) SetHandleRoutes(mux *http.ServeMux) {
 	)
 	mux.HandleFunc(
 		"/discover",
-		HandleJSONFileRead(environment.GetDiscoveryStateLocation()),
+		HandleDiscoveryRead(
+			environment.GetDiscoveryStateLocation(),
+			context_manager.Get().GetClock(),
+		),
+	)
+
+	mux.HandleFunc(
+		"/openapi",
+		HandleOpenAPIRead(
+			environment.GetDiscoveryStateLocation(),
+			environment.GetSchemasStateLocation(),
+		),
 	)
 
 	mux.HandleFunc(
@@ -322,6 +361,44 @@ func (rd *HandlingDataManager) handleOnError() func(http.ResponseWriter, *http.R
 	}
 }
 
+func (rd *HandlingDataManager) handleCachePurge() func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(
+				writer,
+				"Unsupported Method for cache purge",
+				http.StatusMethodNotAllowed,
+			)
+			return
+		}
+
+		purgeRequest := stream_types.CachePurgeRequest{}
+		if err := json.NewDecoder(req.Body).Decode(&purgeRequest); err != nil {
+			handleError(writer, "Failed to decode incoming data", http.StatusBadRequest, err)
+			return
+		}
+		if err := purgeRequest.Validate(); err != nil {
+			handleError(writer, "Invalid cache purge request", http.StatusBadRequest, err)
+			return
+		}
+		if rd.stream == nil {
+			handleError(writer, "Flows are not loaded", http.StatusServiceUnavailable, nil)
+			return
+		}
+
+		result, err := rd.stream.PurgeCache(purgeRequest)
+		if err != nil {
+			handleError(writer, "Failed to purge cache", http.StatusInternalServerError, err)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(writer).Encode(result); err != nil {
+			log.Error().Err(err).Msg("Failed encoding cache purge response")
+		}
+	}
+}
+
 func (rd *HandlingDataManager) handleApplyFlows() func(http.ResponseWriter, *http.Request) {
 	return func(writer http.ResponseWriter, req *http.Request) {
 		if !rd.handlingLock.TryLock() {
@@ -551,6 +628,7 @@ func (rd *HandlingDataManager) buildHAProxyFlowsEndpointsRequest() *config.HAPro
 	manageAll := false
 	bodyMessageForAll := false
 	reqCaptureForAll := false
+	networkErrorForAll := false
 
 	managedEndpoints := []*config.HAProxyEndpointData{}
 	for _, filters := range rd.stream.GetSupportedFilters() {
@@ -566,11 +644,15 @@ func (rd *HandlingDataManager) buildHAProxyFlowsEndpointsRequest() *config.HAPro
 				filterRequirements.IsBodyRequired
 			requirements.IsReqCaptureRequired = requirements.IsReqCaptureRequired ||
 				filterRequirements.IsReqCaptureRequired
+			requirements.IsNetworkErrorRequired = requirements.IsNetworkErrorRequired ||
+				filterRequirements.IsNetworkErrorRequired
 
 			manageAll = manageAll || filter.IsAnyURLAccepted()
 
 			bodyMessageForAll = bodyMessageForAll || (manageAll && requirements.IsBodyRequired)
 			reqCaptureForAll = reqCaptureForAll || (manageAll && requirements.IsReqCaptureRequired)
+			networkErrorForAll = networkErrorForAll ||
+				(manageAll && requirements.IsNetworkErrorRequired)
 		}
 
 		for _, method := range filters[0].GetSupportedMethods() {
@@ -580,10 +662,11 @@ func (rd *HandlingDataManager) buildHAProxyFlowsEndpointsRequest() *config.HAPro
 	}
 
 	return &config.HAProxyEndpointsRequest{
-		ManageAll:        manageAll,
-		BodyNeededForAll: bodyMessageForAll,
-		ReqCaptureForAll: reqCaptureForAll,
-		ManagedEndpoints: managedEndpoints,
+		ManageAll:          manageAll,
+		BodyNeededForAll:   bodyMessageForAll,
+		ReqCaptureForAll:   reqCaptureForAll,
+		NetworkErrorForAll: networkErrorForAll,
+		ManagedEndpoints:   managedEndpoints,
 	}
 }
 
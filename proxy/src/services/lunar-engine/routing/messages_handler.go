@@ -184,6 +184,7 @@ func processResponse(msg *message.Message, data *HandlingDataManager) (action.Ac
 		}
 
 		data.GetMetricManager().UpdateMetricsForAPICall(apiStream)
+		data.GetBodySampler().Sample(apiStream)
 
 		flowActions := &stream_config.StreamActions{
 			Response: &stream_config.ResponseStream{},
@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"encoding/json"
+	public_types "lunar/engine/streams/public-types"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"math/rand"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// BodySamplesExporter routes the samples to the aggregation plugin through fluent-bit
+	BodySamplesExporter = "discovery_samples"
+	// maxSampledBodySize skips large bodies, which are costly to export and to infer from
+	maxSampledBodySize = 64 * 1024
+
+	contentTypeHeaderName = "content-type"
+)
+
+type exporter interface {
+	Write(b []byte) (int, error)
+}
+
+// BodySampler exports the JSON bodies of a fraction of the transactions,
+// so the aggregation plugin can infer the schemas of the discovered endpoints.
+// The gateway only sends the bodies of endpoints whose flows require them,
+// the schemas of other endpoints stay empty.
+type BodySampler struct {
+	rate     float64
+	exporter exporter
+	random   func() float64
+}
+
+func NewBodySampler(rate float64, exporter exporter) *BodySampler {
+	return &BodySampler{
+		rate:     rate,
+		exporter: exporter,
+		random:   rand.Float64,
+	}
+}
+
+// Sample exports the bodies of a response stream, if it is sampled and has a JSON body
+func (s *BodySampler) Sample(apiStream public_types.APIStreamI) {
+	if s == nil || s.exporter == nil || s.rate <= 0 || s.random() >= s.rate {
+		return
+	}
+
+	response := apiStream.GetResponse()
+	if response == nil || !apiStream.GetType().IsResponseType() {
+		return
+	}
+	sample := sharedDiscovery.BodySample{
+		Method:       response.GetMethod(),
+		URL:          response.GetURL(),
+		StatusCode:   response.GetStatus(),
+		ResponseBody: getJSONBody(response),
+	}
+	if request := apiStream.GetRequest(); request != nil {
+		sample.RequestBody = getJSONBody(request)
+	}
+	if sample.RequestBody == nil && sample.ResponseBody == nil {
+		return
+	}
+
+	content, err := json.Marshal(sample)
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to marshal body sample")
+		return
+	}
+	message := append([]byte(BodySamplesExporter+" "), content...)
+	if _, err := s.exporter.Write(message); err != nil {
+		log.Debug().Err(err).Msg("Failed to export body sample")
+	}
+}
+
+// getJSONBody returns the body of a transaction if it is a JSON document, nil otherwise
+func getJSONBody(transaction public_types.TransactionI) json.RawMessage {
+	contentType, _ := transaction.GetHeader(contentTypeHeaderName)
+	if !strings.Contains(strings.ToLower(contentType), "json") {
+		return nil
+	}
+
+	// The bodies of the streams are already decoded from their content encoding
+	body := []byte(transaction.GetBody())
+	if len(body) == 0 || len(body) > maxSampledBodySize || !json.Valid(body) {
+		return nil
+	}
+	return body
+}
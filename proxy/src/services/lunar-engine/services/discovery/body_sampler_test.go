@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"encoding/json"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	public_types "lunar/engine/streams/public-types"
+	stream_types "lunar/engine/streams/types"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testExporter struct {
+	messages []string
+}
+
+func (e *testExporter) Write(b []byte) (int, error) {
+	e.messages = append(e.messages, string(b))
+	return len(b), nil
+}
+
+func newTestStream(requestBody, responseBody string) public_types.APIStreamI {
+	jsonHeaders := map[string]string{"content-type": "application/json; charset=utf-8"}
+	apiStream := stream_types.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:         "txn-1",
+		SequenceID: "seq-1",
+		Method:     "POST",
+		URL:        "api.example.com/users",
+		Headers:    jsonHeaders,
+		RawBody:    []byte(requestBody),
+	}, lunar_context.NewMemoryState[[]byte]())
+	apiStream.SetResponse(stream_types.NewResponse(lunar_messages.OnResponse{
+		ID:         "txn-1",
+		SequenceID: "seq-1",
+		Method:     "POST",
+		URL:        "api.example.com/users",
+		Status:     201,
+		Headers:    jsonHeaders,
+		RawBody:    []byte(responseBody),
+	}))
+	return apiStream
+}
+
+func TestBodySamplerExportsJSONBodies(t *testing.T) {
+	exporter := &testExporter{}
+	sampler := NewBodySampler(1, exporter)
+
+	sampler.Sample(newTestStream(`{"name": "a"}`, `{"id": 1}`))
+
+	require.Len(t, exporter.messages, 1)
+	content, found := strings.CutPrefix(exporter.messages[0], BodySamplesExporter+" ")
+	require.True(t, found)
+
+	sample := sharedDiscovery.BodySample{}
+	require.NoError(t, json.Unmarshal([]byte(content), &sample))
+	require.Equal(t, "POST", sample.Method)
+	require.Equal(t, "api.example.com/users", sample.URL)
+	require.Equal(t, 201, sample.StatusCode)
+	require.JSONEq(t, `{"name": "a"}`, string(sample.RequestBody))
+	require.JSONEq(t, `{"id": 1}`, string(sample.ResponseBody))
+}
+
+func TestBodySamplerSkipsUnsampledAndNonJSONBodies(t *testing.T) {
+	exporter := &testExporter{}
+
+	NewBodySampler(0, exporter).Sample(newTestStream(`{"name": "a"}`, `{"id": 1}`))
+	NewBodySampler(1, exporter).Sample(newTestStream("", "not json"))
+	require.Empty(t, exporter.messages)
+
+	sampler := NewBodySampler(0.5, exporter)
+	sampler.random = func() float64 { return 0.7 }
+	sampler.Sample(newTestStream(`{"name": "a"}`, `{"id": 1}`))
+	require.Empty(t, exporter.messages)
+
+	sampler.random = func() float64 { return 0.2 }
+	sampler.Sample(newTestStream(`{"name": "a"}`, `{"id": 1}`))
+	require.Len(t, exporter.messages, 1)
+}
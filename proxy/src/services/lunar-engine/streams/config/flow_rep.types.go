@@ -314,3 +314,10 @@ func (f *Filter) SetReqCaptureRequired(reqCaptureRequired bool) {
 	}
 	f.flowRequirements.IsReqCaptureRequired = reqCaptureRequired
 }
+
+func (f *Filter) SetNetworkErrorRequired(networkErrorRequired bool) {
+	if f.flowRequirements == nil {
+		f.flowRequirements = &streamTypes.ProcessorRequirement{}
+	}
+	f.flowRequirements.IsNetworkErrorRequired = networkErrorRequired
+}
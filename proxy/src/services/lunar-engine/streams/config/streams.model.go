@@ -63,6 +63,7 @@ type Filter struct {
 	StatusCode       []int                            `yaml:"status_code,omitempty"`
 	Expressions      []string                         `yaml:"expressions,omitempty"`
 	SamplePercentage float64                          `yaml:"sample_percentage,omitempty"`
+	BurnRate         *public_types.BurnRateCondition  `yaml:"burn_rate,omitempty"`
 	flowRequirements *stream_types.ProcessorRequirement
 	expression       *Expression
 }
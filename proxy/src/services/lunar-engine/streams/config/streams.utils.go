@@ -79,6 +79,9 @@ func (f *Filter) Extend(from *Filter) {
 	if f.URL == "" {
 		f.URL = from.URL
 	}
+	if f.BurnRate == nil {
+		f.BurnRate = from.BurnRate
+	}
 
 	if from.Expressions != nil {
 		if f.Expressions == nil {
@@ -133,6 +136,10 @@ func (f Filter) GetResExpressions() []string {
 	return f.expression.res
 }
 
+func (f Filter) GetBurnRateCondition() *publictypes.BurnRateCondition {
+	return f.BurnRate
+}
+
 func (f *Filter) ToComparable() publictypes.ComparableFilter {
 	return publictypes.ComparableFilter{
 		URL:         f.URL,
@@ -140,6 +147,7 @@ func (f *Filter) ToComparable() publictypes.ComparableFilter {
 		Method:      stringSliceToString(f.Method),
 		Headers:     keyValueSliceToString(f.Headers),
 		StatusCode:  intSliceToString(f.StatusCode),
+		BurnRate:    f.BurnRate.String(),
 	}
 }
 
@@ -75,6 +75,32 @@ func validateFilter(filter *Filter) error {
 		return fmt.Errorf("filter url is required")
 	}
 
+	return validateBurnRateCondition(filter.BurnRate)
+}
+
+func validateBurnRateCondition(condition *publictypes.BurnRateCondition) error {
+	if condition == nil {
+		return nil
+	}
+	if condition.SLO == "" {
+		return fmt.Errorf("filter burn_rate slo is required")
+	}
+	if condition.Objective != "" && condition.Objective != "availability" &&
+		condition.Objective != "latency" {
+		return fmt.Errorf("filter burn_rate objective must be availability or latency")
+	}
+	if len(condition.WindowsSeconds) == 0 {
+		return fmt.Errorf("filter burn_rate windows_seconds are required")
+	}
+	for _, windowSeconds := range condition.WindowsSeconds {
+		if windowSeconds <= 0 {
+			return fmt.Errorf("filter burn_rate window %d must be positive", windowSeconds)
+		}
+	}
+	if condition.Above < 0 {
+		return fmt.Errorf("filter burn_rate above must not be negative")
+	}
+
 	return nil
 }
 
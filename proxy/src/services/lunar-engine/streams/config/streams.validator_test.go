@@ -240,6 +240,28 @@ func TestMissingFilterURL(t *testing.T) {
 	}
 }
 
+func TestBurnRateFilterValidation(t *testing.T) {
+	validCondition := publictypes.BurnRateCondition{
+		SLO:            "charges",
+		WindowsSeconds: []int64{3600, 300},
+		Above:          14.4,
+	}
+	require.NoError(t, validateFilter(&Filter{URL: "test", BurnRate: &validCondition}))
+
+	invalidConditions := map[string]func(*publictypes.BurnRateCondition){
+		"missing slo":       func(c *publictypes.BurnRateCondition) { c.SLO = "" },
+		"unknown objective": func(c *publictypes.BurnRateCondition) { c.Objective = "errors" },
+		"missing windows":   func(c *publictypes.BurnRateCondition) { c.WindowsSeconds = nil },
+		"invalid window":    func(c *publictypes.BurnRateCondition) { c.WindowsSeconds = []int64{0} },
+		"negative above":    func(c *publictypes.BurnRateCondition) { c.Above = -1 },
+	}
+	for name, invalidate := range invalidConditions {
+		condition := validCondition
+		invalidate(&condition)
+		require.Error(t, validateFilter(&Filter{URL: "test", BurnRate: &condition}), name)
+	}
+}
+
 func TestMissingProcessorIdentifier(t *testing.T) {
 	flow := &FlowRepresentation{
 		Name: "test",
@@ -1,12 +1,17 @@
 package streamfilter
 
 import (
+	"lunar/engine/metrics"
 	internal_types "lunar/engine/streams/internal-types"
 	public_types "lunar/engine/streams/public-types"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+// getSLOBurnRate returns the burn rate of a tracked SLO, replaced by the tests
+var getSLOBurnRate = metrics.GetSLOBurnRate
+
 // Check if stream headers are qualified based on the filter
 func (node *FilterNode) isHeadersQualified(
 	flow internal_types.FlowI,
@@ -109,3 +114,31 @@ func (node *FilterNode) isQueryParamsQualified(
 	log.Trace().Msgf("Query params qualified for Flow: %s", flow.GetName())
 	return true
 }
+
+// Check if the burn rates of the SLO are above the threshold of the filter
+func (node *FilterNode) isBurnRateQualified(flow internal_types.FlowI) bool {
+	condition := flow.GetFilter().GetBurnRateCondition()
+	if condition == nil {
+		return true
+	}
+
+	for _, windowSeconds := range condition.WindowsSeconds {
+		burnRate, found := getSLOBurnRate(
+			condition.SLO,
+			metrics.SLOObjective(condition.Objective),
+			time.Duration(windowSeconds)*time.Second,
+		)
+		if !found {
+			log.Trace().Msgf("SLO %s is not tracked for Flow: %s", condition.SLO, flow.GetName())
+			return false
+		}
+		if burnRate <= condition.Above {
+			log.Trace().Msgf("Burn rate %v of SLO %s over %ds not qualified on Flow: %s",
+				burnRate, condition.SLO, windowSeconds, flow.GetName())
+			return false
+		}
+	}
+
+	log.Trace().Msgf("Burn rate qualified for Flow: %s", flow.GetName())
+	return true
+}
@@ -153,6 +153,10 @@ func (node *FilterNode) isFlowValid(
 		return false
 	}
 
+	if !node.isBurnRateQualified(flow) {
+		return false
+	}
+
 	if flow.GetFilter().IsExpressionFilter() {
 		return node.validateExpr(flow, apiStream)
 	}
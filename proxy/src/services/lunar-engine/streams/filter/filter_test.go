@@ -4,8 +4,10 @@ import (
 	internaltypes "lunar/engine/streams/internal-types"
 	lunar_context "lunar/engine/streams/lunar-context"
 	"testing"
+	"time"
 
 	lunar_messages "lunar/engine/messages"
+	"lunar/engine/metrics"
 	stream_config "lunar/engine/streams/config"
 	stream_flow "lunar/engine/streams/flow"
 	public_types "lunar/engine/streams/public-types"
@@ -449,6 +451,87 @@ func TestFilterTreeGetRelevantFlowWithStatusCodeNoMatch(t *testing.T) {
 	require.False(t, found, "Expected %v, but got %v, value found: %+v", true, found)
 }
 
+func TestFilterTreeGetRelevantFlowWithUntrackedBurnRateNoMatch(t *testing.T) {
+	filter := createFilter("FilterName", "api.google.com/path1", 0)
+	filter.BurnRate = &public_types.BurnRateCondition{
+		SLO:            "google-availability",
+		WindowsSeconds: []int64{300},
+		Above:          1,
+	}
+
+	apiStream := stream_types.NewAPIStream("APIStreamName", public_types.StreamTypeAny, sharedState)
+	apiStream.SetRequest(stream_types.NewRequest(lunar_messages.OnRequest{
+		Method:  "GET",
+		Scheme:  "https",
+		URL:     "api.google.com/path1",
+		Headers: map[string]string{},
+	}))
+	apiStream.SetContext(lunar_context.NewLunarContext(lunar_context.NewContext()))
+
+	flow := stream_flow.NewFlow(nil, &stream_config.FlowRepresentation{Filter: filter}, nil)
+
+	filterTree := NewFilterTree()
+
+	if err := filterTree.AddFlow(flow); err != nil {
+		t.Errorf("Expected %v, but got %v", nil, err)
+	}
+
+	// The flow only applies while the burn rate of a tracked SLO is above the threshold
+	_, found := filterTree.GetFlow(apiStream)
+	require.False(t, found, "Expected %v, but got %v", false, found)
+}
+
+// setSLOBurnRates replaces the tracked SLOs with the given burn rates of each window
+func setSLOBurnRates(t *testing.T, sloName string, burnRates map[time.Duration]float64) {
+	previous := getSLOBurnRate
+	getSLOBurnRate = func(
+		name string,
+		_ metrics.SLOObjective,
+		window time.Duration,
+	) (float64, bool) {
+		burnRate, found := burnRates[window]
+		return burnRate, found && name == sloName
+	}
+	t.Cleanup(func() { getSLOBurnRate = previous })
+}
+
+func TestFilterTreeGetRelevantFlowWithBurnRateAboveThreshold(t *testing.T) {
+	filter := createFilter("FilterName", "api.google.com/path1", 0)
+	filter.BurnRate = &public_types.BurnRateCondition{
+		SLO:            "google-availability",
+		WindowsSeconds: []int64{300, 3600},
+		Above:          2,
+	}
+
+	apiStream := stream_types.NewAPIStream("APIStreamName", public_types.StreamTypeAny, sharedState)
+	apiStream.SetRequest(stream_types.NewRequest(lunar_messages.OnRequest{
+		Method:  "GET",
+		Scheme:  "https",
+		URL:     "api.google.com/path1",
+		Headers: map[string]string{},
+	}))
+	apiStream.SetContext(lunar_context.NewLunarContext(lunar_context.NewContext()))
+
+	flow := stream_flow.NewFlow(nil, &stream_config.FlowRepresentation{Filter: filter}, nil)
+	filterTree := NewFilterTree()
+	require.NoError(t, filterTree.AddFlow(flow))
+
+	setSLOBurnRates(t, "google-availability", map[time.Duration]float64{
+		5 * time.Minute: 5,
+		time.Hour:       3,
+	})
+	_, found := filterTree.GetFlow(apiStream)
+	require.True(t, found, "Expected the flow to apply above the burn rate threshold")
+
+	// every window must burn above the threshold
+	setSLOBurnRates(t, "google-availability", map[time.Duration]float64{
+		5 * time.Minute: 5,
+		time.Hour:       1,
+	})
+	_, found = filterTree.GetFlow(apiStream)
+	require.False(t, found, "Expected the flow not to apply below the burn rate threshold")
+}
+
 func TestFilterTreeGetRelevantFlowWithHeadersConfigured(t *testing.T) {
 	filter := createFilter("FilterName", "api.google.com/path1", 0)
 	filter.Headers = []public_types.KeyValueOperation{
@@ -22,4 +22,5 @@ type FlowFilterI interface {
 	GetRequirements() *streamtypes.ProcessorRequirement
 	SetBodyRequired(bool)
 	SetReqCaptureRequired(bool)
+	SetNetworkErrorRequired(bool)
 }
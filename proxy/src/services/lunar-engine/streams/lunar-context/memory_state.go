@@ -3,6 +3,7 @@ package lunarcontext
 import (
 	"fmt"
 	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/utils/queue"
 	"lunar/toolkit-core/clock"
 	"sync"
 	"time"
@@ -101,27 +102,16 @@ func (p *memoryState[T]) AtomicSAddWithMaxValuesAllowed(
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	if !p.contextMemory.Exists(key) {
-		if err := p.contextMemory.Set(key, []string{}); err != nil {
-			return false, err
-		}
-	}
-
-	set, err := p.contextMemory.Get(key)
-
-	if len(set.([]string)) >= int(maxAllowed) {
-		return false, nil
-	}
-
+	set, err := p.getSet(key)
 	if err != nil {
 		return false, err
 	}
-	set = append(set.([]string), value)
-	err = p.contextMemory.Set(key, set)
-	if err != nil {
-		return false, err
+
+	if len(set) >= int(maxAllowed) {
+		return false, nil
 	}
 
+	set[value] = struct{}{}
 	return true, nil
 }
 
@@ -133,12 +123,12 @@ func (p *memoryState[T]) SCard(key string) (int64, error) {
 		return 0, nil
 	}
 
-	set, err := p.contextMemory.Get(key)
+	set, err := p.getSet(key)
 	if err != nil {
 		return -1, err
 	}
 
-	return int64(len(set.([]string))), nil
+	return int64(len(set)), nil
 }
 
 func (p *memoryState[T]) SMembers(key string) ([]string, error) {
@@ -149,12 +139,16 @@ func (p *memoryState[T]) SMembers(key string) ([]string, error) {
 		return []string{}, nil
 	}
 
-	set, err := p.contextMemory.Get(key)
+	set, err := p.getSet(key)
 	if err != nil {
 		return []string{}, err
 	}
 
-	return set.([]string), nil
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	return members, nil
 }
 
 func (p *memoryState[T]) SRem(key string, value string) error {
@@ -165,26 +159,49 @@ func (p *memoryState[T]) SRem(key string, value string) error {
 		return nil
 	}
 
-	set, err := p.contextMemory.Get(key)
+	set, err := p.getSet(key)
 	if err != nil {
 		return err
 	}
 
-	for i, v := range set.([]string) {
-		if v == value {
-			set = append(set.([]string)[:i], set.([]string)[i+1:]...)
-			break
+	delete(set, value)
+	return nil
+}
+
+// getSet returns the set stored in the key, creating it if needed.
+// Sets are keyed by member, so adding and removing members does not scan them.
+func (p *memoryState[T]) getSet(key string) (map[string]struct{}, error) {
+	if !p.contextMemory.Exists(key) {
+		set := make(map[string]struct{})
+		if err := p.contextMemory.Set(key, set); err != nil {
+			return nil, err
 		}
+		return set, nil
 	}
 
-	err = p.contextMemory.Set(key, set)
-	return err
+	raw, err := p.contextMemory.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	set, ok := raw.(map[string]struct{})
+	if !ok {
+		return nil, fmt.Errorf("value for key %s is not a set", key)
+	}
+	return set, nil
 }
 
 func (p *memoryState[T]) NewQueue(key string, itemTTL time.Duration) public_types.SharedQueueI {
 	return NewMemoryQueue(key, itemTTL)
 }
 
+func (p *memoryState[T]) NewScheduledQueue(
+	key string,
+	itemTTL time.Duration,
+	scheduling queue.SchedulingConfig,
+) public_types.SharedQueueI {
+	return NewScheduledMemoryQueue(key, itemTTL, scheduling)
+}
+
 func (p *memoryState[T]) AtomicWindowResetIn(
 	key string,
 	windowSize time.Duration,
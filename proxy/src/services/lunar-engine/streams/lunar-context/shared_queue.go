@@ -1,111 +1,74 @@
 package lunarcontext
 
 import (
-	"container/heap"
 	"fmt"
 	publictypes "lunar/engine/streams/public-types"
+	"lunar/engine/utils/queue"
 	"sync"
 	"time"
-
-	"github.com/rs/zerolog/log"
 )
 
-type Item struct {
-	value     string
-	timestamp int64
-	score     float64
+type memoryQueue struct {
+	scheduler queue.Scheduler
+	key       string
+	mutex     sync.RWMutex
 }
 
-type memoryQueue struct {
-	queue PriorityQueue
-	key   string
-	mutex sync.RWMutex
+func NewMemoryQueue(key string, itemTTL time.Duration) publictypes.SharedQueueI {
+	return NewScheduledMemoryQueue(key, itemTTL, queue.SchedulingConfig{Mode: queue.StrictPriority})
 }
 
-func NewMemoryQueue(key string, _ time.Duration) publictypes.SharedQueueI {
-	memoryQueue := &memoryQueue{
-		key: fmt.Sprintf("%s%s", key, queueKeySuffix),
+func NewScheduledMemoryQueue(
+	key string,
+	_ time.Duration,
+	scheduling queue.SchedulingConfig,
+) publictypes.SharedQueueI {
+	return &memoryQueue{
+		key:       fmt.Sprintf("%s%s", key, queueKeySuffix),
+		scheduler: queue.NewScheduler(scheduling),
 	}
-	heap.Init(&memoryQueue.queue)
-	return memoryQueue
 }
 
 func (q *memoryQueue) Enqueue(item string, priority float64) error {
+	return q.EnqueueToGroup(item, "", priority)
+}
+
+func (q *memoryQueue) EnqueueToGroup(item string, group string, priority float64) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	heap.Push(&q.queue, &Item{
-		value:     item,
-		score:     calculateScore(priority),
-		timestamp: time.Now().UnixNano(),
-	})
+	q.scheduler.Push(item, group, calculateScore(priority))
 	return nil
 }
 
 func (q *memoryQueue) DequeueIfValueRelevant() string {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
-	if q.queue.Len() == 0 {
-		return ""
-	}
-
-	queueItem, valid := heap.Pop(&q.queue).(*Item)
 
-	if !valid {
-		log.Error().Msg("Could not cast priorityQueue item, " +
-			"will not process")
+	item, found := q.scheduler.Pop()
+	if !found {
 		return ""
 	}
-
-	return queueItem.value
+	return item
 }
 
 func (q *memoryQueue) Remove(item string) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	for i, v := range q.queue {
-		if v.value == item {
-			heap.Remove(&q.queue, i)
-			return
-		}
-	}
+	q.scheduler.Remove(item)
 }
 
-func (q *memoryQueue) Size() int64 {
+func (q *memoryQueue) Position(item string) int64 {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
 
-	return int64(q.queue.Len())
+	return int64(q.scheduler.Position(item))
 }
 
-type PriorityQueue []*Item
-
-func (pq PriorityQueue) Len() int { return len(pq) }
-
-func (pq PriorityQueue) Less(i, j int) bool {
-	if pq[i].score == pq[j].score {
-		return pq[i].timestamp < pq[j].timestamp
-	}
-	return pq[i].score < pq[j].score
-}
-
-func (pq PriorityQueue) Swap(i, j int) { pq[i], pq[j] = pq[j], pq[i] }
-
-func (pq *PriorityQueue) Push(x interface{}) {
-	item, valid := x.(*Item)
-	if !valid {
-		log.Error().
-			Msg("could not cast PriorityQueue item, will not push to queue")
-		return
-	}
-	*pq = append(*pq, item)
-}
+func (q *memoryQueue) Size() int64 {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
 
-func (pq *PriorityQueue) Pop() interface{} {
-	old := *pq
-	n := len(old)
-	item := old[n-1]
-	*pq = old[0 : n-1]
-	return item
+	return int64(q.scheduler.Len())
 }
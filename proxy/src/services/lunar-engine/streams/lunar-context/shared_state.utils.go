@@ -2,6 +2,7 @@ package lunarcontext
 
 import (
 	"fmt"
+	"lunar/toolkit-core/clock"
 	"sync"
 	"time"
 
@@ -18,6 +19,7 @@ type ExpireWatcher[T any] struct {
 	stopCh         chan struct{}
 	removeFunction removeKeyFunc[T]
 	keysToRemove   map[string]time.Time
+	clock          clock.Clock
 }
 
 var (
@@ -31,16 +33,27 @@ func GetExpireWatcher[T any](removeFunc removeKeyFunc[T]) *ExpireWatcher[T] {
 	ewGetterLock.Lock()
 	defer ewGetterLock.Unlock()
 	if _, ok := ewInstances[key]; !ok {
-		ewInstances[key] = newEW(removeFunc)
+		ewInstances[key] = newEW(removeFunc, clock.NewRealClock())
 	}
 
 	return ewInstances[key].(*ExpireWatcher[T])
 }
 
-func newEW[T any](removeFunc removeKeyFunc[T]) *ExpireWatcher[T] {
+// NewExpireWatcher returns a watcher of its own, for remove functions which
+// should not be shared with other watchers of the same type.
+// The keys expire by the given clock, the one their owner measures their expiration by.
+func NewExpireWatcher[T any](
+	removeFunc removeKeyFunc[T],
+	expirationClock clock.Clock,
+) *ExpireWatcher[T] {
+	return newEW(removeFunc, expirationClock)
+}
+
+func newEW[T any](removeFunc removeKeyFunc[T], expirationClock clock.Clock) *ExpireWatcher[T] {
 	ew := &ExpireWatcher[T]{
 		keysToRemove:   make(map[string]time.Time),
 		removeFunction: removeFunc,
+		clock:          expirationClock,
 	}
 
 	return ew
@@ -58,7 +71,7 @@ func (ew *ExpireWatcher[T]) AddKey(
 		go ew.startExpirationWorker()
 	}
 
-	ew.keysToRemove[key] = time.Now().Add(expiration)
+	ew.keysToRemove[key] = ew.clock.Now().Add(expiration)
 }
 
 func (ew *ExpireWatcher[T]) startExpirationWorker() {
@@ -82,7 +95,7 @@ func (ew *ExpireWatcher[T]) removeExpiredKeys() {
 	defer ew.mu.Unlock()
 
 	for key, expirationTime := range ew.keysToRemove {
-		if time.Now().Before(expirationTime) {
+		if ew.clock.Now().Before(expirationTime) {
 			continue
 		}
 
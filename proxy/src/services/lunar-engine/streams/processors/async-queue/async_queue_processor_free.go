@@ -4,32 +4,121 @@ package processorasyncqueue
 
 import (
 	"fmt"
+	"lunar/engine/actions"
+	"lunar/engine/streams/processors/utils"
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	quotaIDParam = "quota_id"
+
+	// asyncServiceHeader is set by the async service on the requests it dispatches
+	asyncServiceHeader = "X-Lunar-Async"
+	// asyncStateHeader tells the async service what to do with a request it dispatched
+	asyncStateHeader = "X-Lunar-Async-State"
+	asyncFlowHeader  = "X-Lunar-Async-Flow"
+
+	asyncStateBlocked = "blocked"
 )
 
-type asyncQueueProcessor struct{}
+// asyncQueueProcessor holds the requests dispatched by the async service until the quota
+// allows them. Blocked requests are answered with 202, which makes the async service
+// dispatch them again later. Priority groups are not supported in the community edition.
+type asyncQueueProcessor struct {
+	name     string
+	quotaID  string
+	metaData *streamtypes.ProcessorMetaData
+}
 
 func newProcessor(
-	_ *streamtypes.ProcessorMetaData,
+	metaData *streamtypes.ProcessorMetaData,
 ) (streamtypes.ProcessorI, error) {
-	return &asyncQueueProcessor{},
-		fmt.Errorf("async queue processor is not available in the free version")
+	processor := &asyncQueueProcessor{
+		name:     metaData.Name,
+		metaData: metaData,
+	}
+
+	if err := utils.ExtractStrParam(metaData.Parameters,
+		quotaIDParam,
+		&processor.quotaID); err != nil {
+		return nil, err
+	}
+
+	if _, err := metaData.Resources.GetQuota(processor.quotaID, ""); err != nil {
+		return nil, fmt.Errorf(
+			"quota %s not found for processor %s: %w",
+			processor.quotaID,
+			metaData.Name,
+			err,
+		)
+	}
+	return processor, nil
 }
 
 func (p *asyncQueueProcessor) GetName() string {
-	return ""
+	return p.name
 }
 
 func (p *asyncQueueProcessor) Execute(
-	_ string,
+	flowName string,
 	apiStream publictypes.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() != publictypes.StreamTypeRequest {
+		return streamtypes.ProcessorIO{}, fmt.Errorf(
+			"invalid stream type: %s",
+			apiStream.GetType(),
+		)
+	}
+
+	passThrough := streamtypes.ProcessorIO{
+		Type:      apiStream.GetType(),
+		ReqAction: &actions.NoOpAction{},
+	}
+	// Requests sent directly to the gateway are not held
+	if !isDispatchedByAsyncService(apiStream) {
+		return passThrough, nil
+	}
+
+	quota, err := p.metaData.Resources.GetQuota(p.quotaID, apiStream.GetID())
+	if err != nil {
+		return streamtypes.ProcessorIO{}, err
+	}
+
+	if err = quota.Inc(apiStream); err != nil {
+		return streamtypes.ProcessorIO{}, err
+	}
+
+	isAllowed, err := quota.Allowed(apiStream)
+	if err != nil {
+		return streamtypes.ProcessorIO{}, err
+	}
+	if isAllowed {
+		return passThrough, nil
+	}
+
+	log.Trace().Msgf("Async request %s blocked by quota %s, it will be dispatched again",
+		apiStream.GetSequenceID(), p.quotaID)
 	return streamtypes.ProcessorIO{
 		Type: apiStream.GetType(),
+		ReqAction: &actions.EarlyResponseAction{
+			Status: http.StatusAccepted,
+			Headers: map[string]string{
+				asyncStateHeader: asyncStateBlocked,
+				asyncFlowHeader:  flowName,
+			},
+		},
 	}, nil
 }
 
 func (p *asyncQueueProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{}
 }
+
+func isDispatchedByAsyncService(apiStream publictypes.APIStreamI) bool {
+	value, found := apiStream.GetHeader(asyncServiceHeader)
+	return found && value == "true"
+}
@@ -0,0 +1,97 @@
+//go:build !pro
+
+package processorasyncqueue
+
+import (
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	stream_config "lunar/engine/streams/config"
+	lunar_context "lunar/engine/streams/lunar-context"
+	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/streams/resources"
+	quota_resource "lunar/engine/streams/resources/quota"
+	stream_types "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProcessor(t *testing.T, quotaID string) (stream_types.ProcessorI, error) {
+	resourceManagement, err := resources.NewResourceManagement()
+	require.NoError(t, err)
+	resourceManagement, err = resourceManagement.WithQuotaData(
+		[]*quota_resource.QuotaResourceData{
+			{
+				Quotas: []*quota_resource.QuotaConfig{
+					{
+						ID:     "async",
+						Filter: &stream_config.Filter{Name: "async", URL: "api.example.com/*"},
+						Strategy: &quota_resource.StrategyConfig{
+							FixedWindow: &quota_resource.FixedWindowConfig{
+								QuotaLimit: quota_resource.QuotaLimit{
+									Max:          1,
+									Interval:     1,
+									IntervalUnit: "minute",
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	require.NoError(t, err)
+
+	return NewProcessor(&stream_types.ProcessorMetaData{
+		Name: "AsyncQueue",
+		Parameters: map[string]stream_types.ProcessorParam{
+			quotaIDParam: {
+				Name:  quotaIDParam,
+				Value: public_types.NewParamValue(quotaID),
+			},
+		},
+		Resources: resourceManagement,
+	})
+}
+
+func newTestStream(headers map[string]string) public_types.APIStreamI {
+	apiStream := stream_types.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:         "txn-1",
+		SequenceID: "seq-1",
+		Method:     "GET",
+		URL:        "api.example.com/items",
+		Headers:    headers,
+	}, lunar_context.NewMemoryState[[]byte]())
+	return apiStream.WithLunarContext(
+		lunar_context.NewContextManager().WithFlowContext().GetLunarContext())
+}
+
+func TestAsyncQueueHoldsDispatchedRequestsAboveQuota(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	proc, err := newTestProcessor(t, "async")
+	require.NoError(t, err)
+
+	dispatched := map[string]string{"x-lunar-async": "true"}
+	output, err := proc.Execute("flow", newTestStream(dispatched))
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, output.ReqAction)
+
+	output, err = proc.Execute("flow", newTestStream(dispatched))
+	require.NoError(t, err)
+	earlyResponse, ok := output.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	require.Equal(t, http.StatusAccepted, earlyResponse.Status)
+	require.Equal(t, asyncStateBlocked, earlyResponse.Headers[asyncStateHeader])
+	require.Equal(t, "flow", earlyResponse.Headers[asyncFlowHeader])
+
+	// requests sent directly to the gateway are not held
+	output, err = proc.Execute("flow", newTestStream(nil))
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, output.ReqAction)
+}
+
+func TestAsyncQueueUnknownQuota(t *testing.T) {
+	_, err := newTestProcessor(t, "missing")
+	require.Error(t, err)
+}
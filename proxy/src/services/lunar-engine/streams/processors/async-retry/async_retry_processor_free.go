@@ -4,32 +4,119 @@ package processorretry
 
 import (
 	"fmt"
+	"lunar/engine/actions"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
-type asyncRetryProcessor struct{}
+const (
+	attemptsParam = "attempts"
+
+	// asyncServiceHeader is set by the async service on the requests it dispatches
+	asyncServiceHeader = "X-Lunar-Async"
+	// asyncStateHeader tells the async service what to do with a request it dispatched
+	asyncStateHeader = "X-Lunar-Async-State"
+	asyncFlowHeader  = "X-Lunar-Async-Flow"
+
+	asyncStateRetry = "retry"
+
+	// attemptsWindow bounds the time the attempts of a request are counted for
+	attemptsWindow = 24 * time.Hour
+)
+
+// asyncRetryProcessor asks the async service to dispatch a request again
+// for every response routed to it, until the attempts of the request run out.
+// The attempts are counted per sequence ID, which is kept across the dispatches.
+type asyncRetryProcessor struct {
+	name     string
+	attempts int
+	metaData *streamtypes.ProcessorMetaData
+	// attemptCounters holds the number of retries requested for each sequence ID
+	attemptCounters publictypes.SharedStateI[int64]
+}
 
 func newProcessor(
-	_ *streamtypes.ProcessorMetaData,
+	metaData *streamtypes.ProcessorMetaData,
 ) (streamtypes.ProcessorI, error) {
-	return &asyncRetryProcessor{},
-		fmt.Errorf("async retry processor is not available in the free version")
+	processor := &asyncRetryProcessor{
+		name:     metaData.Name,
+		metaData: metaData,
+		attemptCounters: lunar_context.NewSharedState[int64]().
+			WithClock(context_manager.Get().GetClock()),
+	}
+
+	if err := utils.ExtractIntParam(metaData.Parameters,
+		attemptsParam,
+		&processor.attempts); err != nil {
+		return nil, err
+	}
+	if processor.attempts < 0 {
+		return nil, fmt.Errorf("%s should not be negative", attemptsParam)
+	}
+	return processor, nil
 }
 
 func (p *asyncRetryProcessor) GetName() string {
-	return ""
+	return p.name
 }
 
 func (p *asyncRetryProcessor) Execute(
-	_ string,
+	flowName string,
 	apiStream publictypes.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() != publictypes.StreamTypeResponse {
+		return streamtypes.ProcessorIO{}, fmt.Errorf(
+			"invalid stream type: %s",
+			apiStream.GetType(),
+		)
+	}
+
+	passThrough := streamtypes.ProcessorIO{
+		Type:       apiStream.GetType(),
+		RespAction: &actions.NoOpAction{},
+	}
+	// Responses of requests sent directly to the gateway are returned as is
+	if !isDispatchedByAsyncService(apiStream) {
+		return passThrough, nil
+	}
+
+	attempt, _, err := p.attemptCounters.AtomicIncWindow(apiStream.GetSequenceID(), 1,
+		attemptsWindow, int64(p.attempts))
+	if err != nil {
+		log.Trace().Msgf("Async request %s ran out of attempts", apiStream.GetSequenceID())
+		return passThrough, nil
+	}
+
+	log.Trace().Msgf("Async request %s will be dispatched again, attempt %d of %d",
+		apiStream.GetSequenceID(), attempt, p.attempts)
 	return streamtypes.ProcessorIO{
 		Type: apiStream.GetType(),
+		RespAction: &actions.ModifyResponseAction{
+			Status: http.StatusAccepted,
+			HeadersToSet: map[string]string{
+				asyncStateHeader: asyncStateRetry,
+				asyncFlowHeader:  flowName,
+			},
+		},
 	}, nil
 }
 
 func (p *asyncRetryProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{}
 }
+
+func isDispatchedByAsyncService(apiStream publictypes.APIStreamI) bool {
+	request := apiStream.GetRequest()
+	if request == nil {
+		return false
+	}
+	value, found := request.GetHeader(asyncServiceHeader)
+	return found && value == "true"
+}
@@ -0,0 +1,68 @@
+//go:build !pro
+
+package processorretry
+
+import (
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	public_types "lunar/engine/streams/public-types"
+	stream_types "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStream(requestHeaders map[string]string) public_types.APIStreamI {
+	apiStream := stream_types.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:         "txn-1",
+		SequenceID: "seq-1",
+		Method:     "POST",
+		URL:        "api.example.com/jobs",
+		Headers:    requestHeaders,
+	}, lunar_context.NewMemoryState[[]byte]())
+	apiStream.SetResponse(stream_types.NewResponse(lunar_messages.OnResponse{
+		ID:         "txn-1",
+		SequenceID: "seq-1",
+		Method:     "POST",
+		URL:        "api.example.com/jobs",
+		Status:     http.StatusServiceUnavailable,
+	}))
+	return apiStream.WithLunarContext(
+		lunar_context.NewContextManager().WithFlowContext().GetLunarContext())
+}
+
+func TestAsyncRetryUntilAttemptsRunOut(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	proc, err := NewProcessor(&stream_types.ProcessorMetaData{
+		Name: "AsyncRetry",
+		Parameters: map[string]stream_types.ProcessorParam{
+			attemptsParam: {
+				Name:  attemptsParam,
+				Value: public_types.NewParamValue(2),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	dispatched := map[string]string{"x-lunar-async": "true"}
+	for range 2 {
+		output, err := proc.Execute("flow", newTestStream(dispatched))
+		require.NoError(t, err)
+		modifyResponse, ok := output.RespAction.(*actions.ModifyResponseAction)
+		require.True(t, ok)
+		require.Equal(t, http.StatusAccepted, modifyResponse.Status)
+		require.Equal(t, asyncStateRetry, modifyResponse.HeadersToSet[asyncStateHeader])
+	}
+
+	output, err := proc.Execute("flow", newTestStream(dispatched))
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, output.RespAction)
+
+	// responses of requests sent directly to the gateway are returned as is
+	output, err = proc.Execute("flow", newTestStream(nil))
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, output.RespAction)
+}
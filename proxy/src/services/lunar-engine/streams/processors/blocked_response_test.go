@@ -0,0 +1,110 @@
+package processors
+
+import (
+	"fmt"
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	stream_config "lunar/engine/streams/config"
+	lunar_context "lunar/engine/streams/lunar-context"
+	generateresponse "lunar/engine/streams/processors/generate-response"
+	processorlimiter "lunar/engine/streams/processors/limiter"
+	publictypes "lunar/engine/streams/public-types"
+	"lunar/engine/streams/resources"
+	quotaresource "lunar/engine/streams/resources/quota"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateResponseTemplatesLimiterBlockedInfo(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	sharedState := lunar_context.NewMemoryState[[]byte]()
+
+	quotaID := "TestGenerateResponseTemplatesLimiterBlockedInfo"
+	resourceManagement, err := resources.NewResourceManagement()
+	require.NoError(t, err)
+	resourceManagement, err = resourceManagement.WithQuotaData(
+		[]*quotaresource.QuotaResourceData{
+			{
+				Quotas: []*quotaresource.QuotaConfig{
+					{
+						ID:     quotaID,
+						Filter: &stream_config.Filter{Name: quotaID, URL: "api.example.com/*"},
+						Strategy: &quotaresource.StrategyConfig{
+							FixedWindow: &quotaresource.FixedWindowConfig{
+								QuotaLimit: quotaresource.QuotaLimit{
+									Max:          1,
+									Interval:     1,
+									IntervalUnit: "minute",
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	require.NoError(t, err)
+
+	limiter, err := processorlimiter.NewProcessor(&streamtypes.ProcessorMetaData{
+		Name:       "limiter",
+		Clock:      mockClock,
+		Resources:  resourceManagement,
+		Parameters: test_utils.NewProcessorParams(map[string]any{"quota_id": quotaID}),
+	})
+	require.NoError(t, err)
+
+	generateResponse, err := generateresponse.NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "generate_response",
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			"status": 429,
+			"body": `{"reason":"{{ .Blocked.Reason }}",` +
+				`"retry_after":{{ .Blocked.RetryAfter }}}`,
+			"Retry-After":       "{{ .Blocked.RetryAfter }}",
+			"X-RateLimit-Reset": "{{ .Blocked.ResetAt }}",
+			"Content-Type":      "application/json",
+			"templated":         true,
+		}),
+	})
+	require.NoError(t, err)
+
+	flowContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	newAPIStream := func(id string) publictypes.APIStreamI {
+		return streamtypes.NewRequestAPIStream(
+			lunar_messages.OnRequest{ID: id, URL: "api.example.com/resource"},
+			sharedState,
+		).WithLunarContext(flowContext)
+	}
+
+	output, err := limiter.Execute("flow", newAPIStream("first"))
+	require.NoError(t, err)
+	require.Equal(t, "below_limit", output.Name)
+
+	mockClock.AdvanceTime(20 * time.Second)
+	blockedStream := newAPIStream("second")
+	output, err = limiter.Execute("flow", blockedStream)
+	require.NoError(t, err)
+	require.Equal(t, "above_limit", output.Name)
+
+	output, err = generateResponse.Execute("flow", blockedStream)
+	require.NoError(t, err)
+	earlyResponse, ok := output.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+
+	require.Equal(t, 429, earlyResponse.Status)
+	require.Equal(t, `{"reason":"quota_exceeded","retry_after":40}`, earlyResponse.Body)
+	require.Equal(t, "40", earlyResponse.Headers["Retry-After"])
+	expectedReset := mockClock.Now().Add(40 * time.Second).Unix()
+	require.Equal(t, fmt.Sprint(expectedReset), earlyResponse.Headers["X-RateLimit-Reset"])
+	require.Equal(t, "application/json", earlyResponse.Headers["Content-Type"])
+
+	// Blocked info is consumed by the generated response
+	output, err = generateResponse.Execute("flow", blockedStream)
+	require.NoError(t, err)
+	earlyResponse, ok = output.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	require.Equal(t, "0", earlyResponse.Headers["Retry-After"])
+}
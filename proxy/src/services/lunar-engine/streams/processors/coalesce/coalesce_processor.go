@@ -0,0 +1,318 @@
+package processorcoalesce
+
+import (
+	"context"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/clock"
+	"lunar/toolkit-core/otel"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	coalescingKeyPartsParam = "coalescing_key_parts"
+	maxWaitParam            = "max_wait_seconds"
+
+	forwardedConditionName = "forwarded"
+	coalescedConditionName = "coalesced"
+
+	defaultMaxWait = 10 * time.Second
+
+	leadersMetric   = lunar_metrics.MetricPrefix + "coalesce_processor_leaders"
+	followersMetric = lunar_metrics.MetricPrefix + "coalesce_processor_followers"
+
+	outcomeAttribute = "outcome"
+	outcomeCoalesced = "coalesced"
+	outcomeTimedOut  = "timed_out"
+)
+
+// inFlightCall is a call forwarded to the provider, which identical calls wait for
+type inFlightCall struct {
+	leaderID  string
+	expiresAt time.Time
+	// done is closed once the response is set, or when the call is abandoned
+	done     chan struct{}
+	response *actions.EarlyResponseAction
+}
+
+type coalesceProcessor struct {
+	name                     string
+	coalescingKeyDefinitions []string
+	maxWait                  time.Duration
+
+	mutex sync.Mutex
+	// inFlight holds the in-flight call of each coalescing key
+	inFlight map[string]*inFlightCall
+	// leaders maps the transaction ID of each leader to its coalescing key
+	leaders map[string]string
+
+	clock        clock.Clock
+	metaData     *streamtypes.ProcessorMetaData
+	labelManager *lunar_metrics.LabelManager
+
+	metricObjects map[string]metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &coalesceProcessor{
+		name:          metaData.Name,
+		metaData:      metaData,
+		maxWait:       defaultMaxWait,
+		inFlight:      make(map[string]*inFlightCall),
+		leaders:       make(map[string]string),
+		clock:         metaData.GetClock(),
+		metricObjects: make(map[string]metric.Int64Counter),
+		labelManager:  lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	err := proc.initializeMetrics()
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *coalesceProcessor) GetName() string {
+	return p.name
+}
+
+func (p *coalesceProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired: true,
+	}
+}
+
+func (p *coalesceProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() == public_types.StreamTypeRequest {
+		return p.onRequest(flowName, apiStream), nil
+	} else if apiStream.GetType() == public_types.StreamTypeResponse {
+		return p.onResponse(apiStream), nil
+	}
+	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+}
+
+func (p *coalesceProcessor) init() error {
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		coalescingKeyPartsParam,
+		&p.coalescingKeyDefinitions); err != nil {
+		log.Error().Err(err).Msgf("Missing %s parameter", coalescingKeyPartsParam)
+		return err
+	}
+
+	if len(p.coalescingKeyDefinitions) == 0 {
+		return fmt.Errorf("%v cannot be empty", coalescingKeyPartsParam)
+	}
+
+	var maxWaitSeconds float64
+	if err := utils.ExtractFloat64Param(p.metaData.Parameters,
+		maxWaitParam,
+		&maxWaitSeconds); err != nil {
+		log.Trace().Msgf("max_wait_seconds not defined for %v", p.name)
+	} else {
+		if maxWaitSeconds <= 0 {
+			return fmt.Errorf("%v must be positive", maxWaitParam)
+		}
+		p.maxWait = time.Duration(maxWaitSeconds * float64(time.Second))
+	}
+	return nil
+}
+
+func (p *coalesceProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(
+		leadersMetric,
+		metric.WithDescription("Requests forwarded to the provider on behalf of identical requests"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+	p.metricObjects[leadersMetric] = meterObj
+
+	meterObj, err = meter.Int64Counter(
+		followersMetric,
+		metric.WithDescription("Requests which waited for an identical in-flight request"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+	p.metricObjects[followersMetric] = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *coalesceProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	metricObjID string,
+	outcome string,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	if outcome != "" {
+		attributes = append(attributes, attribute.String(outcomeAttribute, outcome))
+	}
+	p.metricObjects[metricObjID].Add(context.Background(), 1, metric.WithAttributes(attributes...))
+}
+
+// onRequest lets the first request of each key through and parks identical requests
+// until the response of the first request arrives, or until max_wait_seconds pass
+func (p *coalesceProcessor) onRequest(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	forwarded := streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		Name:      forwardedConditionName,
+		ReqAction: &actions.NoOpAction{},
+	}
+
+	coalescingKey, err := utils.BuildSharedMemoryKey(flowName,
+		p.coalescingKeyDefinitions,
+		apiStream)
+	if err != nil {
+		log.Trace().Err(err).Msgf("Failed to build coalescing key for %s", p.name)
+		return forwarded
+	}
+
+	call, isLeader := p.joinCall(coalescingKey, apiStream.GetID())
+	if isLeader {
+		log.Trace().Msgf("Forwarding leader %s of key %s", apiStream.GetID(), coalescingKey)
+		p.updateMetrics(flowName, apiStream, leadersMetric, "")
+		return forwarded
+	}
+
+	log.Trace().Msgf("Request %s waits for leader %s of key %s",
+		apiStream.GetID(), call.leaderID, coalescingKey)
+	select {
+	case <-call.done:
+	case <-p.clock.After(p.maxWait):
+	}
+
+	response := call.getResponse()
+	if response == nil {
+		log.Trace().Msgf("Request %s stopped waiting for key %s", apiStream.GetID(), coalescingKey)
+		p.updateMetrics(flowName, apiStream, followersMetric, outcomeTimedOut)
+		return forwarded
+	}
+
+	p.updateMetrics(flowName, apiStream, followersMetric, outcomeCoalesced)
+	return streamtypes.ProcessorIO{
+		Type: public_types.StreamTypeResponse,
+		Name: coalescedConditionName,
+		ReqAction: &actions.EarlyResponseAction{
+			Status:  response.Status,
+			Body:    response.Body,
+			Headers: maps.Clone(response.Headers),
+		},
+	}
+}
+
+// onResponse hands the response of a leader to the requests waiting for it
+func (p *coalesceProcessor) onResponse(apiStream public_types.APIStreamI) streamtypes.ProcessorIO {
+	passThrough := streamtypes.ProcessorIO{
+		Type:       public_types.StreamTypeResponse,
+		RespAction: &actions.NoOpAction{},
+	}
+
+	response := apiStream.GetResponse()
+	if response == nil {
+		return passThrough
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	coalescingKey, found := p.leaders[apiStream.GetID()]
+	if !found {
+		return passThrough
+	}
+	delete(p.leaders, apiStream.GetID())
+
+	call, found := p.inFlight[coalescingKey]
+	if !found || call.leaderID != apiStream.GetID() {
+		return passThrough
+	}
+	delete(p.inFlight, coalescingKey)
+
+	call.response = &actions.EarlyResponseAction{
+		Status:  response.GetStatus(),
+		Body:    response.GetBody(),
+		Headers: maps.Clone(response.GetHeaders()),
+	}
+	close(call.done)
+	return passThrough
+}
+
+// joinCall returns the in-flight call of the key, a new call led by the request is started
+// when there is none. Calls of leaders which did not respond within max_wait_seconds
+// are abandoned, so a new leader is elected.
+func (p *coalesceProcessor) joinCall(coalescingKey, requestID string) (*inFlightCall, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.clock.Now()
+	if call, found := p.inFlight[coalescingKey]; found && now.Before(call.expiresAt) {
+		return call, false
+	}
+
+	p.abandonExpiredCalls(now)
+	call := &inFlightCall{
+		leaderID:  requestID,
+		expiresAt: now.Add(p.maxWait),
+		done:      make(chan struct{}),
+	}
+	p.inFlight[coalescingKey] = call
+	p.leaders[requestID] = coalescingKey
+	return call, true
+}
+
+// abandonExpiredCalls releases the requests waiting for calls without a response,
+// they continue to the provider
+func (p *coalesceProcessor) abandonExpiredCalls(now time.Time) {
+	for coalescingKey, call := range p.inFlight {
+		if now.Before(call.expiresAt) {
+			continue
+		}
+		delete(p.inFlight, coalescingKey)
+		delete(p.leaders, call.leaderID)
+		close(call.done)
+	}
+}
+
+func (c *inFlightCall) getResponse() *actions.EarlyResponseAction {
+	select {
+	case <-c.done:
+		return c.response
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,181 @@
+package processorcoalesce
+
+import (
+	"fmt"
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/clock"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// waitNotifyingClock reports every request which starts waiting for an in-flight call
+type waitNotifyingClock struct {
+	public_types.ClockI
+	waiting chan struct{}
+}
+
+func (c *waitNotifyingClock) After(duration time.Duration) <-chan time.Time {
+	c.waiting <- struct{}{}
+	return c.ClockI.After(duration)
+}
+
+func newTestProcessor(t *testing.T, maxWaitSeconds float64) *coalesceProcessor {
+	proc, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "Coalesce",
+		Clock: &waitNotifyingClock{
+			ClockI:  clock.NewRealClock(),
+			waiting: make(chan struct{}, 10),
+		},
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			coalescingKeyPartsParam: []string{"$.request.headers.api_key"},
+			maxWaitParam:            maxWaitSeconds,
+		}),
+	})
+	require.NoError(t, err)
+	return proc.(*coalesceProcessor)
+}
+
+func newRequestStream(id, apiKey string) public_types.APIStreamI {
+	return streamtypes.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:      id,
+		Method:  "GET",
+		URL:     "api.example.com/orders",
+		Headers: map[string]string{"api_key": apiKey},
+	}, lunar_context.NewMemoryState[[]byte]())
+}
+
+func newResponseStream(id string, status int, body string) public_types.APIStreamI {
+	return streamtypes.NewResponseAPIStream(lunar_messages.OnResponse{
+		ID:      id,
+		Method:  "GET",
+		URL:     "api.example.com/orders",
+		Status:  status,
+		Headers: map[string]string{"Content-Type": "application/json"},
+		RawBody: []byte(body),
+	}, lunar_context.NewMemoryState[[]byte]())
+}
+
+// startFollowers executes identical requests in the background, and returns once all of them
+// wait for the in-flight call. The returned function collects their outputs.
+func startFollowers(
+	t *testing.T,
+	proc *coalesceProcessor,
+	count int,
+) func() []streamtypes.ProcessorIO {
+	outputs := make([]streamtypes.ProcessorIO, count)
+	errs := make(chan error, count)
+	var wg sync.WaitGroup
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := proc.Execute("flow", newRequestStream(fmt.Sprintf("follower-%d", i), "key1"))
+			outputs[i] = output
+			errs <- err
+		}()
+	}
+
+	waiting := proc.clock.(*waitNotifyingClock).waiting
+	for range count {
+		select {
+		case <-waiting:
+		case err := <-errs:
+			require.NoError(t, err)
+			require.Fail(t, "follower returned before waiting for the in-flight call")
+		}
+	}
+
+	return func() []streamtypes.ProcessorIO {
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+		return outputs
+	}
+}
+
+func TestCoalesceFollowersGetLeaderResponse(t *testing.T) {
+	proc := newTestProcessor(t, 5)
+
+	output, err := proc.Execute("flow", newRequestStream("leader", "key1"))
+	require.NoError(t, err)
+	require.Equal(t, forwardedConditionName, output.Name)
+
+	// Requests with another key are not coalesced
+	output, err = proc.Execute("flow", newRequestStream("other", "key2"))
+	require.NoError(t, err)
+	require.Equal(t, forwardedConditionName, output.Name)
+
+	waitForFollowers := startFollowers(t, proc, 3)
+
+	output, err = proc.Execute("flow", newResponseStream("leader", 200, `{"orders":[]}`))
+	require.NoError(t, err)
+	require.Empty(t, output.Name)
+	require.IsType(t, &actions.NoOpAction{}, output.RespAction)
+
+	for _, output := range waitForFollowers() {
+		require.Equal(t, coalescedConditionName, output.Name)
+		require.Equal(t, public_types.StreamTypeResponse, output.Type)
+		earlyResponse := output.ReqAction.(*actions.EarlyResponseAction)
+		require.Equal(t, 200, earlyResponse.Status)
+		require.Equal(t, `{"orders":[]}`, earlyResponse.Body)
+		require.Equal(t, "application/json", earlyResponse.Headers["Content-Type"])
+	}
+
+	// Once the leader responded, the next request leads a new call
+	output, err = proc.Execute("flow", newRequestStream("next-leader", "key1"))
+	require.NoError(t, err)
+	require.Equal(t, forwardedConditionName, output.Name)
+	require.Equal(t, "next-leader", proc.inFlight["flow_key1"].leaderID)
+}
+
+func TestCoalesceFollowersFallThroughOnTimeout(t *testing.T) {
+	proc := newTestProcessor(t, 0.3)
+
+	_, err := proc.Execute("flow", newRequestStream("leader", "key1"))
+	require.NoError(t, err)
+
+	waitForFollowers := startFollowers(t, proc, 2)
+	for _, output := range waitForFollowers() {
+		require.Equal(t, forwardedConditionName, output.Name)
+		require.IsType(t, &actions.NoOpAction{}, output.ReqAction)
+	}
+
+	// The leader did not respond in time, so the next request leads a new call
+	_, err = proc.Execute("flow", newRequestStream("next-leader", "key1"))
+	require.NoError(t, err)
+	require.Equal(t, "next-leader", proc.inFlight["flow_key1"].leaderID)
+	require.NotContains(t, proc.leaders, "leader")
+
+	// A late response of the abandoned leader is passed through
+	output, err := proc.Execute("flow", newResponseStream("leader", 200, "{}"))
+	require.NoError(t, err)
+	require.IsType(t, &actions.NoOpAction{}, output.RespAction)
+	require.Equal(t, "next-leader", proc.inFlight["flow_key1"].leaderID)
+}
+
+func TestCoalesceInvalidParameters(t *testing.T) {
+	_, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name:       "Coalesce",
+		Parameters: map[string]streamtypes.ProcessorParam{},
+	})
+	require.Error(t, err)
+
+	_, err = NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "Coalesce",
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			coalescingKeyPartsParam: []string{"$.request.headers.api_key"},
+			maxWaitParam:            -1,
+		}),
+	})
+	require.Error(t, err)
+}
@@ -8,6 +8,7 @@ import (
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
 	"lunar/toolkit-core/otel"
+	"math"
 
 	lunar_metrics "lunar/engine/metrics"
 
@@ -16,18 +17,25 @@ import (
 )
 
 const (
-	statusParam = "status"
-	bodyParam   = "body"
+	statusParam    = "status"
+	bodyParam      = "body"
+	headersParam   = "headers"
+	quotaIDParam   = "quota_id"
+	templatedParam = "templated"
 
 	metricName = "lunar_generated_response_count"
 )
 
 type generateResponseProcessor struct {
-	name       string
-	statusCode int
-	body       string
-	header     map[string]string
-	metaData   *streamtypes.ProcessorMetaData
+	name            string
+	statusCode      int
+	body            string
+	header          map[string]string
+	quotaID         string
+	templated       bool
+	bodyTemplate    *responseTemplate
+	headerTemplates map[string]*responseTemplate
+	metaData        *streamtypes.ProcessorMetaData
 
 	labelManager *lunar_metrics.LabelManager
 	metricObject metric.Float64Counter
@@ -37,10 +45,11 @@ func NewProcessor(
 	metaData *streamtypes.ProcessorMetaData,
 ) (streamtypes.ProcessorI, error) {
 	proc := &generateResponseProcessor{
-		name:         metaData.Name,
-		metaData:     metaData,
-		header:       make(map[string]string),
-		labelManager: lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+		name:            metaData.Name,
+		metaData:        metaData,
+		header:          make(map[string]string),
+		headerTemplates: make(map[string]*responseTemplate),
+		labelManager:    lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
 	}
 
 	// status code
@@ -61,10 +70,37 @@ func NewProcessor(
 	if err := utils.ExtractMapFromParams(metaData.Parameters,
 		&proc.header,
 		statusParam,
-		bodyParam); err != nil {
+		bodyParam,
+		headersParam,
+		quotaIDParam,
+		templatedParam); err != nil {
 		log.Trace().Err(err).Msgf("headers not defined for %v", metaData.Name)
 	}
 
+	if err := utils.ExtractMapOfStringParam(metaData.Parameters,
+		headersParam,
+		proc.header); err != nil {
+		log.Trace().Err(err).Msgf("headers map not defined for %v", metaData.Name)
+	}
+
+	// quota
+	if err := utils.ExtractStrParam(metaData.Parameters,
+		quotaIDParam,
+		&proc.quotaID); err != nil {
+		log.Trace().Err(err).Msgf("quota_id not defined for %v", metaData.Name)
+	}
+
+	// templates
+	if err := utils.ExtractBoolParam(metaData.Parameters,
+		templatedParam,
+		&proc.templated); err != nil {
+		log.Trace().Err(err).Msgf("templated not defined for %v", metaData.Name)
+	}
+
+	if err := proc.initTemplates(); err != nil {
+		return nil, err
+	}
+
 	if err := proc.initializeMetrics(); err != nil {
 		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
 		proc.metaData.Metrics.Enabled = false
@@ -97,10 +133,11 @@ func (p *generateResponseProcessor) onRequest(
 	flowName string,
 	apiStream publictypes.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
+	body, headers := p.renderResponse(apiStream)
 	var action actions.ReqLunarAction = &actions.EarlyResponseAction{
 		Status:  p.statusCode,
-		Body:    p.body,
-		Headers: p.header,
+		Body:    body,
+		Headers: headers,
 	}
 
 	p.updateMetrics(flowName, apiStream)
@@ -112,6 +149,97 @@ func (p *generateResponseProcessor) onRequest(
 	}, nil
 }
 
+// initTemplates parses the body and headers as templates when templating is enabled,
+// otherwise they are returned as configured, even if they contain template actions.
+func (p *generateResponseProcessor) initTemplates() error {
+	bodyTemplate, err := newResponseTemplate(bodyParam, p.body, p.templated)
+	if err != nil {
+		return fmt.Errorf("invalid body for %s: %w", p.name, err)
+	}
+	p.bodyTemplate = bodyTemplate
+
+	for name, value := range p.header {
+		headerTemplate, err := newResponseTemplate(name, value, p.templated)
+		if err != nil {
+			return fmt.Errorf("invalid header %s for %s: %w", name, p.name, err)
+		}
+		p.headerTemplates[name] = headerTemplate
+	}
+	return nil
+}
+
+// renderResponse renders the templated body and headers,
+// values that fail to render are returned as configured.
+func (p *generateResponseProcessor) renderResponse(
+	apiStream publictypes.APIStreamI,
+) (string, map[string]string) {
+	data := newTemplateData(apiStream)
+	if blockedInfo, found := utils.PopBlockedInfo(apiStream); found {
+		data.Blocked = *blockedInfo
+	}
+	if validationErrors, found := utils.PopValidationErrors(apiStream); found {
+		data.Errors = validationErrors
+	}
+	if p.quotaID != "" && p.isTemplated() {
+		data.Quota = p.getQuotaData(apiStream)
+	}
+
+	body, err := p.bodyTemplate.render(data)
+	if err != nil {
+		log.Debug().Err(err).Msgf("failed to render body for %s", p.name)
+	}
+
+	headers := make(map[string]string, len(p.headerTemplates))
+	for name, headerTemplate := range p.headerTemplates {
+		value, err := headerTemplate.render(data)
+		if err != nil {
+			log.Debug().Err(err).Msgf("failed to render header %s for %s", name, p.name)
+		}
+		headers[name] = value
+	}
+	return body, headers
+}
+
+func (p *generateResponseProcessor) isTemplated() bool {
+	if p.bodyTemplate.isTemplated() {
+		return true
+	}
+	for _, headerTemplate := range p.headerTemplates {
+		if headerTemplate.isTemplated() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *generateResponseProcessor) getQuotaData(apiStream publictypes.APIStreamI) quotaData {
+	data := quotaData{ID: p.quotaID}
+	if p.metaData.Resources == nil {
+		return data
+	}
+
+	quota, err := p.metaData.Resources.GetQuota(p.quotaID, apiStream.GetID())
+	if err != nil {
+		log.Debug().Err(err).Msgf("failed to get quota %s for %s", p.quotaID, p.name)
+		return data
+	}
+
+	resetIn := utils.GetQuotaResetIn(quota, apiStream)
+	data.ResetIn = int64(math.Ceil(resetIn.Seconds()))
+
+	if usageQuota, ok := quota.(publictypes.QuotaUsageI); ok {
+		used, limit, err := usageQuota.GetUsage(apiStream)
+		if err != nil {
+			log.Debug().Err(err).Msgf("failed to get usage of quota %s for %s", p.quotaID, p.name)
+			return data
+		}
+		data.Used = used
+		data.Limit = limit
+		data.Remaining = max(limit-used, 0)
+	}
+	return data
+}
+
 func (p *generateResponseProcessor) onResponse(
 	_ publictypes.APIStreamI,
 ) (streamtypes.ProcessorIO, error) {
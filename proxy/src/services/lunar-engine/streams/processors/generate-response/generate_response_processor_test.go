@@ -0,0 +1,165 @@
+package processorgenerateresponse
+
+import (
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	stream_config "lunar/engine/streams/config"
+	lunar_context "lunar/engine/streams/lunar-context"
+	publictypes "lunar/engine/streams/public-types"
+	"lunar/engine/streams/resources"
+	quotaresource "lunar/engine/streams/resources/quota"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestResources(t *testing.T, quotaID string, limit int64) publictypes.ResourceManagementI {
+	resourceManagement, err := resources.NewResourceManagement()
+	require.NoError(t, err)
+	resourceManagement, err = resourceManagement.WithQuotaData(
+		[]*quotaresource.QuotaResourceData{
+			{
+				Quotas: []*quotaresource.QuotaConfig{
+					{
+						ID:     quotaID,
+						Filter: &stream_config.Filter{Name: quotaID, URL: "api.example.com/*"},
+						Strategy: &quotaresource.StrategyConfig{
+							FixedWindow: &quotaresource.FixedWindowConfig{
+								QuotaLimit: quotaresource.QuotaLimit{
+									Max:          limit,
+									Interval:     1,
+									IntervalUnit: "minute",
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	require.NoError(t, err)
+	return resourceManagement
+}
+
+func execute(
+	t *testing.T,
+	processor streamtypes.ProcessorI,
+	apiStream publictypes.APIStreamI,
+) *actions.EarlyResponseAction {
+	output, err := processor.Execute("flow", apiStream)
+	require.NoError(t, err)
+	earlyResponse, ok := output.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	return earlyResponse
+}
+
+func TestGenerateResponseStaticValuesAreNotTemplated(t *testing.T) {
+	processor, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "static",
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			"status":       503,
+			"body":         "Service Unavailable",
+			"Content-Type": "text/plain",
+		}),
+	})
+	require.NoError(t, err)
+
+	apiStream := streamtypes.NewRequestAPIStream(
+		lunar_messages.OnRequest{ID: "static-1"}, lunar_context.NewMemoryState[[]byte]())
+	response := execute(t, processor, apiStream)
+
+	require.Equal(t, 503, response.Status)
+	require.Equal(t, "Service Unavailable", response.Body)
+	require.Equal(t, map[string]string{"Content-Type": "text/plain"}, response.Headers)
+}
+
+func TestGenerateResponseTemplatedErrorEnvelope(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	quotaID := "TestGenerateResponseTemplatedErrorEnvelope"
+	resourceManagement := newTestResources(t, quotaID, 10)
+
+	processor, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name:      "envelope",
+		Resources: resourceManagement,
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			"status": 429,
+			"body": `{"error":"rate_limited","request_id":{{ json .Request.ID }},` +
+				`"user":{{ json (.JSONPath "$.request.body.user") }},` +
+				`"remaining":{{ .Quota.Remaining }},"tier":"{{ .Flow "tier" }}"}`,
+			"Content-Type": "application/json",
+			"headers": map[string]interface{}{
+				"X-RateLimit-Limit":     "{{ .Quota.Limit }}",
+				"X-RateLimit-Remaining": "{{ .Quota.Remaining }}",
+				"X-Request-Path":        "{{ .Request.Path }}",
+			},
+			"quota_id":  quotaID,
+			"templated": true,
+		}),
+	})
+	require.NoError(t, err)
+
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	require.NoError(t, lunarContext.GetFlowContext().Set("tier::envelope-1", "gold"))
+
+	apiStream := streamtypes.NewRequestAPIStream(
+		lunar_messages.OnRequest{
+			ID:      "envelope-1",
+			Method:  "POST",
+			URL:     "api.example.com/v1/items",
+			Path:    "/v1/items",
+			RawBody: []byte(`{"user":"alice"}`),
+			Headers: map[string]string{"Content-Type": "application/json"},
+		},
+		lunar_context.NewMemoryState[[]byte](),
+	).WithLunarContext(lunarContext)
+
+	// Consume 3 units of the quota, including the current request
+	for _, reqID := range []string{"previous-1", "previous-2", "envelope-1"} {
+		quota, err := resourceManagement.GetQuota(quotaID, reqID)
+		require.NoError(t, err)
+		require.NoError(t, quota.Inc(streamtypes.NewRequestAPIStream(
+			lunar_messages.OnRequest{ID: reqID}, lunar_context.NewMemoryState[[]byte]())))
+	}
+
+	response := execute(t, processor, apiStream)
+	require.Equal(t, 429, response.Status)
+	require.JSONEq(t,
+		`{"error":"rate_limited","request_id":"envelope-1","user":"alice","remaining":7,"tier":"gold"}`,
+		response.Body)
+	require.Equal(t, "10", response.Headers["X-RateLimit-Limit"])
+	require.Equal(t, "7", response.Headers["X-RateLimit-Remaining"])
+	require.Equal(t, "/v1/items", response.Headers["X-Request-Path"])
+	require.Equal(t, "application/json", response.Headers["Content-Type"])
+}
+
+func TestGenerateResponseInvalidTemplate(t *testing.T) {
+	_, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "invalid",
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			"body":      "{{ .Request.ID ",
+			"templated": true,
+		}),
+	})
+	require.Error(t, err)
+}
+
+func TestGenerateResponseTemplateActionsAreLiteralUnlessTemplated(t *testing.T) {
+	mustacheBody := `{"greeting":"Hello {{name}}","id":"{{ .Request.ID }}"}`
+	processor, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "mustache",
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			"body":       mustacheBody,
+			"X-Template": "{{ .Request.ID }}",
+		}),
+	})
+	require.NoError(t, err)
+
+	apiStream := streamtypes.NewRequestAPIStream(
+		lunar_messages.OnRequest{ID: "mustache-1"}, lunar_context.NewMemoryState[[]byte]())
+	response := execute(t, processor, apiStream)
+
+	require.Equal(t, mustacheBody, response.Body)
+	require.Equal(t, "{{ .Request.ID }}", response.Headers["X-Template"])
+}
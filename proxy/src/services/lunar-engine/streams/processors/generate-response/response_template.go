@@ -0,0 +1,147 @@
+package processorgenerateresponse
+
+import (
+	"encoding/json"
+	"fmt"
+	"lunar/engine/streams/processors/utils"
+	publictypes "lunar/engine/streams/public-types"
+	"lunar/engine/streams/stream"
+	"lunar/toolkit-core/jsonpath"
+	"strings"
+	"text/template"
+)
+
+var templateFuncs = template.FuncMap{
+	"json": toJSON,
+}
+
+// templateData is the data available to templated bodies and headers
+type templateData struct {
+	Request requestData
+	Quota   quotaData
+	Blocked utils.BlockedInfo
+	Errors  []utils.ValidationError
+
+	apiStream publictypes.APIStreamI
+	object    map[string]interface{}
+}
+
+type requestData struct {
+	ID      string
+	Method  string
+	URL     string
+	Host    string
+	Path    string
+	Query   string
+	Headers map[string]string
+	Body    string
+}
+
+type quotaData struct {
+	ID        string
+	Used      int64
+	Limit     int64
+	Remaining int64
+	// ResetIn is the amount of seconds until the quota resets
+	ResetIn int64
+}
+
+func newTemplateData(apiStream publictypes.APIStreamI) *templateData {
+	data := &templateData{apiStream: apiStream}
+	if request := apiStream.GetRequest(); request != nil {
+		data.Request = requestData{
+			ID:      request.GetID(),
+			Method:  request.GetMethod(),
+			URL:     request.GetURL(),
+			Host:    request.GetHost(),
+			Path:    request.GetPath(),
+			Query:   request.GetQuery(),
+			Headers: request.GetHeaders(),
+			Body:    request.GetBody(),
+		}
+	}
+	return data
+}
+
+// JSONPath evaluates a JSON path against the API stream,
+// e.g. {{ .JSONPath "$.request.body.user_id" }}
+func (td *templateData) JSONPath(path string) (interface{}, error) {
+	if td.object == nil {
+		td.object = stream.AsObject(td.apiStream)
+	}
+	value, err := jsonpath.GetJSONPathValue(td.object, path)
+	if err != nil {
+		return nil, err
+	}
+	// query params are stored as arrays
+	if values, ok := value.([]interface{}); ok && len(values) == 1 {
+		return values[0], nil
+	}
+	return value, nil
+}
+
+// Flow returns a value which was published into the flow context by a preceding processor.
+// Values stored for the current transaction take precedence over flow wide values.
+func (td *templateData) Flow(key string) interface{} {
+	lunarContext := td.apiStream.GetContext()
+	if lunarContext == nil || lunarContext.GetFlowContext() == nil {
+		return nil
+	}
+	flowContext := lunarContext.GetFlowContext()
+
+	if value, err := flowContext.Get(fmt.Sprintf("%s::%s", key, td.apiStream.GetID())); err == nil {
+		return value
+	}
+	if value, err := flowContext.Get(key); err == nil {
+		return value
+	}
+	return nil
+}
+
+func toJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// responseTemplate renders a response value,
+// values which are not templated or without template actions are returned as is
+type responseTemplate struct {
+	raw      string
+	template *template.Template
+}
+
+func newResponseTemplate(name, raw string, templated bool) (*responseTemplate, error) {
+	responseTmpl := &responseTemplate{raw: raw}
+	if !templated || !strings.Contains(raw, "{{") {
+		return responseTmpl, nil
+	}
+
+	parsed, err := template.New(name).
+		Option("missingkey=zero").
+		Funcs(templateFuncs).
+		Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template of %s: %w", name, err)
+	}
+	responseTmpl.template = parsed
+	return responseTmpl, nil
+}
+
+func (rt *responseTemplate) isTemplated() bool {
+	return rt.template != nil
+}
+
+func (rt *responseTemplate) render(data *templateData) (string, error) {
+	if !rt.isTemplated() {
+		return rt.raw, nil
+	}
+
+	var rendered strings.Builder
+	if err := rt.template.Execute(&rendered, data); err != nil {
+		return rt.raw, err
+	}
+	return rendered.String(), nil
+}
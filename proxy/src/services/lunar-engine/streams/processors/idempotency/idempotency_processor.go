@@ -0,0 +1,444 @@
+package processoridempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	lunar_metrics "lunar/engine/metrics"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/clock"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/otel"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	keyHeaderParam     = "key_header"
+	keyPartsParam      = "key_parts"
+	ttlParam           = "ttl_seconds"
+	inProgressTTLParam = "in_progress_ttl_seconds"
+
+	forwardedConditionName = "forwarded"
+	replayedConditionName  = "replayed"
+	conflictConditionName  = "conflict"
+
+	defaultKeyHeader     = "Idempotency-Key"
+	defaultTTL           = 24 * time.Hour
+	defaultInProgressTTL = time.Minute
+
+	// ReplayedHeader is set on the stored responses served to duplicate requests
+	ReplayedHeader = "Idempotent-Replayed"
+
+	requestsMetric = lunar_metrics.MetricPrefix + "idempotency_processor_requests"
+
+	outcomeAttribute = "outcome"
+)
+
+// idempotencyProcessor forwards the first request of each idempotency key and stores
+// its response, which duplicate requests are answered with until the TTL expires.
+// Duplicates arriving while the first request is in progress are answered with a conflict.
+type idempotencyProcessor struct {
+	name          string
+	keyHeader     string
+	keyParts      []string
+	ttl           time.Duration
+	inProgressTTL time.Duration
+
+	// responses holds the stored response of each completed key
+	responses public_types.SharedStateI[[]byte]
+	// locks holds the in-progress claim of each key, a set with the expiry time of the claim
+	locks public_types.SharedStateI[string]
+	// owners holds the key claimed by each request, until its response arrives
+	owners public_types.SharedStateI[string]
+
+	responsesCollector *lunar_context.ExpireWatcher[[]byte]
+	locksCollector     *lunar_context.ExpireWatcher[string]
+	ownersCollector    *lunar_context.ExpireWatcher[string]
+
+	clock         clock.Clock
+	metaData      *streamtypes.ProcessorMetaData
+	labelManager  *lunar_metrics.LabelManager
+	metricObjects map[string]metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &idempotencyProcessor{
+		name:          metaData.Name,
+		metaData:      metaData,
+		keyHeader:     defaultKeyHeader,
+		ttl:           defaultTTL,
+		inProgressTTL: defaultInProgressTTL,
+		responses:     lunar_context.NewSharedState[[]byte](),
+		locks:         lunar_context.NewSharedState[string](),
+		owners:        lunar_context.NewMemoryState[string](),
+		clock:         context_manager.Get().GetClock(),
+		metricObjects: make(map[string]metric.Int64Counter),
+		labelManager:  lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+	proc.responsesCollector = lunar_context.NewExpireWatcher(proc.responses.Pop, proc.clock)
+	proc.locksCollector = lunar_context.NewExpireWatcher(proc.locks.Pop, proc.clock)
+	proc.ownersCollector = lunar_context.NewExpireWatcher(proc.owners.Pop, proc.clock)
+
+	err := proc.initializeMetrics()
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *idempotencyProcessor) GetName() string {
+	return p.name
+}
+
+func (p *idempotencyProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired: true,
+	}
+}
+
+func (p *idempotencyProcessor) Execute(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	if apiStream.GetType() == public_types.StreamTypeRequest {
+		return p.onRequest(flowName, apiStream), nil
+	} else if apiStream.GetType() == public_types.StreamTypeResponse {
+		return p.onResponse(apiStream), nil
+	}
+	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+}
+
+func (p *idempotencyProcessor) init() error {
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		keyHeaderParam,
+		&p.keyHeader); err != nil {
+		log.Trace().Msgf("key_header not defined for %v", p.name)
+	}
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		keyPartsParam,
+		&p.keyParts); err != nil {
+		log.Trace().Msgf("key_parts not defined for %v", p.name)
+	}
+
+	if p.keyHeader == "" && len(p.keyParts) == 0 {
+		return fmt.Errorf("either %v or %v must be defined", keyHeaderParam, keyPartsParam)
+	}
+
+	var err error
+	if p.ttl, err = p.extractDurationParam(ttlParam, p.ttl); err != nil {
+		return err
+	}
+	p.inProgressTTL, err = p.extractDurationParam(inProgressTTLParam, p.inProgressTTL)
+	return err
+}
+
+func (p *idempotencyProcessor) extractDurationParam(
+	paramName string,
+	defaultValue time.Duration,
+) (time.Duration, error) {
+	var seconds int64
+	if err := utils.ExtractInt64Param(p.metaData.Parameters,
+		paramName,
+		&seconds); err != nil {
+		log.Trace().Msgf("%s not defined for %v", paramName, p.name)
+		return defaultValue, nil
+	}
+
+	if seconds <= 0 {
+		return 0, fmt.Errorf("%v must be positive", paramName)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (p *idempotencyProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meterObj, err := otel.GetMeter().Int64Counter(
+		requestsMetric,
+		metric.WithDescription("Requests with an idempotency key, by outcome"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+	p.metricObjects[requestsMetric] = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *idempotencyProcessor) updateMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	outcome string,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	attributes = append(attributes, attribute.String(outcomeAttribute, outcome))
+	p.metricObjects[requestsMetric].Add(context.Background(), 1,
+		metric.WithAttributes(attributes...))
+}
+
+// onRequest replays the stored response of a completed key, rejects duplicates of a key
+// in progress, and claims the key for the request otherwise
+func (p *idempotencyProcessor) onRequest(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	forwarded := streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		Name:      forwardedConditionName,
+		ReqAction: &actions.NoOpAction{},
+	}
+
+	idempotencyKey, found := p.getIdempotencyKey(flowName, apiStream)
+	if !found {
+		log.Trace().Msgf("No idempotency key for request %s", apiStream.GetID())
+		return forwarded
+	}
+
+	if replayed, found := p.replay(flowName, idempotencyKey, apiStream); found {
+		return replayed
+	}
+
+	if !p.claim(idempotencyKey) {
+		log.Trace().Msgf("Request %s is a duplicate of an in-progress request with key %s",
+			apiStream.GetID(), idempotencyKey)
+		p.updateMetrics(flowName, apiStream, conflictConditionName)
+		return streamtypes.ProcessorIO{
+			Type:      public_types.StreamTypeResponse,
+			Name:      conflictConditionName,
+			ReqAction: buildConflictResponse(),
+		}
+	}
+
+	// the key may have completed between the lookup and the claim
+	if replayed, found := p.replay(flowName, idempotencyKey, apiStream); found {
+		p.release(idempotencyKey)
+		return replayed
+	}
+
+	// the claim is useless once it expired, so is the owner of a response which never arrived
+	ownerKey := p.getOwnerKey(apiStream)
+	if err := p.owners.Set(ownerKey, idempotencyKey); err != nil {
+		log.Debug().Err(err).Msgf("Failed to set idempotency key of request %s", apiStream.GetID())
+		p.release(idempotencyKey)
+	} else {
+		p.ownersCollector.AddKey(ownerKey, p.inProgressTTL)
+	}
+
+	p.updateMetrics(flowName, apiStream, forwardedConditionName)
+	return forwarded
+}
+
+// onResponse stores the response of a request which claimed its key and releases the key.
+// Responses which may succeed when retried are not stored, so a Retry processor
+// or the client can retry the request with the same key.
+func (p *idempotencyProcessor) onResponse(
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	passThrough := streamtypes.ProcessorIO{
+		Type:       public_types.StreamTypeResponse,
+		RespAction: &actions.NoOpAction{},
+	}
+
+	idempotencyKey, err := p.owners.Pop(p.getOwnerKey(apiStream))
+	if err != nil {
+		return passThrough
+	}
+	defer p.release(idempotencyKey)
+
+	response := apiStream.GetResponse()
+	if response == nil || isRetryableStatus(response.GetStatus()) {
+		log.Trace().Msgf("Response of key %s is not stored", idempotencyKey)
+		return passThrough
+	}
+
+	entry, err := utils.BuildSharedMemoryTTLEntry(int64(p.ttl.Seconds()), response)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to build stored response of key %s", idempotencyKey)
+		return passThrough
+	}
+	if err := p.responses.Set(idempotencyKey, entry); err != nil {
+		log.Warn().Err(err).Msgf("Failed to store response of key %s", idempotencyKey)
+		return passThrough
+	}
+	p.responsesCollector.AddKey(idempotencyKey, p.ttl)
+	return passThrough
+}
+
+// getIdempotencyKey returns the key of the request, taken from the key header
+// or derived from the key parts when the header is missing
+func (p *idempotencyProcessor) getIdempotencyKey(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (string, bool) {
+	if p.keyHeader != "" {
+		if value := utils.GetHeaderValue(apiStream.GetHeaders(), p.keyHeader); value != "" {
+			return fmt.Sprintf("%s_%s_%s", flowName, p.name, value), true
+		}
+	}
+
+	if len(p.keyParts) == 0 {
+		return "", false
+	}
+
+	idempotencyKey, err := utils.BuildSharedMemoryKey(fmt.Sprintf("%s_%s", flowName, p.name),
+		p.keyParts, apiStream)
+	if err != nil {
+		log.Trace().Err(err).Msgf("Failed to build idempotency key for %s", p.name)
+		return "", false
+	}
+	return idempotencyKey, true
+}
+
+// replay returns the stored response of the key, if it did not expire
+func (p *idempotencyProcessor) replay(
+	flowName string,
+	idempotencyKey string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, bool) {
+	storedBytes, _ := p.responses.Get(idempotencyKey)
+	if len(storedBytes) == 0 {
+		return streamtypes.ProcessorIO{}, false
+	}
+
+	entry, err := utils.ParseSharedMemoryTTLEntry(storedBytes)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to parse stored response of key %s", idempotencyKey)
+		return streamtypes.ProcessorIO{}, false
+	}
+	if !entry.IsAlive() {
+		_, _ = p.responses.Pop(idempotencyKey)
+		return streamtypes.ProcessorIO{}, false
+	}
+
+	content, err := entry.GetContent()
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to read stored response of key %s", idempotencyKey)
+		return streamtypes.ProcessorIO{}, false
+	}
+	var onResponse lunar_messages.OnResponse
+	if err := json.Unmarshal(content, &onResponse); err != nil {
+		log.Warn().Err(err).Msgf("Failed to parse stored response of key %s", idempotencyKey)
+		return streamtypes.ProcessorIO{}, false
+	}
+
+	log.Trace().Msgf("Replaying stored response of key %s", idempotencyKey)
+	p.updateMetrics(flowName, apiStream, replayedConditionName)
+
+	headers := maps.Clone(onResponse.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[ReplayedHeader] = "true"
+	return streamtypes.ProcessorIO{
+		Type: public_types.StreamTypeResponse,
+		Name: replayedConditionName,
+		ReqAction: &actions.EarlyResponseAction{
+			Status:  onResponse.Status,
+			Body:    onResponse.Body,
+			Headers: headers,
+		},
+	}, true
+}
+
+// claim marks the key as in progress, returns false if it is already in progress.
+// Claims expire after in_progress_ttl_seconds, in case the response never arrives.
+func (p *idempotencyProcessor) claim(idempotencyKey string) bool {
+	now := p.clock.Now()
+	expiresAt := strconv.FormatInt(now.Add(p.inProgressTTL).UnixNano(), 10)
+	for range 2 {
+		claimed, err := p.locks.AtomicSAddWithMaxValuesAllowed(idempotencyKey, expiresAt, 1)
+		if err != nil {
+			return false
+		}
+		if claimed {
+			p.locksCollector.AddKey(idempotencyKey, p.inProgressTTL)
+			return true
+		}
+		// the key can be claimed again once the previous claim expired
+		if !p.removeExpiredClaims(idempotencyKey, now) {
+			return false
+		}
+	}
+	return false
+}
+
+// removeExpiredClaims removes the claims of the key which expired,
+// returns false if there were none
+func (p *idempotencyProcessor) removeExpiredClaims(idempotencyKey string, now time.Time) bool {
+	claims, err := p.locks.SMembers(idempotencyKey)
+	if err != nil {
+		return false
+	}
+
+	removed := false
+	for _, claim := range claims {
+		expiresAt, err := strconv.ParseInt(claim, 10, 64)
+		if err == nil && now.UnixNano() < expiresAt {
+			continue
+		}
+		if err := p.locks.SRem(idempotencyKey, claim); err == nil {
+			removed = true
+		}
+	}
+	return removed
+}
+
+// release removes the claim of the key, so the lock is not kept once the response is stored
+func (p *idempotencyProcessor) release(idempotencyKey string) {
+	_, _ = p.locks.Pop(idempotencyKey)
+}
+
+// isRetryableStatus returns true for the responses which may succeed when the request is retried
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout,
+		http.StatusConflict,
+		http.StatusTooEarly,
+		http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+func (p *idempotencyProcessor) getOwnerKey(apiStream public_types.APIStreamI) string {
+	return fmt.Sprintf("%s::%s", p.name, apiStream.GetSequenceID())
+}
+
+func buildConflictResponse() *actions.EarlyResponseAction {
+	return &actions.EarlyResponseAction{
+		Status: http.StatusConflict,
+		Body:   `{"error":"A request with the same idempotency key is in progress"}`,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	}
+}
@@ -0,0 +1,235 @@
+package processoridempotency
+
+import (
+	"fmt"
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	processorretry "lunar/engine/streams/processors/retry"
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/clock"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProcessor(t *testing.T, params map[string]any) *idempotencyProcessor {
+	proc, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name:       "Idempotency",
+		Parameters: test_utils.NewProcessorParams(params),
+	})
+	require.NoError(t, err)
+	return proc.(*idempotencyProcessor)
+}
+
+func newLunarContext() public_types.LunarContextI {
+	return lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+}
+
+func newRequestStream(
+	lunarContext public_types.LunarContextI,
+	id string,
+	headers map[string]string,
+	body string,
+) public_types.APIStreamI {
+	return streamtypes.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:         id,
+		SequenceID: id,
+		Method:     "POST",
+		URL:        "api.example.com/payments",
+		Headers:    headers,
+		RawBody:    []byte(body),
+	}, lunar_context.NewMemoryState[[]byte]()).WithLunarContext(lunarContext)
+}
+
+func newResponseStream(
+	lunarContext public_types.LunarContextI,
+	id string,
+	status int,
+	body string,
+) public_types.APIStreamI {
+	return streamtypes.NewResponseAPIStream(lunar_messages.OnResponse{
+		ID:         id,
+		SequenceID: id,
+		Method:     "POST",
+		URL:        "api.example.com/payments",
+		Status:     status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		RawBody:    []byte(body),
+	}, lunar_context.NewMemoryState[[]byte]()).WithLunarContext(lunarContext)
+}
+
+func execute(
+	t *testing.T,
+	proc *idempotencyProcessor,
+	apiStream public_types.APIStreamI,
+) streamtypes.ProcessorIO {
+	output, err := proc.Execute("flow", apiStream)
+	require.NoError(t, err)
+	return output
+}
+
+func TestIdempotencyReplaysCompletedRequests(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	proc := newTestProcessor(t, map[string]any{ttlParam: 60})
+	lunarContext := newLunarContext()
+	keyHeaders := map[string]string{"idempotency-key": "payment-1"}
+
+	output := execute(t, proc, newRequestStream(lunarContext, "txn-1", keyHeaders, ""))
+	require.Equal(t, forwardedConditionName, output.Name)
+
+	// a duplicate of a request in progress
+	output = execute(t, proc, newRequestStream(lunarContext, "txn-2", keyHeaders, ""))
+	require.Equal(t, conflictConditionName, output.Name)
+	require.Equal(t, http.StatusConflict, output.ReqAction.(*actions.EarlyResponseAction).Status)
+
+	execute(t, proc, newResponseStream(lunarContext, "txn-1", 201, `{"id":"p1"}`))
+
+	output = execute(t, proc, newRequestStream(lunarContext, "txn-3", keyHeaders, ""))
+	require.Equal(t, replayedConditionName, output.Name)
+	replayed := output.ReqAction.(*actions.EarlyResponseAction)
+	require.Equal(t, 201, replayed.Status)
+	require.Equal(t, `{"id":"p1"}`, replayed.Body)
+	require.Equal(t, "true", replayed.Headers[ReplayedHeader])
+
+	// other keys and requests without a key are forwarded
+	output = execute(t, proc, newRequestStream(lunarContext, "txn-4",
+		map[string]string{"Idempotency-Key": "payment-2"}, ""))
+	require.Equal(t, forwardedConditionName, output.Name)
+	output = execute(t, proc, newRequestStream(lunarContext, "txn-5", nil, ""))
+	require.Equal(t, forwardedConditionName, output.Name)
+
+	// the stored response expires
+	mockClock.AdvanceTime(61 * time.Second)
+	output = execute(t, proc, newRequestStream(lunarContext, "txn-6", keyHeaders, ""))
+	require.Equal(t, forwardedConditionName, output.Name)
+}
+
+func TestIdempotencyDoesNotStoreProviderErrors(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	proc := newTestProcessor(t, nil)
+	lunarContext := newLunarContext()
+	keyHeaders := map[string]string{"Idempotency-Key": "payment-1"}
+
+	execute(t, proc, newRequestStream(lunarContext, "txn-1", keyHeaders, ""))
+	execute(t, proc, newResponseStream(lunarContext, "txn-1", 503, `{"error":"unavailable"}`))
+
+	output := execute(t, proc, newRequestStream(lunarContext, "txn-2", keyHeaders, ""))
+	require.Equal(t, forwardedConditionName, output.Name)
+}
+
+func TestIdempotencyInProgressExpires(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	proc := newTestProcessor(t, map[string]any{inProgressTTLParam: 5})
+	lunarContext := newLunarContext()
+	keyHeaders := map[string]string{"Idempotency-Key": "payment-1"}
+
+	execute(t, proc, newRequestStream(lunarContext, "txn-1", keyHeaders, ""))
+	mockClock.AdvanceTime(6 * time.Second)
+
+	output := execute(t, proc, newRequestStream(lunarContext, "txn-2", keyHeaders, ""))
+	require.Equal(t, forwardedConditionName, output.Name)
+}
+
+func TestIdempotencyLetsRetryProcessorRetryRetryableResponses(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	t.Setenv(environment.LuaRetryRequestTimeoutSecEnvVar, "100")
+	proc := newTestProcessor(t, nil)
+	retry, err := processorretry.NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "Retry",
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			"attempts":                          2,
+			"cooldown_between_attempts_seconds": 0,
+			"cooldown_multiplier":               0,
+			"maximum_cooldown_seconds":          0,
+		}),
+		Clock: clock.NewRealClock(),
+	})
+	require.NoError(t, err)
+
+	lunarContext := newLunarContext()
+	keyHeaders := map[string]string{"Idempotency-Key": "payment-1"}
+
+	// the response flow stores the response, then lets the Retry processor retry it
+	respond := func(id string, status int, body string) streamtypes.ProcessorIO {
+		response := newResponseStream(lunarContext, id, status, body)
+		execute(t, proc, response)
+		output, err := retry.Execute("flow", response)
+		require.NoError(t, err)
+		return output
+	}
+
+	for _, status := range []int{408, 425, 429, 503} {
+		id := fmt.Sprintf("txn-%d", status)
+		output := execute(t, proc, newRequestStream(lunarContext, id, keyHeaders, ""))
+		require.Equal(t, forwardedConditionName, output.Name, status)
+
+		output = respond(id, status, `{"error":"try again"}`)
+		require.Equal(t, "retry", output.Name, status)
+	}
+
+	// the retried request is forwarded again, and its successful response is stored
+	output := execute(t, proc, newRequestStream(lunarContext, "txn-201", keyHeaders, ""))
+	require.Equal(t, forwardedConditionName, output.Name)
+	respond("txn-201", 201, `{"id":"p1"}`)
+
+	output = execute(t, proc, newRequestStream(lunarContext, "txn-duplicate", keyHeaders, ""))
+	require.Equal(t, replayedConditionName, output.Name)
+	require.Equal(t, 201, output.ReqAction.(*actions.EarlyResponseAction).Status)
+}
+
+func TestIdempotencyRemovesRequestStateOnResponse(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	proc := newTestProcessor(t, nil)
+	lunarContext := newLunarContext()
+	keyHeaders := map[string]string{"Idempotency-Key": "payment-1"}
+
+	request := newRequestStream(lunarContext, "txn-1", keyHeaders, "")
+	execute(t, proc, request)
+	require.True(t, proc.owners.Exists(proc.getOwnerKey(request)))
+
+	execute(t, proc, newResponseStream(lunarContext, "txn-1", 201, `{"id":"p1"}`))
+	require.False(t, proc.owners.Exists(proc.getOwnerKey(request)))
+
+	idempotencyKey := "flow_Idempotency_payment-1"
+	require.True(t, proc.responses.Exists(idempotencyKey))
+	// the claim was removed, so the key can be claimed again
+	require.True(t, proc.claim(idempotencyKey))
+}
+
+func TestIdempotencyKeyDerivedFromBody(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	proc := newTestProcessor(t, map[string]any{
+		keyHeaderParam: "",
+		keyPartsParam:  []string{"$.request.body"},
+	})
+	lunarContext := newLunarContext()
+
+	execute(t, proc, newRequestStream(lunarContext, "txn-1", nil, `{"amount":10}`))
+	execute(t, proc, newResponseStream(lunarContext, "txn-1", 200, `{"id":"p1"}`))
+
+	output := execute(t, proc, newRequestStream(lunarContext, "txn-2", nil, `{"amount":10}`))
+	require.Equal(t, replayedConditionName, output.Name)
+	output = execute(t, proc, newRequestStream(lunarContext, "txn-3", nil, `{"amount":20}`))
+	require.Equal(t, forwardedConditionName, output.Name)
+}
+
+func TestIdempotencyInvalidParameters(t *testing.T) {
+	for _, params := range []map[string]any{
+		{keyHeaderParam: ""},
+		{ttlParam: 0},
+		{inProgressTTLParam: -1},
+	} {
+		_, err := NewProcessor(&streamtypes.ProcessorMetaData{
+			Name:       "Idempotency",
+			Parameters: test_utils.NewProcessorParams(params),
+		})
+		require.Error(t, err)
+	}
+}
@@ -3,6 +3,7 @@ package processorlimiter
 import (
 	"context"
 	"fmt"
+	"lunar/engine/actions"
 	"lunar/engine/streams/processors/utils"
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
@@ -19,8 +20,13 @@ const (
 	belowQuotaConditionName = "below_limit"
 	aboveQuotaConditionName = "above_limit"
 
-	belowCountMetric = "lunar_limiter_processor_below_count"
-	aboveCountMetric = "lunar_limiter_processor_above_count"
+	belowCountMetric   = "lunar_limiter_processor_below_count"
+	aboveCountMetric   = "lunar_limiter_processor_above_count"
+	overageCountMetric = "lunar_limiter_processor_overage_count"
+
+	// Requests allowed above a soft limit are tagged with this header and context key
+	QuotaOverageHeader     = "x-lunar-quota-overage"
+	QuotaOverageContextKey = utils.QuotaOverageContextKey
 )
 
 type limiterProcessor struct {
@@ -68,6 +74,10 @@ func (p *limiterProcessor) GetName() string {
 	return p.name
 }
 
+func (p *limiterProcessor) GetQuotaID() string {
+	return p.quotaID
+}
+
 func (p *limiterProcessor) Execute(
 	flowName string,
 	apiStream publictypes.APIStreamI,
@@ -93,18 +103,71 @@ func (p *limiterProcessor) Execute(
 	}
 
 	condition := aboveQuotaConditionName
+	var reqAction actions.ReqLunarAction
 	if isAllowed {
 		condition = belowQuotaConditionName
+		reqAction = p.handleOverage(quota, flowName, apiStream)
+	} else {
+		p.publishBlockedInfo(quota, apiStream)
 	}
 
 	p.updateMetrics(condition, flowName, apiStream)
 
 	return streamtypes.ProcessorIO{
-		Type: apiStream.GetType(),
-		Name: condition,
+		Type:      apiStream.GetType(),
+		Name:      condition,
+		ReqAction: reqAction,
 	}, nil
 }
 
+// handleOverage tags requests which were allowed above a soft limit
+func (p *limiterProcessor) handleOverage(
+	quota publictypes.QuotaResourceI,
+	flowName string,
+	apiStream publictypes.APIStreamI,
+) actions.ReqLunarAction {
+	overageQuota, ok := quota.(publictypes.QuotaOverageI)
+	if !ok {
+		return nil
+	}
+
+	isOverage, err := overageQuota.IsOverage(apiStream)
+	if err != nil {
+		log.Debug().Err(err).Msgf("failed to check quota overage for %s", p.name)
+		return nil
+	}
+	if !isOverage {
+		return nil
+	}
+
+	if err := utils.SetQuotaOverage(apiStream, p.quotaID); err != nil {
+		log.Trace().Err(err).Msgf("failed to set quota overage flag for %s", p.name)
+	}
+	p.updateOverageMetric(flowName, apiStream)
+
+	return &actions.ModifyHeadersAction{
+		HeadersToSet: map[string]string{QuotaOverageHeader: p.quotaID},
+	}
+}
+
+// publishBlockedInfo lets following processors know when the quota will allow requests again
+func (p *limiterProcessor) publishBlockedInfo(
+	quota publictypes.QuotaResourceI,
+	apiStream publictypes.APIStreamI,
+) {
+	resetIn := utils.GetQuotaResetIn(quota, apiStream)
+	info := utils.NewBlockedInfo(
+		utils.BlockedReasonQuotaExceeded,
+		p.quotaID,
+		resetIn,
+		resetIn,
+		p.metaData.GetClock().Now(),
+	)
+	if err := utils.SetBlockedInfo(apiStream, info); err != nil {
+		log.Trace().Err(err).Msgf("failed to publish blocked info for %s", p.name)
+	}
+}
+
 func (p *limiterProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{}
 }
@@ -131,6 +194,13 @@ func (p *limiterProcessor) initializeMetrics() error {
 	}
 	p.metricObjects[aboveCountMetric] = meterObj
 
+	meterObj, err = meter.Float64Counter(overageCountMetric,
+		metric.WithDescription(fmt.Sprintf("Limiter overage count for %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize overage count metric: %w", err)
+	}
+	p.metricObjects[overageCountMetric] = meterObj
+
 	log.Info().Msgf("Metrics initialized for %s", p.name)
 	return nil
 }
@@ -158,3 +228,19 @@ func (p *limiterProcessor) updateMetrics(
 
 	log.Trace().Msgf("Metrics updated for %s", p.name)
 }
+
+func (p *limiterProcessor) updateOverageMetric(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	metricObj, ok := p.metricObjects[overageCountMetric]
+	if !ok {
+		return
+	}
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	metricObj.Add(context.Background(), 1, metric.WithAttributes(attributes...))
+}
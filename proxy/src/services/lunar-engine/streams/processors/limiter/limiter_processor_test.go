@@ -0,0 +1,107 @@
+package processorlimiter
+
+import (
+	"fmt"
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	stream_config "lunar/engine/streams/config"
+	lunar_context "lunar/engine/streams/lunar-context"
+	processorgenerateresponse "lunar/engine/streams/processors/generate-response"
+	"lunar/engine/streams/processors/utils"
+	publictypes "lunar/engine/streams/public-types"
+	"lunar/engine/streams/resources"
+	quotaresource "lunar/engine/streams/resources/quota"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterOverageFlagIsReadByFollowingProcessor(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	quotaID := "TestLimiterOverageFlagIsReadByFollowingProcessor"
+
+	resourceManagement, err := resources.NewResourceManagement()
+	require.NoError(t, err)
+	resourceManagement, err = resourceManagement.WithQuotaData(
+		[]*quotaresource.QuotaResourceData{
+			{
+				Quotas: []*quotaresource.QuotaConfig{
+					{
+						ID:     quotaID,
+						Filter: &stream_config.Filter{Name: quotaID, URL: "api.example.com/*"},
+						Strategy: &quotaresource.StrategyConfig{
+							FixedWindow: &quotaresource.FixedWindowConfig{
+								QuotaLimit: quotaresource.QuotaLimit{
+									Max:          1,
+									Interval:     1,
+									IntervalUnit: "minute",
+								},
+								SoftLimit: &quotaresource.SoftLimitConfig{HardCeiling: 2},
+							},
+						},
+					},
+				},
+			},
+		})
+	require.NoError(t, err)
+
+	limiter, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name:       "limiter",
+		Resources:  resourceManagement,
+		Parameters: test_utils.NewProcessorParams(map[string]any{quotaIDArg: quotaID}),
+	})
+	require.NoError(t, err)
+
+	generateResponse, err := processorgenerateresponse.NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "overage_response",
+		Parameters: test_utils.NewProcessorParams(map[string]any{
+			"body":      `{{ .Flow "quota_overage" }}`,
+			"templated": true,
+		}),
+	})
+	require.NoError(t, err)
+
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	newStream := func(index int) publictypes.APIStreamI {
+		return streamtypes.NewRequestAPIStream(
+			lunar_messages.OnRequest{
+				ID:     fmt.Sprintf("overage-%d", index),
+				Method: "GET",
+				URL:    "api.example.com/v1/items",
+			},
+			lunar_context.NewMemoryState[[]byte](),
+		).WithLunarContext(lunarContext)
+	}
+
+	// Within the limit - not flagged
+	withinLimit := newStream(1)
+	output, err := limiter.Execute("flow", withinLimit)
+	require.NoError(t, err)
+	require.Equal(t, belowQuotaConditionName, output.Name)
+	require.Nil(t, output.ReqAction)
+	_, found := utils.GetQuotaOverage(withinLimit)
+	require.False(t, found)
+
+	// Above the soft limit - allowed, tagged with the header and flagged in the flow context
+	aboveSoftLimit := newStream(2)
+	output, err = limiter.Execute("flow", aboveSoftLimit)
+	require.NoError(t, err)
+	require.Equal(t, belowQuotaConditionName, output.Name)
+	modifyHeaders, ok := output.ReqAction.(*actions.ModifyHeadersAction)
+	require.True(t, ok)
+	require.Equal(t, quotaID, modifyHeaders.HeadersToSet[QuotaOverageHeader])
+
+	output, err = generateResponse.Execute("flow", aboveSoftLimit)
+	require.NoError(t, err)
+	earlyResponse, ok := output.ReqAction.(*actions.EarlyResponseAction)
+	require.True(t, ok)
+	require.Equal(t, quotaID, earlyResponse.Body)
+
+	// The flag is removed once the transaction ends
+	utils.ClearTransactionData(lunarContext.GetFlowContext(), aboveSoftLimit.GetID())
+	_, found = utils.GetQuotaOverage(aboveSoftLimit)
+	require.False(t, found)
+}
@@ -13,6 +13,7 @@ import (
 	"lunar/toolkit-core/network"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 )
@@ -20,6 +21,7 @@ import (
 type ProcessorManager struct {
 	procFactory        map[string]ProcessorFactory
 	processors         map[string]*streamtypes.ProcessorDefinition
+	instancesMutex     sync.RWMutex
 	processorInstances map[string]map[string]streamtypes.ProcessorI
 	processorDefsByKey map[string]map[string]*streamtypes.ProcessorDefinition
 	resources          *resources.ResourceManagement
@@ -88,6 +90,9 @@ func (pm *ProcessorManager) GetProcessorInstance(
 	createdByFlow,
 	processorKey string,
 ) (streamtypes.ProcessorI, bool) {
+	pm.instancesMutex.RLock()
+	defer pm.instancesMutex.RUnlock()
+
 	processorInstances, found := pm.processorInstances[createdByFlow]
 	if !found {
 		return nil, false
@@ -102,6 +107,9 @@ func (pm *ProcessorManager) GetProcessorDefinitionByKey(
 	flowName string,
 	procRef internaltypes.ProcessorRefI,
 ) *streamtypes.ProcessorDefinition {
+	pm.instancesMutex.RLock()
+	defer pm.instancesMutex.RUnlock()
+
 	if processorDefs, found := pm.processorDefsByKey[flowName]; found &&
 		processorDefs[procRef.GetName()] != nil {
 		return processorDefs[procRef.GetName()]
@@ -158,6 +166,9 @@ func (pm *ProcessorManager) CreateProcessor(
 	if err != nil {
 		return nil, fmt.Errorf("error creating processor %s: %v", procConf.GetName(), err)
 	}
+	pm.instancesMutex.Lock()
+	defer pm.instancesMutex.Unlock()
+
 	if _, found := pm.processorInstances[createdByFlow]; !found {
 		pm.processorInstances[createdByFlow] = make(map[string]streamtypes.ProcessorI)
 	}
@@ -170,6 +181,56 @@ func (pm *ProcessorManager) CreateProcessor(
 	return procInstance, nil
 }
 
+// getProcessorInstances returns a snapshot of the created processors,
+// so they can be called without holding the lock
+func (pm *ProcessorManager) getProcessorInstances() []streamtypes.ProcessorI {
+	pm.instancesMutex.RLock()
+	defer pm.instancesMutex.RUnlock()
+
+	var instances []streamtypes.ProcessorI
+	for _, processorInstances := range pm.processorInstances {
+		for _, processorInstance := range processorInstances {
+			instances = append(instances, processorInstance)
+		}
+	}
+	return instances
+}
+
+// PurgeCache purges the entries selected by the request from the caches of all processors
+func (pm *ProcessorManager) PurgeCache(
+	request streamtypes.CachePurgeRequest,
+) (streamtypes.CachePurgeResult, error) {
+	var result streamtypes.CachePurgeResult
+	for _, processorInstance := range pm.getProcessorInstances() {
+		cacheProcessor, ok := processorInstance.(streamtypes.CacheProcessorI)
+		if !ok {
+			continue
+		}
+		processorResult, err := cacheProcessor.PurgeCache(request)
+		if err != nil {
+			return result, fmt.Errorf("error purging cache of %s: %w",
+				processorInstance.GetName(), err)
+		}
+		result.Add(processorResult)
+	}
+	return result, nil
+}
+
+// GetQueueStats returns the state of the queues of all the queue processors
+func (pm *ProcessorManager) GetQueueStats() []streamtypes.QueueStats {
+	var stats []streamtypes.QueueStats
+	for _, processorInstances := range pm.processorInstances {
+		for _, processorInstance := range processorInstances {
+			queueProcessor, ok := processorInstance.(streamtypes.QueueProcessorI)
+			if !ok {
+				continue
+			}
+			stats = append(stats, queueProcessor.GetQueueStats()...)
+		}
+	}
+	return stats
+}
+
 func (pm *ProcessorManager) GetLoadedConfig() []network.ConfigurationPayload {
 	var loadedConfig []network.ConfigurationPayload
 	for _, proc := range pm.processors {
@@ -3,12 +3,14 @@ package processors
 import (
 	processor_async_queue "lunar/engine/streams/processors/async-queue"
 	processor_async_retry "lunar/engine/streams/processors/async-retry"
+	processor_coalesce "lunar/engine/streams/processors/coalesce"
 	processor_count_llm_tokens "lunar/engine/streams/processors/count-llm-tokens"
 	processor_custom_script "lunar/engine/streams/processors/custom-script"
 	processor_data_sanitation "lunar/engine/streams/processors/data-sanitation"
 	processor_filter "lunar/engine/streams/processors/filter-processor"
 	processor_generate_response "lunar/engine/streams/processors/generate-response"
 	processor_har_collector "lunar/engine/streams/processors/har-collector"
+	processor_idempotency "lunar/engine/streams/processors/idempotency"
 	processor_limiter "lunar/engine/streams/processors/limiter"
 	processor_mock "lunar/engine/streams/processors/mock"
 	processor_queue "lunar/engine/streams/processors/queue"
@@ -16,6 +18,7 @@ import (
 	processor_quota_inc "lunar/engine/streams/processors/quota-processor-inc"
 	processor_read_cache "lunar/engine/streams/processors/read-cache"
 	processor_retry "lunar/engine/streams/processors/retry"
+	processor_schema_validation "lunar/engine/streams/processors/schema-validation"
 	processor_transform_api_call "lunar/engine/streams/processors/transform-api-call"
 	processor_user_defined_metrics "lunar/engine/streams/processors/user-defined-metrics"
 	processor_user_defined_traces "lunar/engine/streams/processors/user-defined-traces"
@@ -48,5 +51,8 @@ func init() {
 		"CustomScript":       processor_custom_script.NewProcessor,
 		"UserDefinedTraces":  processor_user_defined_traces.NewProcessor,
 		"DataSanitation":     processor_data_sanitation.NewProcessor,
+		"SchemaValidation":   processor_schema_validation.NewProcessor,
+		"Coalesce":           processor_coalesce.NewProcessor,
+		"Idempotency":        processor_idempotency.NewProcessor,
 	}
 }
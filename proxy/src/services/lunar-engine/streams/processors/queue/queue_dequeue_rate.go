@@ -0,0 +1,58 @@
+package processorqueue
+
+import (
+	context_manager "lunar/toolkit-core/context-manager"
+	"sync"
+	"time"
+)
+
+const dequeueRateWindow = time.Minute
+
+// dequeueRate tracks how many requests left the queue over a sliding window,
+// it is used to estimate the wait time of queued requests.
+type dequeueRate struct {
+	mutex     sync.Mutex
+	window    time.Duration
+	createdAt time.Time
+	dequeued  []time.Time
+}
+
+func newDequeueRate(window time.Duration) *dequeueRate {
+	return &dequeueRate{
+		window:    window,
+		createdAt: context_manager.Get().GetClock().Now(),
+	}
+}
+
+func (r *dequeueRate) record() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := context_manager.Get().GetClock().Now()
+	r.prune(now)
+	r.dequeued = append(r.dequeued, now)
+}
+
+// perSecond returns the observed amount of dequeued requests per second
+func (r *dequeueRate) perSecond() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := context_manager.Get().GetClock().Now()
+	r.prune(now)
+
+	elapsed := min(now.Sub(r.createdAt), r.window)
+	if elapsed <= 0 || len(r.dequeued) == 0 {
+		return 0
+	}
+	return float64(len(r.dequeued)) / elapsed.Seconds()
+}
+
+func (r *dequeueRate) prune(now time.Time) {
+	windowStart := now.Add(-r.window)
+	index := 0
+	for index < len(r.dequeued) && r.dequeued[index].Before(windowStart) {
+		index++
+	}
+	r.dequeued = r.dequeued[index:]
+}
@@ -7,10 +7,12 @@ import (
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
 	"lunar/engine/utils/environment"
+	"lunar/engine/utils/queue"
 	clock "lunar/toolkit-core/clock"
 	context_manager "lunar/toolkit-core/context-manager"
 	"lunar/toolkit-core/otel"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	lunar_metrics "lunar/engine/metrics"
@@ -29,6 +31,9 @@ const (
 	queueTTL                      = "ttl_seconds"
 	groupsParam                   = "priority_groups"
 	redisQueueSize                = "redis_queue_size"
+	schedulingModeParam           = "scheduling_mode"
+	groupWeightsParam             = "group_weights"
+	groupMaxShareParam            = "group_max_share"
 	requestsInQueueMetric         = "lunar_processor_queue_requests_in_queue"
 	requestsHandledMetric         = "lunar_processor_queue_requests_handled"
 	requestsTimeInQueueMetric     = "lunar_processor_queue_requests_time_in_queue"
@@ -51,7 +56,10 @@ type queueGroup struct {
 	maxRedisQueueSize           int64
 	priorityGroupByHeader       string
 	priorityGroups              map[string]int64
+	scheduling                  queue.SchedulingConfig
 	requestsWatcher             *RequestWatcher
+	dequeueRate                 *dequeueRate
+	droppedOnTTL                atomic.Int64
 	logger                      zerolog.Logger
 	requestsInQueueMeterObj     metric.Int64UpDownCounter
 	requestsHandledMeterObj     metric.Int64Counter
@@ -68,6 +76,7 @@ func newQueueGroup(
 	maxRedisQueueSize int64,
 	priorityGroupByHeader string,
 	priorityGroups map[string]int64,
+	scheduling queue.SchedulingConfig,
 	logger zerolog.Logger,
 	sharedMemory publictypes.SharedStateI[string],
 	resources publictypes.ResourceManagementI,
@@ -84,13 +93,15 @@ func newQueueGroup(
 		name:                        groupKey,
 		quotaID:                     quotaID,
 		queueTTL:                    queueTTL,
-		queue:                       sharedMemory.NewQueue(groupKey, queueTTL),
+		queue:                       sharedMemory.NewScheduledQueue(groupKey, queueTTL, scheduling),
 		resources:                   resources,
 		maxQueueSize:                maxQueueSize,
 		maxRedisQueueSize:           maxRedisQueueSize,
 		priorityGroupByHeader:       priorityGroupByHeader,
 		requestsWatcher:             NewRequestsWatcher(queueTTL, logger),
+		dequeueRate:                 newDequeueRate(dequeueRateWindow),
 		priorityGroups:              priorityGroups,
+		scheduling:                  scheduling,
 		logger:                      logger.With().Str("group", groupKey).Logger(),
 		isMetricsEnabled:            isMetricsEnabled,
 		requestsInQueueMeterObj:     requestsInQueueMeterObj,
@@ -126,6 +137,7 @@ func (pg *queueGroup) tryProcessQueueItems() {
 			return
 		}
 		req.SetProcessedSuccess()
+		pg.dequeueRate.record()
 	}
 }
 
@@ -159,7 +171,8 @@ func (pg *queueGroup) processQueueItem(request *Request) bool {
 			Err(err).
 			Str("requestID", request.GetID()).
 			Msgf("Request blocked, re-enqueueing")
-		_ = pg.queue.Enqueue(request.GetID(), request.GetPriority())
+		_ = pg.queue.EnqueueToGroup(
+			request.GetID(), request.GetPriorityGroup(), request.GetPriority())
 		return false
 	}
 
@@ -224,33 +237,35 @@ func (pg *queueGroup) process() {
 	}
 }
 
+// extractPriority returns the priority group of the request and its priority.
+// Requests without a known priority group are scheduled under the default (empty) group.
 func (pg *queueGroup) extractPriority(
 	onRequest publictypes.TransactionI,
-) float64 {
+) (string, float64) {
 	if pg.priorityGroupByHeader == "" {
 		pg.logger.Trace().Str("requestID", onRequest.GetID()).
 			Msg("Priority header not initialized, defaulting to 0")
-		return 0
+		return "", 0
 	}
 	groupName, found := onRequest.GetHeaders()[pg.priorityGroupByHeader]
 	if !found {
 		pg.logger.Trace().Str("requestID", onRequest.GetID()).
 			Str("priorityGroupByHeader", pg.priorityGroupByHeader).
 			Msgf("Priority header not found, defaulting to %d", defaultPriorityWhenGroupFound)
-		return defaultPriorityWhenGroupFound
+		return "", defaultPriorityWhenGroupFound
 	}
 	reqPriority, found := pg.priorityGroups[groupName]
 	if !found {
 		pg.logger.Trace().Str("requestID", onRequest.GetID()).
 			Str("priorityGroupByHeader", pg.priorityGroupByHeader).
 			Msgf("Priority not found, defaulting to to %d", defaultPriorityWhenGroupFound)
-		return defaultPriorityWhenGroupFound
+		return "", defaultPriorityWhenGroupFound
 	}
 	pg.logger.Trace().Str("requestID", onRequest.GetID()).
 		Str("priorityGroupByHeader", pg.priorityGroupByHeader).
 		Msg("Extracting priority")
 
-	return float64(reqPriority)
+	return groupName, float64(reqPriority)
 }
 
 func (pg *queueGroup) enqueueIfSlotAvailable(req *Request) bool {
@@ -281,7 +296,8 @@ func (pg *queueGroup) enqueueIfSlotAvailable(req *Request) bool {
 	pg.requestsWatcher.AddRequest(req)
 
 	pg.logger.Trace().Str("requestID", req.GetID()).Msg("Slot available, enqueuing")
-	if err := pg.queue.Enqueue(req.GetID(), req.GetPriority()); err != nil {
+	err := pg.queue.EnqueueToGroup(req.GetID(), req.GetPriorityGroup(), req.GetPriority())
+	if err != nil {
 		pg.logger.Debug().Err(err).Str("requestID", req.GetID()).
 			Msg("Failed to enqueue request")
 		return false
@@ -291,8 +307,9 @@ func (pg *queueGroup) enqueueIfSlotAvailable(req *Request) bool {
 }
 
 func (pg *queueGroup) enqueue(flowName string, apiStream publictypes.APIStreamI) bool {
-	priority := pg.extractPriority(apiStream.GetRequest())
+	priorityGroup, priority := pg.extractPriority(apiStream.GetRequest())
 	req := NewRequest(
+		priorityGroup,
 		priority,
 		pg.queueTTL,
 		apiStream,
@@ -305,6 +322,7 @@ func (pg *queueGroup) enqueue(flowName string, apiStream publictypes.APIStreamI)
 	if !pg.enqueueIfSlotAvailable(req) {
 		pg.logger.Trace().Str("requestID", req.GetID()).
 			Msg("Slot not available, dropping request")
+		pg.publishBlockedInfo(apiStream, utils.BlockedReasonQueueFull)
 		return false
 	}
 
@@ -330,9 +348,64 @@ func (pg *queueGroup) enqueue(flowName string, apiStream publictypes.APIStreamI)
 		Msgf("Request processing timed out")
 	pg.updateHistogramMetric(flowName, apiStream, req, true)
 	pg.updateMetrics(flowName, apiStream, req, false, true)
+
+	reason := utils.BlockedReasonQueueTTLExpired
+	if pg.inDrainMode {
+		reason = utils.BlockedReasonQueueDrained
+	} else {
+		pg.droppedOnTTL.Add(1)
+	}
+	pg.publishBlockedInfo(apiStream, reason)
 	return false
 }
 
+// publishBlockedInfo lets following processors know the queue state of a blocked request.
+// The estimated wait is the time until the quota resets,
+// plus the time it takes to dequeue the requests ahead at the observed dequeue rate.
+// Requests which were not queued are behind the whole queue.
+func (pg *queueGroup) publishBlockedInfo(apiStream publictypes.APIStreamI, reason string) {
+	queueSize := pg.queue.Size()
+	position := pg.queue.Position(apiStream.GetID())
+	requestsAhead := queueSize
+	if position > 0 {
+		requestsAhead = position - 1
+	}
+	resetIn := defaultIdleTimeForQueue
+	if quota, err := pg.resources.GetQuota(pg.quotaID, apiStream.GetID()); err == nil {
+		resetIn = utils.GetQuotaResetIn(quota, apiStream)
+	}
+	estimatedWait := resetIn
+	if rate := pg.dequeueRate.perSecond(); rate > 0 {
+		estimatedWait += time.Duration(float64(requestsAhead) / rate * float64(time.Second))
+	}
+
+	info := utils.NewBlockedInfo(
+		reason,
+		pg.quotaID,
+		resetIn,
+		estimatedWait,
+		context_manager.Get().GetClock().Now(),
+	).WithQueueState(position, queueSize)
+
+	if err := utils.SetBlockedInfo(apiStream, info); err != nil {
+		pg.logger.Trace().Err(err).Str("requestID", apiStream.GetID()).
+			Msg("Failed to publish blocked info")
+	}
+}
+
+func (pg *queueGroup) getStats() streamtypes.QueueStats {
+	stats := streamtypes.QueueStats{
+		ProcessorKey: pg.processorName,
+		Group:        pg.groupName,
+		Size:         pg.requestsWatcher.GetCount(),
+		DroppedOnTTL: pg.droppedOnTTL.Load(),
+	}
+	if oldest, found := pg.requestsWatcher.GetOldestTimestamp(); found {
+		stats.OldestItemAge = context_manager.Get().GetClock().Now().Sub(oldest)
+	}
+	return stats
+}
+
 func (pg *queueGroup) removeRequest(reqID string) {
 	pg.requestsWatcher.RemoveFromWatchList(reqID)
 	pg.queue.Remove(reqID)
@@ -399,6 +472,7 @@ type queueProcessor struct {
 	priorityGroupByHeader       string
 	groupByHeader               string
 	priorityGroups              map[string]int64
+	scheduling                  queue.SchedulingConfig
 	queues                      map[string]*queueGroup
 	clock                       clock.Clock
 	logger                      zerolog.Logger
@@ -442,6 +516,10 @@ func (p *queueProcessor) GetName() string {
 	return p.name
 }
 
+func (p *queueProcessor) GetQuotaID() string {
+	return p.quotaID
+}
+
 func (p *queueProcessor) Execute(
 	flowName string,
 	apiStream publictypes.APIStreamI,
@@ -477,6 +555,18 @@ func (p *queueProcessor) Execute(
 	}, nil
 }
 
+// GetQueueStats returns the state of the queue of each group
+func (p *queueProcessor) GetQueueStats() []streamtypes.QueueStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := make([]streamtypes.QueueStats, 0, len(p.queues))
+	for _, queue := range p.queues {
+		stats = append(stats, queue.getStats())
+	}
+	return stats
+}
+
 func (p *queueProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{}
 }
@@ -510,6 +600,7 @@ func (p *queueProcessor) getQueue(
 			p.maxRedisQueueSize,
 			p.priorityGroupByHeader,
 			p.priorityGroups,
+			p.scheduling,
 			p.logger,
 			p.metaData.SharedMemory,
 			p.metaData.Resources,
@@ -564,6 +655,10 @@ func (p *queueProcessor) init() error {
 		return err
 	}
 
+	if err := p.initScheduling(); err != nil {
+		return err
+	}
+
 	if err := utils.ExtractInt64Param(p.metaData.Parameters,
 		queueSize, &p.maxQueueSize); err != nil {
 		return err
@@ -590,6 +685,46 @@ func (p *queueProcessor) init() error {
 	return nil
 }
 
+func (p *queueProcessor) initScheduling() error {
+	var schedulingMode string
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		schedulingModeParam, &schedulingMode); err != nil {
+		log.Trace().Msgf("scheduling_mode not defined for %v, using %s", p.name, queue.StrictPriority)
+	}
+
+	groupWeights := make(map[string]int64)
+	if err := utils.ExtractMapOfInt64Param(p.metaData.Parameters,
+		groupWeightsParam, groupWeights); err != nil {
+		log.Trace().Msgf("group_weights not defined for %v", p.name)
+	}
+
+	groupMaxShare := make(map[string]int64)
+	if err := utils.ExtractMapOfInt64Param(p.metaData.Parameters,
+		groupMaxShareParam, groupMaxShare); err != nil {
+		log.Trace().Msgf("group_max_share not defined for %v", p.name)
+	}
+
+	p.scheduling = queue.SchedulingConfig{
+		Mode:     queue.SchedulingMode(schedulingMode),
+		Weights:  make(map[string]float64, len(groupWeights)),
+		MaxShare: make(map[string]float64, len(groupMaxShare)),
+	}
+	if p.scheduling.Mode == "" {
+		p.scheduling.Mode = queue.StrictPriority
+	}
+	for group, weight := range groupWeights {
+		p.scheduling.Weights[group] = float64(weight)
+	}
+	for group, percentage := range groupMaxShare {
+		p.scheduling.MaxShare[group] = float64(percentage) / 100
+	}
+
+	if err := p.scheduling.Validate(); err != nil {
+		return fmt.Errorf("invalid scheduling for processor %s: %w", p.name, err)
+	}
+	return nil
+}
+
 func (p *queueProcessor) initializeMetrics() error {
 	p.logger.Debug().Msgf("Initializing metrics for %s", p.metaData.Name)
 	if !p.metaData.IsMetricsEnabled() {
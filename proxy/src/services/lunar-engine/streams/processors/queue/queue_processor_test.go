@@ -239,6 +239,86 @@ func TestQueueProcessor_SkipEnqueueIfSlotNotAvailable(t *testing.T) {
 	}
 }
 
+func TestQueueProcessor_ReportsQueueStats(t *testing.T) {
+	var wg sync.WaitGroup
+
+	memoryState := lunar_context.NewMemoryState[string]()
+	clk := context_manager.Get().SetRealClock().GetClock()
+	strategy := &quota_resource.StrategyConfig{
+		FixedWindow: &quota_resource.FixedWindowConfig{
+			QuotaLimit: quota_resource.QuotaLimit{
+				Max:          0,
+				Interval:     10,
+				IntervalUnit: "second",
+			},
+		},
+	}
+	quotaID := "TestQueueProcessor_ReportsQueueStats"
+	resourceMng, err := resources.NewResourceManagement()
+	require.NoError(t, err)
+	resourceMng, err = resourceMng.WithQuotaData(getQuotaData(strategy, quotaID))
+	require.NoError(t, err)
+
+	metaData := &stream_types.ProcessorMetaData{
+		Name:                quotaID,
+		Clock:               clk,
+		SharedMemory:        memoryState.WithClock(clk),
+		ProcessorDefinition: stream_types.ProcessorDefinition{},
+		Parameters: map[string]stream_types.ProcessorParam{
+			"quota_id": {
+				Name:  "quota_id",
+				Value: getParamValue("quota_id", quotaID),
+			},
+			"queue_size": {
+				Name:  "queue_size",
+				Value: getParamValue("queue_size", 10),
+			},
+			"redis_queue_size": {
+				Name:  "redis_queue_size",
+				Value: getParamValue("redis_queue_size", -1),
+			},
+			"ttl_seconds": {
+				Name:  "ttl_seconds",
+				Value: getParamValue("ttl_seconds", 1),
+			},
+			"priority_group_by_header": {
+				Name:  "priority_group_by_header",
+				Value: getParamValue("priority_group_by_header", nil),
+			},
+			"priority_groups": {
+				Name:  "priority_groups",
+				Value: getParamValue("priority_groups", nil),
+			},
+			"group_by_header": {
+				Name:  "group_by_header",
+				Value: getParamValue("group_by_header", "default"),
+			},
+		},
+		Resources: resourceMng,
+	}
+	queueProcessor, err := queue_processor.NewProcessor(metaData)
+	require.NoError(t, err)
+	queueStatsProvider, ok := queueProcessor.(stream_types.QueueProcessorI)
+	require.True(t, ok)
+
+	resultChan := make(chan result, 1)
+	defer close(resultChan)
+	wg.Add(1)
+	go execute(getAPIStream(), queueProcessor, resultChan, &wg)
+
+	require.Eventually(t, func() bool {
+		stats := queueStatsProvider.GetQueueStats()
+		return len(stats) == 1 && stats[0].Size == 1 && stats[0].OldestItemAge > 0
+	}, time.Second, 10*time.Millisecond)
+
+	wg.Wait()
+	require.Equal(t, blockedKey, (<-resultChan).procIO.Name)
+	require.Eventually(t, func() bool {
+		stats := queueStatsProvider.GetQueueStats()
+		return stats[0].Size == 0 && stats[0].DroppedOnTTL == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
 func TestQueueProcessor_DrainRequestsWhenContextClose(t *testing.T) {
 	var wg sync.WaitGroup
 
@@ -28,6 +28,7 @@ type Request struct {
 	timestamp      time.Time
 	expireAt       time.Time
 	priority       float64
+	priorityGroup  string
 	inProcessMutex sync.RWMutex
 	apiStream      publictypes.APIStreamI
 	state          requestState
@@ -36,19 +37,21 @@ type Request struct {
 }
 
 func NewRequest(
+	priorityGroup string,
 	priority float64,
 	ttl time.Duration,
 	APIStream publictypes.APIStreamI,
 ) *Request {
 	clock := context_manager.Get().GetClock()
 	req := &Request{
-		priority:  priority,
-		timestamp: clock.Now(),
-		apiStream: APIStream,
-		expireAt:  clock.Now().Add(ttl),
-		state:     requestEnqueued,
-		result:    requestPending,
-		waitGroup: sync.WaitGroup{},
+		priority:      priority,
+		priorityGroup: priorityGroup,
+		timestamp:     clock.Now(),
+		apiStream:     APIStream,
+		expireAt:      clock.Now().Add(ttl),
+		state:         requestEnqueued,
+		result:        requestPending,
+		waitGroup:     sync.WaitGroup{},
 	}
 
 	req.waitGroup.Add(1)
@@ -71,6 +74,10 @@ func (r *Request) GetPriority() float64 {
 	return r.priority
 }
 
+func (r *Request) GetPriorityGroup() string {
+	return r.priorityGroup
+}
+
 func (r *Request) GetID() string {
 	return r.apiStream.GetID()
 }
@@ -46,6 +46,20 @@ func (watcher *RequestWatcher) GetCount() int64 {
 	return watcher.requestCount.Load()
 }
 
+// GetOldestTimestamp returns the time the longest waiting request was enqueued at
+func (watcher *RequestWatcher) GetOldestTimestamp() (time.Time, bool) {
+	watcher.requestsMapMutex.RLock()
+	defer watcher.requestsMapMutex.RUnlock()
+
+	var oldest time.Time
+	for _, request := range watcher.requests {
+		if oldest.IsZero() || request.GetTimestamp().Before(oldest) {
+			oldest = request.GetTimestamp()
+		}
+	}
+	return oldest, !oldest.IsZero()
+}
+
 func (watcher *RequestWatcher) GetRequest(requestID string) (*Request, bool) {
 	watcher.requestsMapMutex.RLock()
 	defer watcher.requestsMapMutex.RUnlock()
@@ -0,0 +1,55 @@
+package readcache
+
+import (
+	"lunar/engine/actions"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/compression"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCacheServesCompressedEntries(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	proc, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "ReadCache",
+		Parameters: map[string]streamtypes.ProcessorParam{
+			cachingKeyPartsParam: {
+				Name:  cachingKeyPartsParam,
+				Value: public_types.NewParamValue(staleCachingKeyParts),
+			},
+		},
+		Metrics: &public_types.ProcessorMetrics{Enabled: true},
+	})
+	require.NoError(t, err)
+	readCache := proc.(*readCacheProcessor)
+
+	apiStream := newStaleTestStream(200, `{"orders":[]}`)
+	entry, err := utils.NewSharedMemoryTTLEntry(60, apiStream.GetResponse())
+	require.NoError(t, err)
+	require.NoError(t, entry.Compress(compression.EncodingGZip))
+	rawEntry, err := entry.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, readCache.cachedResponses.Set("testFlow_key123", rawEntry))
+	readCache.accessTracker.RecordWrite("testFlow", "testFlow_key123", false)
+
+	output, err := proc.Execute("testFlow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, hitConditionName, output.Name)
+	require.Equal(t, `{"orders":[]}`, output.ReqAction.(*actions.EarlyResponseAction).Body)
+	require.Equal(t, int64(1), readCache.accessTracker.Get("testFlow_key123").Hits)
+
+	missStream := test_utils.NewMockAPIStreamFull(public_types.StreamTypeRequest,
+		"GET", "https://example.com/orders", map[string]string{"api_key": "other"},
+		nil, "", "", 200)
+	output, err = proc.Execute("testFlow", missStream)
+	require.NoError(t, err)
+	require.Equal(t, missConditionName, output.Name)
+
+	// one hit out of two lookups, reported as the hit ratio of the flow
+	require.Equal(t, &cacheLookups{hits: 1, total: 2}, readCache.lookups["testFlow"])
+}
@@ -10,35 +10,76 @@ import (
 	lunar_context "lunar/engine/streams/lunar-context"
 	"lunar/engine/streams/processors/utils"
 	public_types "lunar/engine/streams/public-types"
+	"lunar/toolkit-core/clock"
+	context_manager "lunar/toolkit-core/context-manager"
 	"lunar/toolkit-core/otel"
+	"net/http"
+	"sync"
+	"time"
 
 	streamtypes "lunar/engine/streams/types"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
 const (
 	cachingKeyPartsParam = "caching_key_parts"
+	httpSemanticsParam   = "http_semantics"
 
-	hitConditionName  = "cache_hit"
-	missConditionName = "cache_miss"
+	hitConditionName   = "cache_hit"
+	missConditionName  = "cache_miss"
+	staleConditionName = "cache_stale"
 
 	cacheMissMetric       = lunar_metrics.MetricPrefix + "read_cache_processor_cache_miss"
 	cacheHitMetric        = lunar_metrics.MetricPrefix + "read_cache_processor_cache_hit"
+	cacheStaleHitMetric   = lunar_metrics.MetricPrefix + "read_cache_processor_cache_stale_hit"
 	cacheSizeServedMetric = lunar_metrics.MetricPrefix + "read_cache_processor_cache_size_served"
+	cacheHitRatioMetric   = lunar_metrics.MetricPrefix + "read_cache_processor_cache_hit_ratio"
+
+	staleReasonAttribute  = "stale_reason"
+	staleReasonRevalidate = "revalidate"
+	staleReasonError      = "error"
+
+	// CacheStatusHeader is set on responses served from an expired cache entry
+	CacheStatusHeader = "x-lunar-cache-status"
+	cacheStatusStale  = "stale"
+
+	// revalidationLease is the time in which a single background refresh per key is sent
+	// for a stale entry, while requests are served the stale entry
+	revalidationLease = 10 * time.Second
 )
 
 type readCacheProcessor struct {
 	name                  string
 	cachingKeyDefinitions []string
+	httpSemantics         bool
 
 	cachedResponses public_types.SharedStateI[[]byte]
+	accessTracker   *utils.CacheAccessTracker
 
 	metaData     *streamtypes.ProcessorMetaData
 	labelManager *lunar_metrics.LabelManager
 
 	metricObjects map[string]metric.Int64Counter
+
+	lookupsMutex sync.Mutex
+	// lookups holds the cache lookups of each flow, reported as the hit ratio of the flow
+	lookups map[string]*cacheLookups
+
+	revalidationsMutex sync.Mutex
+	// revalidations holds the lease expiration of the keys being refreshed,
+	// the leases and their watcher are measured by the same clock
+	revalidations      map[string]time.Time
+	revalidationsWatch *lunar_context.ExpireWatcher[time.Time]
+	clock              clock.Clock
+	sendRefresh        refreshSender
+}
+
+type cacheLookups struct {
+	hits  int64
+	total int64
 }
 
 func NewProcessor(
@@ -49,8 +90,14 @@ func NewProcessor(
 		metaData:        metaData,
 		metricObjects:   make(map[string]metric.Int64Counter),
 		cachedResponses: lunar_context.NewSharedState[[]byte](),
+		accessTracker:   utils.GetCacheAccessTracker(),
+		lookups:         make(map[string]*cacheLookups),
 		labelManager:    lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+		revalidations:   make(map[string]time.Time),
+		clock:           context_manager.Get().GetClock(),
+		sendRefresh:     sendToGateway,
 	}
+	proc.revalidationsWatch = lunar_context.NewExpireWatcher(proc.expireRevalidation, proc.clock)
 
 	if err := proc.init(); err != nil {
 		return nil, err
@@ -82,11 +129,7 @@ func (p *readCacheProcessor) Execute(
 	if apiStream.GetType() == public_types.StreamTypeRequest {
 		return p.onRequest(flowName, apiStream)
 	} else if apiStream.GetType() == public_types.StreamTypeResponse {
-		return streamtypes.ProcessorIO{
-			Type:       public_types.StreamTypeResponse,
-			RespAction: &actions.NoOpAction{},
-			Name:       "",
-		}, nil
+		return p.onResponse(flowName, apiStream)
 	}
 	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
 }
@@ -102,6 +145,12 @@ func (p *readCacheProcessor) init() error {
 	if len(p.cachingKeyDefinitions) == 0 {
 		return fmt.Errorf("%v cannot be empty", cachingKeyPartsParam)
 	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		httpSemanticsParam,
+		&p.httpSemantics); err != nil {
+		log.Trace().Msgf("http_semantics not defined for %v", p.name)
+	}
 	return nil
 }
 
@@ -129,6 +178,14 @@ func (p *readCacheProcessor) initializeMetrics() error {
 	}
 	p.metricObjects[cacheHitMetric] = meterObj
 
+	meterObj, err = meter.Int64Counter(
+		cacheStaleHitMetric,
+		metric.WithDescription("Cache hits served from expired entries by processor"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+	p.metricObjects[cacheStaleHitMetric] = meterObj
+
 	meterObj, err = meter.Int64Counter(
 		cacheSizeServedMetric,
 		metric.WithUnit("By"), // unit for bytes
@@ -138,6 +195,14 @@ func (p *readCacheProcessor) initializeMetrics() error {
 	}
 	p.metricObjects[cacheSizeServedMetric] = meterObj
 
+	_, err = meter.Float64ObservableGauge(
+		cacheHitRatioMetric,
+		metric.WithDescription("Ratio of requests served from the cache by processor, per flow"),
+		metric.WithFloat64Callback(p.observeHitRatio))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+
 	log.Info().Msgf("Metrics initialized for %s", p.name)
 	return nil
 }
@@ -145,24 +210,29 @@ func (p *readCacheProcessor) initializeMetrics() error {
 func (p *readCacheProcessor) updateMetrics(
 	flowName string,
 	provider lunar_metrics.APICallMetricsProviderI,
-	cacheServedSize int,
-	cacheMiss bool,
+	cacheServedSize int64,
+	metricObjID string,
+	staleReason string,
 ) {
 	if !p.metaData.IsMetricsEnabled() {
 		return
 	}
+	// stale hits of failed responses are not lookups
+	if staleReason != staleReasonError {
+		p.recordLookup(flowName, metricObjID != cacheMissMetric)
+	}
 
 	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
 	preparedAttributes := metric.WithAttributes(attributes...)
 
 	ctx := context.Background()
 	if cacheServedSize > 0 {
-		p.metricObjects[cacheSizeServedMetric].Add(ctx, int64(cacheServedSize), preparedAttributes)
+		p.metricObjects[cacheSizeServedMetric].Add(ctx, cacheServedSize, preparedAttributes)
 	}
 
-	metricObjID := cacheHitMetric
-	if cacheMiss {
-		metricObjID = cacheMissMetric
+	if staleReason != "" {
+		attributes = append(attributes, attribute.String(staleReasonAttribute, staleReason))
+		preparedAttributes = metric.WithAttributes(attributes...)
 	}
 	p.metricObjects[metricObjID].Add(ctx, 1, preparedAttributes)
 
@@ -180,64 +250,261 @@ func (p *readCacheProcessor) onRequest(
 		log.Trace().Err(err).Msgf("Failed to build cache key for %s", p.name)
 	}
 
-	var cacheSizeServed int
-	var onResponse *lunar_messages.OnResponse
-	onResponse, cacheSizeServed, err = p.getCachedEntry(cacheKey)
+	ttlEntry, onResponse, err := p.getCachedEntry(cacheKey)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to get cached entry for key %s", cacheKey)
 		return streamtypes.ProcessorIO{}, err
 	}
 
-	var reqAction actions.ReqLunarAction
-	var reqType public_types.StreamType
-	var conditionName string
-	cacheMiss := onResponse == nil
-	if cacheMiss {
-		log.Trace().Msgf("Cache miss for key %s", cacheKey)
-		reqType = public_types.StreamTypeRequest
-		conditionName = missConditionName
-		reqAction = &actions.NoOpAction{}
-	} else {
+	if onResponse != nil && p.httpSemantics && !ttlEntry.MatchesVary(apiStream.GetHeaders()) {
+		log.Trace().Msgf("Cache entry for key %s varies from the request", cacheKey)
+		ttlEntry, onResponse = nil, nil
+	}
+
+	if isRefresh(apiStream) {
+		// Background refreshes are not lookups of a client, they always continue to the provider
+		log.Trace().Msgf("Refreshing cache entry for key %s", cacheKey)
+		return streamtypes.ProcessorIO{
+			Type:      public_types.StreamTypeRequest,
+			Name:      missConditionName,
+			ReqAction: p.buildMissAction(apiStream, cacheKey, ttlEntry),
+		}, nil
+	}
+
+	switch {
+	case onResponse != nil && ttlEntry.IsAlive():
 		log.Trace().Msgf("Cache hit for key %s", cacheKey)
-		reqType = public_types.StreamTypeResponse
-		conditionName = hitConditionName
-		reqAction = &actions.EarlyResponseAction{
-			Status:  onResponse.Status,
-			Body:    onResponse.Body,
-			Headers: onResponse.Headers,
+		p.accessTracker.RecordHit(cacheKey)
+		p.updateMetrics(flowName, apiStream, ttlEntry.GetContentSize(), cacheHitMetric, "")
+		return streamtypes.ProcessorIO{
+			Type:      public_types.StreamTypeResponse,
+			Name:      hitConditionName,
+			ReqAction: buildEarlyResponse(onResponse, nil),
+		}, nil
+
+	case onResponse != nil && ttlEntry.IsStaleWhileRevalidate():
+		log.Trace().Msgf("Stale cache hit for key %s", cacheKey)
+		if p.acquireRevalidation(cacheKey) {
+			p.refreshInBackground(apiStream, cacheKey)
 		}
+		p.accessTracker.RecordHit(cacheKey)
+		p.updateMetrics(flowName, apiStream, ttlEntry.GetContentSize(),
+			cacheStaleHitMetric, staleReasonRevalidate)
+		return streamtypes.ProcessorIO{
+			Type:      public_types.StreamTypeResponse,
+			Name:      staleConditionName,
+			ReqAction: buildEarlyResponse(onResponse, staleHeaders()),
+		}, nil
+	}
+
+	log.Trace().Msgf("Cache miss for key %s", cacheKey)
+	p.updateMetrics(flowName, apiStream, 0, cacheMissMetric, "")
+	return streamtypes.ProcessorIO{
+		Type:      public_types.StreamTypeRequest,
+		Name:      missConditionName,
+		ReqAction: p.buildMissAction(apiStream, cacheKey, ttlEntry),
+	}, nil
+}
+
+// onResponse replaces failed provider responses with a stale entry, when allowed by the entry
+func (p *readCacheProcessor) onResponse(
+	flowName string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	passThrough := streamtypes.ProcessorIO{
+		Type:       public_types.StreamTypeResponse,
+		RespAction: &actions.NoOpAction{},
+		Name:       "",
 	}
 
-	p.updateMetrics(flowName, apiStream, cacheSizeServed, cacheMiss)
+	response := apiStream.GetResponse()
+	if response == nil || response.GetStatus() < http.StatusInternalServerError {
+		return passThrough, nil
+	}
 
+	cacheKey, err := utils.BuildSharedMemoryKey(flowName,
+		p.cachingKeyDefinitions,
+		apiStream)
+	if err != nil {
+		log.Trace().Err(err).Msgf("Failed to build cache key for %s", p.name)
+		return passThrough, nil
+	}
+
+	ttlEntry, onResponse, err := p.getCachedEntry(cacheKey)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to get cached entry for key %s", cacheKey)
+		return passThrough, nil
+	}
+	if onResponse == nil || !ttlEntry.IsStaleIfError() {
+		return passThrough, nil
+	}
+
+	log.Trace().Msgf("Serving stale entry of key %s instead of status %d",
+		cacheKey, response.GetStatus())
+	p.accessTracker.RecordHit(cacheKey)
+	p.updateMetrics(flowName, apiStream, ttlEntry.GetContentSize(),
+		cacheStaleHitMetric, staleReasonError)
+
+	headers := staleHeaders()
+	for name, value := range onResponse.Headers {
+		headers[name] = value
+	}
 	return streamtypes.ProcessorIO{
-		Type:      reqType,
-		Name:      conditionName,
-		ReqAction: reqAction,
+		Type: public_types.StreamTypeResponse,
+		Name: staleConditionName,
+		RespAction: &actions.ModifyResponseAction{
+			Status:       onResponse.Status,
+			Body:         onResponse.Body,
+			HeadersToSet: headers,
+		},
 	}, nil
 }
 
-// getCachedEntry retrieves a cached entry from the shared memory
-func (p *readCacheProcessor) getCachedEntry(key string) (*lunar_messages.OnResponse, int, error) {
+// recordLookup counts a cache lookup of the flow for its hit ratio
+func (p *readCacheProcessor) recordLookup(flowName string, hit bool) {
+	p.lookupsMutex.Lock()
+	defer p.lookupsMutex.Unlock()
+
+	lookups, found := p.lookups[flowName]
+	if !found {
+		lookups = &cacheLookups{}
+		p.lookups[flowName] = lookups
+	}
+	lookups.total++
+	if hit {
+		lookups.hits++
+	}
+}
+
+func (p *readCacheProcessor) observeHitRatio(
+	_ context.Context,
+	observer metric.Float64Observer,
+) error {
+	p.lookupsMutex.Lock()
+	defer p.lookupsMutex.Unlock()
+
+	for flowName, lookups := range p.lookups {
+		observer.Observe(
+			float64(lookups.hits)/float64(lookups.total),
+			metric.WithAttributes(
+				attribute.String(lunar_metrics.FlowName, flowName),
+				attribute.String(lunar_metrics.ProcessorKey, p.name),
+			),
+		)
+	}
+	return nil
+}
+
+// buildMissAction turns the request into a conditional request when the expired entry
+// can be revalidated, so the provider may answer with 304 (Not Modified) instead of the body.
+// Requests which are already conditional are left to the client.
+func (p *readCacheProcessor) buildMissAction(
+	apiStream public_types.APIStreamI,
+	cacheKey string,
+	ttlEntry *utils.SharedMemoryTTLEntry,
+) actions.ReqLunarAction {
+	if !p.httpSemantics || ttlEntry == nil || !ttlEntry.HasValidators() ||
+		utils.HasConditionalHeaders(apiStream.GetHeaders()) {
+		return &actions.NoOpAction{}
+	}
+
+	if err := utils.SetCacheRevalidation(apiStream, cacheKey); err != nil {
+		log.Debug().Err(err).Msgf("Failed to mark revalidation of key %s", cacheKey)
+		return &actions.NoOpAction{}
+	}
+	log.Trace().Msgf("Revalidating cache entry for key %s", cacheKey)
+	return &actions.ModifyHeadersAction{HeadersToSet: ttlEntry.ConditionalHeaders()}
+}
+
+// acquireRevalidation returns true if the request should trigger a refresh of the stale entry
+// of the key, a single refresh per key is sent for each revalidation lease.
+func (p *readCacheProcessor) acquireRevalidation(cacheKey string) bool {
+	p.revalidationsMutex.Lock()
+	now := p.clock.Now()
+	if expiresAt, found := p.revalidations[cacheKey]; found && now.Before(expiresAt) {
+		p.revalidationsMutex.Unlock()
+		return false
+	}
+	p.revalidations[cacheKey] = now.Add(revalidationLease)
+	p.revalidationsMutex.Unlock()
+
+	// the watcher calls expireRevalidation under its own lock
+	p.revalidationsWatch.AddKey(cacheKey, revalidationLease)
+	return true
+}
+
+// expireRevalidation removes the revalidation lease of the key, unless it was renewed
+func (p *readCacheProcessor) expireRevalidation(cacheKey string) (time.Time, error) {
+	p.revalidationsMutex.Lock()
+	defer p.revalidationsMutex.Unlock()
+
+	expiresAt, found := p.revalidations[cacheKey]
+	if !found {
+		return expiresAt, fmt.Errorf("no revalidation lease for key %s", cacheKey)
+	}
+	if p.clock.Now().Before(expiresAt) {
+		return expiresAt, nil
+	}
+	delete(p.revalidations, cacheKey)
+	return expiresAt, nil
+}
+
+func buildEarlyResponse(
+	onResponse *lunar_messages.OnResponse,
+	extraHeaders map[string]string,
+) *actions.EarlyResponseAction {
+	headers := onResponse.Headers
+	if len(extraHeaders) > 0 {
+		headers = make(map[string]string, len(onResponse.Headers)+len(extraHeaders))
+		for name, value := range onResponse.Headers {
+			headers[name] = value
+		}
+		for name, value := range extraHeaders {
+			headers[name] = value
+		}
+	}
+	return &actions.EarlyResponseAction{
+		Status:  onResponse.Status,
+		Body:    onResponse.Body,
+		Headers: headers,
+	}
+}
+
+func staleHeaders() map[string]string {
+	return map[string]string{CacheStatusHeader: cacheStatusStale}
+}
+
+// getCachedEntry retrieves a cached entry from the shared memory,
+// expired entries are returned as long as they are within their stale periods
+// or can be revalidated
+func (p *readCacheProcessor) getCachedEntry(
+	key string,
+) (*utils.SharedMemoryTTLEntry, *lunar_messages.OnResponse, error) {
 	storedBytes, _ := p.cachedResponses.Get(key)
 	if len(storedBytes) == 0 {
 		log.Trace().Msgf("Cache entry for key %s not found", key)
-		return nil, 0, nil
+		return nil, nil, nil
 	}
 
 	ttlEntry, err := utils.ParseSharedMemoryTTLEntry(storedBytes)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
 
-	if !ttlEntry.IsAlive() {
+	revalidatable := p.httpSemantics && ttlEntry.HasValidators()
+	if !ttlEntry.IsAlive() && !ttlEntry.IsStaleWhileRevalidate() && !ttlEntry.IsStaleIfError() &&
+		!revalidatable {
 		log.Trace().Msgf("Cache entry for key %s is expired", key)
-		return nil, 0, nil
+		return nil, nil, nil
+	}
+	content, err := ttlEntry.GetContent()
+	if err != nil {
+		return nil, nil, err
 	}
 	var onResponse lunar_messages.OnResponse
-	err = json.Unmarshal(ttlEntry.Content, &onResponse)
+	err = json.Unmarshal(content, &onResponse)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
-	return &onResponse, len(ttlEntry.Content), nil
+	return ttlEntry, &onResponse, nil
 }
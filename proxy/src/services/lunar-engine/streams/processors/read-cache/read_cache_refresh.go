@@ -0,0 +1,110 @@
+package readcache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/utils/environment"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// CacheRefreshHeader marks the requests the gateway sends to itself to refresh a stale entry.
+	// These requests skip the cache lookup, so their response goes through WriteCache.
+	// Like every x-lunar header, it is removed before the request is sent to the provider.
+	CacheRefreshHeader = "x-lunar-cache-refresh"
+
+	lunarHostHeader   = "x-lunar-host"
+	lunarSchemeHeader = "x-lunar-scheme"
+
+	refreshTimeout = 30 * time.Second
+)
+
+// refreshToken is the value of CacheRefreshHeader, so only refreshes of this gateway skip the cache
+var refreshToken = newRefreshToken()
+
+type refreshSender func(*http.Request) error
+
+var refreshClient = &http.Client{Timeout: refreshTimeout}
+
+func newRefreshToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		log.Warn().Err(err).Msg("Failed to generate cache refresh token")
+	}
+	return hex.EncodeToString(token)
+}
+
+// isRefresh reports whether the request was sent by the gateway to refresh a stale entry
+func isRefresh(apiStream public_types.APIStreamI) bool {
+	value, found := apiStream.GetHeader(CacheRefreshHeader)
+	return found && value == refreshToken
+}
+
+// refreshInBackground sends the request through the gateway again, without waiting for it,
+// so the flows handle it like a cache miss and WriteCache stores the fresh response
+func (p *readCacheProcessor) refreshInBackground(apiStream public_types.APIStreamI, cacheKey string) {
+	request, err := buildRefreshRequest(apiStream.GetRequest())
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to build refresh request of key %s", cacheKey)
+		return
+	}
+
+	go func() {
+		if err := p.sendRefresh(request); err != nil {
+			log.Debug().Err(err).Msgf("Failed to refresh cache entry of key %s", cacheKey)
+			return
+		}
+		log.Trace().Msgf("Refreshed cache entry of key %s", cacheKey)
+	}()
+}
+
+func buildRefreshRequest(original public_types.TransactionI) (*http.Request, error) {
+	if original == nil {
+		return nil, fmt.Errorf("request is not available")
+	}
+
+	target := fmt.Sprintf("http://localhost:%s%s", environment.GetBindPort(), original.GetPath())
+	if query := original.GetQuery(); query != "" {
+		target = fmt.Sprintf("%s?%s", target, query)
+	}
+
+	var body io.Reader
+	if originalBody := original.GetBody(); originalBody != "" {
+		body = strings.NewReader(originalBody)
+	}
+	request, err := http.NewRequest(original.GetMethod(), target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh request: %w", err)
+	}
+
+	for name, value := range original.GetHeaders() {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set(lunarHostHeader, original.GetHost())
+	if scheme := original.GetScheme(); scheme != "" {
+		request.Header.Set(lunarSchemeHeader, scheme)
+	}
+	request.Header.Set(CacheRefreshHeader, refreshToken)
+	return request, nil
+}
+
+func sendToGateway(request *http.Request) error {
+	response, err := refreshClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("refresh failed with status %d", response.StatusCode)
+	}
+	return nil
+}
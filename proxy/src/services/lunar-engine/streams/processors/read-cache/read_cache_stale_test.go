@@ -0,0 +1,268 @@
+package readcache
+
+import (
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var staleCachingKeyParts = []string{"$.request.headers.api_key"}
+
+func newStaleTestProcessor(t *testing.T) *readCacheProcessor {
+	proc, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name: "ReadCache",
+		Parameters: map[string]streamtypes.ProcessorParam{
+			cachingKeyPartsParam: {
+				Name:  cachingKeyPartsParam,
+				Value: public_types.NewParamValue(staleCachingKeyParts),
+			},
+		},
+	})
+	require.NoError(t, err)
+	return proc.(*readCacheProcessor)
+}
+
+func newStaleTestStream(status int, respBody string) public_types.APIStreamI {
+	return test_utils.NewMockAPIStreamFull(
+		public_types.StreamTypeRequest,
+		"GET",
+		"https://example.com/orders",
+		map[string]string{"api_key": "key123"},
+		map[string]string{"Content-Type": "application/json"},
+		"",
+		respBody,
+		status,
+	)
+}
+
+// storeStaleTestEntry stores the response of the stream as WriteCache would
+func storeStaleTestEntry(
+	t *testing.T,
+	proc *readCacheProcessor,
+	apiStream public_types.APIStreamI,
+	ttl, staleWhileRevalidate, staleIfError int64,
+) {
+	key, err := utils.BuildSharedMemoryKey("testFlow", staleCachingKeyParts, apiStream)
+	require.NoError(t, err)
+	entry, err := utils.BuildSharedMemoryStaleTTLEntry(
+		ttl, staleWhileRevalidate, staleIfError, apiStream.GetResponse())
+	require.NoError(t, err)
+	require.NoError(t, proc.cachedResponses.Set(key, entry))
+}
+
+// captureRefreshes replaces the refresh sender of the processor with a channel of the sent requests
+func captureRefreshes(proc *readCacheProcessor) chan *http.Request {
+	refreshes := make(chan *http.Request, 10)
+	proc.sendRefresh = func(request *http.Request) error {
+		refreshes <- request
+		return nil
+	}
+	return refreshes
+}
+
+func TestReadCacheStaleWhileRevalidate(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	proc := newStaleTestProcessor(t)
+	refreshes := captureRefreshes(proc)
+	apiStream := newStaleTestStream(200, `{"orders":[]}`)
+	storeStaleTestEntry(t, proc, apiStream, 10, 30, 0)
+
+	output, err := proc.Execute("testFlow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, hitConditionName, output.Name)
+	require.NotContains(t, output.ReqAction.(*actions.EarlyResponseAction).Headers, CacheStatusHeader)
+
+	// Expired, every request is served the stale entry and a single refresh is sent
+	mockClock.AdvanceTime(15 * time.Second)
+	for i := 0; i < 2; i++ {
+		output, err = proc.Execute("testFlow", apiStream)
+		require.NoError(t, err)
+		require.Equal(t, staleConditionName, output.Name)
+		require.Equal(t, public_types.StreamTypeResponse, output.Type)
+		earlyResponse := output.ReqAction.(*actions.EarlyResponseAction)
+		require.Equal(t, `{"orders":[]}`, earlyResponse.Body)
+		require.Equal(t, "stale", earlyResponse.Headers[CacheStatusHeader])
+	}
+
+	var refresh *http.Request
+	select {
+	case refresh = <-refreshes:
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not refreshed")
+	}
+	require.Equal(t, "GET", refresh.Method)
+	require.Equal(t, "/orders", refresh.URL.Path)
+	require.Equal(t, "key123", refresh.Header.Get("api_key"))
+	require.Equal(t, "example.com", refresh.Header.Get(lunarHostHeader))
+	require.Equal(t, refreshToken, refresh.Header.Get(CacheRefreshHeader))
+	require.Empty(t, refreshes)
+
+	// Another refresh is sent once the revalidation lease is over
+	mockClock.AdvanceTime(revalidationLease)
+	output, err = proc.Execute("testFlow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, staleConditionName, output.Name)
+	select {
+	case <-refreshes:
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not refreshed after the lease")
+	}
+
+	// Beyond the stale period the entry is not served
+	mockClock.AdvanceTime(30 * time.Second)
+	output, err = proc.Execute("testFlow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, missConditionName, output.Name)
+	output, err = proc.Execute("testFlow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, missConditionName, output.Name)
+}
+
+func TestReadCacheRefreshRequestSkipsLookup(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	proc := newStaleTestProcessor(t)
+	storeStaleTestEntry(t, proc, newStaleTestStream(200, `{"orders":[]}`), 10, 30, 0)
+	mockClock.AdvanceTime(15 * time.Second)
+
+	newRefreshStream := func(token string) public_types.APIStreamI {
+		return test_utils.NewMockAPIStreamFull(
+			public_types.StreamTypeRequest,
+			"GET",
+			"https://example.com/orders",
+			map[string]string{"api_key": "key123", CacheRefreshHeader: token},
+			nil,
+			"",
+			"",
+			200,
+		)
+	}
+
+	output, err := proc.Execute("testFlow", newRefreshStream(refreshToken))
+	require.NoError(t, err)
+	require.Equal(t, missConditionName, output.Name)
+
+	// Only refreshes sent by the gateway skip the lookup
+	output, err = proc.Execute("testFlow", newRefreshStream("forged"))
+	require.NoError(t, err)
+	require.Equal(t, staleConditionName, output.Name)
+}
+
+func TestReadCacheRevalidationLeaseExpiry(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	proc := newStaleTestProcessor(t)
+
+	require.True(t, proc.acquireRevalidation("key1"))
+	require.False(t, proc.acquireRevalidation("key1"))
+	require.True(t, proc.acquireRevalidation("key2"))
+
+	// Leases are only removed once they are over
+	_, err := proc.expireRevalidation("key1")
+	require.NoError(t, err)
+	require.Contains(t, proc.revalidations, "key1")
+
+	mockClock.AdvanceTime(revalidationLease)
+	_, err = proc.expireRevalidation("key1")
+	require.NoError(t, err)
+	require.NotContains(t, proc.revalidations, "key1")
+	require.Contains(t, proc.revalidations, "key2")
+}
+
+func TestReadCacheStaleIfError(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	proc := newStaleTestProcessor(t)
+	storeStaleTestEntry(t, proc, newStaleTestStream(200, `{"orders":[]}`), 10, 0, 60)
+
+	// Expired entries without a revalidation period are misses
+	mockClock.AdvanceTime(20 * time.Second)
+	output, err := proc.Execute("testFlow", newStaleTestStream(200, ""))
+	require.NoError(t, err)
+	require.Equal(t, missConditionName, output.Name)
+
+	// Successful responses are passed through
+	successStream := newStaleTestStream(200, `{"orders":[1]}`)
+	successStream.SetType(public_types.StreamTypeResponse)
+	output, err = proc.Execute("testFlow", successStream)
+	require.NoError(t, err)
+	require.Empty(t, output.Name)
+	require.IsType(t, &actions.NoOpAction{}, output.RespAction)
+
+	// Failed responses are replaced with the stale entry
+	failedStream := newStaleTestStream(503, "unavailable")
+	failedStream.SetType(public_types.StreamTypeResponse)
+	output, err = proc.Execute("testFlow", failedStream)
+	require.NoError(t, err)
+	require.Equal(t, staleConditionName, output.Name)
+	modifyResponse := output.RespAction.(*actions.ModifyResponseAction)
+	require.Equal(t, 200, modifyResponse.Status)
+	require.Equal(t, `{"orders":[]}`, modifyResponse.Body)
+	require.Equal(t, "stale", modifyResponse.HeadersToSet[CacheStatusHeader])
+
+	// Beyond the stale period failures are passed through
+	mockClock.AdvanceTime(time.Minute)
+	output, err = proc.Execute("testFlow", failedStream)
+	require.NoError(t, err)
+	require.Empty(t, output.Name)
+}
+
+func TestReadCacheHTTPSemanticsRevalidation(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	proc := newStaleTestProcessor(t)
+	proc.httpSemantics = true
+
+	apiStream := streamtypes.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:      "txn-1",
+		Method:  "GET",
+		URL:     "api.example.com/orders",
+		Headers: map[string]string{"api_key": "key123", "Accept-Language": "en"},
+	}, lunar_context.NewMemoryState[[]byte]()).
+		WithLunarContext(lunar_context.NewContextManager().WithFlowContext().GetLunarContext())
+
+	key, err := utils.BuildSharedMemoryKey("testFlow", staleCachingKeyParts, apiStream)
+	require.NoError(t, err)
+	entry, err := utils.NewSharedMemoryTTLEntry(10, test_utils.NewMockAPIResponseStream(
+		"https://api.example.com/orders", map[string]string{"ETag": `"v1"`}, "{}", 200).GetResponse())
+	require.NoError(t, err)
+	entry.WithHTTPValidators(map[string]string{"ETag": `"v1"`},
+		apiStream.GetHeaders(), []string{"Accept-Language"})
+	rawEntry, err := entry.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, proc.cachedResponses.Set(key, rawEntry))
+
+	output, err := proc.Execute("testFlow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, hitConditionName, output.Name)
+
+	// Expired entries with validators turn the request into a conditional request
+	mockClock.AdvanceTime(20 * time.Second)
+	output, err = proc.Execute("testFlow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, missConditionName, output.Name)
+	require.Equal(t, map[string]string{"If-None-Match": `"v1"`},
+		output.ReqAction.(*actions.ModifyHeadersAction).HeadersToSet)
+
+	revalidatedKey, found := utils.PopCacheRevalidation(apiStream)
+	require.True(t, found)
+	require.Equal(t, key, revalidatedKey)
+
+	// Requests with other values of the varying headers are plain misses
+	otherLanguage := streamtypes.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:      "txn-2",
+		Method:  "GET",
+		URL:     "api.example.com/orders",
+		Headers: map[string]string{"api_key": "key123", "Accept-Language": "fr"},
+	}, lunar_context.NewMemoryState[[]byte]())
+	output, err = proc.Execute("testFlow", otherLanguage)
+	require.NoError(t, err)
+	require.Equal(t, missConditionName, output.Name)
+	require.IsType(t, &actions.NoOpAction{}, output.ReqAction)
+}
@@ -0,0 +1,213 @@
+package processorretry
+
+import (
+	"fmt"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	jitterNone         = "none"
+	jitterFull         = "full"
+	jitterEqual        = "equal"
+	jitterDecorrelated = "decorrelated"
+
+	retryReasonFlow         = "flow"
+	retryReasonNetworkError = "network_error"
+	retryReasonExpression   = "expression"
+
+	retryAfterHeader = "Retry-After"
+
+	// lunarErrorHeader is set by the gateway on the responses it generates,
+	// these failures are also reported through /on_haproxy_error
+	lunarErrorHeader = "x-lunar-error"
+	// lunarErrorUnreachable is set when the provider cannot be reached
+	lunarErrorUnreachable = "2"
+	// lunarErrorTimeout is set when the provider did not respond in time
+	lunarErrorTimeout = "3"
+
+	// decorrelatedJitterGrowth bounds a decorrelated cooldown by the previous cooldown
+	decorrelatedJitterGrowth = 3
+
+	// requestTimeoutMargin is left between the cooldown and the retry request timeout
+	requestTimeoutMargin = time.Second
+)
+
+func (p *retryProcessor) initConditions() error {
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		jitterKey, &p.jitter); err != nil {
+		p.logger.Trace().Msgf("jitter not defined for %v", p.name)
+	}
+	switch p.jitter {
+	case "":
+		p.jitter = jitterNone
+	case jitterNone, jitterFull, jitterEqual, jitterDecorrelated:
+	default:
+		return fmt.Errorf("jitter should be one of %s, %s, %s or %s",
+			jitterNone, jitterFull, jitterEqual, jitterDecorrelated)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		honorRetryAfterKey, &p.honorRetryAfter); err != nil {
+		p.logger.Trace().Msgf("honor_retry_after not defined for %v", p.name)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		networkErrorsKey, &p.retryNetworkErrors); err != nil {
+		p.logger.Trace().Msgf("retry_on_network_errors not defined for %v", p.name)
+	}
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		expressionsKey, &p.expressions); err != nil {
+		p.logger.Trace().Msgf("retry_on_expressions not defined for %v", p.name)
+	}
+	return nil
+}
+
+// getRetryReason returns why the response should be retried.
+// Without retry conditions every response routed to the processor by the flow is retried,
+// otherwise the response has to match one of the conditions.
+func (p *retryProcessor) getRetryReason(apiStream public_types.APIStreamI) (string, bool) {
+	if !p.retryNetworkErrors && len(p.expressions) == 0 {
+		return retryReasonFlow, true
+	}
+
+	response := apiStream.GetResponse()
+	if response == nil {
+		return "", false
+	}
+
+	if p.retryNetworkErrors && isNetworkError(response.GetHeaders()) {
+		return retryReasonNetworkError, true
+	}
+
+	for _, expression := range p.expressions {
+		if p.matchesExpression(apiStream, expression) {
+			return retryReasonExpression, true
+		}
+	}
+	return "", false
+}
+
+// matchesExpression returns true if the JSONPath expression selects a value of the API call.
+// Expressions on the body are also evaluated on the parsed body, like the Filter processor does.
+func (p *retryProcessor) matchesExpression(
+	apiStream public_types.APIStreamI,
+	expression string,
+) bool {
+	bodyMapExpression := strings.Replace(expression, ".body.", ".body_map.", 1)
+	bodyMapExpression = strings.Replace(bodyMapExpression, ".body[", ".body_map[", 1)
+	for _, query := range []string{expression, bodyMapExpression} {
+		result, err := apiStream.JSONPathQuery(query)
+		if err != nil {
+			p.logger.Trace().Err(err).Msgf("Failed to evaluate retry expression %s", query)
+			continue
+		}
+		if len(result) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isNetworkError returns true for the gateway responses of connection failures and timeouts
+func isNetworkError(headers map[string]string) bool {
+	switch utils.GetHeaderValue(headers, lunarErrorHeader) {
+	case lunarErrorUnreachable, lunarErrorTimeout:
+		return true
+	}
+	return false
+}
+
+// getAttemptCooldown returns the time to wait before the attempt.
+// The Retry-After of the provider is used when honored, otherwise the jitter is applied
+// on the configured cooldown.
+func (p *retryProcessor) getAttemptCooldown(
+	currentRetryCount int,
+	apiStream public_types.APIStreamI,
+) time.Duration {
+	if p.honorRetryAfter {
+		if retryAfter, found := p.getRetryAfter(apiStream); found {
+			return p.capCooldown(retryAfter)
+		}
+	}
+
+	cooldown := p.getCooldownDuration(currentRetryCount)
+	switch p.jitter {
+	case jitterFull:
+		return p.randomDuration(0, cooldown)
+	case jitterEqual:
+		return cooldown/2 + p.randomDuration(0, cooldown/2)
+	case jitterDecorrelated:
+		return p.getDecorrelatedCooldown(apiStream)
+	}
+	return cooldown
+}
+
+// getDecorrelatedCooldown returns a random cooldown between the base cooldown and
+// a few times the previous cooldown of the transaction
+func (p *retryProcessor) getDecorrelatedCooldown(apiStream public_types.APIStreamI) time.Duration {
+	counterKey := p.getCounterKey(apiStream.GetSequenceID())
+	state := p.getRetryState(counterKey, apiStream)
+
+	previousCooldown := p.cooldown
+	if state.previousCooldown > 0 {
+		previousCooldown = state.previousCooldown
+	}
+
+	cooldown := p.capCooldown(p.randomDuration(p.cooldown,
+		max(previousCooldown*decorrelatedJitterGrowth, p.cooldown)))
+	state.previousCooldown = cooldown
+	p.setRetryState(counterKey, state, apiStream)
+	return cooldown
+}
+
+// getRetryAfter parses the Retry-After header of the response,
+// given either in seconds or as an HTTP date
+func (p *retryProcessor) getRetryAfter(apiStream public_types.APIStreamI) (time.Duration, bool) {
+	response := apiStream.GetResponse()
+	if response == nil {
+		return 0, false
+	}
+
+	retryAfter := strings.TrimSpace(utils.GetHeaderValue(response.GetHeaders(), retryAfterHeader))
+	if retryAfter == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(retryAfter, 10, 64); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+
+	retryAt, err := http.ParseTime(retryAfter)
+	if err != nil {
+		p.logger.Debug().Err(err).Msgf("Invalid %s header: %s", retryAfterHeader, retryAfter)
+		return 0, false
+	}
+	return max(retryAt.Sub(p.metaData.Clock.Now()), 0), true
+}
+
+func (p *retryProcessor) capCooldown(cooldown time.Duration) time.Duration {
+	if p.maximumCooldown > 0 && cooldown > p.maximumCooldown {
+		cooldown = p.maximumCooldown
+	}
+	// HAProxy stops waiting for the retry decision after the retry request timeout,
+	// so the retry is sent a little before it
+	if p.requestTimeout > 0 {
+		latestCooldown := p.requestTimeout - min(requestTimeoutMargin, p.requestTimeout/2)
+		cooldown = min(cooldown, latestCooldown)
+	}
+	return cooldown
+}
+
+// randomDuration returns a random duration in [from, to)
+func (p *retryProcessor) randomDuration(from, to time.Duration) time.Duration {
+	if to <= from {
+		return from
+	}
+	return from + time.Duration(p.random()*float64(to-from))
+}
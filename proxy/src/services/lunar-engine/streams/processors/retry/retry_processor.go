@@ -7,14 +7,17 @@ import (
 	lunar_metrics "lunar/engine/metrics"
 	"lunar/engine/streams/processors/utils"
 	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/streams/tracing"
 	stream_types "lunar/engine/streams/types"
 	"lunar/engine/utils/environment"
 	"lunar/toolkit-core/otel"
+	"math/rand/v2"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
@@ -23,11 +26,24 @@ const (
 	cooldownKey           = "cooldown_between_attempts_seconds"
 	cooldownMultiplierKey = "cooldown_multiplier"
 	maximumCooldownKey    = "maximum_cooldown_seconds"
+	jitterKey             = "jitter"
+	honorRetryAfterKey    = "honor_retry_after"
+	networkErrorsKey      = "retry_on_network_errors"
+	expressionsKey        = "retry_on_expressions"
+	retryBudgetIDKey      = "retry_budget_id"
 
-	retryCountMetric       = "lunar_retry_processor_retry_count"
-	failedRetryCountMetric = "lunar_retry_processor_failed_retry_count"
+	retryConditionName           = "retry"
+	failedConditionName          = "failed"
+	notRetriedConditionName      = "not_retried"
+	budgetExhaustedConditionName = "budget_exhausted"
+
+	retryCountMetric           = "lunar_retry_processor_retry_count"
+	failedRetryCountMetric     = "lunar_retry_processor_failed_retry_count"
+	budgetExhaustedCountMetric = "lunar_retry_processor_budget_exhausted_count"
 
 	maxTimeoutAllowed = 2147483 * time.Second
+
+	retryAttemptSpanName = "retry#attempt"
 )
 
 type retryProcessor struct {
@@ -35,11 +51,20 @@ type retryProcessor struct {
 	attempts           int
 	cooldown           time.Duration
 	maximumCooldown    time.Duration
+	requestTimeout     time.Duration
 	cooldownMultiplier float64
-	metaData           *stream_types.ProcessorMetaData
-	logger             zerolog.Logger
-	labelManager       *lunar_metrics.LabelManager
-	metricObjects      map[string]metric.Float64Counter
+	jitter             string
+	honorRetryAfter    bool
+	retryNetworkErrors bool
+	expressions        []string
+	retryBudgetID      string
+	retryBudget        public_types.RetryBudgetResourceI
+	// random returns a number in [0, 1), used for the jitter
+	random        func() float64
+	metaData      *stream_types.ProcessorMetaData
+	logger        zerolog.Logger
+	labelManager  *lunar_metrics.LabelManager
+	metricObjects map[string]metric.Float64Counter
 }
 
 func NewProcessor(metaData *stream_types.ProcessorMetaData) (stream_types.ProcessorI, error) {
@@ -47,6 +72,7 @@ func NewProcessor(metaData *stream_types.ProcessorMetaData) (stream_types.Proces
 		name:          metaData.Name,
 		metaData:      metaData,
 		metricObjects: make(map[string]metric.Float64Counter),
+		random:        rand.Float64,
 		labelManager:  lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
 	}
 
@@ -67,6 +93,17 @@ func (p *retryProcessor) Execute(
 	APIStream public_types.APIStreamI,
 ) (stream_types.ProcessorIO, error) {
 	retryCounterKey := p.getCounterKey(APIStream.GetSequenceID())
+
+	reason, shouldRetry := p.getRetryReason(APIStream)
+	if !shouldRetry {
+		p.removeCount(retryCounterKey, APIStream)
+		p.logger.Trace().Msg("Response does not match the retry conditions, will not retry")
+		return stream_types.ProcessorIO{
+			Type: public_types.StreamTypeRequest,
+			Name: notRetriedConditionName,
+		}, nil
+	}
+
 	currentRetryCount := p.incrementRetryCount(retryCounterKey, APIStream)
 
 	if currentRetryCount > p.attempts {
@@ -75,23 +112,47 @@ func (p *retryProcessor) Execute(
 		p.updateMetrics(failedRetryCountMetric, flowName, APIStream)
 		return stream_types.ProcessorIO{
 			Type:    public_types.StreamTypeRequest,
-			Name:    "failed",
+			Name:    failedConditionName,
 			Failure: true,
 		}, nil
 	}
 
-	cooldownDuration := p.getCooldownDuration(currentRetryCount)
+	if p.retryBudget != nil && !p.retryBudget.TryRetry() {
+		p.removeCount(retryCounterKey, APIStream)
+		p.logger.Trace().Msgf("Retry budget %s exhausted, will not retry", p.retryBudgetID)
+		p.updateMetrics(budgetExhaustedCountMetric, flowName, APIStream)
+		return stream_types.ProcessorIO{
+			Type:    public_types.StreamTypeRequest,
+			Name:    budgetExhaustedConditionName,
+			Failure: true,
+		}, nil
+	}
+
+	cooldownDuration := p.getAttemptCooldown(currentRetryCount, APIStream)
 
 	p.logger.Trace().Int("currentRetryCount", currentRetryCount).
 		Dur("cooldown", cooldownDuration).Msg("waiting before retry")
 
+	_, span := tracing.StartSpan(APIStream, retryAttemptSpanName)
+	span.SetAttributes(
+		attribute.String(lunar_metrics.FlowName, flowName),
+		attribute.String(lunar_metrics.ProcessorKey, p.name),
+		attribute.String("lunar.sequence_id", APIStream.GetSequenceID()),
+		attribute.Int("retry.attempt", currentRetryCount),
+		attribute.String("retry.reason", reason),
+		attribute.Int64("retry.cooldown_ms", cooldownDuration.Milliseconds()),
+	)
+	if response := APIStream.GetResponse(); response != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", response.GetStatus()))
+	}
 	<-p.metaData.Clock.After(cooldownDuration)
+	span.End()
 
 	p.updateMetrics(retryCountMetric, flowName, APIStream)
 	return stream_types.ProcessorIO{
 		RespAction: &actions.RetryRequestAction{},
 		Type:       public_types.StreamTypeRequest,
-		Name:       "retry",
+		Name:       retryConditionName,
 	}, nil
 }
 
@@ -101,35 +162,55 @@ func (p *retryProcessor) GetName() string {
 
 func (p *retryProcessor) GetRequirement() *stream_types.ProcessorRequirement {
 	return &stream_types.ProcessorRequirement{
-		IsReqCaptureRequired: true,
+		IsReqCaptureRequired:   true,
+		IsNetworkErrorRequired: p.retryNetworkErrors,
 	}
 }
 
-func (p *retryProcessor) incrementRetryCount(
+// retryState is the state of the retries of a request,
+// stored under its counter key so it is removed along with the counter
+type retryState struct {
+	attempts int
+	// previousCooldown is the cooldown of the last attempt, used by the decorrelated jitter
+	previousCooldown time.Duration
+}
+
+func (p *retryProcessor) getRetryState(
 	counterKey string,
 	APIStream public_types.APIStreamI,
-) int {
-	var currentRetryCount int
+) retryState {
 	flowContext := APIStream.GetContext().GetFlowContext()
-	currentRetryCountRaw, err := flowContext.Get(counterKey)
-
+	rawState, err := flowContext.Get(counterKey)
 	if err != nil {
 		log.Trace().Err(err).Msg("Failed to get retry counter")
-		currentRetryCount = 0
-	} else {
-		currentRetryCount = currentRetryCountRaw.(int)
+		return retryState{}
 	}
+	state, _ := rawState.(retryState)
+	return state
+}
 
-	updatedRetryCount := currentRetryCount + 1
-
-	err = flowContext.Set(counterKey, updatedRetryCount)
-	if err != nil {
+func (p *retryProcessor) setRetryState(
+	counterKey string,
+	state retryState,
+	APIStream public_types.APIStreamI,
+) {
+	flowContext := APIStream.GetContext().GetFlowContext()
+	if err := flowContext.Set(counterKey, state); err != nil {
 		p.logger.Debug().Err(err).Msg("Failed to set retry counter")
 	}
+}
 
-	return updatedRetryCount
+func (p *retryProcessor) incrementRetryCount(
+	counterKey string,
+	APIStream public_types.APIStreamI,
+) int {
+	state := p.getRetryState(counterKey, APIStream)
+	state.attempts++
+	p.setRetryState(counterKey, state, APIStream)
+	return state.attempts
 }
 
+// removeCount removes the retry state of the request, whatever its outcome
 func (p *retryProcessor) removeCount(
 	counterKey string,
 	APIStream public_types.APIStreamI,
@@ -137,7 +218,7 @@ func (p *retryProcessor) removeCount(
 	flowContext := APIStream.GetContext().GetFlowContext()
 	_, err := flowContext.Pop(counterKey)
 	if err != nil {
-		p.logger.Debug().Err(err).Msg("Failed to remove retry counter")
+		p.logger.Trace().Err(err).Msg("Failed to remove retry counter")
 	}
 }
 
@@ -194,6 +275,14 @@ func (p *retryProcessor) init() error {
 		return err
 	}
 
+	if err := p.initConditions(); err != nil {
+		return err
+	}
+
+	if err := p.initRetryBudget(); err != nil {
+		return err
+	}
+
 	if p.maximumCooldown < 0 {
 		return fmt.Errorf("maximumCooldown should be greater than 0")
 	} else if p.maximumCooldown > maxTimeoutAllowed {
@@ -204,6 +293,7 @@ func (p *retryProcessor) init() error {
 	if err != nil {
 		return err
 	}
+	p.requestTimeout = configuredTimeout
 
 	// Verify that the cooldown duration for each attempt is less than the configured timeout
 	// Take in consideration that each retry can wait for the duration of the following attempts
@@ -227,6 +317,28 @@ func (p *retryProcessor) init() error {
 	return nil
 }
 
+func (p *retryProcessor) initRetryBudget() error {
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		retryBudgetIDKey, &p.retryBudgetID); err != nil {
+		p.logger.Trace().Msgf("retry_budget_id not defined for %v", p.name)
+	}
+	if p.retryBudgetID == "" {
+		return nil
+	}
+
+	if p.metaData.Resources == nil {
+		return fmt.Errorf("resources are not available for processor %s", p.name)
+	}
+
+	retryBudget, err := p.metaData.Resources.GetRetryBudget(p.retryBudgetID)
+	if err != nil {
+		return fmt.Errorf("retry budget %s not found for processor %s: %w",
+			p.retryBudgetID, p.name, err)
+	}
+	p.retryBudget = retryBudget
+	return nil
+}
+
 func (p *retryProcessor) initializeMetrics() error {
 	log.Info().Msgf("Initializing metrics for %s", p.name)
 	if !p.metaData.IsMetricsEnabled() {
@@ -249,6 +361,13 @@ func (p *retryProcessor) initializeMetrics() error {
 	}
 	p.metricObjects[failedRetryCountMetric] = meterObj
 
+	meterObj, err = meter.Float64Counter(budgetExhaustedCountMetric,
+		metric.WithDescription(fmt.Sprintf("Retries refused by the retry budget for %s", p.name)))
+	if err != nil {
+		return fmt.Errorf("failed to initialize budget exhausted count metric: %w", err)
+	}
+	p.metricObjects[budgetExhaustedCountMetric] = meterObj
+
 	log.Info().Msgf("Metrics initialized for %s", p.name)
 	return nil
 }
@@ -0,0 +1,258 @@
+package processorretry
+
+import (
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/streams/resources"
+	quotaresource "lunar/engine/streams/resources/quota"
+	retrybudgetresource "lunar/engine/streams/resources/retry_budget"
+	test_utils "lunar/engine/streams/test-utils"
+	stream_types "lunar/engine/streams/types"
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/clock"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProcessor(t *testing.T, extraParams map[string]any) *retryProcessor {
+	return newTestProcessorWithResources(t, extraParams, nil)
+}
+
+func newTestProcessorWithResources(
+	t *testing.T,
+	extraParams map[string]any,
+	resources public_types.ResourceManagementI,
+) *retryProcessor {
+	t.Setenv(environment.LuaRetryRequestTimeoutSecEnvVar, "100")
+
+	proc, err := NewProcessor(&stream_types.ProcessorMetaData{
+		Name:       "Retry",
+		Parameters: test_utils.NewProcessorParams(defaultTestParams, extraParams),
+		Clock:      clock.NewRealClock(),
+		Resources:  resources,
+	})
+	require.NoError(t, err)
+	return proc.(*retryProcessor)
+}
+
+// defaultTestParams are the parameters of a test processor, unless overridden
+var defaultTestParams = map[string]any{
+	attemptsKey:           2,
+	cooldownKey:           0,
+	cooldownMultiplierKey: 0,
+	maximumCooldownKey:    0,
+}
+
+func newTestStream(status int, headers map[string]string, body string) public_types.APIStreamI {
+	apiStream := stream_types.NewResponseAPIStream(lunar_messages.OnResponse{
+		ID:         "txn-1",
+		SequenceID: "seq-1",
+		Method:     "POST",
+		URL:        "api.example.com/completions",
+		Status:     status,
+		Headers:    headers,
+		RawBody:    []byte(body),
+	}, lunar_context.NewMemoryState[[]byte]())
+	return apiStream.WithLunarContext(
+		lunar_context.NewContextManager().WithFlowContext().GetLunarContext())
+}
+
+func TestRetryConditions(t *testing.T) {
+	proc := newTestProcessor(t, map[string]any{
+		networkErrorsKey: true,
+		expressionsKey:   []string{"$.response.body[?(@.code == 'overloaded')]"},
+	})
+
+	for _, test := range []struct {
+		name      string
+		status    int
+		headers   map[string]string
+		body      string
+		condition string
+	}{
+		{"unreachable", 503, map[string]string{"x-lunar-error": "2"}, "", retryConditionName},
+		{"timeout", 504, map[string]string{"X-Lunar-Error": "3"}, "", retryConditionName},
+		{"unresolved host", 503, map[string]string{"x-lunar-error": "5"}, "", notRetriedConditionName},
+		{"overloaded", 529, nil, `{"error":{"code":"overloaded"}}`, retryConditionName},
+		{"other error", 500, nil, `{"error":{"code":"internal"}}`, notRetriedConditionName},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := proc.Execute("flow", newTestStream(test.status, test.headers, test.body))
+			require.NoError(t, err)
+			require.Equal(t, test.condition, output.Name)
+			if test.condition == retryConditionName {
+				require.IsType(t, &actions.RetryRequestAction{}, output.RespAction)
+			}
+		})
+	}
+}
+
+func TestRetryRequiresNetworkErrorsOnlyWhenRetryingThem(t *testing.T) {
+	require.False(t, newTestProcessor(t, nil).GetRequirement().IsNetworkErrorRequired)
+
+	requirement := newTestProcessor(t, map[string]any{networkErrorsKey: true}).GetRequirement()
+	require.True(t, requirement.IsNetworkErrorRequired)
+	require.True(t, requirement.IsReqCaptureRequired)
+}
+
+func TestRetryWithoutConditionsUntilAttemptsRunOut(t *testing.T) {
+	proc := newTestProcessor(t, nil)
+	apiStream := newTestStream(500, nil, "")
+
+	for range proc.attempts {
+		output, err := proc.Execute("flow", apiStream)
+		require.NoError(t, err)
+		require.Equal(t, retryConditionName, output.Name)
+	}
+
+	output, err := proc.Execute("flow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, failedConditionName, output.Name)
+	require.True(t, output.Failure)
+}
+
+func TestRetryJitter(t *testing.T) {
+	for _, test := range []struct {
+		jitter    string
+		cooldowns []time.Duration
+	}{
+		{jitterNone, []time.Duration{4 * time.Second, 4 * time.Second}},
+		{jitterFull, []time.Duration{2 * time.Second, 2 * time.Second}},
+		{jitterEqual, []time.Duration{3 * time.Second, 3 * time.Second}},
+		// between the cooldown and three times the previous cooldown, capped by the maximum
+		{jitterDecorrelated, []time.Duration{8 * time.Second, 10 * time.Second}},
+	} {
+		t.Run(test.jitter, func(t *testing.T) {
+			proc := newTestProcessor(t, map[string]any{
+				cooldownKey:        4,
+				maximumCooldownKey: 10,
+				jitterKey:          test.jitter,
+			})
+			proc.random = func() float64 { return 0.5 }
+			apiStream := newTestStream(500, nil, "")
+
+			for attempt, expected := range test.cooldowns {
+				require.Equal(t, expected, proc.getAttemptCooldown(attempt+1, apiStream))
+			}
+		})
+	}
+}
+
+func TestRetryStateRemovedOnceNotRetried(t *testing.T) {
+	proc := newTestProcessor(t, map[string]any{
+		cooldownKey:    4,
+		jitterKey:      jitterDecorrelated,
+		expressionsKey: []string{"$.response.body[?(@.code == 'overloaded')]"},
+	})
+	proc.random = func() float64 { return 0.5 }
+	apiStream := newTestStream(500, nil, "")
+	counterKey := proc.getCounterKey(apiStream.GetSequenceID())
+
+	require.Equal(t, 8*time.Second, proc.getAttemptCooldown(1, apiStream))
+	require.Equal(t, 8*time.Second, proc.getRetryState(counterKey, apiStream).previousCooldown)
+
+	// the response of the retry succeeded, the previous cooldown goes along with the counter
+	output, err := proc.Execute("flow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, notRetriedConditionName, output.Name)
+	_, err = apiStream.GetContext().GetFlowContext().Get(counterKey)
+	require.Error(t, err)
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	proc := newTestProcessor(t, map[string]any{
+		cooldownKey:        1,
+		maximumCooldownKey: 20,
+		honorRetryAfterKey: true,
+	})
+
+	retryAt := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	for _, test := range []struct {
+		retryAfter string
+		cooldown   time.Duration
+	}{
+		{"7", 7 * time.Second},
+		// capped by the maximum cooldown
+		{retryAt, 20 * time.Second},
+		{"soon", time.Second},
+	} {
+		apiStream := newTestStream(429, map[string]string{"retry-after": test.retryAfter}, "")
+		require.Equal(t, test.cooldown, proc.getAttemptCooldown(1, apiStream), test.retryAfter)
+	}
+}
+
+func TestRetryCooldownCappedByRequestTimeout(t *testing.T) {
+	proc := newTestProcessor(t, map[string]any{
+		cooldownKey:        40,
+		honorRetryAfterKey: true,
+		jitterKey:          jitterDecorrelated,
+	})
+	proc.random = func() float64 { return 0.5 }
+	require.Equal(t, 100*time.Second, proc.requestTimeout)
+
+	// the Retry-After of the provider would outlive the retry request of HAProxy
+	apiStream := newTestStream(429, map[string]string{"retry-after": "3600"}, "")
+	require.Equal(t, 99*time.Second, proc.getAttemptCooldown(1, apiStream))
+
+	// so would the decorrelated jitter, which grows from the previous cooldown
+	apiStream = newTestStream(500, nil, "")
+	require.Equal(t, 80*time.Second, proc.getAttemptCooldown(1, apiStream))
+	require.Equal(t, 99*time.Second, proc.getAttemptCooldown(2, apiStream))
+}
+
+func TestRetryInvalidJitter(t *testing.T) {
+	t.Setenv(environment.LuaRetryRequestTimeoutSecEnvVar, "100")
+	params := test_utils.NewProcessorParams(defaultTestParams, map[string]any{jitterKey: "random"})
+	_, err := NewProcessor(&stream_types.ProcessorMetaData{
+		Name:       "Retry",
+		Parameters: params,
+		Clock:      clock.NewRealClock(),
+	})
+	require.Error(t, err)
+}
+
+func TestRetryBudgetExhausted(t *testing.T) {
+	resourceManagement, err := resources.NewResourceManagement()
+	require.NoError(t, err)
+	resourceManagement, err = resourceManagement.WithQuotaData(
+		[]*quotaresource.QuotaResourceData{
+			{
+				RetryBudgets: []*retrybudgetresource.RetryBudgetConfig{
+					{ID: "budget", RetryPercentage: 50},
+				},
+			},
+		})
+	require.NoError(t, err)
+
+	proc := newTestProcessorWithResources(t, map[string]any{retryBudgetIDKey: "budget"},
+		resourceManagement)
+
+	// two successful requests fund a single retry
+	for range 2 {
+		resourceManagement.OnResponseFinish(newTestStream(200, nil, ""))
+	}
+
+	output, err := proc.Execute("flow", newTestStream(500, nil, ""))
+	require.NoError(t, err)
+	require.Equal(t, retryConditionName, output.Name)
+
+	output, err = proc.Execute("flow", newTestStream(500, nil, ""))
+	require.NoError(t, err)
+	require.Equal(t, budgetExhaustedConditionName, output.Name)
+	require.True(t, output.Failure)
+
+	params := test_utils.NewProcessorParams(defaultTestParams,
+		map[string]any{retryBudgetIDKey: "missing"})
+	_, err = NewProcessor(&stream_types.ProcessorMetaData{
+		Name:       "Retry",
+		Parameters: params,
+		Clock:      clock.NewRealClock(),
+		Resources:  resourceManagement,
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,387 @@
+package processorschemavalidation
+
+import (
+	"fmt"
+	pathparamsresource "lunar/engine/streams/resources/path_params"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	componentsSchemasRef       = "#/components/schemas/"
+	componentsParametersRef    = "#/components/parameters/"
+	componentsRequestBodiesRef = "#/components/requestBodies/"
+	componentsResponsesRef     = "#/components/responses/"
+
+	defaultResponseKey = "default"
+)
+
+// openAPIDocument is the subset of an OpenAPI 3 document used for validation
+type openAPIDocument struct {
+	OpenAPI    string               `yaml:"openapi"`
+	Servers    []*server            `yaml:"servers"`
+	Paths      map[string]*pathItem `yaml:"paths"`
+	Components components           `yaml:"components"`
+}
+
+type server struct {
+	URL       string                     `yaml:"url"`
+	Variables map[string]*serverVariable `yaml:"variables"`
+}
+
+type serverVariable struct {
+	Default string `yaml:"default"`
+}
+
+type components struct {
+	Schemas       map[string]*Schema      `yaml:"schemas"`
+	Parameters    map[string]*parameter   `yaml:"parameters"`
+	RequestBodies map[string]*requestBody `yaml:"requestBodies"`
+	Responses     map[string]*response    `yaml:"responses"`
+}
+
+type pathItem struct {
+	Parameters []*parameter `yaml:"parameters"`
+	Get        *operation   `yaml:"get"`
+	Put        *operation   `yaml:"put"`
+	Post       *operation   `yaml:"post"`
+	Delete     *operation   `yaml:"delete"`
+	Options    *operation   `yaml:"options"`
+	Head       *operation   `yaml:"head"`
+	Patch      *operation   `yaml:"patch"`
+	Trace      *operation   `yaml:"trace"`
+}
+
+type operation struct {
+	OperationID string               `yaml:"operationId"`
+	Parameters  []*parameter         `yaml:"parameters"`
+	RequestBody *requestBody         `yaml:"requestBody"`
+	Responses   map[string]*response `yaml:"responses"`
+}
+
+type parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type requestBody struct {
+	Ref      string                `yaml:"$ref"`
+	Required bool                  `yaml:"required"`
+	Content  map[string]*mediaType `yaml:"content"`
+}
+
+type response struct {
+	Ref     string                `yaml:"$ref"`
+	Content map[string]*mediaType `yaml:"content"`
+}
+
+type mediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// specOperation is an operation of the document with all of its references resolved
+type specOperation struct {
+	ID          string
+	Method      string
+	Template    string
+	Parameters  []*parameter
+	RequestBody *requestBody
+	Responses   map[string]*response
+}
+
+// apiSpec indexes the operations of an OpenAPI document by their URL templates
+type apiSpec struct {
+	document   *openAPIDocument
+	templates  *pathparamsresource.PathParams
+	operations map[string]map[string]*specOperation
+}
+
+func loadAPISpec(path string, serverURLs []string) (*apiSpec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI document %s: %w", path, err)
+	}
+	return parseAPISpec(content, serverURLs)
+}
+
+// parseAPISpec parses an OpenAPI 3 document (YAML or JSON).
+// Operations are registered under each of the given server URLs,
+// or under the servers declared by the document when none are given.
+func parseAPISpec(content []byte, serverURLs []string) (*apiSpec, error) {
+	document := &openAPIDocument{}
+	if err := yaml.Unmarshal(content, document); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(document.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version '%s', only OpenAPI 3 is supported",
+			document.OpenAPI)
+	}
+
+	if len(serverURLs) == 0 {
+		for _, server := range document.Servers {
+			serverURLs = append(serverURLs, server.resolveURL())
+		}
+	}
+	if len(serverURLs) == 0 {
+		return nil, fmt.Errorf("no servers are defined, a server URL is required to match requests")
+	}
+
+	spec := &apiSpec{
+		document:   document,
+		operations: make(map[string]map[string]*specOperation),
+	}
+	var templates []string
+	for _, serverURL := range serverURLs {
+		base, err := normalizeServerURL(serverURL)
+		if err != nil {
+			return nil, err
+		}
+
+		for path, item := range document.Paths {
+			template := base + "/" + strings.Trim(path, "/")
+			template = strings.TrimSuffix(template, "/")
+			if _, found := spec.operations[template]; found {
+				continue
+			}
+
+			operations, err := spec.buildOperations(template, item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %s: %w", path, err)
+			}
+			spec.operations[template] = operations
+			templates = append(templates, template)
+		}
+	}
+
+	templateParams, err := pathparamsresource.NewPathTemplates(templates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build path templates: %w", err)
+	}
+	spec.templates = templateParams
+	return spec, nil
+}
+
+// findOperation returns the operation matching the request URL (host and path) and method,
+// along with the path params extracted from the URL.
+// The operation is nil when the path is defined but the method is not.
+func (s *apiSpec) findOperation(
+	requestURL string,
+	method string,
+) (*specOperation, map[string]string, bool) {
+	requestURL = strings.TrimSuffix(strings.SplitN(requestURL, "?", 2)[0], "/")
+	template, pathParams, found := s.templates.Match(requestURL)
+	if !found {
+		return nil, nil, false
+	}
+	operations, found := s.operations[template]
+	if !found {
+		return nil, nil, false
+	}
+	return operations[strings.ToUpper(method)], pathParams, true
+}
+
+func (s *apiSpec) buildOperations(
+	template string,
+	item *pathItem,
+) (map[string]*specOperation, error) {
+	operations := make(map[string]*specOperation)
+	if item == nil {
+		return operations, nil
+	}
+
+	sharedParams, err := s.resolveParameters(item.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	for method, op := range item.operations() {
+		params, err := s.resolveParameters(op.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+
+		body, err := s.resolveRequestBody(op.RequestBody)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+
+		responses := make(map[string]*response, len(op.Responses))
+		for status, resp := range op.Responses {
+			resolved, err := s.resolveResponse(resp)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", method, err)
+			}
+			responses[strings.ToUpper(status)] = resolved
+		}
+
+		operations[method] = &specOperation{
+			ID:          op.OperationID,
+			Method:      method,
+			Template:    template,
+			Parameters:  mergeParameters(sharedParams, params),
+			RequestBody: body,
+			Responses:   responses,
+		}
+	}
+	return operations, nil
+}
+
+// resolveSchema follows the reference of the schema, if any
+func (s *apiSpec) resolveSchema(schema *Schema) (*Schema, error) {
+	visited := make(map[string]bool)
+	for schema != nil && schema.Ref != "" {
+		if visited[schema.Ref] {
+			return nil, fmt.Errorf("circular reference %s", schema.Ref)
+		}
+		visited[schema.Ref] = true
+
+		name, err := refName(schema.Ref, componentsSchemasRef)
+		if err != nil {
+			return nil, err
+		}
+		resolved, found := s.document.Components.Schemas[name]
+		if !found {
+			return nil, fmt.Errorf("schema %s is not defined", schema.Ref)
+		}
+		schema = resolved
+	}
+	return schema, nil
+}
+
+func (s *apiSpec) resolveParameters(params []*parameter) ([]*parameter, error) {
+	resolved := make([]*parameter, 0, len(params))
+	for _, param := range params {
+		if param == nil {
+			continue
+		}
+		if param.Ref != "" {
+			name, err := refName(param.Ref, componentsParametersRef)
+			if err != nil {
+				return nil, err
+			}
+			component, found := s.document.Components.Parameters[name]
+			if !found {
+				return nil, fmt.Errorf("parameter %s is not defined", param.Ref)
+			}
+			param = component
+		}
+		resolved = append(resolved, param)
+	}
+	return resolved, nil
+}
+
+func (s *apiSpec) resolveRequestBody(body *requestBody) (*requestBody, error) {
+	if body == nil || body.Ref == "" {
+		return body, nil
+	}
+	name, err := refName(body.Ref, componentsRequestBodiesRef)
+	if err != nil {
+		return nil, err
+	}
+	component, found := s.document.Components.RequestBodies[name]
+	if !found {
+		return nil, fmt.Errorf("request body %s is not defined", body.Ref)
+	}
+	return component, nil
+}
+
+func (s *apiSpec) resolveResponse(resp *response) (*response, error) {
+	if resp == nil || resp.Ref == "" {
+		return resp, nil
+	}
+	name, err := refName(resp.Ref, componentsResponsesRef)
+	if err != nil {
+		return nil, err
+	}
+	component, found := s.document.Components.Responses[name]
+	if !found {
+		return nil, fmt.Errorf("response %s is not defined", resp.Ref)
+	}
+	return component, nil
+}
+
+// findResponse returns the response declared for the status code,
+// falling back to the status range (e.g. 4XX) and to the default response.
+func (op *specOperation) findResponse(status int) (*response, bool) {
+	statusCode := fmt.Sprint(status)
+	for _, key := range []string{statusCode, statusCode[:1] + "XX", defaultResponseKey} {
+		if resp, found := op.Responses[strings.ToUpper(key)]; found {
+			return resp, true
+		}
+	}
+	return nil, false
+}
+
+func (item *pathItem) operations() map[string]*operation {
+	operations := make(map[string]*operation)
+	for method, op := range map[string]*operation{
+		"GET":     item.Get,
+		"PUT":     item.Put,
+		"POST":    item.Post,
+		"DELETE":  item.Delete,
+		"OPTIONS": item.Options,
+		"HEAD":    item.Head,
+		"PATCH":   item.Patch,
+		"TRACE":   item.Trace,
+	} {
+		if op != nil {
+			operations[method] = op
+		}
+	}
+	return operations
+}
+
+func (srv *server) resolveURL() string {
+	serverURL := srv.URL
+	for name, variable := range srv.Variables {
+		if variable != nil {
+			serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", variable.Default)
+		}
+	}
+	return serverURL
+}
+
+// normalizeServerURL converts a server URL into the host and base path format of request URLs
+func normalizeServerURL(serverURL string) (string, error) {
+	if !strings.Contains(serverURL, "://") {
+		serverURL = "https://" + strings.TrimPrefix(serverURL, "//")
+	}
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %s: %w", serverURL, err)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("server URL %s does not define a host", serverURL)
+	}
+	return parsed.Host + strings.TrimSuffix(parsed.Path, "/"), nil
+}
+
+// mergeParameters merges path level parameters with operation level parameters,
+// operation level parameters override path level parameters with the same name and location.
+func mergeParameters(shared, params []*parameter) []*parameter {
+	merged := make([]*parameter, 0, len(shared)+len(params))
+	overridden := make(map[string]bool, len(params))
+	for _, param := range params {
+		overridden[param.In+":"+param.Name] = true
+	}
+	for _, param := range shared {
+		if !overridden[param.In+":"+param.Name] {
+			merged = append(merged, param)
+		}
+	}
+	return append(merged, params...)
+}
+
+func refName(ref, prefix string) (string, error) {
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported reference %s, only local %s references are supported",
+			ref, prefix)
+	}
+	return strings.TrimPrefix(ref, prefix), nil
+}
@@ -0,0 +1,435 @@
+package processorschemavalidation
+
+import (
+	"context"
+	"fmt"
+	"lunar/engine/actions"
+	lunar_metrics "lunar/engine/metrics"
+	"lunar/engine/streams/processors/utils"
+	publictypes "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/otel"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	specFileParam                = "spec_file"
+	serverURLsParam              = "server_urls"
+	validateResponsesParam       = "validate_responses"
+	rejectUnknownOperationsParam = "reject_unknown_operations"
+
+	validConditionName   = "valid"
+	invalidConditionName = "invalid"
+
+	requestViolationsMetric  = lunar_metrics.MetricPrefix + "schema_validation_request_violations"
+	responseViolationsMetric = lunar_metrics.MetricPrefix + "schema_validation_response_violations"
+
+	operationAttribute = "operation"
+
+	locationPath   = "path"
+	locationQuery  = "query"
+	locationHeader = "header"
+	locationBody   = "body"
+	locationStatus = "status"
+)
+
+type schemaValidationProcessor struct {
+	name                    string
+	specFile                string
+	serverURLs              []string
+	validateResponses       bool
+	rejectUnknownOperations bool
+
+	spec      *apiSpec
+	validator *schemaValidator
+
+	metaData      *streamtypes.ProcessorMetaData
+	labelManager  *lunar_metrics.LabelManager
+	metricObjects map[string]metric.Int64Counter
+}
+
+func NewProcessor(
+	metaData *streamtypes.ProcessorMetaData,
+) (streamtypes.ProcessorI, error) {
+	proc := &schemaValidationProcessor{
+		name:          metaData.Name,
+		metaData:      metaData,
+		metricObjects: make(map[string]metric.Int64Counter),
+		labelManager:  lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
+	}
+
+	if err := proc.init(); err != nil {
+		return nil, err
+	}
+
+	if err := proc.initializeMetrics(); err != nil {
+		log.Error().Err(err).Msgf("failed to initialize metrics for %s", metaData.Name)
+		proc.metaData.Metrics.Enabled = false
+	}
+
+	return proc, nil
+}
+
+func (p *schemaValidationProcessor) GetName() string {
+	return p.name
+}
+
+func (p *schemaValidationProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
+	return &streamtypes.ProcessorRequirement{
+		IsBodyRequired: true,
+	}
+}
+
+func (p *schemaValidationProcessor) Execute(
+	flowName string,
+	apiStream publictypes.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	switch apiStream.GetType() {
+	case publictypes.StreamTypeRequest:
+		return p.onRequest(flowName, apiStream), nil
+	case publictypes.StreamTypeResponse:
+		return p.onResponse(flowName, apiStream), nil
+	}
+	return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
+}
+
+func (p *schemaValidationProcessor) init() error {
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		specFileParam,
+		&p.specFile); err != nil {
+		log.Error().Err(err).Msgf("Missing %s parameter", specFileParam)
+		return err
+	}
+
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		serverURLsParam,
+		&p.serverURLs); err != nil {
+		log.Trace().Msgf("server_urls not defined for %v", p.name)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		validateResponsesParam,
+		&p.validateResponses); err != nil {
+		log.Trace().Msgf("validate_responses not defined for %v", p.name)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		rejectUnknownOperationsParam,
+		&p.rejectUnknownOperations); err != nil {
+		log.Trace().Msgf("reject_unknown_operations not defined for %v", p.name)
+	}
+
+	specPath := p.specFile
+	if !filepath.IsAbs(specPath) {
+		specPath = filepath.Join(environment.GetConfigRootDirectory(), specPath)
+	}
+
+	spec, err := loadAPISpec(specPath, p.serverURLs)
+	if err != nil {
+		return fmt.Errorf("failed to load OpenAPI document for %s: %w", p.name, err)
+	}
+	p.spec = spec
+	p.validator = newSchemaValidator(spec)
+	return nil
+}
+
+func (p *schemaValidationProcessor) onRequest(
+	flowName string,
+	apiStream publictypes.APIStreamI,
+) streamtypes.ProcessorIO {
+	validationErrors, operationID := p.validateRequest(apiStream)
+	if len(validationErrors) == 0 {
+		return streamtypes.ProcessorIO{
+			Type:      publictypes.StreamTypeRequest,
+			Name:      validConditionName,
+			ReqAction: &actions.NoOpAction{},
+		}
+	}
+
+	log.Trace().Msgf("%s: request %s violates the API schema: %v",
+		p.name, apiStream.GetID(), validationErrors)
+	if err := utils.SetValidationErrors(apiStream, validationErrors); err != nil {
+		log.Trace().Err(err).Msgf("failed to publish validation errors for %s", p.name)
+	}
+	p.updateMetrics(requestViolationsMetric, flowName, operationID, apiStream)
+
+	return streamtypes.ProcessorIO{
+		Type:      publictypes.StreamTypeRequest,
+		Name:      invalidConditionName,
+		ReqAction: &actions.NoOpAction{},
+	}
+}
+
+// onResponse records violations of provider responses, responses are always passed through
+func (p *schemaValidationProcessor) onResponse(
+	flowName string,
+	apiStream publictypes.APIStreamI,
+) streamtypes.ProcessorIO {
+	if p.validateResponses {
+		validationErrors, operationID := p.validateResponse(apiStream)
+		if len(validationErrors) > 0 {
+			log.Debug().Msgf("%s: response of %s %s violates the API schema: %v",
+				p.name, apiStream.GetMethod(), apiStream.GetURL(), validationErrors)
+			p.updateMetrics(responseViolationsMetric, flowName, operationID, apiStream)
+		}
+	}
+
+	return streamtypes.ProcessorIO{
+		Type:       publictypes.StreamTypeResponse,
+		Name:       validConditionName,
+		RespAction: &actions.NoOpAction{},
+	}
+}
+
+// validateRequest returns the violations of the request along with the matching operation ID
+func (p *schemaValidationProcessor) validateRequest(
+	apiStream publictypes.APIStreamI,
+) ([]utils.ValidationError, string) {
+	request := apiStream.GetRequest()
+	if request == nil {
+		return nil, ""
+	}
+
+	operation, pathParams, validationErrors := p.findOperation(request.GetURL(), request.GetMethod())
+	if operation == nil {
+		return validationErrors, ""
+	}
+
+	query, err := url.ParseQuery(request.GetQuery())
+	if err != nil {
+		validationErrors = append(validationErrors,
+			newValidationError(locationQuery, "invalid query string: %v", err))
+	}
+
+	for _, param := range operation.Parameters {
+		var values []string
+		switch param.In {
+		case locationPath:
+			if value, found := pathParams[param.Name]; found {
+				values = []string{value}
+			}
+		case locationQuery:
+			values = query[param.Name]
+		case locationHeader:
+			if value, found := getHeader(request.GetHeaders(), param.Name); found {
+				values = []string{value}
+			}
+		default:
+			continue
+		}
+		validationErrors = append(validationErrors, p.validateParameter(param, values)...)
+	}
+
+	if operation.RequestBody != nil {
+		validationErrors = append(validationErrors, p.validateRequestBody(
+			operation.RequestBody, request.GetHeaders(), request.GetBody())...)
+	}
+	return validationErrors, operation.ID
+}
+
+// validateResponse returns the violations of the response along with the matching operation ID
+func (p *schemaValidationProcessor) validateResponse(
+	apiStream publictypes.APIStreamI,
+) ([]utils.ValidationError, string) {
+	response := apiStream.GetResponse()
+	if response == nil {
+		return nil, ""
+	}
+
+	operation, _, _ := p.findOperation(response.GetURL(), response.GetMethod())
+	if operation == nil {
+		return nil, ""
+	}
+
+	declared, found := operation.findResponse(response.GetStatus())
+	if !found {
+		return []utils.ValidationError{
+			newValidationError(locationStatus,
+				"status code %d is not documented", response.GetStatus()),
+		}, operation.ID
+	}
+
+	body := response.GetBody()
+	if body == "" || len(declared.Content) == 0 {
+		return nil, operation.ID
+	}
+	return p.validateContent(declared.Content, response.GetHeaders(), body), operation.ID
+}
+
+// findOperation returns the operation of the API call,
+// unknown operations are violations only when they are configured to be rejected.
+func (p *schemaValidationProcessor) findOperation(
+	requestURL string,
+	method string,
+) (*specOperation, map[string]string, []utils.ValidationError) {
+	operation, pathParams, pathFound := p.spec.findOperation(requestURL, method)
+	if operation != nil || !p.rejectUnknownOperations {
+		return operation, pathParams, nil
+	}
+
+	message := fmt.Sprintf("path %s is not defined", requestURL)
+	if pathFound {
+		message = fmt.Sprintf("method %s is not defined for %s", method, requestURL)
+	}
+	return nil, nil, []utils.ValidationError{{Location: locationPath, Message: message}}
+}
+
+func (p *schemaValidationProcessor) validateParameter(
+	param *parameter,
+	values []string,
+) []utils.ValidationError {
+	location := joinLocation(param.In, param.Name)
+	if len(values) == 0 {
+		if param.Required || param.In == locationPath {
+			return []utils.ValidationError{
+				newValidationError(location, "required parameter is missing"),
+			}
+		}
+		return nil
+	}
+
+	value, err := p.validator.coerceParameter(values, param.Schema)
+	if err != nil {
+		return []utils.ValidationError{newValidationError(location, "%v", err)}
+	}
+	return p.validator.validate(location, value, param.Schema)
+}
+
+func (p *schemaValidationProcessor) validateRequestBody(
+	body *requestBody,
+	headers map[string]string,
+	raw string,
+) []utils.ValidationError {
+	if raw == "" {
+		if body.Required {
+			return []utils.ValidationError{
+				newValidationError(locationBody, "required request body is missing"),
+			}
+		}
+		return nil
+	}
+	if len(body.Content) == 0 {
+		return nil
+	}
+	return p.validateContent(body.Content, headers, raw)
+}
+
+// validateContent validates a body against the media type matching its content type,
+// only JSON media types are validated against their schema.
+func (p *schemaValidationProcessor) validateContent(
+	content map[string]*mediaType,
+	headers map[string]string,
+	raw string,
+) []utils.ValidationError {
+	contentType, _ := getHeader(headers, "Content-Type")
+	mediaTypeName, declared, found := findMediaType(content, contentType)
+	if !found {
+		return []utils.ValidationError{
+			newValidationError(locationBody, "content type '%s' is not supported", contentType),
+		}
+	}
+	if declared == nil || declared.Schema == nil || !isJSONMediaType(mediaTypeName) {
+		return nil
+	}
+	return p.validator.validateJSON(locationBody, raw, declared.Schema)
+}
+
+func (p *schemaValidationProcessor) initializeMetrics() error {
+	log.Info().Msgf("Initializing metrics for %s", p.name)
+	if !p.metaData.IsMetricsEnabled() {
+		log.Info().Msgf("Metrics are disabled for %s", p.name)
+		return nil
+	}
+
+	meter := otel.GetMeter()
+	meterObj, err := meter.Int64Counter(
+		requestViolationsMetric,
+		metric.WithDescription("Requests violating the API schema by processor"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+	p.metricObjects[requestViolationsMetric] = meterObj
+
+	meterObj, err = meter.Int64Counter(
+		responseViolationsMetric,
+		metric.WithDescription("Provider responses violating the API schema by processor"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+	p.metricObjects[responseViolationsMetric] = meterObj
+
+	log.Info().Msgf("Metrics initialized for %s", p.name)
+	return nil
+}
+
+func (p *schemaValidationProcessor) updateMetrics(
+	metricName string,
+	flowName string,
+	operationID string,
+	provider lunar_metrics.APICallMetricsProviderI,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	if operationID != "" {
+		attributes = append(attributes, attribute.String(operationAttribute, operationID))
+	}
+	p.metricObjects[metricName].Add(context.Background(), 1, metric.WithAttributes(attributes...))
+}
+
+// findMediaType returns the declared media type matching the content type,
+// falling back to wildcard media types (e.g. application/* and */*).
+// A body without a content type is matched when a single media type is declared.
+func findMediaType(
+	content map[string]*mediaType,
+	contentType string,
+) (string, *mediaType, bool) {
+	if strings.TrimSpace(contentType) == "" && len(content) == 1 {
+		for name, declared := range content {
+			return strings.ToLower(name), declared, true
+		}
+	}
+
+	mediaTypeName, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaTypeName = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	candidates := []string{mediaTypeName}
+	if mainType, _, found := strings.Cut(mediaTypeName, "/"); found {
+		candidates = append(candidates, mainType+"/*")
+	}
+	candidates = append(candidates, "*/*")
+
+	for _, candidate := range candidates {
+		for name, declared := range content {
+			if strings.EqualFold(name, candidate) {
+				return mediaTypeName, declared, true
+			}
+		}
+	}
+	return mediaTypeName, nil, false
+}
+
+func isJSONMediaType(mediaTypeName string) bool {
+	return mediaTypeName == "application/json" || strings.HasSuffix(mediaTypeName, "+json")
+}
+
+func getHeader(headers map[string]string, name string) (string, bool) {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
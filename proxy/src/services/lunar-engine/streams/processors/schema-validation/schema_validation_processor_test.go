@@ -0,0 +1,404 @@
+package processorschemavalidation
+
+import (
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
+	publictypes "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/environment"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSpec = `
+openapi: 3.0.3
+info:
+  title: Items
+  version: "1.0"
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /items:
+    get:
+      operationId: listItems
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+        - $ref: '#/components/parameters/ApiKey'
+      responses:
+        "200":
+          description: items
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Item'
+    post:
+      operationId: createItem
+      parameters:
+        - $ref: '#/components/parameters/ApiKey'
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Item'
+      responses:
+        "201":
+          description: created
+  /items/{itemID}:
+    parameters:
+      - name: itemID
+        in: path
+        required: true
+        schema:
+          type: integer
+    get:
+      operationId: getItem
+      responses:
+        "200":
+          description: item
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Item'
+        4XX:
+          description: error
+components:
+  parameters:
+    ApiKey:
+      name: X-Api-Key
+      in: header
+      required: true
+      schema:
+        type: string
+        minLength: 8
+  schemas:
+    Item:
+      type: object
+      required: [name, price]
+      additionalProperties: false
+      properties:
+        name:
+          type: string
+        price:
+          type: number
+          minimum: 0
+        tags:
+          type: array
+          maxItems: 2
+          items:
+            type: string
+            enum: [new, sale]
+`
+
+func newTestProcessor(
+	t *testing.T,
+	params map[string]any,
+) *schemaValidationProcessor {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "items.yaml"), []byte(testSpec), 0o644))
+	prevRoot := environment.SetConfigRootDirectory(dir)
+	t.Cleanup(func() { environment.SetConfigRootDirectory(prevRoot) })
+
+	parameters := map[string]streamtypes.ProcessorParam{
+		specFileParam: {Name: specFileParam, Value: publictypes.NewParamValue("items.yaml")},
+	}
+	for name, value := range params {
+		parameters[name] = streamtypes.ProcessorParam{
+			Name:  name,
+			Value: publictypes.NewParamValue(value),
+		}
+	}
+
+	processor, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name:       "schema_validation",
+		Parameters: parameters,
+	})
+	require.NoError(t, err)
+	return processor.(*schemaValidationProcessor)
+}
+
+func newRequestStream(onRequest lunar_messages.OnRequest) publictypes.APIStreamI {
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	return streamtypes.NewRequestAPIStream(onRequest, lunar_context.NewMemoryState[[]byte]()).
+		WithLunarContext(lunarContext)
+}
+
+func TestSchemaValidationValidRequests(t *testing.T) {
+	processor := newTestProcessor(t, nil)
+
+	for _, onRequest := range []lunar_messages.OnRequest{
+		{
+			ID:      "list",
+			Method:  "GET",
+			URL:     "api.example.com/v1/items",
+			Query:   "limit=10",
+			Headers: map[string]string{"x-api-key": "secret-key"},
+		},
+		{
+			ID:      "create",
+			Method:  "POST",
+			URL:     "api.example.com/v1/items",
+			Headers: map[string]string{"x-api-key": "secret-key", "content-type": "application/json"},
+			RawBody: []byte(`{"name":"lamp","price":12.5,"tags":["new"]}`),
+		},
+		{
+			ID:     "get",
+			Method: "GET",
+			URL:    "api.example.com/v1/items/42",
+		},
+		{
+			ID:     "unknown",
+			Method: "DELETE",
+			URL:    "api.example.com/v1/orders/42",
+		},
+	} {
+		output, err := processor.Execute("flow", newRequestStream(onRequest))
+		require.NoError(t, err)
+		require.Equal(t, validConditionName, output.Name, onRequest.ID)
+	}
+}
+
+func TestSchemaValidationInvalidRequest(t *testing.T) {
+	processor := newTestProcessor(t, nil)
+
+	apiStream := newRequestStream(lunar_messages.OnRequest{
+		ID:      "invalid-create",
+		Method:  "POST",
+		URL:     "api.example.com/v1/items",
+		Headers: map[string]string{"x-api-key": "short", "content-type": "application/json"},
+		RawBody: []byte(`{"name":7,"tags":["new","sale","old"],"color":"red"}`),
+	})
+	output, err := processor.Execute("flow", apiStream)
+	require.NoError(t, err)
+	require.Equal(t, invalidConditionName, output.Name)
+
+	validationErrors, found := utils.PopValidationErrors(apiStream)
+	require.True(t, found)
+
+	locations := make([]string, 0, len(validationErrors))
+	for _, validationError := range validationErrors {
+		locations = append(locations, validationError.Location)
+	}
+	require.ElementsMatch(t, []string{
+		"header.X-Api-Key",
+		"body.price",
+		"body.color",
+		"body.name",
+		"body.tags",
+		"body.tags[2]",
+	}, locations)
+}
+
+func TestSchemaValidationInvalidParameters(t *testing.T) {
+	processor := newTestProcessor(t, nil)
+
+	for _, test := range []struct {
+		onRequest lunar_messages.OnRequest
+		location  string
+	}{
+		{
+			onRequest: lunar_messages.OnRequest{
+				ID:     "path",
+				Method: "GET",
+				URL:    "api.example.com/v1/items/abc",
+			},
+			location: "path.itemID",
+		},
+		{
+			onRequest: lunar_messages.OnRequest{
+				ID:      "query",
+				Method:  "GET",
+				URL:     "api.example.com/v1/items",
+				Query:   "limit=500",
+				Headers: map[string]string{"x-api-key": "secret-key"},
+			},
+			location: "query.limit",
+		},
+		{
+			onRequest: lunar_messages.OnRequest{
+				ID:     "header",
+				Method: "GET",
+				URL:    "api.example.com/v1/items",
+			},
+			location: "header.X-Api-Key",
+		},
+		{
+			onRequest: lunar_messages.OnRequest{
+				ID:      "body",
+				Method:  "POST",
+				URL:     "api.example.com/v1/items",
+				Headers: map[string]string{"x-api-key": "secret-key"},
+			},
+			location: "body",
+		},
+	} {
+		apiStream := newRequestStream(test.onRequest)
+		output, err := processor.Execute("flow", apiStream)
+		require.NoError(t, err)
+		require.Equal(t, invalidConditionName, output.Name, test.onRequest.ID)
+
+		validationErrors, found := utils.PopValidationErrors(apiStream)
+		require.True(t, found)
+		require.Len(t, validationErrors, 1, test.onRequest.ID)
+		require.Equal(t, test.location, validationErrors[0].Location)
+	}
+}
+
+func TestSchemaValidationRejectUnknownOperations(t *testing.T) {
+	processor := newTestProcessor(t, map[string]any{rejectUnknownOperationsParam: true})
+
+	for _, onRequest := range []lunar_messages.OnRequest{
+		{ID: "unknown-path", Method: "GET", URL: "api.example.com/v1/orders"},
+		{ID: "unknown-method", Method: "DELETE", URL: "api.example.com/v1/items/42"},
+	} {
+		output, err := processor.Execute("flow", newRequestStream(onRequest))
+		require.NoError(t, err)
+		require.Equal(t, invalidConditionName, output.Name, onRequest.ID)
+	}
+}
+
+func TestSchemaValidationResponses(t *testing.T) {
+	processor := newTestProcessor(t, map[string]any{validateResponsesParam: true})
+
+	newResponseStream := func(status int, body string) publictypes.APIStreamI {
+		return streamtypes.NewResponseAPIStream(lunar_messages.OnResponse{
+			ID:      "response",
+			Method:  "GET",
+			URL:     "api.example.com/v1/items/42",
+			Status:  status,
+			Headers: map[string]string{"content-type": "application/json"},
+			RawBody: []byte(body),
+		}, lunar_context.NewMemoryState[[]byte]())
+	}
+
+	validationErrors, operationID := processor.validateResponse(
+		newResponseStream(200, `{"name":"lamp","price":3}`))
+	require.Empty(t, validationErrors)
+	require.Equal(t, "getItem", operationID)
+
+	validationErrors, _ = processor.validateResponse(
+		newResponseStream(404, `{"message":"not found"}`))
+	require.Empty(t, validationErrors)
+
+	validationErrors, _ = processor.validateResponse(newResponseStream(200, `{"name":"lamp"}`))
+	require.Equal(t, []utils.ValidationError{
+		{Location: "body.price", Message: "required property is missing"},
+	}, validationErrors)
+
+	validationErrors, _ = processor.validateResponse(newResponseStream(500, ""))
+	require.Equal(t, []utils.ValidationError{
+		{Location: "status", Message: "status code 500 is not documented"},
+	}, validationErrors)
+
+	// Responses are passed through regardless of violations
+	output, err := processor.Execute("flow", newResponseStream(200, `[]`))
+	require.NoError(t, err)
+	require.Equal(t, validConditionName, output.Name)
+	require.Equal(t, publictypes.StreamTypeResponse, output.Type)
+}
+
+func TestSchemaValidationServerURLsOverride(t *testing.T) {
+	processor := newTestProcessor(t, map[string]any{
+		serverURLsParam: []string{"https://sandbox.example.com/api/"},
+	})
+
+	output, err := processor.Execute("flow", newRequestStream(lunar_messages.OnRequest{
+		ID:     "sandbox",
+		Method: "GET",
+		URL:    "sandbox.example.com/api/items/abc",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, invalidConditionName, output.Name)
+}
+
+func TestSchemaValidationInvalidDocument(t *testing.T) {
+	_, err := parseAPISpec([]byte(`swagger: "2.0"`), nil)
+	require.Error(t, err)
+
+	_, err = parseAPISpec([]byte(`
+openapi: 3.0.0
+paths:
+  /items: {}
+`), nil)
+	require.Error(t, err)
+
+	_, err = parseAPISpec([]byte(`
+openapi: 3.0.0
+servers:
+  - url: https://api.example.com
+paths:
+  /items:
+    get:
+      parameters:
+        - $ref: '#/components/parameters/Missing'
+`), nil)
+	require.Error(t, err)
+}
+
+func TestSchemaValidatorComposition(t *testing.T) {
+	spec, err := parseAPISpec([]byte(`
+openapi: 3.1.0
+servers:
+  - url: https://api.example.com
+paths: {}
+components:
+  schemas:
+    Card:
+      type: object
+      required: [number]
+      properties:
+        number:
+          type: string
+          pattern: '^[0-9]{16}$'
+    Wallet:
+      type: object
+      required: [wallet_id]
+      properties:
+        wallet_id:
+          type: integer
+    Payment:
+      allOf:
+        - type: object
+          required: [amount]
+          properties:
+            amount:
+              type: number
+              minimum: 1
+            note:
+              type: [string, "null"]
+      oneOf:
+        - $ref: '#/components/schemas/Card'
+        - $ref: '#/components/schemas/Wallet'
+`), nil)
+	require.NoError(t, err)
+	validator := newSchemaValidator(spec)
+	payment := &Schema{Ref: "#/components/schemas/Payment"}
+
+	require.Empty(t, validator.validateJSON("body",
+		`{"amount":10,"number":"4111111111111111","note":null}`, payment))
+	require.Empty(t, validator.validateJSON("body", `{"amount":10,"wallet_id":3}`, payment))
+
+	require.Equal(t, []utils.ValidationError{
+		{Location: "body.amount", Message: "value 0 is less than the minimum 1"},
+	}, validator.validateJSON("body", `{"amount":0,"wallet_id":3}`, payment))
+
+	require.Equal(t, []utils.ValidationError{
+		{Location: "body", Message: "value must match exactly one of the allowed schemas, matched 2"},
+	}, validator.validateJSON("body",
+		`{"amount":10,"wallet_id":3,"number":"4111111111111111"}`, payment))
+
+	require.Equal(t, []utils.ValidationError{
+		{Location: "body", Message: "value must match exactly one of the allowed schemas, matched 0"},
+	}, validator.validateJSON("body", `{"amount":10,"wallet_id":3.5}`, payment))
+}
@@ -0,0 +1,431 @@
+package processorschemavalidation
+
+import (
+	"encoding/json"
+	"fmt"
+	"lunar/engine/streams/processors/utils"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	typeObject  = "object"
+	typeArray   = "array"
+	typeString  = "string"
+	typeInteger = "integer"
+	typeNumber  = "number"
+	typeBoolean = "boolean"
+	typeNull    = "null"
+)
+
+// Schema is the subset of the OpenAPI schema object supported for validation
+type Schema struct {
+	Ref                  string               `yaml:"$ref"`
+	Type                 schemaTypes          `yaml:"type"`
+	Nullable             bool                 `yaml:"nullable"`
+	Enum                 []interface{}        `yaml:"enum"`
+	Properties           map[string]*Schema   `yaml:"properties"`
+	Required             []string             `yaml:"required"`
+	AdditionalProperties additionalProperties `yaml:"additionalProperties"`
+	Items                *Schema              `yaml:"items"`
+	MinItems             *int                 `yaml:"minItems"`
+	MaxItems             *int                 `yaml:"maxItems"`
+	MinLength            *int                 `yaml:"minLength"`
+	MaxLength            *int                 `yaml:"maxLength"`
+	Pattern              string               `yaml:"pattern"`
+	Minimum              *float64             `yaml:"minimum"`
+	Maximum              *float64             `yaml:"maximum"`
+	AllOf                []*Schema            `yaml:"allOf"`
+	AnyOf                []*Schema            `yaml:"anyOf"`
+	OneOf                []*Schema            `yaml:"oneOf"`
+}
+
+// schemaTypes supports both the OpenAPI 3.0 (single type) and 3.1 (list of types) notations
+type schemaTypes []string
+
+func (st *schemaTypes) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*st = schemaTypes{node.Value}
+		return nil
+	}
+	var types []string
+	if err := node.Decode(&types); err != nil {
+		return err
+	}
+	*st = types
+	return nil
+}
+
+// additionalProperties is either a boolean or a schema
+type additionalProperties struct {
+	Disallowed bool
+	Schema     *Schema
+}
+
+func (ap *additionalProperties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var allowed bool
+		if err := node.Decode(&allowed); err != nil {
+			return err
+		}
+		ap.Disallowed = !allowed
+		return nil
+	}
+	ap.Schema = &Schema{}
+	return node.Decode(ap.Schema)
+}
+
+// schemaValidator validates decoded JSON values against the schemas of a document
+type schemaValidator struct {
+	spec *apiSpec
+
+	patternsMutex sync.Mutex
+	patterns      map[string]*regexp.Regexp
+}
+
+func newSchemaValidator(spec *apiSpec) *schemaValidator {
+	return &schemaValidator{
+		spec:     spec,
+		patterns: make(map[string]*regexp.Regexp),
+	}
+}
+
+// validateJSON decodes a JSON document and validates it against the schema
+func (v *schemaValidator) validateJSON(
+	location string,
+	raw string,
+	schema *Schema,
+) []utils.ValidationError {
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return []utils.ValidationError{
+			newValidationError(location, "invalid JSON: %v", err),
+		}
+	}
+	return v.validate(location, value, schema)
+}
+
+// validate validates a decoded JSON value against the schema
+func (v *schemaValidator) validate(
+	location string,
+	value interface{},
+	schema *Schema,
+) []utils.ValidationError {
+	schema, err := v.spec.resolveSchema(schema)
+	if err != nil {
+		return []utils.ValidationError{newValidationError(location, "invalid schema: %v", err)}
+	}
+	if schema == nil {
+		return nil
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.allowsType(typeNull) || len(schema.Type) == 0 {
+			return nil
+		}
+		return []utils.ValidationError{
+			newValidationError(location, "expected %s, got null", schema.Type.String()),
+		}
+	}
+
+	var errors []utils.ValidationError
+	if len(schema.Type) > 0 && !schema.allowsValue(value) {
+		return []utils.ValidationError{
+			newValidationError(location, "expected %s, got %s", schema.Type.String(), jsonType(value)),
+		}
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(value, schema.Enum) {
+		errors = append(errors,
+			newValidationError(location, "value %v is not one of %v", value, schema.Enum))
+	}
+
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		errors = append(errors, v.validateObject(location, typedValue, schema)...)
+	case []interface{}:
+		errors = append(errors, v.validateArray(location, typedValue, schema)...)
+	case string:
+		errors = append(errors, v.validateString(location, typedValue, schema)...)
+	case float64:
+		errors = append(errors, validateNumber(location, typedValue, schema)...)
+	}
+
+	for _, subSchema := range schema.AllOf {
+		errors = append(errors, v.validate(location, value, subSchema)...)
+	}
+
+	if len(schema.AnyOf) > 0 && v.countMatches(location, value, schema.AnyOf) == 0 {
+		errors = append(errors,
+			newValidationError(location, "value does not match any of the allowed schemas"))
+	}
+
+	if len(schema.OneOf) > 0 {
+		if matches := v.countMatches(location, value, schema.OneOf); matches != 1 {
+			errors = append(errors, newValidationError(location,
+				"value must match exactly one of the allowed schemas, matched %d", matches))
+		}
+	}
+	return errors
+}
+
+func (v *schemaValidator) validateObject(
+	location string,
+	value map[string]interface{},
+	schema *Schema,
+) []utils.ValidationError {
+	var errors []utils.ValidationError
+	for _, name := range schema.Required {
+		if _, found := value[name]; !found {
+			errors = append(errors,
+				newValidationError(joinLocation(location, name), "required property is missing"))
+		}
+	}
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyLocation := joinLocation(location, name)
+		if propertySchema, found := schema.Properties[name]; found {
+			errors = append(errors, v.validate(propertyLocation, value[name], propertySchema)...)
+			continue
+		}
+		if schema.AdditionalProperties.Disallowed {
+			errors = append(errors,
+				newValidationError(propertyLocation, "additional property is not allowed"))
+			continue
+		}
+		if schema.AdditionalProperties.Schema != nil {
+			errors = append(errors,
+				v.validate(propertyLocation, value[name], schema.AdditionalProperties.Schema)...)
+		}
+	}
+	return errors
+}
+
+func (v *schemaValidator) validateArray(
+	location string,
+	value []interface{},
+	schema *Schema,
+) []utils.ValidationError {
+	var errors []utils.ValidationError
+	if schema.MinItems != nil && len(value) < *schema.MinItems {
+		errors = append(errors,
+			newValidationError(location, "expected at least %d items, got %d", *schema.MinItems, len(value)))
+	}
+	if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+		errors = append(errors,
+			newValidationError(location, "expected at most %d items, got %d", *schema.MaxItems, len(value)))
+	}
+	if schema.Items != nil {
+		for index, item := range value {
+			errors = append(errors,
+				v.validate(fmt.Sprintf("%s[%d]", location, index), item, schema.Items)...)
+		}
+	}
+	return errors
+}
+
+func (v *schemaValidator) validateString(
+	location string,
+	value string,
+	schema *Schema,
+) []utils.ValidationError {
+	var errors []utils.ValidationError
+	length := len([]rune(value))
+	if schema.MinLength != nil && length < *schema.MinLength {
+		errors = append(errors, newValidationError(location,
+			"expected at least %d characters, got %d", *schema.MinLength, length))
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		errors = append(errors, newValidationError(location,
+			"expected at most %d characters, got %d", *schema.MaxLength, length))
+	}
+	if schema.Pattern != "" {
+		pattern, err := v.getPattern(schema.Pattern)
+		if err != nil {
+			errors = append(errors, newValidationError(location, "invalid pattern: %v", err))
+		} else if !pattern.MatchString(value) {
+			errors = append(errors,
+				newValidationError(location, "value does not match pattern %s", schema.Pattern))
+		}
+	}
+	return errors
+}
+
+func validateNumber(location string, value float64, schema *Schema) []utils.ValidationError {
+	var errors []utils.ValidationError
+	if schema.Minimum != nil && value < *schema.Minimum {
+		errors = append(errors,
+			newValidationError(location, "value %v is less than the minimum %v", value, *schema.Minimum))
+	}
+	if schema.Maximum != nil && value > *schema.Maximum {
+		errors = append(errors,
+			newValidationError(location, "value %v is greater than the maximum %v", value, *schema.Maximum))
+	}
+	return errors
+}
+
+func (v *schemaValidator) countMatches(
+	location string,
+	value interface{},
+	schemas []*Schema,
+) int {
+	matches := 0
+	for _, subSchema := range schemas {
+		if len(v.validate(location, value, subSchema)) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func (v *schemaValidator) getPattern(pattern string) (*regexp.Regexp, error) {
+	v.patternsMutex.Lock()
+	defer v.patternsMutex.Unlock()
+
+	if compiled, found := v.patterns[pattern]; found {
+		return compiled, nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	v.patterns[pattern] = compiled
+	return compiled, nil
+}
+
+// coerceParameter converts a raw path, query or header value into the type declared by the schema
+func (v *schemaValidator) coerceParameter(
+	values []string,
+	schema *Schema,
+) (interface{}, error) {
+	schema, err := v.spec.resolveSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return strings.Join(values, ","), nil
+	}
+
+	if schema.allowsType(typeArray) {
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		items := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			item, err := coerceScalar(value, schema.Items)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return coerceScalar(values[0], schema)
+}
+
+func coerceScalar(value string, schema *Schema) (interface{}, error) {
+	if schema == nil {
+		return value, nil
+	}
+	switch {
+	case schema.allowsType(typeInteger) || schema.allowsType(typeNumber):
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected %s, got '%s'", schema.Type.String(), value)
+		}
+		return number, nil
+	case schema.allowsType(typeBoolean):
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected boolean, got '%s'", value)
+		}
+		return boolean, nil
+	}
+	return value, nil
+}
+
+func (s *Schema) allowsType(schemaType string) bool {
+	for _, allowed := range s.Type {
+		if allowed == schemaType {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) allowsValue(value interface{}) bool {
+	if s.allowsType(jsonType(value)) {
+		return true
+	}
+	// JSON numbers are decoded as floats, numbers without a fraction are valid integers
+	number, isNumber := value.(float64)
+	return isNumber && s.allowsType(typeInteger) && number == math.Trunc(number)
+}
+
+func (st schemaTypes) String() string {
+	return strings.Join(st, " or ")
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return typeNull
+	case map[string]interface{}:
+		return typeObject
+	case []interface{}:
+		return typeArray
+	case string:
+		return typeString
+	case float64:
+		return typeNumber
+	case bool:
+		return typeBoolean
+	}
+	return reflect.TypeOf(value).String()
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, normalizeEnumValue(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEnumValue converts YAML decoded values into their JSON decoded representation
+func normalizeEnumValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case int:
+		return float64(typedValue)
+	case int64:
+		return float64(typedValue)
+	case uint64:
+		return float64(typedValue)
+	}
+	return value
+}
+
+func joinLocation(location, name string) string {
+	return location + "." + name
+}
+
+func newValidationError(location, format string, args ...interface{}) utils.ValidationError {
+	return utils.ValidationError{
+		Location: location,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"lunar/engine/actions"
 	"lunar/engine/streams/processors/utils"
+	"lunar/engine/streams/tracing"
 	streamtypes "lunar/engine/streams/types"
 	"lunar/engine/utils/environment"
 	"strings"
@@ -20,11 +21,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -32,9 +29,6 @@ const (
 	exporterIDParam            = "trace_exporter_id"
 	customTraceAttributesParam = "custom_trace_attributes"
 
-	tempoGRPCEndpoint = "tempo:4317"
-	tempoHTTPEndpoint = "tempo:4318"
-
 	cleanPeriod = 15 * time.Second
 	cleanTTL    = 30 * time.Second
 )
@@ -43,7 +37,6 @@ type userDefinedProcessor struct {
 	name                  string
 	exporterID            string
 	tracesEndpoint        string
-	withInsecure          bool
 	customTraceAttributes map[string]string
 
 	tracer            trace.Tracer
@@ -290,21 +283,7 @@ func (p *userDefinedProcessor) init() error {
 			p.exporterID, gatewayConfig.TraceExporter.TraceExporterID)
 	}
 
-	if gatewayConfig.TraceExporter.TracesEndpoint == "" {
-		return fmt.Errorf("traces endpoint not found in gateway config")
-	}
-
-	parsedEndpoint, err := utils.ExtractDomainAndPath(gatewayConfig.TraceExporter.TracesEndpoint)
-	if err != nil {
-		return fmt.Errorf("failed to parse traces endpoint: %w", err)
-	}
-
-	p.tracesEndpoint = parsedEndpoint.GetHostAndPort()
-	if p.tracesEndpoint == tempoHTTPEndpoint {
-		log.Warn().Msg("Tempo HTTP endpoint not supported. Switching to gRPC endpoint instead.")
-		p.tracesEndpoint = tempoGRPCEndpoint
-	}
-	p.withInsecure = parsedEndpoint.GetScheme() == "http"
+	p.tracesEndpoint = gatewayConfig.TraceExporter.TracesEndpoint
 
 	err = utils.ExtractMapOfStringParam(
 		p.metaData.Parameters,
@@ -321,33 +300,11 @@ func (p *userDefinedProcessor) init() error {
 }
 
 func (p *userDefinedProcessor) initTracer() error {
-	ctx := context.Background()
-
-	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(p.tracesEndpoint)}
-	if p.withInsecure {
-		options = append(options, otlptracegrpc.WithInsecure())
-	}
-	// TODO: add support for TLS creds in the future versions
-	// options = append(options, otlptracegrpc.WithTLSCredentials())
-
-	// Set up an OTLP exporter
-	exporter, err := otlptracegrpc.New(ctx, options...)
-	if err != nil {
-		return fmt.Errorf("failed to create OTLP exporter: %w", err)
-	}
-
-	// Define a resource to identify our processor
-	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceNameKey.String(p.name)))
+	traceProvider, err := tracing.NewTracerProvider(p.name, p.tracesEndpoint)
 	if err != nil {
-		return fmt.Errorf("failed to create otel resource for trace processor: %w", err)
+		return err
 	}
 
-	// Create a tracer provider
-	traceProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
-
 	// Set global tracer provider and propagator
 	p.tracer = traceProvider.Tracer(p.name) // keep local tracer
 
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"fmt"
+	public_types "lunar/engine/streams/public-types"
+	"math"
+	"time"
+)
+
+const BlockedInfoContextKey = "blocked_info"
+
+const (
+	BlockedReasonQuotaExceeded   = "quota_exceeded"
+	BlockedReasonQueueFull       = "queue_full"
+	BlockedReasonQueueTTLExpired = "queue_ttl_expired"
+	BlockedReasonQueueDrained    = "queue_drained"
+)
+
+// BlockedInfo describes why a request was blocked and when it is worth retrying.
+// It is published into the flow context by blocking processors, so it can be
+// templated into the generated response.
+type BlockedInfo struct {
+	Reason  string `json:"reason"`
+	QuotaID string `json:"quota_id"`
+	// QueuePosition is the 1-based place of the request in the dispatch order when it was blocked,
+	// 0 when the request was not queued (e.g. the queue was full)
+	QueuePosition int64 `json:"queue_position"`
+	// QueueSize is the amount of requests waiting in the queue when the request was blocked
+	QueueSize int64 `json:"queue_size"`
+	// EstimatedWait is the estimated time in seconds until the request could be served
+	EstimatedWait int64 `json:"estimated_wait"`
+	// RetryAfter is the amount of seconds a client should wait before retrying
+	RetryAfter int64 `json:"retry_after"`
+	// ResetAt is the unix time in seconds in which the quota window resets
+	ResetAt int64 `json:"reset_at"`
+}
+
+func NewBlockedInfo(
+	reason string,
+	quotaID string,
+	resetIn time.Duration,
+	estimatedWait time.Duration,
+	now time.Time,
+) *BlockedInfo {
+	resetIn = max(resetIn, 0)
+	estimatedWait = max(estimatedWait, resetIn)
+	return &BlockedInfo{
+		Reason:        reason,
+		QuotaID:       quotaID,
+		EstimatedWait: durationToSeconds(estimatedWait),
+		RetryAfter:    durationToSeconds(estimatedWait),
+		ResetAt:       now.Add(resetIn).Unix(),
+	}
+}
+
+func (b *BlockedInfo) WithQueueState(position, size int64) *BlockedInfo {
+	b.QueuePosition = position
+	b.QueueSize = size
+	return b
+}
+
+// GetQuotaResetIn returns the time until the quota of the request resets,
+// falling back to the quota's polling reset when a per-request reset is not supported.
+func GetQuotaResetIn(
+	quota public_types.QuotaResourceI,
+	apiStream public_types.APIStreamI,
+) time.Duration {
+	if resetQuota, ok := quota.(public_types.QuotaResetI); ok {
+		if resetIn, err := resetQuota.ResetInFor(apiStream); err == nil {
+			return resetIn
+		}
+	}
+	return quota.ResetIn()
+}
+
+// SetBlockedInfo publishes the blocked info of the transaction into the flow context
+func SetBlockedInfo(apiStream public_types.APIStreamI, info *BlockedInfo) error {
+	flowContext := getFlowContext(apiStream)
+	if flowContext == nil {
+		return fmt.Errorf("flow context is not available")
+	}
+	return flowContext.Set(buildBlockedInfoKey(apiStream.GetID()), info)
+}
+
+// PopBlockedInfo returns the blocked info of the transaction and removes it from the flow context
+func PopBlockedInfo(apiStream public_types.APIStreamI) (*BlockedInfo, bool) {
+	flowContext := getFlowContext(apiStream)
+	if flowContext == nil {
+		return nil, false
+	}
+
+	raw, err := flowContext.Pop(buildBlockedInfoKey(apiStream.GetID()))
+	if err != nil {
+		return nil, false
+	}
+	info, ok := raw.(*BlockedInfo)
+	return info, ok
+}
+
+// ClearTransactionData removes the values published into the flow context for the transaction,
+// which were not consumed by a following processor
+func ClearTransactionData(flowContext public_types.ContextI, transactionID string) {
+	_, _ = flowContext.Pop(buildBlockedInfoKey(transactionID))
+	_, _ = flowContext.Pop(buildValidationErrorsKey(transactionID))
+	_, _ = flowContext.Pop(buildQuotaOverageKey(transactionID))
+	_, _ = flowContext.Pop(buildCacheRevalidationKey(transactionID))
+}
+
+func getFlowContext(apiStream public_types.APIStreamI) public_types.ContextI {
+	lunarContext := apiStream.GetContext()
+	if lunarContext == nil {
+		return nil
+	}
+	return lunarContext.GetFlowContext()
+}
+
+func buildBlockedInfoKey(transactionID string) string {
+	return fmt.Sprintf("%s::%s", BlockedInfoContextKey, transactionID)
+}
+
+func durationToSeconds(duration time.Duration) int64 {
+	return int64(math.Ceil(duration.Seconds()))
+}
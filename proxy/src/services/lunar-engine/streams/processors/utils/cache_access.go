@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"cmp"
+	"container/heap"
+	context_manager "lunar/toolkit-core/context-manager"
+	"sync"
+)
+
+// CacheAccess describes how recently and how often a cache entry was used
+type CacheAccess struct {
+	// LastAccess is the Unix time in nanoseconds of the last write or hit of the entry
+	LastAccess int64
+	// Hits is the amount of times the entry was served
+	Hits int64
+}
+
+// CacheAccessTracker keeps the entries written by WriteCache ordered by their accesses,
+// so the entries served least recently or least frequently by ReadCache can be evicted
+// without scanning the cache. Accesses are tracked in memory by each gateway instance,
+// hits of entries which were not written through the tracker are ignored.
+type CacheAccessTracker struct {
+	mutex   sync.Mutex
+	entries map[string]*trackedEntry
+	// groups orders the entries of each eviction group from the coldest
+	groups map[string]*accessHeap
+}
+
+type trackedEntry struct {
+	cacheKey string
+	group    string
+	access   CacheAccess
+	index    int
+}
+
+var (
+	cacheAccessTracker     *CacheAccessTracker
+	cacheAccessTrackerOnce sync.Once
+)
+
+// GetCacheAccessTracker returns the tracker shared by the cache processors,
+// so the hits of ReadCache order the entries of WriteCache
+func GetCacheAccessTracker() *CacheAccessTracker {
+	cacheAccessTrackerOnce.Do(func() {
+		cacheAccessTracker = &CacheAccessTracker{
+			entries: make(map[string]*trackedEntry),
+			groups:  make(map[string]*accessHeap),
+		}
+	})
+	return cacheAccessTracker
+}
+
+// RecordWrite marks the entry of the group as recently used, the hits of an overwritten entry
+// are kept. Groups ordered by frequency put the least served entries first.
+func (t *CacheAccessTracker) RecordWrite(group, cacheKey string, byFrequency bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	groupHeap, found := t.groups[group]
+	if !found {
+		groupHeap = &accessHeap{byFrequency: byFrequency}
+		t.groups[group] = groupHeap
+	} else if groupHeap.byFrequency != byFrequency {
+		groupHeap.byFrequency = byFrequency
+		heap.Init(groupHeap)
+	}
+
+	entry, found := t.entries[cacheKey]
+	if found && entry.group != group {
+		t.removeLocked(entry)
+		found = false
+	}
+	if !found {
+		entry = &trackedEntry{cacheKey: cacheKey, group: group}
+		entry.access.LastAccess = accessTime()
+		t.entries[cacheKey] = entry
+		heap.Push(groupHeap, entry)
+		return
+	}
+	entry.access.LastAccess = accessTime()
+	heap.Fix(groupHeap, entry.index)
+}
+
+// RecordHit marks the entry as recently used and counts the hit
+func (t *CacheAccessTracker) RecordHit(cacheKey string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry, found := t.entries[cacheKey]
+	if !found {
+		return
+	}
+	entry.access.LastAccess = accessTime()
+	entry.access.Hits++
+	heap.Fix(t.groups[entry.group], entry.index)
+}
+
+// Get returns the recorded accesses of the entry, zero values mean no access was recorded
+func (t *CacheAccessTracker) Get(cacheKey string) CacheAccess {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if entry, found := t.entries[cacheKey]; found {
+		return entry.access
+	}
+	return CacheAccess{}
+}
+
+// Remove drops the recorded accesses of a removed entry
+func (t *CacheAccessTracker) Remove(cacheKey string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if entry, found := t.entries[cacheKey]; found {
+		t.removeLocked(entry)
+	}
+}
+
+// PopColdest removes the coldest entry of the group, other than the excluded one,
+// from the tracker and returns its key
+func (t *CacheAccessTracker) PopColdest(group, excludedCacheKey string) (string, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	groupHeap, found := t.groups[group]
+	if !found || groupHeap.Len() == 0 {
+		return "", false
+	}
+
+	entry := heap.Pop(groupHeap).(*trackedEntry)
+	if entry.cacheKey == excludedCacheKey {
+		if groupHeap.Len() == 0 {
+			heap.Push(groupHeap, entry)
+			return "", false
+		}
+		next := heap.Pop(groupHeap).(*trackedEntry)
+		heap.Push(groupHeap, entry)
+		entry = next
+	}
+	delete(t.entries, entry.cacheKey)
+	return entry.cacheKey, true
+}
+
+func (t *CacheAccessTracker) removeLocked(entry *trackedEntry) {
+	delete(t.entries, entry.cacheKey)
+	groupHeap := t.groups[entry.group]
+	heap.Remove(groupHeap, entry.index)
+	if groupHeap.Len() == 0 {
+		delete(t.groups, entry.group)
+	}
+}
+
+// accessHeap orders the entries of a group from the coldest,
+// by recency or by frequency and then recency
+type accessHeap struct {
+	byFrequency bool
+	entries     []*trackedEntry
+}
+
+func (h *accessHeap) Len() int { return len(h.entries) }
+
+func (h *accessHeap) Less(i, j int) bool {
+	a, b := h.entries[i].access, h.entries[j].access
+	if h.byFrequency {
+		if byHits := cmp.Compare(a.Hits, b.Hits); byHits != 0 {
+			return byHits < 0
+		}
+	}
+	return a.LastAccess < b.LastAccess
+}
+
+func (h *accessHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+
+func (h *accessHeap) Push(item any) {
+	entry := item.(*trackedEntry)
+	entry.index = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *accessHeap) Pop() any {
+	last := len(h.entries) - 1
+	entry := h.entries[last]
+	h.entries[last] = nil
+	h.entries = h.entries[:last]
+	return entry
+}
+
+func accessTime() int64 {
+	return context_manager.Get().GetClock().Now().UnixNano()
+}
@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const CacheRevalidationContextKey = "cache_revalidation"
+
+const (
+	HeaderCacheControl    = "Cache-Control"
+	HeaderExpires         = "Expires"
+	HeaderDate            = "Date"
+	HeaderVary            = "Vary"
+	HeaderETag            = "ETag"
+	HeaderLastModified    = "Last-Modified"
+	HeaderIfNoneMatch     = "If-None-Match"
+	HeaderIfModifiedSince = "If-Modified-Since"
+	headerContentLength   = "Content-Length"
+)
+
+const (
+	cacheControlNoStore   = "no-store"
+	cacheControlNoCache   = "no-cache"
+	cacheControlPrivate   = "private"
+	cacheControlMaxAge    = "max-age"
+	cacheControlSharedAge = "s-maxage"
+
+	varyAllHeadersWildcard = "*"
+)
+
+// HTTPCachePolicy is the caching policy a provider declared for a response
+type HTTPCachePolicy struct {
+	// Storable is false when the response may not be stored by a shared cache
+	Storable bool
+	// TTL is the freshness lifetime in seconds, it is only set when HasTTL is true
+	TTL    int64
+	HasTTL bool
+	// Vary holds the request headers the response varies on
+	Vary []string
+}
+
+// ParseHTTPCachePolicy parses the Cache-Control, Expires and Vary headers of a response
+// from the perspective of a shared cache
+func ParseHTTPCachePolicy(headers map[string]string, now time.Time) HTTPCachePolicy {
+	policy := HTTPCachePolicy{Storable: true}
+	directives := parseCacheControl(GetHeaderValue(headers, HeaderCacheControl))
+
+	if _, found := directives[cacheControlNoStore]; found {
+		policy.Storable = false
+	}
+	if _, found := directives[cacheControlPrivate]; found {
+		policy.Storable = false
+	}
+
+	for _, directive := range []string{cacheControlSharedAge, cacheControlMaxAge} {
+		if value, found := directives[directive]; found {
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+				policy.TTL, policy.HasTTL = seconds, true
+				break
+			}
+		}
+	}
+
+	if !policy.HasTTL {
+		if expires := GetHeaderValue(headers, HeaderExpires); expires != "" {
+			policy.TTL, policy.HasTTL = 0, true
+			if expiresAt, err := http.ParseTime(expires); err == nil {
+				if date, err := http.ParseTime(GetHeaderValue(headers, HeaderDate)); err == nil {
+					now = date
+				}
+				policy.TTL = max(int64(expiresAt.Sub(now).Seconds()), 0)
+			}
+		}
+	}
+
+	// no-cache responses may be stored, but must be revalidated before they are served
+	if _, found := directives[cacheControlNoCache]; found {
+		policy.TTL, policy.HasTTL = 0, true
+	}
+
+	for _, name := range strings.Split(GetHeaderValue(headers, HeaderVary), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == varyAllHeadersWildcard {
+			policy.Storable = false
+			continue
+		}
+		policy.Vary = append(policy.Vary, http.CanonicalHeaderKey(name))
+	}
+	return policy
+}
+
+// WithHTTPValidators stores the validators of the response and the request header values
+// the response varies on
+func (e *SharedMemoryTTLEntry) WithHTTPValidators(
+	responseHeaders map[string]string,
+	requestHeaders map[string]string,
+	vary []string,
+) *SharedMemoryTTLEntry {
+	e.ETag = GetHeaderValue(responseHeaders, HeaderETag)
+	e.LastModified = GetHeaderValue(responseHeaders, HeaderLastModified)
+	if len(vary) > 0 {
+		e.Vary = make(map[string]string, len(vary))
+		for _, name := range vary {
+			e.Vary[name] = GetHeaderValue(requestHeaders, name)
+		}
+	}
+	return e
+}
+
+// MatchesVary returns true if the request has the header values the stored response varies on
+func (e *SharedMemoryTTLEntry) MatchesVary(requestHeaders map[string]string) bool {
+	for name, value := range e.Vary {
+		if GetHeaderValue(requestHeaders, name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// HasValidators returns true if the entry can be revalidated with a conditional request
+func (e *SharedMemoryTTLEntry) HasValidators() bool {
+	return e.ETag != "" || e.LastModified != ""
+}
+
+// ConditionalHeaders returns the headers turning a request into a revalidation of the entry
+func (e *SharedMemoryTTLEntry) ConditionalHeaders() map[string]string {
+	headers := make(map[string]string)
+	if e.ETag != "" {
+		headers[HeaderIfNoneMatch] = e.ETag
+	}
+	if e.LastModified != "" {
+		headers[HeaderIfModifiedSince] = e.LastModified
+	}
+	return headers
+}
+
+// Revalidate refreshes the entry with a 304 (Not Modified) response of the provider.
+// The freshness lifetime restarts with the given TTL and the headers of the 304 response
+// replace the stored ones, the stored response is returned.
+func (e *SharedMemoryTTLEntry) Revalidate(
+	ttl int64,
+	notModifiedHeaders map[string]string,
+) (*streamtypes.OnResponse, error) {
+	storedContent, err := e.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	var stored streamtypes.OnResponse
+	if err := json.Unmarshal(storedContent, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse stored response: %w", err)
+	}
+
+	if stored.Headers == nil {
+		stored.Headers = make(map[string]string)
+	}
+	for name, value := range notModifiedHeaders {
+		if strings.EqualFold(name, headerContentLength) {
+			continue
+		}
+		deleteHeader(stored.Headers, name)
+		stored.Headers[name] = value
+	}
+
+	content, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = e.setContent(e.Encoding, content); err != nil {
+		return nil, err
+	}
+	e.TTL = ttl
+	e.StorageTime = context_manager.Get().GetClock().Now().UTC().Unix()
+	e.now = e.StorageTime
+	if etag := GetHeaderValue(notModifiedHeaders, HeaderETag); etag != "" {
+		e.ETag = etag
+	}
+	if lastModified := GetHeaderValue(notModifiedHeaders, HeaderLastModified); lastModified != "" {
+		e.LastModified = lastModified
+	}
+	e.alive = ttl > 0
+	return &stored, nil
+}
+
+// HasConditionalHeaders returns true if the client sent its own conditional request
+func HasConditionalHeaders(headers map[string]string) bool {
+	return GetHeaderValue(headers, HeaderIfNoneMatch) != "" ||
+		GetHeaderValue(headers, HeaderIfModifiedSince) != ""
+}
+
+// GetHeaderValue returns the value of a header, header names are matched case-insensitively
+func GetHeaderValue(headers map[string]string, name string) string {
+	if value, found := headers[name]; found {
+		return value
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// SetCacheRevalidation marks the transaction as a revalidation of the given cache key
+func SetCacheRevalidation(apiStream public_types.APIStreamI, cacheKey string) error {
+	flowContext := getFlowContext(apiStream)
+	if flowContext == nil {
+		return fmt.Errorf("flow context is not available")
+	}
+	return flowContext.Set(buildCacheRevalidationKey(apiStream.GetID()), cacheKey)
+}
+
+// PopCacheRevalidation returns the cache key revalidated by the transaction, if any
+func PopCacheRevalidation(apiStream public_types.APIStreamI) (string, bool) {
+	flowContext := getFlowContext(apiStream)
+	if flowContext == nil {
+		return "", false
+	}
+
+	raw, err := flowContext.Pop(buildCacheRevalidationKey(apiStream.GetID()))
+	if err != nil {
+		return "", false
+	}
+	cacheKey, ok := raw.(string)
+	return cacheKey, ok
+}
+
+func buildCacheRevalidationKey(transactionID string) string {
+	return fmt.Sprintf("%s::%s", CacheRevalidationContextKey, transactionID)
+}
+
+// parseCacheControl returns the directives of a Cache-Control header with their values
+func parseCacheControl(cacheControl string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name == "" {
+			continue
+		}
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return directives
+}
+
+func deleteHeader(headers map[string]string, name string) {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			delete(headers, key)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"fmt"
+	public_types "lunar/engine/streams/public-types"
+)
+
+const QuotaOverageContextKey = "quota_overage"
+
+// SetQuotaOverage flags the transaction as allowed above the soft limit of the given quota,
+// so following processors can read it from the flow context
+func SetQuotaOverage(apiStream public_types.APIStreamI, quotaID string) error {
+	flowContext := getFlowContext(apiStream)
+	if flowContext == nil {
+		return fmt.Errorf("flow context is not available")
+	}
+	return flowContext.Set(buildQuotaOverageKey(apiStream.GetID()), quotaID)
+}
+
+// GetQuotaOverage returns the quota whose soft limit the transaction was allowed above
+func GetQuotaOverage(apiStream public_types.APIStreamI) (string, bool) {
+	flowContext := getFlowContext(apiStream)
+	if flowContext == nil {
+		return "", false
+	}
+
+	raw, err := flowContext.Get(buildQuotaOverageKey(apiStream.GetID()))
+	if err != nil {
+		return "", false
+	}
+	quotaID, ok := raw.(string)
+	return quotaID, ok
+}
+
+func buildQuotaOverageKey(transactionID string) string {
+	return fmt.Sprintf("%s::%s", QuotaOverageContextKey, transactionID)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	public_types "lunar/engine/streams/public-types"
 	"lunar/engine/streams/stream"
+	"lunar/engine/utils/compression"
 	context_manager "lunar/toolkit-core/context-manager"
 	"lunar/toolkit-core/jsonpath"
 	"strings"
@@ -45,32 +46,141 @@ type SharedMemoryTTLEntry struct {
 	TTL         int64
 	StorageTime int64
 	Content     []byte
+	// StaleWhileRevalidate is the amount of seconds an expired entry may still be served
+	// while it is being refreshed
+	StaleWhileRevalidate int64 `json:",omitempty"`
+	// StaleIfError is the amount of seconds an expired entry may still be served
+	// when the provider fails
+	StaleIfError int64 `json:",omitempty"`
+	// ETag and LastModified are the validators of the stored response, used for revalidation
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+	// Vary holds the request header values the stored response varies on
+	Vary map[string]string `json:",omitempty"`
+	// Tags are the purge tags of the entry
+	Tags []string `json:",omitempty"`
+	// Encoding is the compression of Content and ContentSize its size before compression
+	Encoding    compression.Encoding `json:",omitempty"`
+	ContentSize int64                `json:",omitempty"`
 	alive       bool
+	now         int64
 }
 
 func (e *SharedMemoryTTLEntry) IsAlive() bool {
 	return e.alive
 }
 
-// BuildSharedMemoryTTLEntry builds a shared memory entry with a TTL and a response
-func BuildSharedMemoryTTLEntry(ttl int64, response public_types.TransactionI) ([]byte, error) {
+// IsStaleWhileRevalidate returns true if the entry expired but may still be served while refreshed
+func (e *SharedMemoryTTLEntry) IsStaleWhileRevalidate() bool {
+	return !e.alive && e.now < e.expiresAt()+e.StaleWhileRevalidate
+}
+
+// IsStaleIfError returns true if the entry may be served instead of a failed provider response
+func (e *SharedMemoryTTLEntry) IsStaleIfError() bool {
+	return e.now < e.expiresAt()+e.StaleIfError
+}
+
+// GracePeriod returns the amount of seconds an entry is kept after it expires
+func (e *SharedMemoryTTLEntry) GracePeriod() int64 {
+	return max(e.StaleWhileRevalidate, e.StaleIfError, 0)
+}
+
+func (e *SharedMemoryTTLEntry) expiresAt() int64 {
+	return e.StorageTime + e.TTL
+}
+
+// NewSharedMemoryTTLEntry creates a shared memory entry with a TTL and a response
+func NewSharedMemoryTTLEntry(
+	ttl int64,
+	response public_types.TransactionI,
+) (*SharedMemoryTTLEntry, error) {
 	responseJSON, err := response.ToJSON()
 	if err != nil {
 		return nil, err
 	}
 
-	entry := SharedMemoryTTLEntry{
+	return &SharedMemoryTTLEntry{
 		TTL:         ttl,
 		StorageTime: context_manager.Get().GetClock().Now().UTC().Unix(),
 		Content:     responseJSON,
 		alive:       true,
+	}, nil
+}
+
+// Compress compresses the content of the entry with the encoding
+func (e *SharedMemoryTTLEntry) Compress(encoding compression.Encoding) error {
+	content, err := e.GetContent()
+	if err != nil {
+		return err
 	}
+	return e.setContent(encoding, content)
+}
 
-	entryJSON, err := json.Marshal(entry)
+// GetContent returns the content of the entry, decompressed if needed
+func (e *SharedMemoryTTLEntry) GetContent() ([]byte, error) {
+	content, err := compression.Decompress(e.Encoding, e.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s cache entry: %w", e.Encoding, err)
+	}
+	return content, nil
+}
+
+// GetContentSize returns the size of the content before compression
+func (e *SharedMemoryTTLEntry) GetContentSize() int64 {
+	if !e.isCompressed() {
+		return int64(len(e.Content))
+	}
+	return e.ContentSize
+}
+
+// BytesSaved returns the amount of bytes saved by compressing the content
+func (e *SharedMemoryTTLEntry) BytesSaved() int64 {
+	return e.GetContentSize() - int64(len(e.Content))
+}
+
+func (e *SharedMemoryTTLEntry) setContent(encoding compression.Encoding, content []byte) error {
+	compressed, err := compression.Compress(encoding, content)
+	if err != nil {
+		return err
+	}
+	e.Content = compressed
+	e.Encoding = encoding
+	e.ContentSize = 0
+	if e.isCompressed() {
+		e.ContentSize = int64(len(content))
+	}
+	return nil
+}
+
+func (e *SharedMemoryTTLEntry) isCompressed() bool {
+	return e.Encoding != "" && e.Encoding != compression.EncodingNone
+}
+
+// Marshal returns the stored representation of the entry
+func (e *SharedMemoryTTLEntry) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// BuildSharedMemoryTTLEntry builds a shared memory entry with a TTL and a response
+func BuildSharedMemoryTTLEntry(ttl int64, response public_types.TransactionI) ([]byte, error) {
+	return BuildSharedMemoryStaleTTLEntry(ttl, 0, 0, response)
+}
+
+// BuildSharedMemoryStaleTTLEntry builds a shared memory entry with a TTL and a response,
+// which may still be served after it expires for the given stale periods in seconds
+func BuildSharedMemoryStaleTTLEntry(
+	ttl int64,
+	staleWhileRevalidate int64,
+	staleIfError int64,
+	response public_types.TransactionI,
+) ([]byte, error) {
+	entry, err := NewSharedMemoryTTLEntry(ttl, response)
 	if err != nil {
 		return nil, err
 	}
-	return entryJSON, nil
+	entry.StaleWhileRevalidate = staleWhileRevalidate
+	entry.StaleIfError = staleIfError
+	return entry.Marshal()
 }
 
 // ParseSharedMemoryTTLEntry parses a shared memory entry and returns response and alive flag
@@ -80,10 +190,8 @@ func ParseSharedMemoryTTLEntry(entry []byte) (*SharedMemoryTTLEntry, error) {
 	if err != nil {
 		return nil, err
 	}
-	alive := parsedEntry.StorageTime+int64(parsedEntry.TTL) >
-		context_manager.Get().GetClock().Now().UTC().Unix()
-
-	parsedEntry.alive = alive
+	parsedEntry.now = context_manager.Get().GetClock().Now().UTC().Unix()
+	parsedEntry.alive = parsedEntry.expiresAt() > parsedEntry.now
 
 	return &parsedEntry, nil
 }
@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"fmt"
+	lunarcontext "lunar/engine/streams/lunar-context"
 	publictypes "lunar/engine/streams/public-types"
 	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -303,3 +307,72 @@ func TestExtractMapFromParams(t *testing.T) {
 		require.EqualError(t, err, "result is nil")
 	})
 }
+
+func TestClearTransactionData(t *testing.T) {
+	flowContext := lunarcontext.NewContext()
+	require.NoError(t, flowContext.Set(buildBlockedInfoKey("txn-1"), &BlockedInfo{}))
+	require.NoError(t, flowContext.Set(buildBlockedInfoKey("txn-2"), &BlockedInfo{}))
+	require.NoError(t, flowContext.Set(buildValidationErrorsKey("txn-1"), []ValidationError{}))
+	require.NoError(t, flowContext.Set(buildQuotaOverageKey("txn-1"), "quota"))
+	require.NoError(t, flowContext.Set(buildCacheRevalidationKey("txn-1"), "cache-key"))
+
+	ClearTransactionData(flowContext, "txn-1")
+
+	_, err := flowContext.Get(buildBlockedInfoKey("txn-1"))
+	require.Error(t, err)
+	_, err = flowContext.Get(buildValidationErrorsKey("txn-1"))
+	require.Error(t, err)
+	_, err = flowContext.Get(buildQuotaOverageKey("txn-1"))
+	require.Error(t, err)
+	_, err = flowContext.Get(buildCacheRevalidationKey("txn-1"))
+	require.Error(t, err)
+	_, err = flowContext.Get(buildBlockedInfoKey("txn-2"))
+	require.NoError(t, err)
+}
+
+func TestCacheAccessTrackerPopsColdestEntries(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	tracker := GetCacheAccessTracker()
+
+	for _, byFrequency := range []bool{false, true} {
+		group := fmt.Sprintf("group_%v", byFrequency)
+		for _, cacheKey := range []string{"a", "b", "c"} {
+			tracker.RecordWrite(group, group+cacheKey, byFrequency)
+			mockClock.AdvanceTime(time.Second)
+		}
+		tracker.RecordHit(group + "b")
+		tracker.RecordHit(group + "b")
+		mockClock.AdvanceTime(time.Second)
+		tracker.RecordHit(group + "a")
+
+		// c is the least recently used, a is the least frequently used
+		expectedOrder := []string{"c", "b", "a"}
+		if byFrequency {
+			expectedOrder = []string{"c", "a", "b"}
+		}
+		for _, expected := range expectedOrder {
+			cacheKey, found := tracker.PopColdest(group, "")
+			require.True(t, found)
+			require.Equal(t, group+expected, cacheKey)
+			require.Zero(t, tracker.Get(cacheKey))
+		}
+		_, found := tracker.PopColdest(group, "")
+		require.False(t, found)
+	}
+}
+
+func TestCacheAccessTrackerExcludesKey(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	tracker := GetCacheAccessTracker()
+	tracker.RecordWrite("excluded", "only", false)
+
+	_, found := tracker.PopColdest("excluded", "only")
+	require.False(t, found)
+
+	// hits of entries which were not written through the tracker are not recorded
+	tracker.RecordHit("unknown")
+	require.Zero(t, tracker.Get("unknown"))
+
+	tracker.Remove("only")
+	require.Zero(t, tracker.Get("only"))
+}
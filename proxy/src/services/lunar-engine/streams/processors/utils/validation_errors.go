@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	public_types "lunar/engine/streams/public-types"
+)
+
+const ValidationErrorsContextKey = "validation_errors"
+
+// ValidationError describes a single violation found while validating an API call
+type ValidationError struct {
+	// Location is the part of the API call that is invalid, e.g. query.limit or body.items[0].name
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+func (e ValidationError) String() string {
+	return fmt.Sprintf("%s: %s", e.Location, e.Message)
+}
+
+// SetValidationErrors publishes the validation errors of the transaction into the flow context
+func SetValidationErrors(apiStream public_types.APIStreamI, errors []ValidationError) error {
+	flowContext := getFlowContext(apiStream)
+	if flowContext == nil {
+		return fmt.Errorf("flow context is not available")
+	}
+	return flowContext.Set(buildValidationErrorsKey(apiStream.GetID()), errors)
+}
+
+// PopValidationErrors returns the validation errors of the transaction
+// and removes them from the flow context
+func PopValidationErrors(apiStream public_types.APIStreamI) ([]ValidationError, bool) {
+	flowContext := getFlowContext(apiStream)
+	if flowContext == nil {
+		return nil, false
+	}
+
+	raw, err := flowContext.Pop(buildValidationErrorsKey(apiStream.GetID()))
+	if err != nil {
+		return nil, false
+	}
+	errors, ok := raw.([]ValidationError)
+	return errors, ok
+}
+
+func buildValidationErrorsKey(transactionID string) string {
+	return fmt.Sprintf("%s::%s", ValidationErrorsContextKey, transactionID)
+}
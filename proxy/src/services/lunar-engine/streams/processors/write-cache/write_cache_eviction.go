@@ -0,0 +1,75 @@
+package writecache
+
+import (
+	"context"
+	"fmt"
+	lunar_metrics "lunar/engine/metrics"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// When the cache of a flow is full, entries are evicted by the eviction policy:
+// none rejects the new entry, lru evicts the entries served least recently and lfu evicts
+// the entries served least often. Accesses are recorded by ReadCache on every cache hit,
+// and the entries are kept ordered by them, so evicting does not scan the cache.
+const (
+	evictionPolicyNone = "none"
+	evictionPolicyLRU  = "lru"
+	evictionPolicyLFU  = "lfu"
+)
+
+func (p *writeCacheProcessor) validateEvictionPolicy() error {
+	switch p.evictionPolicy {
+	case "":
+		p.evictionPolicy = evictionPolicyNone
+	case evictionPolicyNone, evictionPolicyLRU, evictionPolicyLFU:
+	default:
+		return fmt.Errorf("%v must be one of %s, %s or %s", evictionPolicyParam,
+			evictionPolicyNone, evictionPolicyLRU, evictionPolicyLFU)
+	}
+	return nil
+}
+
+// evict removes the coldest entries of the flow, other than the given key,
+// until an entry of the given size fits, and returns the cache size after the eviction
+func (p *writeCacheProcessor) evict(
+	flowName string,
+	cacheKey string,
+	currentCacheSize int64,
+	entrySize int64,
+	provider lunar_metrics.APICallMetricsProviderI,
+) int64 {
+	group := p.buildKeysIndexKey(flowName)
+
+	var evicted int64
+	for !p.fitsCache(currentCacheSize, entrySize) {
+		coldestKey, found := p.accessTracker.PopColdest(group, cacheKey)
+		if !found {
+			break
+		}
+		removed := p.removeEntry(flowName, coldestKey)
+		currentCacheSize = max(currentCacheSize-removed.PurgedBytes, 0)
+		evicted += removed.PurgedEntries
+	}
+
+	if evicted > 0 {
+		log.Debug().Msgf("Evicted %d %s cache entries of %s", evicted, p.evictionPolicy, p.name)
+		p.updateEvictionMetrics(flowName, provider, evicted)
+	}
+	return currentCacheSize
+}
+
+func (p *writeCacheProcessor) updateEvictionMetrics(
+	flowName string,
+	provider lunar_metrics.APICallMetricsProviderI,
+	evicted int64,
+) {
+	if !p.metaData.IsMetricsEnabled() {
+		return
+	}
+
+	attributes := p.labelManager.GetProcessorMetricsAttributes(provider, flowName, p.name)
+	p.metricObjects[cacheEntriesEvictedMetric].Add(context.Background(), evicted,
+		metric.WithAttributes(attributes...))
+}
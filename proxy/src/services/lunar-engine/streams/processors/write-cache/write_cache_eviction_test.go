@@ -0,0 +1,152 @@
+package writecache
+
+import (
+	"encoding/json"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/compression"
+	context_manager "lunar/toolkit-core/context-manager"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// evictionTestBody is large enough for two uncompressed entries to fill a cache of 1 MB,
+// which holds up to 2 MB minus a byte
+var evictionTestBody = strings.Repeat("a", 600*1024)
+
+func newEvictionTestProcessor(t *testing.T, evictionPolicy string) *writeCacheProcessor {
+	return newTestProcessor(t, map[string]any{
+		maxCacheSizeParam:   1,
+		compressionParam:    string(compression.EncodingNone),
+		evictionPolicyParam: evictionPolicy,
+	})
+}
+
+func writeEntries(t *testing.T, proc *writeCacheProcessor, apiKeys ...string) {
+	mockClock := context_manager.Get().GetMockClock()
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	for _, apiKey := range apiKeys {
+		output, err := proc.Execute("testFlow", newTestStream(lunarContext, apiKey, 200,
+			nil, evictionTestBody))
+		require.NoError(t, err)
+		require.False(t, output.Failure, apiKey)
+		mockClock.AdvanceTime(time.Second)
+	}
+}
+
+func recordHits(proc *writeCacheProcessor, hits map[string]int) {
+	mockClock := context_manager.Get().GetMockClock()
+	for apiKey, count := range hits {
+		for range count {
+			proc.accessTracker.RecordHit("testFlow_" + apiKey)
+		}
+		mockClock.AdvanceTime(time.Second)
+	}
+}
+
+func requireCacheSize(t *testing.T, proc *writeCacheProcessor) {
+	keys, err := proc.cacheIndex.SMembers(proc.buildKeysIndexKey("testFlow"))
+	require.NoError(t, err)
+
+	var storedSize int64
+	for _, cacheKey := range keys {
+		rawEntry, err := proc.cachedResponses.Get(cacheKey)
+		require.NoError(t, err)
+		storedSize += int64(len(rawEntry))
+	}
+	require.Equal(t, storedSize, proc.getCurrentCacheSize("testFlow"))
+}
+
+func TestWriteCacheEviction(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		evictionPolicy string
+		hits           map[string]int
+		evicted        string
+	}{
+		// k1 is served after k2, so k2 is the least recently used
+		{"lru", evictionPolicyLRU, map[string]int{"k1": 1}, "k2"},
+		// k2 is served more often than k1, so k1 is the least frequently used
+		{"lfu", evictionPolicyLFU, map[string]int{"k2": 2}, "k1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			context_manager.Get().SetMockClock()
+			proc := newEvictionTestProcessor(t, test.evictionPolicy)
+
+			writeEntries(t, proc, "k1", "k2")
+			recordHits(proc, test.hits)
+			writeEntries(t, proc, "k3")
+
+			for _, apiKey := range []string{"k1", "k2", "k3"} {
+				requireCached(t, proc, apiKey != test.evicted, "testFlow_"+apiKey)
+			}
+			require.Zero(t, proc.accessTracker.Get("testFlow_"+test.evicted))
+			requireCacheSize(t, proc)
+
+			// overwriting a stored entry replaces its size, so nothing is evicted
+			writeEntries(t, proc, "k3")
+			requireCached(t, proc, true, "testFlow_k3")
+			requireCacheSize(t, proc)
+		})
+	}
+}
+
+func TestWriteCacheWithoutEvictionRejectsEntries(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	proc := newEvictionTestProcessor(t, evictionPolicyNone)
+	writeEntries(t, proc, "k1", "k2")
+
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	output, err := proc.Execute("testFlow", newTestStream(lunarContext, "k3", 200,
+		nil, evictionTestBody))
+	require.NoError(t, err)
+	require.True(t, output.Failure)
+	requireCached(t, proc, true, "testFlow_k1", "testFlow_k2")
+	requireCached(t, proc, false, "testFlow_k3")
+}
+
+func TestWriteCacheCompression(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+
+	proc := newTestProcessor(t, map[string]any{compressionParam: string(compression.EncodingGZip)})
+	_, err := proc.Execute("testFlow", newTestStream(lunarContext, "key123", 200,
+		map[string]string{"Content-Type": "text/plain"}, evictionTestBody))
+	require.NoError(t, err)
+
+	entry := getStoredEntry(t, proc)
+	require.Equal(t, compression.EncodingGZip, entry.Encoding)
+	require.Positive(t, entry.BytesSaved())
+	require.Less(t, proc.getCurrentCacheSize("testFlow"), int64(len(evictionTestBody)/10))
+
+	content, err := entry.GetContent()
+	require.NoError(t, err)
+	require.Equal(t, entry.GetContentSize(), int64(len(content)))
+
+	var stored lunar_messages.OnResponse
+	require.NoError(t, json.Unmarshal(content, &stored))
+	require.True(t, stored.Body == evictionTestBody)
+	require.Equal(t, "text/plain", stored.Headers["Content-Type"])
+}
+
+func TestWriteCacheInvalidStorageParameters(t *testing.T) {
+	for _, params := range []map[string]any{
+		{compressionParam: "zstd"},
+		{evictionPolicyParam: "fifo"},
+	} {
+		_, err := NewProcessor(&streamtypes.ProcessorMetaData{
+			Name:       "WriteCache",
+			Parameters: test_utils.NewProcessorParams(defaultTestParams, params),
+		})
+		require.Error(t, err)
+	}
+
+	entry := &utils.SharedMemoryTTLEntry{}
+	require.Error(t, entry.Compress("zstd"))
+}
@@ -0,0 +1,184 @@
+package writecache
+
+import (
+	"encoding/json"
+	"lunar/engine/actions"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	test_utils "lunar/engine/streams/test-utils"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newHTTPSemanticsProcessor(t *testing.T) *writeCacheProcessor {
+	return newTestProcessor(t, map[string]any{httpSemanticsParam: true})
+}
+
+func newTestProcessor(t *testing.T, extraParams map[string]any) *writeCacheProcessor {
+	proc, err := NewProcessor(&streamtypes.ProcessorMetaData{
+		Name:       "WriteCache",
+		Parameters: test_utils.NewProcessorParams(defaultTestParams, extraParams),
+	})
+	require.NoError(t, err)
+	return proc.(*writeCacheProcessor)
+}
+
+// defaultTestParams are the parameters of a test processor, unless overridden
+var defaultTestParams = map[string]any{
+	ttlParam:             60,
+	recordMaxSizeParam:   -1,
+	maxCacheSizeParam:    10,
+	cachingKeyPartsParam: []string{"$.request.headers.api_key"},
+}
+
+func newHTTPSemanticsStream(
+	lunarContext public_types.LunarContextI,
+	status int,
+	respHeaders map[string]string,
+	respBody string,
+) public_types.APIStreamI {
+	return newTestStream(lunarContext, "key123", status, respHeaders, respBody)
+}
+
+func newTestStream(
+	lunarContext public_types.LunarContextI,
+	apiKey string,
+	status int,
+	respHeaders map[string]string,
+	respBody string,
+) public_types.APIStreamI {
+	apiStream := streamtypes.NewResponseAPIStream(lunar_messages.OnResponse{
+		ID:      "txn-1",
+		Method:  "GET",
+		URL:     "api.example.com/orders",
+		Status:  status,
+		Headers: respHeaders,
+		RawBody: []byte(respBody),
+	}, lunar_context.NewMemoryState[[]byte]())
+	apiStream.SetRequest(streamtypes.NewRequest(lunar_messages.OnRequest{
+		ID:      "txn-1",
+		Method:  "GET",
+		URL:     "api.example.com/orders",
+		Headers: map[string]string{"api_key": apiKey, "Accept-Language": "en"},
+	}))
+	apiStream.SetType(public_types.StreamTypeResponse)
+	return apiStream.WithLunarContext(lunarContext)
+}
+
+func getStoredEntry(t *testing.T, proc *writeCacheProcessor) *utils.SharedMemoryTTLEntry {
+	rawEntry, err := proc.cachedResponses.Get("testFlow_key123")
+	require.NoError(t, err)
+	entry, err := utils.ParseSharedMemoryTTLEntry(rawEntry)
+	require.NoError(t, err)
+	return entry
+}
+
+func TestWriteCacheHTTPSemanticsStorage(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+
+	for _, test := range []struct {
+		name        string
+		headers     map[string]string
+		storable    bool
+		expectedTTL int64
+	}{
+		{"no headers", map[string]string{}, true, 60},
+		{"max-age", map[string]string{"Cache-Control": "max-age=120"}, true, 120},
+		{"s-maxage", map[string]string{"Cache-Control": "max-age=120, s-maxage=30"}, true, 30},
+		{"no-cache", map[string]string{"Cache-Control": "no-cache"}, true, 0},
+		{"no-store", map[string]string{"Cache-Control": "no-store"}, false, 0},
+		{"private", map[string]string{"Cache-Control": "private, max-age=60"}, false, 0},
+		{"vary all", map[string]string{"Vary": "*"}, false, 0},
+	} {
+		proc := newHTTPSemanticsProcessor(t)
+		_, err := proc.Execute("testFlow", newHTTPSemanticsStream(lunarContext, 200, test.headers, "{}"))
+		require.NoError(t, err, test.name)
+
+		_, err = proc.cachedResponses.Get("testFlow_key123")
+		if !test.storable {
+			require.Error(t, err, test.name)
+			continue
+		}
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expectedTTL, getStoredEntry(t, proc).TTL, test.name)
+	}
+}
+
+func TestWriteCacheHTTPSemanticsRevalidation(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	proc := newHTTPSemanticsProcessor(t)
+
+	_, err := proc.Execute("testFlow", newHTTPSemanticsStream(lunarContext, 200, map[string]string{
+		"Cache-Control": "max-age=10",
+		"ETag":          `"v1"`,
+		"Vary":          "accept-language",
+		"Content-Type":  "application/json",
+	}, `{"orders":[]}`))
+	require.NoError(t, err)
+
+	entry := getStoredEntry(t, proc)
+	require.Equal(t, `"v1"`, entry.ETag)
+	require.Equal(t, map[string]string{"Accept-Language": "en"}, entry.Vary)
+	require.Equal(t, map[string]string{"If-None-Match": `"v1"`}, entry.ConditionalHeaders())
+
+	mockClock.AdvanceTime(20 * time.Second)
+	require.False(t, getStoredEntry(t, proc).IsAlive())
+
+	// A 304 answering a client's own conditional request is passed through
+	notModified := newHTTPSemanticsStream(lunarContext, 304,
+		map[string]string{"Cache-Control": "max-age=30"}, "")
+	output, err := proc.Execute("testFlow", notModified)
+	require.NoError(t, err)
+	require.Nil(t, output.RespAction)
+	require.False(t, getStoredEntry(t, proc).IsAlive())
+
+	// A 304 answering a revalidation refreshes the entry and is replaced with the stored response
+	require.NoError(t, utils.SetCacheRevalidation(notModified, "testFlow_key123"))
+	output, err = proc.Execute("testFlow", notModified)
+	require.NoError(t, err)
+
+	modifyResponse := output.RespAction.(*actions.ModifyResponseAction)
+	require.Equal(t, 200, modifyResponse.Status)
+	require.Equal(t, `{"orders":[]}`, modifyResponse.Body)
+	require.Equal(t, "max-age=30", modifyResponse.HeadersToSet["Cache-Control"])
+	require.Equal(t, "application/json", modifyResponse.HeadersToSet["Content-Type"])
+
+	entry = getStoredEntry(t, proc)
+	require.True(t, entry.IsAlive())
+	require.Equal(t, int64(30), entry.TTL)
+
+	content, err := entry.GetContent()
+	require.NoError(t, err)
+	var stored streamtypes.OnResponse
+	require.NoError(t, json.Unmarshal(content, &stored))
+	require.Equal(t, "max-age=30", stored.Headers["Cache-Control"])
+
+	// the cache size follows the refreshed entry, and the entry is accounted as written
+	rawEntry, err := proc.cachedResponses.Get("testFlow_key123")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(rawEntry)), proc.getCurrentCacheSize("testFlow"))
+	require.Equal(t, mockClock.Now().UnixNano(),
+		proc.accessTracker.Get("testFlow_key123").LastAccess)
+}
+
+func TestWriteCacheHTTPSemanticsRevalidationOfRemovedEntry(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	proc := newHTTPSemanticsProcessor(t)
+	require.True(t, proc.GetRequirement().IsReqCaptureRequired)
+
+	// The entry was removed before the 304 arrived, so the request is re-issued
+	notModified := newHTTPSemanticsStream(lunarContext, 304, map[string]string{}, "")
+	require.NoError(t, utils.SetCacheRevalidation(notModified, "testFlow_key123"))
+	output, err := proc.Execute("testFlow", notModified)
+	require.NoError(t, err)
+	require.IsType(t, &actions.RetryRequestAction{}, output.RespAction)
+}
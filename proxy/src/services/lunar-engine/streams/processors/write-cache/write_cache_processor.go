@@ -8,7 +8,10 @@ import (
 	lunar_context "lunar/engine/streams/lunar-context"
 	"lunar/engine/streams/processors/utils"
 	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/utils/compression"
+	context_manager "lunar/toolkit-core/context-manager"
 	"lunar/toolkit-core/otel"
+	"net/http"
 	"time"
 
 	streamtypes "lunar/engine/streams/types"
@@ -18,29 +21,45 @@ import (
 )
 
 const (
-	ttlParam             = "ttl_seconds"
-	recordMaxSizeParam   = "record_max_size_bytes"
-	maxCacheSizeParam    = "max_cache_size_mb"
-	cachingKeyPartsParam = "caching_key_parts"
+	ttlParam                  = "ttl_seconds"
+	staleWhileRevalidateParam = "stale_while_revalidate_seconds"
+	staleIfErrorParam         = "stale_if_error_seconds"
+	httpSemanticsParam        = "http_semantics"
+	recordMaxSizeParam        = "record_max_size_bytes"
+	maxCacheSizeParam         = "max_cache_size_mb"
+	cachingKeyPartsParam      = "caching_key_parts"
+	tagsParam                 = "tags"
+	compressionParam          = "compression"
+	evictionPolicyParam       = "eviction_policy"
 
 	usedCacheSizeKey = "used_cache_size"
 
 	cacheSizeMetric           = lunar_metrics.MetricPrefix + "write_cache_processor_cache_size_written"
 	cacheEntriesWrittenMetric = lunar_metrics.MetricPrefix + "write_cache_processor_cache_entries_written" //nolint:lll
+	cacheBytesSavedMetric     = lunar_metrics.MetricPrefix + "write_cache_processor_cache_bytes_saved"
+	cacheEntriesEvictedMetric = lunar_metrics.MetricPrefix + "write_cache_processor_cache_entries_evicted" //nolint:lll
 )
 
 type writeCacheProcessor struct {
 	name string
 
-	ttlSeconds            int64
-	recordMaxSizeBytes    int
-	maxCacheSizeMb        int
-	cachingKeyDefinitions []string
+	ttlSeconds                  int64
+	staleWhileRevalidateSeconds int64
+	staleIfErrorSeconds         int64
+	httpSemantics               bool
+	recordMaxSizeBytes          int
+	maxCacheSizeMb              int
+	cachingKeyDefinitions       []string
+	tagDefinitions              []string
+	encoding                    compression.Encoding
+	evictionPolicy              string
 
 	usedCacheSizeKeySuffix string
 	usedCacheSize          public_types.SharedStateI[int64]
 	cachedResponses        public_types.SharedStateI[[]byte]
+	cacheIndex             public_types.SharedStateI[string]
 	expiredCollector       *lunar_context.ExpireWatcher[[]byte]
+	accessTracker          *utils.CacheAccessTracker
 
 	metaData     *streamtypes.ProcessorMetaData
 	labelManager *lunar_metrics.LabelManager
@@ -58,10 +77,13 @@ func NewProcessor(
 		usedCacheSizeKeySuffix: fmt.Sprintf("%s_%s", metaData.Name, usedCacheSizeKey),
 		usedCacheSize:          lunar_context.NewSharedState[int64](),
 		cachedResponses:        lunar_context.NewSharedState[[]byte](),
+		cacheIndex:             lunar_context.NewSharedState[string](),
+		accessTracker:          utils.GetCacheAccessTracker(),
 		labelManager:           lunar_metrics.NewLabelManager(metaData.GetMetricLabels()),
 	}
 
-	proc.expiredCollector = lunar_context.GetExpireWatcher(proc.cachedResponses.Pop)
+	proc.expiredCollector = lunar_context.NewExpireWatcher(proc.expireEntry,
+		context_manager.Get().GetClock())
 
 	if err := proc.init(); err != nil {
 		return nil, err
@@ -83,6 +105,8 @@ func (p *writeCacheProcessor) GetName() string {
 func (p *writeCacheProcessor) GetRequirement() *streamtypes.ProcessorRequirement {
 	return &streamtypes.ProcessorRequirement{
 		IsBodyRequired: true,
+		// revalidated requests are re-issued when their entry is gone
+		IsReqCaptureRequired: p.httpSemantics,
 	}
 }
 
@@ -94,6 +118,9 @@ func (p *writeCacheProcessor) Execute(
 		return streamtypes.ProcessorIO{}, fmt.Errorf("invalid stream type: %s", apiStream.GetType())
 	}
 
+	// the revalidation marker is popped first, so it never outlives the transaction
+	_, isRevalidation := utils.PopCacheRevalidation(apiStream)
+
 	cacheKey, err := utils.BuildSharedMemoryKey(flowName,
 		p.cachingKeyDefinitions,
 		apiStream)
@@ -110,15 +137,41 @@ func (p *writeCacheProcessor) Execute(
 	if response == nil {
 		return streamtypes.ProcessorIO{}, fmt.Errorf("response not found")
 	}
-	cacheEntry, err := utils.BuildSharedMemoryTTLEntry(p.ttlSeconds, response)
+
+	if p.httpSemantics && response.GetStatus() == http.StatusNotModified {
+		if isRevalidation {
+			return p.revalidate(flowName, cacheKey, apiStream)
+		}
+		// the client revalidated its own copy, there is nothing to store
+		return streamtypes.ProcessorIO{
+			Type:      apiStream.GetType(),
+			ReqAction: &actions.NoOpAction{},
+		}, nil
+	}
+
+	cacheEntry, storable, err := p.buildCacheEntry(apiStream)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to build cache record for %s", p.name)
 		return streamtypes.ProcessorIO{}, err
 	}
+	if !storable {
+		log.Trace().Msgf("Response is not storable by %s", p.name)
+		return streamtypes.ProcessorIO{
+			Type:      apiStream.GetType(),
+			ReqAction: &actions.NoOpAction{},
+		}, nil
+	}
 
-	cacheEntrySize := len(cacheEntry)
+	cacheEntryData, err := cacheEntry.Marshal()
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to build cache record for %s", p.name)
+		return streamtypes.ProcessorIO{}, err
+	}
+	cacheEntrySize := int64(len(cacheEntryData))
 
-	currentCacheSize, canProceed := p.ensureCacheEntrySize(cacheEntrySize, flowName)
+	previousSize, previousTags := p.getStoredEntry(cacheKey)
+	currentCacheSize, canProceed := p.ensureCacheEntrySize(flowName, cacheKey,
+		cacheEntrySize, previousSize, apiStream)
 	if !canProceed {
 		return streamtypes.ProcessorIO{
 			Type:      apiStream.GetType(),
@@ -127,15 +180,18 @@ func (p *writeCacheProcessor) Execute(
 		}, nil
 	}
 
-	err = p.cachedResponses.Set(cacheKey, cacheEntry)
+	err = p.cachedResponses.Set(cacheKey, cacheEntryData)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to set cache entry for %s", p.name)
 		return streamtypes.ProcessorIO{}, err
 	}
-	p.expiredCollector.AddKey(cacheKey, time.Second*time.Duration(p.ttlSeconds))
+	p.indexEntry(flowName, cacheKey, previousTags, cacheEntry.Tags)
+	p.expireAfterGracePeriod(flowName, cacheKey, cacheEntry)
+	p.accessTracker.RecordWrite(p.buildKeysIndexKey(flowName), cacheKey,
+		p.evictionPolicy == evictionPolicyLFU)
 
-	p.updateMetrics(flowName, apiStream, cacheEntrySize)
-	p.updateCacheSize(flowName, currentCacheSize+int64(cacheEntrySize))
+	p.updateMetrics(flowName, apiStream, cacheEntrySize, cacheEntry.BytesSaved())
+	p.updateCacheSize(flowName, currentCacheSize+cacheEntrySize)
 
 	return streamtypes.ProcessorIO{
 		Type:      apiStream.GetType(),
@@ -155,6 +211,12 @@ func (p *writeCacheProcessor) init() error {
 		return fmt.Errorf("%v cannot be empty", cachingKeyPartsParam)
 	}
 
+	if err := utils.ExtractListOfStringParam(p.metaData.Parameters,
+		tagsParam,
+		&p.tagDefinitions); err != nil {
+		log.Trace().Msgf("tags not defined for %v", p.name)
+	}
+
 	if err := utils.ExtractInt64Param(p.metaData.Parameters,
 		ttlParam,
 		&p.ttlSeconds); err != nil {
@@ -162,6 +224,49 @@ func (p *writeCacheProcessor) init() error {
 		return err
 	}
 
+	if err := utils.ExtractInt64Param(p.metaData.Parameters,
+		staleWhileRevalidateParam,
+		&p.staleWhileRevalidateSeconds); err != nil {
+		log.Trace().Msgf("stale_while_revalidate_seconds not defined for %v", p.name)
+	}
+
+	if err := utils.ExtractInt64Param(p.metaData.Parameters,
+		staleIfErrorParam,
+		&p.staleIfErrorSeconds); err != nil {
+		log.Trace().Msgf("stale_if_error_seconds not defined for %v", p.name)
+	}
+
+	if err := utils.ExtractBoolParam(p.metaData.Parameters,
+		httpSemanticsParam,
+		&p.httpSemantics); err != nil {
+		log.Trace().Msgf("http_semantics not defined for %v", p.name)
+	}
+
+	var compressionName string
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		compressionParam,
+		&compressionName); err != nil {
+		log.Trace().Msgf("compression not defined for %v", p.name)
+	}
+	encoding, err := compression.ParseEncoding(compressionName)
+	if err != nil {
+		return fmt.Errorf("invalid %v: %w", compressionParam, err)
+	}
+	p.encoding = encoding
+
+	if err := utils.ExtractStrParam(p.metaData.Parameters,
+		evictionPolicyParam,
+		&p.evictionPolicy); err != nil {
+		log.Trace().Msgf("eviction_policy not defined for %v", p.name)
+	}
+	if err := p.validateEvictionPolicy(); err != nil {
+		return err
+	}
+
+	if p.staleWhileRevalidateSeconds < 0 || p.staleIfErrorSeconds < 0 {
+		return fmt.Errorf("%v and %v cannot be negative", staleWhileRevalidateParam, staleIfErrorParam)
+	}
+
 	if err := utils.ExtractIntParam(p.metaData.Parameters,
 		recordMaxSizeParam,
 		&p.recordMaxSizeBytes); err != nil {
@@ -204,6 +309,23 @@ func (p *writeCacheProcessor) initializeMetrics() error {
 	}
 	p.metricObjects[cacheEntriesWrittenMetric] = meterObj
 
+	meterObj, err = meter.Int64Counter(
+		cacheBytesSavedMetric,
+		metric.WithUnit("By"), // unit for bytes
+		metric.WithDescription("Bytes saved by compressing the cache entries written by processor"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+	p.metricObjects[cacheBytesSavedMetric] = meterObj
+
+	meterObj, err = meter.Int64Counter(
+		cacheEntriesEvictedMetric,
+		metric.WithDescription("Cache entries evicted by processor to make room for new entries"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize metric: %w", err)
+	}
+	p.metricObjects[cacheEntriesEvictedMetric] = meterObj
+
 	log.Info().Msgf("Metrics initialized for %s", p.name)
 	return nil
 }
@@ -211,7 +333,8 @@ func (p *writeCacheProcessor) initializeMetrics() error {
 func (p *writeCacheProcessor) updateMetrics(
 	flowName string,
 	provider lunar_metrics.APICallMetricsProviderI,
-	cacheEntrySize int,
+	cacheEntrySize int64,
+	bytesSaved int64,
 ) {
 	if !p.metaData.IsMetricsEnabled() {
 		return
@@ -221,24 +344,158 @@ func (p *writeCacheProcessor) updateMetrics(
 	preparedAttributes := metric.WithAttributes(attributes...)
 
 	ctx := context.Background()
-	p.metricObjects[cacheSizeMetric].Add(ctx, int64(cacheEntrySize), preparedAttributes)
+	p.metricObjects[cacheSizeMetric].Add(ctx, cacheEntrySize, preparedAttributes)
 	p.metricObjects[cacheEntriesWrittenMetric].Add(ctx, 1, preparedAttributes)
+	if bytesSaved > 0 {
+		p.metricObjects[cacheBytesSavedMetric].Add(ctx, bytesSaved, preparedAttributes)
+	}
 
 	log.Trace().Msgf("Metrics updated for %s", p.name)
 }
 
-// ensureCacheEntrySize checks if the cache entry size is within the limits
-// and returns the current cache size and if the entry can be stored
-func (p *writeCacheProcessor) ensureCacheEntrySize(entrySize int, flowName string) (int64, bool) {
-	currentCacheSize := p.getCurrentCacheSize(flowName)
-	newCacheSizeMb := (currentCacheSize + int64(entrySize)) / (1024 * 1024)
-	if newCacheSizeMb > int64(p.maxCacheSizeMb) {
-		log.Warn().Msgf("cache size exceeded. New size: %v, max size: %v. Response won't be stored",
-			newCacheSizeMb, p.maxCacheSizeMb)
-		return 0, false
+// buildCacheEntry builds the cache entry of the response and returns false
+// when the provider does not allow storing it
+func (p *writeCacheProcessor) buildCacheEntry(
+	apiStream public_types.APIStreamI,
+) (*utils.SharedMemoryTTLEntry, bool, error) {
+	response := apiStream.GetResponse()
+	ttl := p.ttlSeconds
+	var policy utils.HTTPCachePolicy
+	if p.httpSemantics {
+		policy = utils.ParseHTTPCachePolicy(response.GetHeaders(),
+			context_manager.Get().GetClock().Now().UTC())
+		if !policy.Storable {
+			return nil, false, nil
+		}
+		if policy.HasTTL {
+			ttl = policy.TTL
+		}
+	}
+
+	entry, err := utils.NewSharedMemoryTTLEntry(ttl, response)
+	if err != nil {
+		return nil, false, err
+	}
+	entry.StaleWhileRevalidate = p.staleWhileRevalidateSeconds
+	entry.StaleIfError = p.staleIfErrorSeconds
+	entry.Tags = p.extractTags(apiStream)
+
+	if p.httpSemantics {
+		var requestHeaders map[string]string
+		if request := apiStream.GetRequest(); request != nil {
+			requestHeaders = request.GetHeaders()
+		}
+		entry.WithHTTPValidators(response.GetHeaders(), requestHeaders, policy.Vary)
+	}
+
+	if err = entry.Compress(p.encoding); err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// revalidate refreshes the stored entry with the 304 (Not Modified) response of the provider
+// and replaces the 304 response with the stored one.
+// The client did not ask for a 304, so when the stored entry is gone the request is re-issued,
+// and as it is no longer cached it is sent without the validators.
+func (p *writeCacheProcessor) revalidate(
+	flowName string,
+	cacheKey string,
+	apiStream public_types.APIStreamI,
+) (streamtypes.ProcessorIO, error) {
+	reissue := streamtypes.ProcessorIO{
+		Type:       apiStream.GetType(),
+		RespAction: &actions.RetryRequestAction{},
+	}
+
+	rawEntry, err := p.cachedResponses.Get(cacheKey)
+	if err != nil {
+		log.Debug().Msgf("Revalidated entry of %s is no longer cached, re-issuing request", p.name)
+		return reissue, nil
+	}
+	entry, err := utils.ParseSharedMemoryTTLEntry(rawEntry)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to parse cache entry for %s", p.name)
+		p.discardEntry(flowName, cacheKey)
+		return reissue, nil
+	}
+
+	response := apiStream.GetResponse()
+	ttl := entry.TTL
+	policy := utils.ParseHTTPCachePolicy(response.GetHeaders(),
+		context_manager.Get().GetClock().Now().UTC())
+	if policy.HasTTL {
+		ttl = policy.TTL
+	}
+
+	stored, err := entry.Revalidate(ttl, response.GetHeaders())
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to revalidate cache entry for %s", p.name)
+		p.discardEntry(flowName, cacheKey)
+		return reissue, nil
+	}
+
+	served := streamtypes.ProcessorIO{
+		Type: apiStream.GetType(),
+		RespAction: &actions.ModifyResponseAction{
+			Status:       stored.Status,
+			Body:         stored.Body,
+			HeadersToSet: stored.Headers,
+		},
 	}
 
-	if p.recordMaxSizeBytes != -1 && entrySize > p.recordMaxSizeBytes {
+	cacheEntry, err := entry.Marshal()
+	if err != nil {
+		return streamtypes.ProcessorIO{}, err
+	}
+	// the refreshed headers may change the size of the entry
+	cacheEntrySize := int64(len(cacheEntry))
+	currentCacheSize, canProceed := p.ensureCacheEntrySize(flowName, cacheKey,
+		cacheEntrySize, int64(len(rawEntry)), apiStream)
+	if !canProceed {
+		// the stored response is still served, it is just no longer cached
+		p.discardEntry(flowName, cacheKey)
+		return served, nil
+	}
+
+	if err = p.cachedResponses.Set(cacheKey, cacheEntry); err != nil {
+		log.Error().Err(err).Msgf("Failed to set cache entry for %s", p.name)
+		return streamtypes.ProcessorIO{}, err
+	}
+	p.expireAfterGracePeriod(flowName, cacheKey, entry)
+	p.accessTracker.RecordWrite(p.buildKeysIndexKey(flowName), cacheKey,
+		p.evictionPolicy == evictionPolicyLFU)
+	p.updateCacheSize(flowName, currentCacheSize+cacheEntrySize)
+
+	return served, nil
+}
+
+// expireAfterGracePeriod schedules the removal of the entry.
+// Expired entries are kept for the grace period, so they can still be served as stale,
+// and entries with validators are kept for another TTL, so they can be revalidated.
+func (p *writeCacheProcessor) expireAfterGracePeriod(
+	flowName string,
+	cacheKey string,
+	entry *utils.SharedMemoryTTLEntry,
+) {
+	gracePeriod := entry.GracePeriod()
+	if p.httpSemantics && entry.HasValidators() {
+		gracePeriod = max(gracePeriod, p.ttlSeconds)
+	}
+	p.expiredCollector.AddKey(p.buildExpiryKey(flowName, cacheKey),
+		time.Second*time.Duration(entry.TTL+gracePeriod))
+}
+
+// ensureCacheEntrySize checks if the cache entry size is within the limits, evicting cold entries
+// when allowed, and returns the cache size without the replaced entry and if the entry can be stored
+func (p *writeCacheProcessor) ensureCacheEntrySize(
+	flowName string,
+	cacheKey string,
+	entrySize int64,
+	previousSize int64,
+	provider lunar_metrics.APICallMetricsProviderI,
+) (int64, bool) {
+	if p.recordMaxSizeBytes != -1 && entrySize > int64(p.recordMaxSizeBytes) {
 		log.Warn().Msgf("response size %v exceeds the max allowed size %v. Response won't be stored",
 			entrySize,
 			p.recordMaxSizeBytes,
@@ -246,7 +503,28 @@ func (p *writeCacheProcessor) ensureCacheEntrySize(entrySize int, flowName strin
 		return 0, false
 	}
 
-	return currentCacheSize, true
+	currentCacheSize := max(p.getCurrentCacheSize(flowName)-previousSize, 0)
+	if p.fitsCache(currentCacheSize, entrySize) {
+		return currentCacheSize, true
+	}
+
+	if p.evictionPolicy != evictionPolicyNone {
+		currentCacheSize = p.evict(flowName, cacheKey, currentCacheSize, entrySize, provider)
+		if p.fitsCache(currentCacheSize, entrySize) {
+			return currentCacheSize, true
+		}
+		p.updateCacheSize(flowName, currentCacheSize+previousSize)
+	}
+
+	log.Warn().Msgf("cache size exceeded. New size: %v, max size: %v. Response won't be stored",
+		(currentCacheSize+entrySize)/(1024*1024), p.maxCacheSizeMb)
+	return 0, false
+}
+
+// fitsCache returns true if an entry of the given size can be added to the cache
+func (p *writeCacheProcessor) fitsCache(currentCacheSize, entrySize int64) bool {
+	newCacheSizeMb := (currentCacheSize + entrySize) / (1024 * 1024)
+	return newCacheSizeMb <= int64(p.maxCacheSizeMb)
 }
 
 // getCurrentCacheSize returns the current cache size allocated by this processor
@@ -287,8 +287,11 @@ func getTTLResponseFromCache(t *testing.T, key string) (lunar_messages.OnRespons
 	ttlEntry, err := utils.ParseSharedMemoryTTLEntry(storedBytes)
 	require.NoError(t, err)
 
+	content, err := ttlEntry.GetContent()
+	require.NoError(t, err)
+
 	var onResponse lunar_messages.OnResponse
-	err = json.Unmarshal(ttlEntry.Content, &onResponse)
+	err = json.Unmarshal(content, &onResponse)
 	require.NoError(t, err)
 
 	return onResponse, ttlEntry.IsAlive()
@@ -0,0 +1,220 @@
+package writecache
+
+import (
+	"fmt"
+	"lunar/engine/streams/processors/utils"
+	public_types "lunar/engine/streams/public-types"
+	"lunar/engine/streams/stream"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/toolkit-core/jsonpath"
+	"math"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var _ streamtypes.CacheProcessorI = &writeCacheProcessor{}
+
+// The cache entries are indexed by flow and by tag, so they can be purged without scanning
+// the shared state. Entries leave the indexes when they are removed or expire.
+const (
+	flowsIndexKey = "cache_flows"
+	keysIndexKey  = "cache_keys"
+	tagIndexKey   = "cache_tag"
+
+	expiryKeySeparator = "::"
+)
+
+// PurgeCache removes the cache entries selected by the request and returns what was removed
+func (p *writeCacheProcessor) PurgeCache(
+	request streamtypes.CachePurgeRequest,
+) (streamtypes.CachePurgeResult, error) {
+	var result streamtypes.CachePurgeResult
+
+	flowNames, err := p.cacheIndex.SMembers(p.buildFlowsIndexKey())
+	if err != nil {
+		return result, fmt.Errorf("failed to get cached flows of %s: %w", p.name, err)
+	}
+
+	for _, flowName := range flowNames {
+		if request.Flow != "" && request.Flow != flowName {
+			continue
+		}
+
+		indexKey := p.buildKeysIndexKey(flowName)
+		if request.Tag != "" {
+			indexKey = p.buildTagIndexKey(flowName, request.Tag)
+		}
+		cacheKeys, err := p.cacheIndex.SMembers(indexKey)
+		if err != nil {
+			return result, fmt.Errorf("failed to get cache keys of %s: %w", p.name, err)
+		}
+
+		var flowResult streamtypes.CachePurgeResult
+		for _, cacheKey := range cacheKeys {
+			if request.MatchesKey(cacheKey) {
+				flowResult.Add(p.removeEntry(flowName, cacheKey))
+			}
+		}
+
+		if flowResult.PurgedBytes > 0 {
+			currentCacheSize := p.getCurrentCacheSize(flowName)
+			p.updateCacheSize(flowName, max(currentCacheSize-flowResult.PurgedBytes, 0))
+		}
+		result.Add(flowResult)
+	}
+
+	log.Debug().Msgf("Purged %d cache entries (%d bytes) of %s",
+		result.PurgedEntries, result.PurgedBytes, p.name)
+	return result, nil
+}
+
+// removeEntry removes the entry and its index references,
+// the entry is only counted if it was still stored
+func (p *writeCacheProcessor) removeEntry(
+	flowName string,
+	cacheKey string,
+) streamtypes.CachePurgeResult {
+	var result streamtypes.CachePurgeResult
+	var tags []string
+
+	rawEntry, err := p.cachedResponses.Pop(cacheKey)
+	if err == nil && len(rawEntry) > 0 {
+		result.PurgedEntries = 1
+		result.PurgedBytes = int64(len(rawEntry))
+		if entry, err := utils.ParseSharedMemoryTTLEntry(rawEntry); err == nil {
+			tags = entry.Tags
+		}
+	}
+
+	p.accessTracker.Remove(cacheKey)
+	p.removeFromIndex(p.buildKeysIndexKey(flowName), cacheKey)
+	for _, tag := range tags {
+		p.removeFromIndex(p.buildTagIndexKey(flowName, tag), cacheKey)
+	}
+	return result
+}
+
+// discardEntry removes an expired or unusable entry and releases its size from the cache
+func (p *writeCacheProcessor) discardEntry(flowName, cacheKey string) {
+	removed := p.removeEntry(flowName, cacheKey)
+	if removed.PurgedBytes > 0 {
+		p.updateCacheSize(flowName, max(p.getCurrentCacheSize(flowName)-removed.PurgedBytes, 0))
+	}
+}
+
+// expireEntry removes an expired entry, the expiry key holds the flow and the cache key
+// as built by buildExpiryKey
+func (p *writeCacheProcessor) expireEntry(expiryKey string) ([]byte, error) {
+	flowName, cacheKey, found := strings.Cut(expiryKey, expiryKeySeparator)
+	if !found {
+		return nil, fmt.Errorf("invalid expiry key %s of %s", expiryKey, p.name)
+	}
+	p.discardEntry(flowName, cacheKey)
+	return nil, nil
+}
+
+// indexEntry adds the entry to the indexes of its flow and tags,
+// the previous tags of an overwritten entry no longer reference it
+func (p *writeCacheProcessor) indexEntry(
+	flowName string,
+	cacheKey string,
+	previousTags []string,
+	tags []string,
+) {
+	p.addToIndex(p.buildFlowsIndexKey(), flowName)
+	p.addToIndex(p.buildKeysIndexKey(flowName), cacheKey)
+	for _, tag := range previousTags {
+		p.removeFromIndex(p.buildTagIndexKey(flowName, tag), cacheKey)
+	}
+	for _, tag := range tags {
+		p.addToIndex(p.buildTagIndexKey(flowName, tag), cacheKey)
+	}
+}
+
+// getStoredEntry returns the size and the tags of the stored entry, if any
+func (p *writeCacheProcessor) getStoredEntry(cacheKey string) (int64, []string) {
+	rawEntry, err := p.cachedResponses.Get(cacheKey)
+	if err != nil || len(rawEntry) == 0 {
+		return 0, nil
+	}
+	if len(p.tagDefinitions) == 0 {
+		return int64(len(rawEntry)), nil
+	}
+	entry, err := utils.ParseSharedMemoryTTLEntry(rawEntry)
+	if err != nil {
+		return int64(len(rawEntry)), nil
+	}
+	return int64(len(rawEntry)), entry.Tags
+}
+
+// extractTags extracts the tags of the API call using the tag definitions.
+// String values may hold several comma separated tags.
+func (p *writeCacheProcessor) extractTags(apiStream public_types.APIStreamI) []string {
+	if len(p.tagDefinitions) == 0 {
+		return nil
+	}
+
+	object := stream.AsObject(apiStream)
+	var tags []string
+	seen := make(map[string]struct{})
+	addTag := func(tag string) {
+		tag = strings.TrimSpace(tag)
+		if _, found := seen[tag]; found || tag == "" {
+			return
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	for _, definition := range p.tagDefinitions {
+		value, err := jsonpath.GetJSONPathValue(object, definition)
+		if err != nil || value == nil {
+			log.Trace().Msgf("Tag %s not found for %s", definition, p.name)
+			continue
+		}
+
+		switch typedValue := value.(type) {
+		case string:
+			for _, tag := range strings.Split(typedValue, ",") {
+				addTag(tag)
+			}
+		case []any:
+			for _, item := range typedValue {
+				addTag(fmt.Sprintf("%v", item))
+			}
+		default:
+			addTag(fmt.Sprintf("%v", typedValue))
+		}
+	}
+	return tags
+}
+
+func (p *writeCacheProcessor) addToIndex(indexKey, member string) {
+	if _, err := p.cacheIndex.AtomicSAddWithMaxValuesAllowed(
+		indexKey, member, math.MaxInt64); err != nil {
+		log.Warn().Err(err).Msgf("Failed to index %s of %s", member, p.name)
+	}
+}
+
+func (p *writeCacheProcessor) removeFromIndex(indexKey, member string) {
+	if err := p.cacheIndex.SRem(indexKey, member); err != nil {
+		log.Warn().Err(err).Msgf("Failed to remove %s from the index of %s", member, p.name)
+	}
+}
+
+func (p *writeCacheProcessor) buildExpiryKey(flowName, cacheKey string) string {
+	return flowName + expiryKeySeparator + cacheKey
+}
+
+func (p *writeCacheProcessor) buildFlowsIndexKey() string {
+	return fmt.Sprintf("%s_%s", p.name, flowsIndexKey)
+}
+
+func (p *writeCacheProcessor) buildKeysIndexKey(flowName string) string {
+	return fmt.Sprintf("%s_%s_%s", flowName, p.name, keysIndexKey)
+}
+
+func (p *writeCacheProcessor) buildTagIndexKey(flowName, tag string) string {
+	return fmt.Sprintf("%s_%s_%s_%s", flowName, p.name, tagIndexKey, tag)
+}
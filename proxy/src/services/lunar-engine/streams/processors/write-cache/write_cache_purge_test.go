@@ -0,0 +1,219 @@
+package writecache
+
+import (
+	lunar_context "lunar/engine/streams/lunar-context"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fillPurgeTestCache stores an entry per API key, tagged by the x-tenant response header
+func fillPurgeTestCache(t *testing.T, proc *writeCacheProcessor) {
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	for flowName, entries := range map[string]map[string]string{
+		"orders":   {"a1": "acme", "a2": "acme, beta", "b1": "beta"},
+		"invoices": {"a1": "acme"},
+	} {
+		for apiKey, tenants := range entries {
+			_, err := proc.Execute(flowName, newTestStream(lunarContext, apiKey, 200,
+				map[string]string{"x-tenant": tenants}, `{"id":1}`))
+			require.NoError(t, err)
+		}
+	}
+}
+
+func requireCached(t *testing.T, proc *writeCacheProcessor, cached bool, cacheKeys ...string) {
+	for _, cacheKey := range cacheKeys {
+		_, err := proc.cachedResponses.Get(cacheKey)
+		require.Equal(t, cached, err == nil, cacheKey)
+	}
+}
+
+func TestWriteCachePurge(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	allKeys := []string{"orders_a1", "orders_a2", "orders_b1", "invoices_a1"}
+
+	for _, test := range []struct {
+		name    string
+		request streamtypes.CachePurgeRequest
+		purged  []string
+	}{
+		{"key", streamtypes.CachePurgeRequest{Key: "orders_a1"}, []string{"orders_a1"}},
+		{
+			"prefix",
+			streamtypes.CachePurgeRequest{Prefix: "orders_a"},
+			[]string{"orders_a1", "orders_a2"},
+		},
+		{
+			"pattern",
+			streamtypes.CachePurgeRequest{Pattern: "*_a1"},
+			[]string{"orders_a1", "invoices_a1"},
+		},
+		{
+			"flow",
+			streamtypes.CachePurgeRequest{Flow: "orders"},
+			[]string{"orders_a1", "orders_a2", "orders_b1"},
+		},
+		{
+			"tag",
+			streamtypes.CachePurgeRequest{Tag: "beta"},
+			[]string{"orders_a2", "orders_b1"},
+		},
+		{
+			"tag of flow",
+			streamtypes.CachePurgeRequest{Flow: "invoices", Tag: "acme"},
+			[]string{"invoices_a1"},
+		},
+	} {
+		proc := newTestProcessor(t, map[string]any{
+			tagsParam: []string{`$.response.headers['x-tenant']`},
+		})
+		fillPurgeTestCache(t, proc)
+		ordersSize := proc.getCurrentCacheSize("orders")
+
+		result, err := proc.PurgeCache(test.request)
+		require.NoError(t, err, test.name)
+		require.Equal(t, int64(len(test.purged)), result.PurgedEntries, test.name)
+		requireCached(t, proc, false, test.purged...)
+
+		var remaining []string
+		for _, cacheKey := range allKeys {
+			purged := false
+			for _, purgedKey := range test.purged {
+				purged = purged || purgedKey == cacheKey
+			}
+			if !purged {
+				remaining = append(remaining, cacheKey)
+			}
+		}
+		requireCached(t, proc, true, remaining...)
+
+		// The purged size is no longer accounted for
+		purgedOrdersSize := ordersSize - proc.getCurrentCacheSize("orders")
+		require.GreaterOrEqual(t, result.PurgedBytes, purgedOrdersSize, test.name)
+		require.GreaterOrEqual(t, proc.getCurrentCacheSize("orders"), int64(0), test.name)
+
+		// Purging again finds nothing
+		result, err = proc.PurgeCache(test.request)
+		require.NoError(t, err, test.name)
+		require.Zero(t, result.PurgedEntries, test.name)
+	}
+}
+
+func TestWriteCachePurgeRetaggedEntry(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	proc := newTestProcessor(t, map[string]any{
+		tagsParam: []string{`$.response.headers['x-tenant']`},
+	})
+
+	for _, tenant := range []string{"acme", "beta"} {
+		_, err := proc.Execute("orders", newTestStream(lunarContext, "a1", 200,
+			map[string]string{"x-tenant": tenant}, `{"id":1}`))
+		require.NoError(t, err)
+	}
+
+	result, err := proc.PurgeCache(streamtypes.CachePurgeRequest{Tag: "acme"})
+	require.NoError(t, err)
+	require.Zero(t, result.PurgedEntries)
+	requireCached(t, proc, true, "orders_a1")
+
+	result, err = proc.PurgeCache(streamtypes.CachePurgeRequest{Tag: "beta"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), result.PurgedEntries)
+	requireCached(t, proc, false, "orders_a1")
+}
+
+func TestWriteCacheExpiredEntryIsRemovedFromIndexes(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	proc := newTestProcessor(t, map[string]any{
+		tagsParam: []string{`$.response.headers['x-tenant']`},
+	})
+	fillPurgeTestCache(t, proc)
+	proc.accessTracker.RecordHit("orders_a2")
+	ordersSize := proc.getCurrentCacheSize("orders")
+
+	_, err := proc.expireEntry(proc.buildExpiryKey("orders", "orders_a2"))
+	require.NoError(t, err)
+	requireCached(t, proc, false, "orders_a2")
+
+	cacheKeys, err := proc.cacheIndex.SMembers(proc.buildKeysIndexKey("orders"))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"orders_a1", "orders_b1"}, cacheKeys)
+	for tag, expected := range map[string][]string{
+		"acme": {"orders_a1"},
+		"beta": {"orders_b1"},
+	} {
+		cacheKeys, err = proc.cacheIndex.SMembers(proc.buildTagIndexKey("orders", tag))
+		require.NoError(t, err)
+		require.ElementsMatch(t, expected, cacheKeys, tag)
+	}
+	require.Less(t, proc.getCurrentCacheSize("orders"), ordersSize)
+	require.Zero(t, proc.accessTracker.Get("orders_a2"))
+}
+
+func TestWriteCachePurgePatternMatchesURLKeyParts(t *testing.T) {
+	context_manager.Get().SetMockClock()
+	lunarContext := lunar_context.NewContextManager().WithFlowContext().GetLunarContext()
+	proc := newTestProcessor(t, map[string]any{
+		cachingKeyPartsParam: []string{
+			"$.request.headers.api_key",
+			"$.request.headers['Accept-Language']",
+		},
+	})
+	for _, apiKey := range []string{"https://example.com/keys/a1", "https://example.com/keys/a2"} {
+		_, err := proc.Execute("orders", newTestStream(lunarContext, apiKey, 200, nil, `{"id":1}`))
+		require.NoError(t, err)
+	}
+	firstKey := "orders_https://example.com/keys/a1_en"
+	secondKey := "orders_https://example.com/keys/a2_en"
+	requireCached(t, proc, true, firstKey, secondKey)
+
+	// * matches across the / of the URL
+	result, err := proc.PurgeCache(streamtypes.CachePurgeRequest{Pattern: "orders_*/a1_*"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), result.PurgedEntries)
+	requireCached(t, proc, false, firstKey)
+	requireCached(t, proc, true, secondKey)
+
+	result, err = proc.PurgeCache(streamtypes.CachePurgeRequest{Pattern: "orders_*_en"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), result.PurgedEntries)
+	requireCached(t, proc, false, secondKey)
+}
+
+func TestCachePurgeRequestMatchesKey(t *testing.T) {
+	for _, test := range []struct {
+		pattern  string
+		cacheKey string
+		matched  bool
+	}{
+		{"orders_*_a1", "orders_api.example.com/v1/orders_a1", true},
+		{"orders_*", "orders_api.example.com/v1/orders_a1", true},
+		{"orders_?1", "orders_a1", true},
+		{"orders_?1", "orders_/1", true},
+		{"orders_?1", "orders_a11", false},
+		{"orders_*_a1", "orders_api.example.com/v1/orders_a2", false},
+		// Other characters are matched literally
+		{"orders_[a]1", "orders_[a]1", true},
+		{"orders_[a]1", "orders_a1", false},
+		{"orders_a.1", "orders_ab1", false},
+	} {
+		request := streamtypes.CachePurgeRequest{Pattern: test.pattern}
+		// the pattern of a request which was not validated is compiled on its first match
+		unvalidated := request
+		require.NoError(t, request.Validate(), test.pattern)
+		require.Equal(t, test.matched, request.MatchesKey(test.cacheKey),
+			"%s %s", test.pattern, test.cacheKey)
+		require.Equal(t, test.matched, unvalidated.MatchesKey(test.cacheKey),
+			"%s %s", test.pattern, test.cacheKey)
+	}
+}
+
+func TestCachePurgeRequestValidation(t *testing.T) {
+	require.Error(t, (&streamtypes.CachePurgeRequest{}).Validate())
+	require.NoError(t, (&streamtypes.CachePurgeRequest{Pattern: "orders_["}).Validate())
+	require.NoError(t, (&streamtypes.CachePurgeRequest{Flow: "orders"}).Validate())
+}
@@ -1,6 +1,7 @@
 package publictypes
 
 import (
+	"lunar/engine/utils/queue"
 	"lunar/toolkit-core/clock"
 	"time"
 
@@ -23,8 +24,13 @@ type LunarContextI interface {
 
 type SharedQueueI interface {
 	Enqueue(string, float64) error
+	// EnqueueToGroup enqueues an item on behalf of a scheduling group,
+	// groups are only relevant for the fair scheduling modes.
+	EnqueueToGroup(string, string, float64) error
 	DequeueIfValueRelevant() string
 	Remove(string)
+	// Position returns the 1-based place of the item in the dispatch order, or 0 when it is not queued
+	Position(string) int64
 	Size() int64
 }
 
@@ -33,6 +39,7 @@ type SharedStateI[T PersistentType] interface {
 	Set(string, T) error
 	SetWithScore(string, float64, T) error
 	NewQueue(string, time.Duration) SharedQueueI
+	NewScheduledQueue(string, time.Duration, queue.SchedulingConfig) SharedQueueI
 	Get(string) (T, error)
 	GetMany(string, int64) ([]T, error)
 
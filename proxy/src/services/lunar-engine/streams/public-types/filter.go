@@ -1,5 +1,25 @@
 package publictypes
 
+import "fmt"
+
+// BurnRateCondition matches while the error budget of an SLO burns faster than the threshold
+// over each of the windows, e.g. over both the last hour and the last 5 minutes
+type BurnRateCondition struct {
+	SLO string `yaml:"slo"`
+	// Objective narrows the condition to an objective of the SLO (availability or latency),
+	// the highest burn rate of its objectives is used when not set
+	Objective      string  `yaml:"objective,omitempty"`
+	WindowsSeconds []int64 `yaml:"windows_seconds"`
+	Above          float64 `yaml:"above"`
+}
+
+func (c *BurnRateCondition) String() string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%v>%v", c.SLO, c.Objective, c.WindowsSeconds, c.Above)
+}
+
 type FilterI interface {
 	ShouldAllowSample() bool
 	GetName() string
@@ -12,6 +32,7 @@ type FilterI interface {
 	GetAllowedQueryParams() []KeyValueOperation
 	GetReqExpressions() []string
 	GetResExpressions() []string
+	GetBurnRateCondition() *BurnRateCondition
 	IsAnyURLAccepted() bool
 	IsExpressionFilter() bool
 	ToComparable() ComparableFilter
@@ -23,4 +44,5 @@ type ComparableFilter struct {
 	Method      string
 	Headers     string
 	StatusCode  string
+	BurnRate    string
 }
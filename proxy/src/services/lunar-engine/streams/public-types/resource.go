@@ -12,6 +12,13 @@ type ResourceManagementI interface {
 	GetQuota(string, string) (QuotaResourceI, error)
 	OnRequestDrop(APIStreamI)
 	OnResponseFinish(APIStreamI)
+	GetRetryBudget(string) (RetryBudgetResourceI, error)
+}
+
+// RetryBudgetResourceI limits the retries of the processors sharing it
+// to a share of the recent successful requests
+type RetryBudgetResourceI interface {
+	TryRetry() bool
 }
 
 type QuotaResourceI interface {
@@ -22,6 +29,23 @@ type QuotaResourceI interface {
 	GetParentID() string
 }
 
+// QuotaOverageI is implemented by quotas that support a soft limit,
+// where requests above the limit are allowed and tracked as overage.
+type QuotaOverageI interface {
+	IsOverage(APIStreamI) (bool, error)
+}
+
+// QuotaResetI is implemented by quotas that can tell when the quota of a specific request resets,
+// as opposed to ResetIn which is used for polling.
+type QuotaResetI interface {
+	ResetInFor(APIStreamI) (time.Duration, error)
+}
+
+// QuotaUsageI is implemented by quotas that expose the usage of the quota group of a request
+type QuotaUsageI interface {
+	GetUsage(APIStreamI) (used int64, limit int64, err error)
+}
+
 type ResourceFlowDataI interface {
 	GetFilter() FilterI
 	GetProcessorsConnections() ResourceFlowI
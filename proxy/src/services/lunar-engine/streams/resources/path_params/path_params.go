@@ -26,7 +26,7 @@ type (
 )
 
 type PathParams struct {
-	duplicationValidation *urltree.URLTree[struct{}]
+	duplicationValidation *urltree.URLTree[PathParam]
 	loadedConfig          []network.ConfigurationPayload
 	pathParams            *PathParamsRaw
 
@@ -52,6 +52,18 @@ func NewValidationPathParams(dir string) *PathParams {
 	return pathParams
 }
 
+// NewPathTemplates builds path params from the given URL templates without loading
+// the configured path params files, e.g. for templates declared in an API spec.
+func NewPathTemplates(URLs []string) (*PathParams, error) {
+	pathParams := newPathParams()
+	for _, URL := range URLs {
+		if err := pathParams.SetPathParams(URL); err != nil {
+			return nil, err
+		}
+	}
+	return pathParams, nil
+}
+
 func (pp *PathParams) WithData(pathParams []*PathParam) error {
 	return pp.storePathParams(pathParams)
 }
@@ -60,18 +72,30 @@ func (pp *PathParams) GetPathParams() []*PathParam {
 	return pp.pathParams.PathParams
 }
 
+func (pp *PathParams) GetPathParamDetection() []sharedDiscovery.PathParamDetectionRule {
+	return pp.pathParams.PathParamDetection
+}
+
 func (pp *PathParams) SetPathParams(URL string) error {
-	err := pp.addURLToTree(URL)
+	pathParam := &PathParam{URL: URL}
+	err := pp.addURLToTree(pathParam)
 	if err != nil {
 		return err
 	}
 
-	pp.pathParams.PathParams = append(pp.pathParams.PathParams, &PathParam{
-		URL: URL,
-	})
+	pp.pathParams.PathParams = append(pp.pathParams.PathParams, pathParam)
 	return nil
 }
 
+// Match returns the URL template matching the given URL along with the extracted path params
+func (pp *PathParams) Match(URL string) (string, map[string]string, bool) {
+	result := pp.duplicationValidation.Lookup(URL)
+	if !result.Match || result.Value == nil {
+		return "", nil, false
+	}
+	return result.Value.URL, result.PathParams, true
+}
+
 func (pp *PathParams) GeneratePathParamConfFile() error {
 	return pp.writePathParams()
 }
@@ -108,13 +132,18 @@ func (pp *PathParams) loadAndParsePathParamsFiles() error {
 			return err
 		}
 
+		err = pp.storePathParamDetection(config.UnmarshaledData.PathParamDetection)
+		if err != nil {
+			return err
+		}
+
 	}
 	return nil
 }
 
 func (pp *PathParams) storePathParams(pathParams []*PathParam) error {
 	for _, pathParam := range pathParams {
-		err := pp.addURLToTree(pathParam.URL)
+		err := pp.addURLToTree(pathParam)
 		if err != nil {
 			return err
 		}
@@ -124,9 +153,24 @@ func (pp *PathParams) storePathParams(pathParams []*PathParam) error {
 	return nil
 }
 
-func (pp *PathParams) addURLToTree(URL string) error {
-	emptyStruct := EmptyStruct{}
-	err := pp.duplicationValidation.Insert(URL, &emptyStruct)
+func (pp *PathParams) storePathParamDetection(
+	rules []sharedDiscovery.PathParamDetectionRule,
+) error {
+	for _, rule := range rules {
+		if rule.Host == "" {
+			return fmt.Errorf("path param detection rule is missing a host")
+		}
+	}
+	if _, err := sharedDiscovery.ConvertPathParamDetection(rules); err != nil {
+		return err
+	}
+
+	pp.pathParams.PathParamDetection = append(pp.pathParams.PathParamDetection, rules...)
+	return nil
+}
+
+func (pp *PathParams) addURLToTree(pathParam *PathParam) error {
+	err := pp.duplicationValidation.Insert(pathParam.URL, pathParam)
 	if err != nil {
 		return fmt.Errorf("error inserting URL into duplication validation tree: %v", err)
 	}
@@ -134,7 +178,9 @@ func (pp *PathParams) addURLToTree(URL string) error {
 }
 
 func (pp *PathParams) writePathParams() error {
-	policies := sharedDiscovery.KnownEndpoints{}
+	policies := sharedDiscovery.KnownEndpoints{
+		PathParamDetection: pp.pathParams.PathParamDetection,
+	}
 	for _, pathParam := range pp.pathParams.PathParams {
 		policies.Endpoints = append(policies.Endpoints, sharedDiscovery.Endpoint{
 			URL: pathParam.URL,
@@ -197,7 +243,7 @@ func createYAMLFile(data interface{}, filePath string) error {
 
 func newPathParams() *PathParams {
 	return &PathParams{
-		duplicationValidation: urltree.NewURLTree[EmptyStruct](false, 0),
+		duplicationValidation: urltree.NewURLTree[PathParam](false, 0),
 		loadedConfig:          []network.ConfigurationPayload{},
 		pathParams:            &PathParamsRaw{},
 	}
@@ -1,7 +1,11 @@
 package pathparamsresource
 
+import sharedDiscovery "lunar/shared-model/discovery"
+
 type PathParamsRaw struct {
 	PathParams []*PathParam `yaml:"path_params" validate:"required"`
+	// PathParamDetection overrides per host how the discovery detects path params
+	PathParamDetection []sharedDiscovery.PathParamDetectionRule `yaml:"path_param_detection,omitempty"`
 }
 
 type PathParam struct {
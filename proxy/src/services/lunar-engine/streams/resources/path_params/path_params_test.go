@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	pathparamsresource "lunar/engine/streams/resources/path_params"
+	sharedDiscovery "lunar/shared-model/discovery"
+	"lunar/toolkit-core/configuration"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -86,3 +88,79 @@ path_params:
 	err = pp.SetPathParams("api.example.com/{myID2}/c")
 	require.Error(t, err)
 }
+
+func TestPathTemplatesMatch(t *testing.T) {
+	pp, err := pathparamsresource.NewPathTemplates([]string{
+		"api.example.com/v1/items/{itemID}",
+		"api.example.com/v1/items/{itemID}/tags/{tag}",
+		"api.example.com/v1/users",
+	})
+	require.NoError(t, err)
+
+	template, params, found := pp.Match("api.example.com/v1/items/42/tags/blue")
+	require.True(t, found)
+	assert.Equal(t, "api.example.com/v1/items/{itemID}/tags/{tag}", template)
+	assert.Equal(t, map[string]string{"itemID": "42", "tag": "blue"}, params)
+
+	template, params, found = pp.Match("api.example.com/v1/users")
+	require.True(t, found)
+	assert.Equal(t, "api.example.com/v1/users", template)
+	assert.Empty(t, params)
+
+	_, _, found = pp.Match("api.example.com/v2/users")
+	assert.False(t, found)
+}
+
+func TestLoadPathParamDetectionRules(t *testing.T) {
+	tempDir := t.TempDir()
+	testFilePath := filepath.Join(tempDir, "test_path_params.yaml")
+	testYAMLContent := `
+path_params:
+    - url: "api.example.com/b/c"
+path_param_detection:
+    - host: "legacy.example.com"
+      disabled: true
+    - host: "api.example.com"
+      classifiers: ["uuid", "numeric"]
+`
+	err := os.WriteFile(testFilePath, []byte(testYAMLContent), 0o644)
+	require.NoError(t, err)
+
+	os.Setenv(environment.PathParamsDirectoryEnvVar, tempDir)
+	defer os.Unsetenv(environment.PathParamsDirectoryEnvVar)
+
+	pp := pathparamsresource.NewPathParams()
+	assert.Equal(t, []sharedDiscovery.PathParamDetectionRule{
+		{Host: "legacy.example.com", Disabled: true},
+		{Host: "api.example.com", Classifiers: []string{"uuid", "numeric"}},
+	}, pp.GetPathParamDetection())
+
+	policiesPath := filepath.Join(tempDir, "policies.yaml")
+	os.Setenv("LUNAR_FLOWS_PATH_PARAM_CONFIG", policiesPath)
+	defer os.Unsetenv("LUNAR_FLOWS_PATH_PARAM_CONFIG")
+	require.NoError(t, pp.GeneratePathParamConfFile())
+
+	config, err := configuration.DecodeYAML[sharedDiscovery.KnownEndpoints](policiesPath)
+	require.NoError(t, err)
+	assert.Equal(t, pp.GetPathParamDetection(), config.UnmarshaledData.PathParamDetection)
+}
+
+func TestInvalidPathParamDetectionRules(t *testing.T) {
+	tempDir := t.TempDir()
+	testFilePath := filepath.Join(tempDir, "test_path_params.yaml")
+	testYAMLContent := `
+path_params:
+    - url: "api.example.com/b/c"
+path_param_detection:
+    - host: "api.example.com"
+      classifiers: ["guid"]
+`
+	err := os.WriteFile(testFilePath, []byte(testYAMLContent), 0o644)
+	require.NoError(t, err)
+
+	os.Setenv(environment.PathParamsDirectoryEnvVar, tempDir)
+	defer os.Unsetenv(environment.PathParamsDirectoryEnvVar)
+
+	pp := pathparamsresource.NewPathParams()
+	assert.Empty(t, pp.GetPathParamDetection())
+}
@@ -118,6 +118,20 @@ func (cs *concurrentStrategy) GetQuotaGroupsCounters() map[string]int64 {
 	return counters
 }
 
+func (cs *concurrentStrategy) GetQuotaGroupsOverages() map[string]int64 {
+	return make(map[string]int64)
+}
+
+// GetQuotaGroupsStates returns the requests in flight, the concurrency limit never resets
+func (cs *concurrentStrategy) GetQuotaGroupsStates() map[string]QuotaGroupState {
+	return map[string]QuotaGroupState{
+		DefaultGroup: {
+			Used:  cs.GetCounter(),
+			Limit: cs.maxRequestCount,
+		},
+	}
+}
+
 func (cs *concurrentStrategy) Allowed(APIStream public_types.APIStreamI) (bool, error) {
 	cs.logger.Trace().Msg("Checking if allowed")
 
@@ -10,6 +10,7 @@ import (
 	"lunar/engine/streams/stream"
 	"lunar/toolkit-core/clock"
 	"lunar/toolkit-core/jsonpath"
+	"maps"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,7 +22,12 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-var _ ResourceAdmI = &fixedWindow{}
+var (
+	_ ResourceAdmI              = &fixedWindow{}
+	_ publicTypes.QuotaOverageI = &fixedWindow{}
+	_ publicTypes.QuotaResetI   = &fixedWindow{}
+	_ publicTypes.QuotaUsageI   = &fixedWindow{}
+)
 
 type quotaCounterUsed int
 
@@ -48,7 +54,11 @@ type quota struct {
 	mutex             sync.RWMutex
 	clock             clock.Clock
 	allowedByReqID    map[string]bool
+	overageByReqID    map[string]int64
+	overageTotal      int64
 	extractCountF     ExtractInt64F
+	thresholds        *thresholdNotifier
+	softLimit         *softLimit
 }
 
 func newQuota(
@@ -59,6 +69,8 @@ func newQuota(
 	maxSpillover int64,
 	withSpillover bool,
 	extractCountF ExtractInt64F,
+	thresholds *thresholdNotifier,
+	softLimit *softLimit,
 	context publicTypes.SharedStateI[int64],
 	clock clock.Clock,
 ) *quota {
@@ -74,7 +86,10 @@ func newQuota(
 		logger:            logger.With().Str("component", "quota").Str("key", key).Logger(),
 		context:           context.WithClock(clock),
 		allowedByReqID:    make(map[string]bool),
+		overageByReqID:    make(map[string]int64),
 		extractCountF:     extractCountF,
+		thresholds:        thresholds,
+		softLimit:         softLimit,
 		mutex:             sync.RWMutex{},
 		clock:             clock,
 	}
@@ -87,6 +102,30 @@ func (q *quota) GetCounter() int64 {
 	return q.getCountFromContext(q.currentCountKey)
 }
 
+// GetOverage returns the overage consumed in the current window
+func (q *quota) GetOverage() int64 {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	// the window may have ended without a request restarting it yet
+	_, windowEnded, err := q.context.AtomicWindowResetIn(q.currentCountKey, q.window)
+	if err == nil && windowEnded {
+		return 0
+	}
+	return q.overageTotal
+}
+
+// GetSpilloverBalance returns the spillover left to use, if the quota has a spillover
+func (q *quota) GetSpilloverBalance() int64 {
+	if !q.withSpillover {
+		return 0
+	}
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	return q.getCountFromContext(q.spilloverCountKey)
+}
+
 func (q *quota) Reset(_ bool) {
 	// TODO: Implement spillover reset
 	q.mutex.Lock()
@@ -149,7 +188,7 @@ func (q *quota) Inc(APIStream publicTypes.APIStreamI) incResult {
 		q.logger.Trace().Int64("incrBy", incrBy).Msg("Incrementing window")
 
 		currentCount, windowRestarted, err = q.context.AtomicIncWindow(q.currentCountKey, incrBy,
-			q.window, q.maxCount)
+			q.window, q.maxAllowed())
 		log.Trace().Msgf("AtomicIncWindow result: %d, %v", currentCount, windowRestarted)
 		if windowRestarted {
 			q.onWindowRestart()
@@ -158,8 +197,12 @@ func (q *quota) Inc(APIStream publicTypes.APIStreamI) incResult {
 			q.logger.Trace().Err(err).Msg("Failed to increment window")
 		} else {
 			q.allowedByReqID[reqID] = true
+			q.trackOverage(reqID, currentCount, incrBy)
 		}
 		q.storeCountIntoContext(currentCount, q.currentCountKey)
+		if err == nil && q.thresholds != nil {
+			q.thresholds.evaluate(q.quotaKey, currentCount, q.maxCount)
+		}
 	}
 	if q.allowedByReqID[reqID] {
 		return increased
@@ -172,6 +215,37 @@ func (q *quota) Dec(APIStream publicTypes.APIStreamI) {
 	defer q.mutex.Unlock()
 	reqID := APIStream.GetID()
 	delete(q.allowedByReqID, reqID)
+	delete(q.overageByReqID, reqID)
+}
+
+// IsOverage reports (once) whether the request was allowed above the soft limit
+func (q *quota) IsOverage(APIStream publicTypes.APIStreamI) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	reqID := APIStream.GetID()
+	_, found := q.overageByReqID[reqID]
+	delete(q.overageByReqID, reqID)
+	return found
+}
+
+func (q *quota) maxAllowed() int64 {
+	if q.softLimit != nil {
+		return q.softLimit.maxAllowed()
+	}
+	return q.maxCount
+}
+
+func (q *quota) trackOverage(reqID string, currentCount, incrBy int64) {
+	// We don't need to lock here as we are already in a mutex lock
+	if q.softLimit == nil || currentCount <= q.maxCount {
+		return
+	}
+
+	overage := min(incrBy, currentCount-q.maxCount)
+	q.overageByReqID[reqID] = overage
+	q.overageTotal += overage
+	q.logger.Trace().Int64("overage", overage).Msg("Request allowed above soft limit")
+	q.softLimit.record(q.quotaKey, overage)
 }
 
 func (q *quota) Allowed(APIStream publicTypes.APIStreamI) bool {
@@ -215,6 +289,11 @@ func (q *quota) storeCountIntoContext(count int64, key string) {
 func (q *quota) onWindowRestart() {
 	// We don't need to lock here as we are already in a mutex lock
 	q.allowedByReqID = make(map[string]bool)
+	q.overageByReqID = make(map[string]int64)
+	q.overageTotal = 0
+	if q.thresholds != nil {
+		q.thresholds.reset(q.quotaKey)
+	}
 }
 
 type fixedWindow struct {
@@ -225,9 +304,14 @@ type fixedWindow struct {
 	spilloverMax     int64
 	groupByKey       string
 	window           time.Duration
-	monthlyRenewal   *MonthlyRenewalData
-	nextMonthlyReset time.Time
+	renewal          *RenewalData
+	nextRenewalReset time.Time
+	renewalLock      sync.RWMutex
 	spilloverData    *Spillover
+	thresholdsData   *ThresholdsConfig
+	thresholds       *thresholdNotifier
+	softLimitData    *SoftLimitConfig
+	softLimit        *softLimit
 	filter           *streamConfig.Filter
 	clock            clock.Clock
 	logger           zerolog.Logger
@@ -268,14 +352,17 @@ func newTransactionalFixedWindow(
 		return int64(1), nil
 	}
 	instance := fixedWindow{
-		parent:        parent,
-		quotaID:       providerCfg.ID,
-		filter:        providerCfg.Filter,
-		max:           providerCfg.Strategy.FixedWindow.Max,
-		window:        providerCfg.Strategy.FixedWindow.ParseWindow(),
-		spilloverData: providerCfg.Strategy.FixedWindow.Spillover,
-		groupByKey:    providerCfg.Strategy.FixedWindow.GetGroup(),
-		clock:         contextManager.Get().GetClock(),
+		parent:         parent,
+		quotaID:        providerCfg.ID,
+		filter:         providerCfg.Filter,
+		max:            providerCfg.Strategy.FixedWindow.Max,
+		window:         providerCfg.Strategy.FixedWindow.ParseWindow(),
+		spilloverData:  providerCfg.Strategy.FixedWindow.Spillover,
+		thresholdsData: providerCfg.Strategy.FixedWindow.Thresholds,
+		renewal:        providerCfg.Strategy.FixedWindow.GetRenewal(),
+		softLimitData:  providerCfg.Strategy.FixedWindow.SoftLimit,
+		groupByKey:     providerCfg.Strategy.FixedWindow.GetGroup(),
+		clock:          contextManager.Get().GetClock(),
 		logger: log.Logger.With().Str("component", "fixedWindow").
 			Str("ID", providerCfg.ID).Logger(),
 		context:        lunarContext.NewSharedState[int64](),
@@ -294,14 +381,17 @@ func newCustomCounterFixedWindow(
 		providerCfg.Strategy.FixedWindowCustomCounter.CounterValuePath,
 	)
 	instance := fixedWindow{
-		parent:        parent,
-		quotaID:       providerCfg.ID,
-		filter:        providerCfg.Filter,
-		max:           providerCfg.Strategy.FixedWindowCustomCounter.Max,
-		window:        providerCfg.Strategy.FixedWindowCustomCounter.ParseWindow(),
-		spilloverData: providerCfg.Strategy.FixedWindowCustomCounter.Spillover,
-		groupByKey:    providerCfg.Strategy.FixedWindowCustomCounter.GetGroup(),
-		clock:         contextManager.Get().GetClock(),
+		parent:         parent,
+		quotaID:        providerCfg.ID,
+		filter:         providerCfg.Filter,
+		max:            providerCfg.Strategy.FixedWindowCustomCounter.Max,
+		window:         providerCfg.Strategy.FixedWindowCustomCounter.ParseWindow(),
+		spilloverData:  providerCfg.Strategy.FixedWindowCustomCounter.Spillover,
+		thresholdsData: providerCfg.Strategy.FixedWindowCustomCounter.Thresholds,
+		renewal:        providerCfg.Strategy.FixedWindowCustomCounter.GetRenewal(),
+		softLimitData:  providerCfg.Strategy.FixedWindowCustomCounter.SoftLimit,
+		groupByKey:     providerCfg.Strategy.FixedWindowCustomCounter.GetGroup(),
+		clock:          contextManager.Get().GetClock(),
 		logger: log.Logger.With().Str("component", "fixedWindow").
 			Str("ID", providerCfg.ID).Logger(),
 		context:        lunarContext.NewSharedState[int64](),
@@ -362,6 +452,100 @@ func (fw *fixedWindow) GetQuotaGroupsCounters() map[string]int64 {
 	return counters
 }
 
+func (fw *fixedWindow) GetQuotaGroupsOverages() map[string]int64 {
+	overages := make(map[string]int64)
+	if fw.softLimit == nil {
+		return overages
+	}
+
+	fw.getQuotaLock.Lock()
+	quotaGroups := maps.Clone(fw.quotaGroups)
+	fw.getQuotaLock.Unlock()
+
+	for key, quotaObj := range quotaGroups {
+		overages[key] = quotaObj.GetOverage()
+	}
+	return overages
+}
+
+// GetQuotaGroupsStates returns the state of each quota group, keyed by the group value
+func (fw *fixedWindow) GetQuotaGroupsStates() map[string]QuotaGroupState {
+	fw.getQuotaLock.Lock()
+	quotaGroups := maps.Clone(fw.quotaGroups)
+	fw.getQuotaLock.Unlock()
+
+	states := make(map[string]QuotaGroupState, len(quotaGroups))
+	for quotaKey, quotaObj := range quotaGroups {
+		group := strings.TrimPrefix(quotaKey, fw.quotaID+"_")
+		states[group] = QuotaGroupState{
+			Used:             quotaObj.GetCounter(),
+			Limit:            quotaObj.maxCount,
+			ResetIn:          fw.getGroupResetIn(quotaObj),
+			SpilloverBalance: quotaObj.GetSpilloverBalance(),
+		}
+	}
+	return states
+}
+
+// IsOverage reports whether the request was allowed above the soft limit
+// of this quota or one of its parents. Should be called after Allowed.
+func (fw *fixedWindow) IsOverage(APIStream publicTypes.APIStreamI) (bool, error) {
+	quotaObj, err := fw.getQuota(APIStream)
+	if err != nil {
+		return false, err
+	}
+
+	if quotaObj.IsOverage(APIStream) {
+		return true, nil
+	}
+
+	if fw.parent != nil {
+		if parentQuota, ok := fw.parent.GetQuota().(publicTypes.QuotaOverageI); ok {
+			return parentQuota.IsOverage(APIStream)
+		}
+	}
+	return false, nil
+}
+
+// GetUsage returns the current usage and limit of the quota group of the request
+func (fw *fixedWindow) GetUsage(APIStream publicTypes.APIStreamI) (int64, int64, error) {
+	quotaObj, err := fw.getQuota(APIStream)
+	if err != nil {
+		return 0, 0, err
+	}
+	return quotaObj.GetCounter(), quotaObj.maxCount, nil
+}
+
+// ResetInFor returns the time until the quota group of the request resets.
+// When the quota has a parent, the later of both resets is returned.
+func (fw *fixedWindow) ResetInFor(APIStream publicTypes.APIStreamI) (time.Duration, error) {
+	quotaObj, err := fw.getQuota(APIStream)
+	if err != nil {
+		return 0, err
+	}
+
+	resetIn := fw.getGroupResetIn(quotaObj)
+	if fw.parent != nil {
+		if parentQuota, ok := fw.parent.GetQuota().(publicTypes.QuotaResetI); ok {
+			parentResetIn, err := parentQuota.ResetInFor(APIStream)
+			if err != nil {
+				return resetIn, err
+			}
+			resetIn = max(resetIn, parentResetIn)
+		}
+	}
+	return resetIn, nil
+}
+
+// getGroupResetIn returns the time until the window of the quota group or the renewal resets
+func (fw *fixedWindow) getGroupResetIn(quotaObj *quota) time.Duration {
+	resetIn := quotaObj.ResetIn()
+	if nextRenewalReset := fw.getNextRenewalReset(); !nextRenewalReset.IsZero() {
+		resetIn = min(resetIn, fw.clock.Until(nextRenewalReset))
+	}
+	return resetIn
+}
+
 func (fw *fixedWindow) Allowed(APIStream publicTypes.APIStreamI) (bool, error) {
 	fw.windowAligning()
 	fw.logger.Trace().Msg("Checking if allowed")
@@ -416,7 +600,7 @@ func (fw *fixedWindow) ResetIn() time.Duration {
 func (fw *fixedWindow) windowAligning() {
 	fw.alignmentLock.Lock()
 	defer fw.alignmentLock.Unlock()
-	if fw.aligningMonthlyReset() {
+	if fw.aligningRenewalReset() {
 		return
 	}
 }
@@ -448,7 +632,8 @@ func (fw *fixedWindow) getQuota(APIStream publicTypes.APIStreamI) (*quota, error
 		Msg("Quota object not found in context, initialize new quota")
 
 	quotaObj := newQuota(fw.window, quotaKey, fw.logger, fw.max, fw.spilloverMax,
-		fw.spilloverData != nil, fw.extractCountF, fw.context, fw.clock)
+		fw.spilloverData != nil, fw.extractCountF, fw.thresholds, fw.softLimit,
+		fw.context, fw.clock)
 	fw.quotaGroups[quotaKey] = quotaObj
 	return quotaObj, nil
 }
@@ -472,6 +657,9 @@ func (fw *fixedWindow) calculateContextKey(apiStream publicTypes.APIStreamI) str
 
 func (fw *fixedWindow) init() error {
 	fw.validateSpilloverNeeds()
+	fw.thresholds = newThresholdNotifier(fw.quotaID, fw.thresholdsData, fw.context,
+		fw.clock, fw.logger)
+	fw.softLimit = newSoftLimit(fw.quotaID, fw.softLimitData, fw.logger)
 	fw.systemFlowData = &resourceTypes.ResourceFlowData{
 		ID:                    fw.quotaID,
 		Filter:                fw.filter,
@@ -479,12 +667,12 @@ func (fw *fixedWindow) init() error {
 		ProcessorsConnections: fw.getProcessorsLocation(),
 	}
 
-	if fw.monthlyRenewal != nil {
-		nextMonthlyReset, err := fw.monthlyRenewal.getMonthlyResetIn()
+	if fw.renewal != nil {
+		nextRenewalReset, err := fw.renewal.getNextReset(fw.clock.Now())
 		if err != nil {
-			return fmt.Errorf("failed to get next monthly reset: %w", err)
+			return fmt.Errorf("failed to get next renewal reset: %w", err)
 		}
-		fw.nextMonthlyReset = nextMonthlyReset
+		fw.setNextRenewalReset(nextRenewalReset)
 	}
 	return nil
 }
@@ -531,27 +719,46 @@ func (fw *fixedWindow) validateSpilloverNeeds() {
 	}
 }
 
-func (fw *fixedWindow) aligningMonthlyReset() bool {
-	if fw.monthlyRenewal == nil || fw.nextMonthlyReset.IsZero() {
+func (fw *fixedWindow) aligningRenewalReset() bool {
+	nextRenewalReset := fw.getNextRenewalReset()
+	if nextRenewalReset.IsZero() {
 		return false
 	}
 
-	shouldReset := fw.clock.Now().After(fw.nextMonthlyReset)
+	now := fw.clock.Now()
+	shouldReset := !now.Before(nextRenewalReset)
 	if shouldReset {
 		fw.resetQuota(true)
 
-		nextMonthlyReset, err := fw.monthlyRenewal.getMonthlyResetIn()
+		nextRenewalReset, err := fw.renewal.getNextReset(now)
 		if err != nil {
 			fw.logger.Warn().Err(err).
-				Msg("Failed to get next monthly reset, please reconfigure the monthly renewal date.")
-			fw.nextMonthlyReset = time.Time{}
+				Msg("Failed to get next renewal reset, please reconfigure the renewal date.")
+			fw.setNextRenewalReset(time.Time{})
 		} else {
-			fw.nextMonthlyReset = nextMonthlyReset
+			fw.setNextRenewalReset(nextRenewalReset)
 		}
 	}
 	return shouldReset
 }
 
+// getNextRenewalReset returns the time of the next renewal reset, zero without a renewal.
+// It is read on the request path and by the metrics observer, while it is moved on resets.
+func (fw *fixedWindow) getNextRenewalReset() time.Time {
+	if fw.renewal == nil {
+		return time.Time{}
+	}
+	fw.renewalLock.RLock()
+	defer fw.renewalLock.RUnlock()
+	return fw.nextRenewalReset
+}
+
+func (fw *fixedWindow) setNextRenewalReset(nextRenewalReset time.Time) {
+	fw.renewalLock.Lock()
+	defer fw.renewalLock.Unlock()
+	fw.nextRenewalReset = nextRenewalReset
+}
+
 func (fw *fixedWindow) resetQuota(withSpillover bool) {
 	fw.getQuotaLock.Lock()
 	defer fw.getQuotaLock.Unlock()
@@ -572,5 +779,12 @@ func (fw *fixedWindow) getNextResetIn() time.Duration {
 			resetIn = quotaResetIn
 		}
 	}
+
+	if nextRenewalReset := fw.getNextRenewalReset(); !nextRenewalReset.IsZero() {
+		renewalResetIn := fw.clock.Until(nextRenewalReset)
+		if resetIn > renewalResetIn {
+			resetIn = renewalResetIn
+		}
+	}
 	return resetIn
 }
@@ -1,6 +1,7 @@
 package quotaresource
 
 import (
+	"fmt"
 	lunar_messages "lunar/engine/messages"
 	lunar_context "lunar/engine/streams/lunar-context"
 	streamtypes "lunar/engine/streams/types"
@@ -91,12 +92,14 @@ func TestFixedWindowsMonthlyRenewal(t *testing.T) {
 	mockClock.AdvanceTime(1 * time.Minute)
 	setMemoryTime(mockClock.Now())
 
+	// The renewal point has passed, so the quota is renewed
+	// even though the 10 hours window did not end yet
 	err = fixedWindow.Inc(APIStreamB)
 	assert.Nil(t, err)
 
 	allowed, err = fixedWindow.Allowed(APIStreamB)
 	assert.Nil(t, err)
-	assert.False(t, allowed)
+	assert.True(t, allowed)
 }
 
 func TestFixedWindowCustomCounterHandlesQuotaByHeaderValue(t *testing.T) {
@@ -191,3 +194,41 @@ func TestFixedWindowCustomCounterHandlesQuotaByHeaderValue(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, allowed)
 }
+
+func TestFixedWindowReportsQuotaGroupsStates(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	setMemoryTime(mockClock.Now())
+
+	quotaStrategy := &QuotaConfig{
+		ID: "TestFixedWindowReportsQuotaGroupsStates",
+		Strategy: &StrategyConfig{
+			FixedWindow: &FixedWindowConfig{
+				QuotaLimit: QuotaLimit{
+					Max:          3,
+					Interval:     1,
+					IntervalUnit: "minute",
+				},
+				GroupByHeader: "x-tenant",
+			},
+		},
+	}
+	fixedWindow, err := NewFixedStrategy(quotaStrategy, nil)
+	assert.Nil(t, err)
+
+	for index, tenant := range []string{"acme", "acme", "globex"} {
+		request := lunar_messages.OnRequest{
+			ID:      fmt.Sprintf("states-%d", index),
+			Headers: map[string]string{"x-tenant": tenant},
+		}
+		assert.Nil(t, fixedWindow.Inc(streamtypes.NewRequestAPIStream(request, sharedState)))
+	}
+
+	states := fixedWindow.GetQuotaGroupsStates()
+	assert.Len(t, states, 2)
+	assert.Equal(t, int64(2), states["acme"].Used)
+	assert.Equal(t, int64(1), states["globex"].Used)
+	assert.Equal(t, int64(3), states["acme"].Limit)
+	assert.Equal(t, int64(0), states["acme"].SpilloverBalance)
+	assert.Greater(t, states["acme"].ResetIn, time.Duration(0))
+	assert.LessOrEqual(t, states["acme"].ResetIn, time.Minute)
+}
@@ -78,3 +78,11 @@ func (hs *headerBasedStrategy) GetLimit() int64 {
 func (hs *headerBasedStrategy) GetQuotaGroupsCounters() map[string]int64 {
 	return make(map[string]int64)
 }
+
+func (hs *headerBasedStrategy) GetQuotaGroupsOverages() map[string]int64 {
+	return make(map[string]int64)
+}
+
+func (hs *headerBasedStrategy) GetQuotaGroupsStates() map[string]QuotaGroupState {
+	return make(map[string]QuotaGroupState)
+}
@@ -2,12 +2,15 @@ package quotaresource
 
 import (
 	streamconfig "lunar/engine/streams/config"
+	retrybudgetresource "lunar/engine/streams/resources/retry_budget"
 )
 
 // revive:disable-next-line:exported
 type QuotaResourceData struct {
 	Quotas         []*QuotaConfig      `yaml:"quotas"          validate:"dive,required"`
 	InternalLimits []*ChildQuotaConfig `yaml:"internal_limits" validate:"dive"`
+	// RetryBudgets are shared by the Retry processors referencing them
+	RetryBudgets []*retrybudgetresource.RetryBudgetConfig `yaml:"retry_budgets,omitempty"`
 }
 
 type SingleQuotaResourceData struct {
@@ -43,6 +46,18 @@ type FixedWindowConfig struct {
 	QuotaLimit     `                    yaml:",inline"`
 	GroupByHeader  string              `yaml:"group_by_header,omitempty"`
 	MonthlyRenewal *MonthlyRenewalData `yaml:"monthly_renewal,omitempty"`
+	Renewal        *RenewalData        `yaml:"renewal,omitempty"`
+	Thresholds     *ThresholdsConfig   `yaml:"thresholds,omitempty"`
+	SoftLimit      *SoftLimitConfig    `yaml:"soft_limit,omitempty"`
+}
+
+type SoftLimitConfig struct {
+	HardCeiling int64 `yaml:"hard_ceiling,omitempty" validate:"omitempty,gt=0"`
+}
+
+type ThresholdsConfig struct {
+	Percentages []int64 `yaml:"percentages"           validate:"required,dive,gt=0,lte=100"`
+	WebhookURL  string  `yaml:"webhook_url,omitempty" validate:"omitempty,url"`
 }
 
 type HeaderBasedConfig struct {
@@ -61,7 +76,17 @@ type MonthlyRenewalData struct {
 	Day      int    `yaml:"day"      validate:"gt=0,lte=31"`
 	Hour     int    `yaml:"hour"     validate:"gte=0,lte=23"`
 	Minute   int    `yaml:"minute"   validate:"gte=0,lte=59"`
-	Timezone string `yaml:"timezone" validate:"oneof=UTC Local"`
+	Timezone string `yaml:"timezone" validate:"timezone|eq=Local"`
+}
+
+type RenewalData struct {
+	Period         string `yaml:"period"                      validate:"oneof=daily weekly monthly"`
+	Day            int    `yaml:"day,omitempty"               validate:"gte=0,lte=31"`
+	LastDayOfMonth bool   `yaml:"last_day_of_month,omitempty"`
+	Weekday        string `yaml:"weekday,omitempty"           validate:"omitempty,oneof=sunday monday tuesday wednesday thursday friday saturday"` //nolint:lll
+	Hour           int    `yaml:"hour"                        validate:"gte=0,lte=23"`
+	Minute         int    `yaml:"minute"                      validate:"gte=0,lte=59"`
+	Timezone       string `yaml:"timezone"                    validate:"timezone|eq=Local"`
 }
 
 type Spillover struct {
@@ -20,6 +20,8 @@ type ResourceAdmI interface {
 	GetID() string
 	GetLimit() int64
 	GetQuotaGroupsCounters() map[string]int64
+	GetQuotaGroupsOverages() map[string]int64
+	GetQuotaGroupsStates() map[string]QuotaGroupState
 	GetStrategyConfig() *StrategyConfig
 }
 
@@ -27,6 +29,8 @@ type QuotaAdmI interface {
 	GetMetaData() *SingleQuotaResourceData
 	GetQuota(string) (publictypes.QuotaResourceI, error)
 	GetIDs() []string
+	GetOverages() map[string]map[string]int64
+	GetStates() map[string]map[string]QuotaGroupState
 	GetSystemFlow() map[publictypes.ComparableFilter]*resourceutils.SystemFlowRepresentation
 	Update(metadata *SingleQuotaResourceData) error
 }
@@ -37,6 +41,14 @@ type QuotaMetaData struct {
 	Strategy *StrategyConfig
 }
 
+// QuotaGroupState is the current state of a quota group, as exported by the system metrics
+type QuotaGroupState struct {
+	Used             int64
+	Limit            int64
+	ResetIn          time.Duration
+	SpilloverBalance int64
+}
+
 type UsedStrategy int
 
 const (
@@ -184,6 +196,22 @@ func (fw *FixedWindowConfig) IsMonthlyRenewalSet() bool {
 	return fw.MonthlyRenewal != nil
 }
 
+func (fw *FixedWindowConfig) IsRenewalSet() bool {
+	return fw.Renewal != nil || fw.MonthlyRenewal != nil
+}
+
+// GetRenewal returns the renewal calendar of the window,
+// falling back to the legacy monthly renewal definition.
+func (fw *FixedWindowConfig) GetRenewal() *RenewalData {
+	if fw.Renewal != nil {
+		return fw.Renewal
+	}
+	if fw.MonthlyRenewal != nil {
+		return fw.MonthlyRenewal.toRenewal()
+	}
+	return nil
+}
+
 func (ql *QuotaLimit) GetIntervalType() TimeUnit {
 	return TimeUnit(ql.IntervalUnit)
 }
@@ -3,7 +3,6 @@ package quotaresource
 import (
 	streamconfig "lunar/engine/streams/config"
 	"lunar/toolkit-core/configuration"
-	"time"
 )
 
 // This function is used to convert the QuotaResourceData to a list of SingleQuotaResourceData
@@ -32,6 +31,13 @@ func (qc *QuotaResourceData) ToSingleQuotaResourceDataList() []*SingleQuotaResou
 	return singleQuotaResourceDataList
 }
 
+func (sl *SoftLimitConfig) allocate(percentage int64) {
+	if sl == nil {
+		return
+	}
+	sl.HardCeiling = (sl.HardCeiling * percentage) / 100
+}
+
 func (q *QuotaMetaData) GetID() string {
 	return q.ID
 }
@@ -44,20 +50,6 @@ func (q *QuotaMetaData) GetStrategy() *StrategyConfig {
 	return q.Strategy
 }
 
-func (mrd *MonthlyRenewalData) getMonthlyResetIn() (time.Time, error) {
-	loc, err := time.LoadLocation(mrd.Timezone)
-	if err != nil {
-		return time.Time{}, err
-	}
-
-	now := time.Now().In(loc)
-	nextReset := now.AddDate(0, 1, mrd.Day-1).
-		Add(time.Duration(mrd.Hour) * time.Hour).
-		Add(time.Duration(mrd.Minute) * time.Minute)
-
-	return nextReset, nil
-}
-
 // This function is used to assign the effective quota limit for a child quota based on its
 // PercentageAllocation value. It will inherit and assign the quota strategy from the parent
 // and will update the quota limit based on the percentage.
@@ -87,11 +79,13 @@ func AssignQuotaLimitForPercentageAllocation(
 		childStrategyConfig.AllocationPercentage = 0
 		updatedMax := (childStrategyConfig.FixedWindow.Max * percentage) / 100
 		childStrategyConfig.FixedWindow.Max = updatedMax
+		childStrategyConfig.FixedWindow.SoftLimit.allocate(percentage)
 	case FixedWindowCustomCounterStrategy:
 		childStrategyConfig.FixedWindowCustomCounter = parentCopy.FixedWindowCustomCounter
 		childStrategyConfig.AllocationPercentage = 0
 		updatedMax := (childStrategyConfig.FixedWindowCustomCounter.Max * percentage) / 100
 		childStrategyConfig.FixedWindowCustomCounter.Max = updatedMax
+		childStrategyConfig.FixedWindowCustomCounter.SoftLimit.allocate(percentage)
 	default:
 	}
 	return nil
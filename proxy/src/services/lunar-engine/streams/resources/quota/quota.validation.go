@@ -39,7 +39,28 @@ func (qr *QuotaResourceData) Validate() error {
 		}
 
 		if !singleQuotaData.specificValidation() {
-			return errors.New("validation error: MonthlyRenewal is required for limit with Spillover")
+			return errors.New("validation error: MonthlyRenewal or Renewal is required for limit with Spillover") //nolint:lll
+		}
+
+		if err := singleQuotaData.validateRenewals(); err != nil {
+			return err
+		}
+
+		if err := singleQuotaData.validateSoftLimits(); err != nil {
+			return err
+		}
+
+		if err := singleQuotaData.validateThresholds(); err != nil {
+			return err
+		}
+	}
+
+	for _, retryBudget := range qr.RetryBudgets {
+		if retryBudget == nil {
+			return errors.New("validation error: retry budget is empty")
+		}
+		if err := retryBudget.Validate(); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -76,8 +97,8 @@ func (qr *SingleQuotaResourceData) specificValidation() bool {
 	}
 
 	if qr.Quota.Strategy.FixedWindow != nil {
-		isMonthlyRenewalSet := qr.Quota.Strategy.FixedWindow.IsMonthlyRenewalSet()
-		if !isMonthlyRenewalSet {
+		isRenewalSet := qr.Quota.Strategy.FixedWindow.IsRenewalSet()
+		if !isRenewalSet {
 			return !shouldHaveMonthlyRenewal
 		}
 		return shouldHaveMonthlyRenewal
@@ -106,6 +127,61 @@ func (fw *FixedWindowConfig) shouldHaveMonthlyRenewal() bool {
 	return fw.Spillover != nil
 }
 
+func (qr *SingleQuotaResourceData) validateRenewals() error {
+	for _, fixedWindow := range qr.fixedWindowConfigs() {
+		if fixedWindow.Renewal == nil {
+			continue
+		}
+		if err := fixedWindow.Renewal.validate(); err != nil {
+			return fmt.Errorf("validation error: quota '%s': %w", qr.Quota.ID, err)
+		}
+	}
+	return nil
+}
+
+func (qr *SingleQuotaResourceData) validateSoftLimits() error {
+	for _, fixedWindow := range qr.fixedWindowConfigs() {
+		if fixedWindow.SoftLimit == nil || fixedWindow.SoftLimit.HardCeiling == 0 {
+			continue
+		}
+		if fixedWindow.SoftLimit.HardCeiling <= fixedWindow.Max {
+			return fmt.Errorf(
+				"validation error: quota '%s': soft limit hard_ceiling must be greater than max",
+				qr.Quota.ID)
+		}
+	}
+	return nil
+}
+
+func (qr *SingleQuotaResourceData) validateThresholds() error {
+	for _, fixedWindow := range qr.fixedWindowConfigs() {
+		if fixedWindow.Thresholds == nil || fixedWindow.Thresholds.WebhookURL == "" {
+			continue
+		}
+		if err := validateWebhookURL(fixedWindow.Thresholds.WebhookURL); err != nil {
+			return fmt.Errorf("validation error: quota '%s': %w", qr.Quota.ID, err)
+		}
+	}
+	return nil
+}
+
+func (qr *SingleQuotaResourceData) fixedWindowConfigs() []*FixedWindowConfig {
+	strategies := []*StrategyConfig{qr.Quota.Strategy}
+	for _, il := range qr.InternalLimits {
+		strategies = append(strategies, il.Strategy)
+	}
+
+	fixedWindows := []*FixedWindowConfig{}
+	for _, strategy := range strategies {
+		if strategy.FixedWindow != nil {
+			fixedWindows = append(fixedWindows, strategy.FixedWindow)
+		} else if strategy.FixedWindowCustomCounter != nil {
+			fixedWindows = append(fixedWindows, &strategy.FixedWindowCustomCounter.FixedWindowConfig)
+		}
+	}
+	return fixedWindows
+}
+
 func newQuotaProviderValidator() *quotaProviderValidator {
 	return &quotaProviderValidator{
 		fileToHostDictionary: make(map[string]string),
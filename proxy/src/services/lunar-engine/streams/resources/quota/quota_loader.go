@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	internaltypes "lunar/engine/streams/internal-types"
 	publictypes "lunar/engine/streams/public-types"
+	retrybudgetresource "lunar/engine/streams/resources/retry_budget"
 	resourceutils "lunar/engine/streams/resources/utils"
 	"lunar/engine/utils/environment"
 	"lunar/toolkit-core/configuration"
@@ -20,6 +21,7 @@ type Loader struct {
 	loadedConfig []network.ConfigurationPayload
 	flowData     map[publictypes.ComparableFilter]*resourceutils.SystemFlowRepresentation
 	quotas       *resourceutils.Resource[QuotaAdmI]
+	retryBudgets *resourceutils.Resource[*retrybudgetresource.RetryBudget]
 
 	validationPath string
 }
@@ -56,6 +58,10 @@ func (l *Loader) GetQuotas() *resourceutils.Resource[QuotaAdmI] {
 	return l.quotas
 }
 
+func (l *Loader) GetRetryBudgets() *resourceutils.Resource[*retrybudgetresource.RetryBudget] {
+	return l.retryBudgets
+}
+
 func (l *Loader) GetFlowData() map[publictypes.ComparableFilter]*resourceutils.SystemFlowRepresentation { //nolint: lll
 	return l.flowData
 }
@@ -101,7 +107,7 @@ func (l *Loader) loadAndParseQuotaFiles() (
 			return nil, readErr
 		}
 
-		if config.UnmarshaledData.Quotas == nil {
+		if config.UnmarshaledData.Quotas == nil && config.UnmarshaledData.RetryBudgets == nil {
 			return nil, fmt.Errorf("quota part is missing: %s", path)
 		}
 
@@ -157,11 +163,34 @@ func (l *Loader) loadQuotaResources(
 				}
 			}
 		}
+
+		if err := l.loadRetryBudgets(metaData.RetryBudgets); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+func (l *Loader) loadRetryBudgets(
+	retryBudgetData []*retrybudgetresource.RetryBudgetConfig,
+) error {
+	for _, retryBudgetConfig := range retryBudgetData {
+		if _, found := l.retryBudgets.Get(retryBudgetConfig.ID); found {
+			return fmt.Errorf("retry budget %s is defined more than once", retryBudgetConfig.ID)
+		}
+
+		retryBudget, err := retrybudgetresource.NewRetryBudget(retryBudgetConfig)
+		if err != nil {
+			return err
+		}
+
+		log.Info().Msgf("Adding retry budget resource with: ID %s", retryBudgetConfig.ID)
+		l.retryBudgets.Set(retryBudgetConfig.ID, retryBudget)
+	}
+	return nil
+}
+
 func findQuotaResources(dir string) ([]string, error) {
 	log.Info().Msgf("Looking for quota resources in: %s", dir)
 	var files []string
@@ -192,6 +221,7 @@ func newLoader() *Loader {
 	return &Loader{
 		loadedConfig: []network.ConfigurationPayload{},
 		quotas:       resourceutils.NewResource[QuotaAdmI](),
+		retryBudgets: resourceutils.NewResource[*retrybudgetresource.RetryBudget](),
 		flowData: make(
 			map[publictypes.ComparableFilter]*resourceutils.SystemFlowRepresentation,
 		),
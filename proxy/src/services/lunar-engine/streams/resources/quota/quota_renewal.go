@@ -0,0 +1,143 @@
+package quotaresource
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type RenewalPeriod string
+
+const (
+	DailyRenewal   RenewalPeriod = "daily"
+	WeeklyRenewal  RenewalPeriod = "weekly"
+	MonthlyRenewal RenewalPeriod = "monthly"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// toRenewal converts the legacy monthly renewal definition into a monthly RenewalData
+func (mrd *MonthlyRenewalData) toRenewal() *RenewalData {
+	return &RenewalData{
+		Period:   string(MonthlyRenewal),
+		Day:      mrd.Day,
+		Hour:     mrd.Hour,
+		Minute:   mrd.Minute,
+		Timezone: mrd.Timezone,
+	}
+}
+
+func (rd *RenewalData) GetPeriod() RenewalPeriod {
+	return RenewalPeriod(rd.Period)
+}
+
+func (rd *RenewalData) validate() error {
+	if _, err := time.LoadLocation(rd.Timezone); err != nil {
+		return fmt.Errorf("invalid renewal timezone '%s': %w", rd.Timezone, err)
+	}
+
+	switch rd.GetPeriod() {
+	case DailyRenewal:
+		return nil
+	case WeeklyRenewal:
+		if _, found := weekdays[strings.ToLower(rd.Weekday)]; !found {
+			return fmt.Errorf("weekly renewal requires a valid weekday, got '%s'", rd.Weekday)
+		}
+		return nil
+	case MonthlyRenewal:
+		if rd.LastDayOfMonth && rd.Day != 0 {
+			return fmt.Errorf("monthly renewal accepts either day or last_day_of_month, not both")
+		}
+		if !rd.LastDayOfMonth && rd.Day == 0 {
+			return fmt.Errorf("monthly renewal requires day or last_day_of_month")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid renewal period: %s", rd.Period)
+	}
+}
+
+// getNextReset returns the first renewal point which is strictly after the given time.
+// Candidates are built from wall-clock values in the configured location,
+// so renewals stay anchored to the local hour across DST transitions.
+func (rd *RenewalData) getNextReset(now time.Time) (time.Time, error) {
+	if err := rd.validate(); err != nil {
+		return time.Time{}, err
+	}
+
+	loc, err := time.LoadLocation(rd.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := now.In(loc)
+	year, month, day := local.Date()
+
+	switch rd.GetPeriod() {
+	case DailyRenewal:
+		next := rd.atDate(year, month, day, loc)
+		if !next.After(local) {
+			next = rd.atDate(year, month, day+1, loc)
+		}
+		return next, nil
+
+	case WeeklyRenewal:
+		target := weekdays[strings.ToLower(rd.Weekday)]
+		daysAhead := (int(target) - int(local.Weekday()) + 7) % 7
+		next := rd.atDate(year, month, day+daysAhead, loc)
+		if !next.After(local) {
+			next = rd.atDate(year, month, day+daysAhead+7, loc)
+		}
+		return next, nil
+
+	case MonthlyRenewal:
+		next := rd.atDate(year, month, rd.dayInMonth(year, month), loc)
+		if !next.After(local) {
+			nextYear, nextMonth := year, month+1
+			if nextMonth > time.December {
+				nextYear, nextMonth = year+1, time.January
+			}
+			next = rd.atDate(nextYear, nextMonth, rd.dayInMonth(nextYear, nextMonth), loc)
+		}
+		return next, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid renewal period: %s", rd.Period)
+}
+
+func (rd *RenewalData) atDate(year int, month time.Month, day int, loc *time.Location) time.Time {
+	// time.Date normalizes day overflow. A wall time which does not exist on the day,
+	// as it falls in a DST gap, is resolved by time.Date to the same time before the gap
+	// (02:30 becomes 01:30 standard time), so it is moved forward by the difference.
+	// The renewal then happens the length of the gap after the requested wall time
+	// (03:30 daylight time). A wall time repeated when DST ends resolves to its first occurrence.
+	candidate := time.Date(year, month, day, rd.Hour, rd.Minute, 0, 0, loc)
+	requested := time.Duration(rd.Hour)*time.Hour + time.Duration(rd.Minute)*time.Minute
+	actual := time.Duration(candidate.Hour())*time.Hour +
+		time.Duration(candidate.Minute())*time.Minute
+	if actual < requested {
+		candidate = candidate.Add(requested - actual)
+	}
+	return candidate
+}
+
+// dayInMonth clamps the configured day to the length of the given month
+func (rd *RenewalData) dayInMonth(year int, month time.Month) int {
+	lastDay := daysInMonth(year, month)
+	if rd.LastDayOfMonth || rd.Day > lastDay {
+		return lastDay
+	}
+	return rd.Day
+}
+
+func daysInMonth(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
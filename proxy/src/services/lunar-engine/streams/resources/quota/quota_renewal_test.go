@@ -0,0 +1,221 @@
+package quotaresource
+
+import (
+	lunar_messages "lunar/engine/messages"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenewalGetNextReset(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		renewal  *RenewalData
+		now      time.Time
+		expected time.Time
+	}{
+		{
+			name:     "daily before anchor",
+			renewal:  &RenewalData{Period: "daily", Timezone: "America/Los_Angeles"},
+			now:      time.Date(2024, 5, 10, 23, 30, 0, 0, losAngeles),
+			expected: time.Date(2024, 5, 11, 0, 0, 0, 0, losAngeles),
+		},
+		{
+			name:     "daily exactly on anchor moves to next day",
+			renewal:  &RenewalData{Period: "daily", Timezone: "America/Los_Angeles"},
+			now:      time.Date(2024, 5, 11, 0, 0, 0, 0, losAngeles),
+			expected: time.Date(2024, 5, 12, 0, 0, 0, 0, losAngeles),
+		},
+		{
+			name: "daily across spring forward keeps local anchor",
+			renewal: &RenewalData{
+				Period: "daily", Hour: 9, Timezone: "America/New_York",
+			},
+			now:      time.Date(2024, 3, 9, 10, 0, 0, 0, newYork),
+			expected: time.Date(2024, 3, 10, 9, 0, 0, 0, newYork),
+		},
+		{
+			name: "daily anchor inside the DST gap is normalized forward",
+			renewal: &RenewalData{
+				Period: "daily", Hour: 2, Minute: 30, Timezone: "America/New_York",
+			},
+			now:      time.Date(2024, 3, 9, 12, 0, 0, 0, newYork),
+			expected: time.Date(2024, 3, 10, 3, 30, 0, 0, newYork),
+		},
+		{
+			name: "daily anchor repeated when DST ends is the first occurrence",
+			renewal: &RenewalData{
+				Period: "daily", Hour: 1, Minute: 30, Timezone: "America/New_York",
+			},
+			now:      time.Date(2024, 11, 2, 12, 0, 0, 0, newYork),
+			expected: time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "weekly on monday",
+			renewal: &RenewalData{
+				Period: "weekly", Weekday: "monday", Timezone: "America/New_York",
+			},
+			// Wednesday
+			now:      time.Date(2024, 10, 30, 15, 0, 0, 0, newYork),
+			expected: time.Date(2024, 11, 4, 0, 0, 0, 0, newYork),
+		},
+		{
+			name: "weekly on the same weekday after anchor moves a week ahead",
+			renewal: &RenewalData{
+				Period: "weekly", Weekday: "monday", Hour: 8, Timezone: "America/New_York",
+			},
+			now:      time.Date(2024, 11, 4, 9, 0, 0, 0, newYork),
+			expected: time.Date(2024, 11, 11, 8, 0, 0, 0, newYork),
+		},
+		{
+			name: "monthly clamps to the length of the month",
+			renewal: &RenewalData{
+				Period: "monthly", Day: 31, Timezone: "UTC",
+			},
+			now:      time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "monthly on the last day rolls over the year",
+			renewal: &RenewalData{
+				Period: "monthly", LastDayOfMonth: true, Hour: 23, Minute: 59, Timezone: "UTC",
+			},
+			now:      time.Date(2024, 12, 31, 23, 59, 30, 0, time.UTC),
+			expected: time.Date(2025, 1, 31, 23, 59, 0, 0, time.UTC),
+		},
+		{
+			name:     "legacy monthly renewal",
+			renewal:  (&MonthlyRenewalData{Day: 1, Timezone: "UTC"}).toRenewal(),
+			now:      time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			nextReset, err := testCase.renewal.getNextReset(testCase.now)
+			require.NoError(t, err)
+			assert.True(t, testCase.expected.Equal(nextReset),
+				"expected %s, got %s", testCase.expected, nextReset)
+		})
+	}
+}
+
+func TestRenewalValidation(t *testing.T) {
+	invalid := []*RenewalData{
+		{Period: "weekly", Timezone: "UTC"},
+		{Period: "monthly", Timezone: "UTC"},
+		{Period: "monthly", Day: 3, LastDayOfMonth: true, Timezone: "UTC"},
+		{Period: "daily", Timezone: "Mars/Olympus_Mons"},
+	}
+
+	for _, renewal := range invalid {
+		_, err := renewal.getNextReset(time.Now())
+		assert.Error(t, err, "expected renewal %+v to be invalid", renewal)
+	}
+}
+
+func TestFixedWindowWeeklyRenewalAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	// Sunday before the end of DST in 2024 (November 3rd)
+	mockClock.Set(time.Date(2024, 10, 27, 12, 0, 0, 0, newYork))
+	setMemoryTime(mockClock.Now())
+
+	quotaStrategy := &QuotaConfig{
+		ID: "TestFixedWindowWeeklyRenewalAcrossDST",
+		Strategy: &StrategyConfig{
+			FixedWindow: &FixedWindowConfig{
+				QuotaLimit: QuotaLimit{
+					Max:          1,
+					Interval:     1,
+					IntervalUnit: "month",
+				},
+				Renewal: &RenewalData{
+					Period:   "weekly",
+					Weekday:  "monday",
+					Timezone: "America/New_York",
+				},
+			},
+		},
+	}
+
+	fixedWindow, err := NewFixedStrategy(quotaStrategy, nil)
+	require.NoError(t, err)
+
+	isAllowed := func(id string) bool {
+		apiStream := streamtypes.NewRequestAPIStream(lunar_messages.OnRequest{ID: id}, sharedState)
+		require.NoError(t, fixedWindow.Inc(apiStream))
+		allowed, err := fixedWindow.Allowed(apiStream)
+		require.NoError(t, err)
+		return allowed
+	}
+
+	assert.True(t, isAllowed("week-1-a"))
+	assert.False(t, isAllowed("week-1-b"))
+
+	// Monday 00:00 New York time
+	mockClock.Set(time.Date(2024, 10, 28, 0, 0, 0, 0, newYork))
+	setMemoryTime(mockClock.Now())
+	assert.True(t, isAllowed("week-2-a"))
+	assert.False(t, isAllowed("week-2-b"))
+
+	// One minute before the next Monday - after DST ended the week is 169 hours long
+	mockClock.Set(time.Date(2024, 11, 3, 23, 59, 0, 0, newYork))
+	setMemoryTime(mockClock.Now())
+	assert.False(t, isAllowed("week-2-c"))
+
+	mockClock.AdvanceTime(time.Minute)
+	setMemoryTime(mockClock.Now())
+	assert.True(t, isAllowed("week-3-a"))
+}
+
+func TestFixedWindowRenewalReadWhileRenewing(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	mockClock.Set(time.Date(2024, 5, 10, 23, 59, 0, 0, time.UTC))
+	setMemoryTime(mockClock.Now())
+
+	quotaStrategy := &QuotaConfig{
+		ID: "TestFixedWindowRenewalReadWhileRenewing",
+		Strategy: &StrategyConfig{
+			FixedWindow: &FixedWindowConfig{
+				QuotaLimit: QuotaLimit{Max: 10, Interval: 1, IntervalUnit: "month"},
+				Renewal:    &RenewalData{Period: "daily", Timezone: "UTC"},
+			},
+		},
+	}
+	strategy, err := NewFixedStrategy(quotaStrategy, nil)
+	require.NoError(t, err)
+	window := strategy.(*fixedWindow)
+	apiStream := streamtypes.NewRequestAPIStream(lunar_messages.OnRequest{ID: "renewal"}, sharedState)
+	require.NoError(t, window.Inc(apiStream))
+
+	// the metrics observer reads the states while a request moves the renewal
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			window.GetQuotaGroupsStates()
+		}
+	}()
+	mockClock.AdvanceTime(2 * time.Minute)
+	setMemoryTime(mockClock.Now())
+	_, err = window.Allowed(apiStream)
+	require.NoError(t, err)
+	<-done
+
+	// the next renewal is at the following midnight
+	states := window.GetQuotaGroupsStates()
+	require.Equal(t, 23*time.Hour+59*time.Minute, states[DefaultGroup].ResetIn)
+}
@@ -74,6 +74,42 @@ func (q *quotaResource) GetSystemFlow() map[publictypes.ComparableFilter]*resour
 	return q.flowData
 }
 
+// GetOverages returns the overage consumed by each soft-limited quota, per group
+func (q *quotaResource) GetOverages() map[string]map[string]int64 {
+	overages := make(map[string]map[string]int64)
+	for quotaID := range q.definedQuotas {
+		quota, err := q.getQuota(quotaID)
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to get quota")
+			continue
+		}
+		groupOverages := quota.GetQuotaGroupsOverages()
+		if len(groupOverages) == 0 {
+			continue
+		}
+		overages[quotaID] = groupOverages
+	}
+	return overages
+}
+
+// GetStates returns the state of each quota, per group
+func (q *quotaResource) GetStates() map[string]map[string]QuotaGroupState {
+	states := make(map[string]map[string]QuotaGroupState)
+	for quotaID := range q.definedQuotas {
+		quota, err := q.getQuota(quotaID)
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to get quota")
+			continue
+		}
+		groupStates := quota.GetQuotaGroupsStates()
+		if len(groupStates) == 0 {
+			continue
+		}
+		states[quotaID] = groupStates
+	}
+	return states
+}
+
 func (q *quotaResource) Update(metadata *SingleQuotaResourceData) error {
 	q.metadata = metadata
 	return q.init()
@@ -0,0 +1,66 @@
+package quotaresource
+
+import (
+	"context"
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/otel"
+	"math"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const quotaOverageMetricName = "lunar_resources_quota_resource_quota_overage"
+
+// softLimit lets requests above the quota limit pass through, up to an optional hard ceiling.
+// Anything consumed above the limit is counted as overage.
+type softLimit struct {
+	quotaID       string
+	hardCeiling   int64
+	instanceID    string
+	overageMetric metric.Int64Counter
+}
+
+func newSoftLimit(quotaID string, cfg *SoftLimitConfig, logger zerolog.Logger) *softLimit {
+	if cfg == nil {
+		return nil
+	}
+
+	limit := &softLimit{
+		quotaID:     quotaID,
+		hardCeiling: cfg.HardCeiling,
+		instanceID:  environment.GetGatewayInstanceID(),
+	}
+
+	overageMetric, err := otel.GetMeter().Int64Counter(
+		quotaOverageMetricName,
+		metric.WithDescription("Quota consumed above the soft limit of quota resource"),
+	)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to initialize quota overage metric")
+	} else {
+		limit.overageMetric = overageMetric
+	}
+	return limit
+}
+
+// maxAllowed returns the count above which requests are blocked
+func (sl *softLimit) maxAllowed() int64 {
+	if sl.hardCeiling > 0 {
+		return sl.hardCeiling
+	}
+	return math.MaxInt64
+}
+
+func (sl *softLimit) record(groupID string, units int64) {
+	if sl.overageMetric == nil {
+		return
+	}
+	sl.overageMetric.Add(context.Background(), units,
+		metric.WithAttributes(
+			attribute.String("quota_id", sl.quotaID),
+			attribute.String("group_id", groupID),
+			attribute.String("gateway_id", sl.instanceID),
+		))
+}
@@ -0,0 +1,130 @@
+package quotaresource
+
+import (
+	"fmt"
+	lunar_messages "lunar/engine/messages"
+	publictypes "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedWindowSoftLimitAllowsOverageUpToHardCeiling(t *testing.T) {
+	context_manager.Get().SetMockClock()
+
+	quotaStrategy := &QuotaConfig{
+		ID: "TestFixedWindowSoftLimitAllowsOverageUpToHardCeiling",
+		Strategy: &StrategyConfig{
+			FixedWindow: &FixedWindowConfig{
+				QuotaLimit: QuotaLimit{
+					Max:          2,
+					Interval:     1,
+					IntervalUnit: "minute",
+				},
+				SoftLimit: &SoftLimitConfig{HardCeiling: 4},
+			},
+		},
+	}
+
+	fixedWindow, err := NewFixedStrategy(quotaStrategy, nil)
+	require.NoError(t, err)
+	overageQuota, ok := fixedWindow.(publictypes.QuotaOverageI)
+	require.True(t, ok)
+
+	type result struct {
+		allowed bool
+		overage bool
+	}
+	send := func(index int) result {
+		request := lunar_messages.OnRequest{ID: fmt.Sprintf("soft-limit-%d", index)}
+		apiStream := streamtypes.NewRequestAPIStream(request, sharedState)
+		require.NoError(t, fixedWindow.Inc(apiStream))
+		allowed, err := fixedWindow.Allowed(apiStream)
+		require.NoError(t, err)
+		overage, err := overageQuota.IsOverage(apiStream)
+		require.NoError(t, err)
+		return result{allowed: allowed, overage: overage}
+	}
+
+	expected := []result{
+		{allowed: true, overage: false},
+		{allowed: true, overage: false},
+		{allowed: true, overage: true},
+		{allowed: true, overage: true},
+		// Hard ceiling reached
+		{allowed: false, overage: false},
+	}
+	for index, expectedResult := range expected {
+		assert.Equal(t, expectedResult, send(index), "request %d", index)
+	}
+
+	overages := fixedWindow.GetQuotaGroupsOverages()
+	assert.Equal(t, int64(2), overages[quotaStrategy.ID+"_"+DefaultGroup])
+}
+
+func TestSoftLimitHardCeilingMustExceedMax(t *testing.T) {
+	quotaData := &SingleQuotaResourceData{
+		Quota: &QuotaConfig{
+			ID: "TestSoftLimitHardCeilingMustExceedMax",
+			Strategy: &StrategyConfig{
+				FixedWindow: &FixedWindowConfig{
+					QuotaLimit: QuotaLimit{Max: 10, Interval: 1, IntervalUnit: "minute"},
+					SoftLimit:  &SoftLimitConfig{HardCeiling: 10},
+				},
+			},
+		},
+	}
+
+	assert.Error(t, quotaData.validateSoftLimits())
+
+	quotaData.Quota.Strategy.FixedWindow.SoftLimit.HardCeiling = 0
+	assert.NoError(t, quotaData.validateSoftLimits())
+}
+
+func TestFixedWindowSoftLimitOverageCountedPerWindow(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	setMemoryTime(mockClock.Now())
+
+	quotaStrategy := &QuotaConfig{
+		ID: "TestFixedWindowSoftLimitOverageCountedPerWindow",
+		Strategy: &StrategyConfig{
+			FixedWindow: &FixedWindowConfig{
+				QuotaLimit: QuotaLimit{
+					Max:          1,
+					Interval:     1,
+					IntervalUnit: "minute",
+				},
+				SoftLimit: &SoftLimitConfig{HardCeiling: 3},
+			},
+		},
+	}
+
+	fixedWindow, err := NewFixedStrategy(quotaStrategy, nil)
+	require.NoError(t, err)
+	groupKey := quotaStrategy.ID + "_" + DefaultGroup
+
+	send := func(id string) {
+		request := lunar_messages.OnRequest{ID: id}
+		require.NoError(t, fixedWindow.Inc(streamtypes.NewRequestAPIStream(request, sharedState)))
+	}
+
+	for index := range 3 {
+		send(fmt.Sprintf("first-window-%d", index))
+	}
+	assert.Equal(t, int64(2), fixedWindow.GetQuotaGroupsOverages()[groupKey])
+
+	mockClock.AdvanceTime(time.Minute)
+	setMemoryTime(mockClock.Now())
+
+	// the window ended, so its overage is no longer reported
+	assert.Equal(t, int64(0), fixedWindow.GetQuotaGroupsOverages()[groupKey])
+
+	for index := range 2 {
+		send(fmt.Sprintf("second-window-%d", index))
+	}
+	assert.Equal(t, int64(1), fixedWindow.GetQuotaGroupsOverages()[groupKey])
+}
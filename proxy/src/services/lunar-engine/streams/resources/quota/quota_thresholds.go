@@ -0,0 +1,208 @@
+package quotaresource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	publicTypes "lunar/engine/streams/public-types"
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/clock"
+	"lunar/toolkit-core/otel"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	quotaThresholdCrossedMetricName = "lunar_resources_quota_resource_threshold_crossed"
+	thresholdEmittedKeySuffix       = "thresholdEmitted"
+	thresholdWebhookTimeout         = 5 * time.Second
+)
+
+// ThresholdEvent is emitted once per window per quota group,
+// when the group usage crosses one of the configured percentages.
+type ThresholdEvent struct {
+	QuotaID    string    `json:"quota_id"`
+	GroupID    string    `json:"group_id"`
+	Percentage int64     `json:"threshold_percentage"`
+	Used       int64     `json:"used"`
+	Limit      int64     `json:"limit"`
+	GatewayID  string    `json:"gateway_id"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type thresholdNotifier struct {
+	quotaID       string
+	percentages   []int64
+	webhookURL    string
+	instanceID    string
+	context       publicTypes.SharedStateI[int64]
+	httpClient    *http.Client
+	crossedMetric metric.Int64Counter
+	clock         clock.Clock
+	logger        zerolog.Logger
+}
+
+func newThresholdNotifier(
+	quotaID string,
+	cfg *ThresholdsConfig,
+	context publicTypes.SharedStateI[int64],
+	clock clock.Clock,
+	logger zerolog.Logger,
+) *thresholdNotifier {
+	if cfg == nil || len(cfg.Percentages) == 0 {
+		return nil
+	}
+
+	percentages := make([]int64, len(cfg.Percentages))
+	copy(percentages, cfg.Percentages)
+	sort.Slice(percentages, func(i, j int) bool { return percentages[i] < percentages[j] })
+
+	notifier := &thresholdNotifier{
+		quotaID:     quotaID,
+		percentages: percentages,
+		webhookURL:  cfg.WebhookURL,
+		instanceID:  environment.GetGatewayInstanceID(),
+		context:     context,
+		httpClient:  &http.Client{Timeout: thresholdWebhookTimeout},
+		clock:       clock,
+		logger:      logger.With().Str("component", "quotaThresholds").Logger(),
+	}
+
+	crossedMetric, err := otel.GetMeter().Int64Counter(
+		quotaThresholdCrossedMetricName,
+		metric.WithDescription("Number of times a quota group crossed a usage threshold"),
+	)
+	if err != nil {
+		notifier.logger.Warn().Err(err).Msg("Failed to initialize threshold metric")
+	} else {
+		notifier.crossedMetric = crossedMetric
+	}
+	return notifier
+}
+
+// evaluate emits an event for every threshold crossed by the given usage
+// that was not already emitted in the current window.
+func (tn *thresholdNotifier) evaluate(groupID string, used, limit int64) {
+	if limit <= 0 {
+		return
+	}
+
+	for _, percentage := range tn.percentages {
+		if used*100 < limit*percentage {
+			// Percentages are sorted, no further threshold can be crossed
+			return
+		}
+
+		// Only the instance which marks the threshold first emits it
+		emittedKey := tn.buildEmittedKey(groupID, percentage)
+		marked, err := tn.context.AtomicSAddWithMaxValuesAllowed(emittedKey,
+			thresholdEmittedKeySuffix, 1)
+		if err != nil {
+			tn.logger.Warn().Err(err).Str("key", emittedKey).
+				Msg("Failed to store threshold state")
+			continue
+		}
+		if !marked {
+			continue
+		}
+
+		tn.emit(&ThresholdEvent{
+			QuotaID:    tn.quotaID,
+			GroupID:    groupID,
+			Percentage: percentage,
+			Used:       used,
+			Limit:      limit,
+			GatewayID:  tn.instanceID,
+			Timestamp:  tn.clock.Now().UTC(),
+		})
+	}
+}
+
+// reset clears the emitted state of the group, so thresholds will fire again in the new window.
+func (tn *thresholdNotifier) reset(groupID string) {
+	for _, percentage := range tn.percentages {
+		emittedKey := tn.buildEmittedKey(groupID, percentage)
+		_, _ = tn.context.Pop(emittedKey)
+	}
+}
+
+func (tn *thresholdNotifier) emit(event *ThresholdEvent) {
+	tn.logger.Info().
+		Str("quota_id", event.QuotaID).
+		Str("group_id", event.GroupID).
+		Int64("threshold_percentage", event.Percentage).
+		Int64("used", event.Used).
+		Int64("limit", event.Limit).
+		Msg("Quota usage threshold crossed")
+
+	if tn.crossedMetric != nil {
+		tn.crossedMetric.Add(context.Background(), 1,
+			metric.WithAttributes(
+				attribute.String("quota_id", event.QuotaID),
+				attribute.String("group_id", event.GroupID),
+				attribute.Int64("threshold_percentage", event.Percentage),
+				attribute.String("gateway_id", event.GatewayID),
+			))
+	}
+
+	if tn.webhookURL != "" {
+		go tn.postWebhook(event)
+	}
+}
+
+func (tn *thresholdNotifier) postWebhook(event *ThresholdEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		tn.logger.Warn().Err(err).Msg("Failed to marshal threshold event")
+		return
+	}
+
+	response, err := tn.httpClient.Post(tn.webhookURL, "application/json",
+		bytes.NewReader(payload))
+	if err != nil {
+		tn.logger.Warn().Err(err).Str("url", tn.webhookURL).
+			Msg("Failed to send threshold event to webhook")
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		tn.logger.Warn().Int("status", response.StatusCode).Str("url", tn.webhookURL).
+			Msg("Threshold webhook responded with an error status")
+	}
+}
+
+// validateWebhookURL accepts webhook URLs of local endpoints only,
+// as threshold events are meant for a local collector and not for external services
+func validateWebhookURL(webhookURL string) error {
+	parsedURL, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("webhook_url '%s' should be an HTTP URL", webhookURL)
+	}
+
+	host := parsedURL.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("webhook_url '%s' should be a local endpoint, e.g. http://localhost:8080",
+		webhookURL)
+}
+
+func (tn *thresholdNotifier) buildEmittedKey(groupID string, percentage int64) string {
+	return fmt.Sprintf("%s_%s_%d", groupID, thresholdEmittedKeySuffix, percentage)
+}
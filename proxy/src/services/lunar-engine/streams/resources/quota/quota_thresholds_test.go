@@ -0,0 +1,153 @@
+package quotaresource
+
+import (
+	"encoding/json"
+	"fmt"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedWindowThresholdEventsAreEmittedOncePerWindow(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+
+	received := make(chan ThresholdEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ThresholdEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			received <- event
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	quotaStrategy := &QuotaConfig{
+		ID: "TestFixedWindowThresholdEventsAreEmittedOncePerWindow",
+		Strategy: &StrategyConfig{
+			FixedWindow: &FixedWindowConfig{
+				QuotaLimit: QuotaLimit{
+					Max:          10,
+					Interval:     1,
+					IntervalUnit: "minute",
+				},
+				Thresholds: &ThresholdsConfig{
+					Percentages: []int64{80, 50},
+					WebhookURL:  server.URL,
+				},
+			},
+		},
+	}
+
+	fixedWindow, err := NewFixedStrategy(quotaStrategy, nil)
+	require.NoError(t, err)
+
+	sendRequests := func(prefix string, count int) {
+		for i := 0; i < count; i++ {
+			request := lunar_messages.OnRequest{ID: fmt.Sprintf("%s-%d", prefix, i)}
+			apiStream := streamtypes.NewRequestAPIStream(request, sharedState)
+			require.NoError(t, fixedWindow.Inc(apiStream))
+			allowed, err := fixedWindow.Allowed(apiStream)
+			require.NoError(t, err)
+			require.True(t, allowed)
+		}
+	}
+
+	waitForEvent := func() ThresholdEvent {
+		select {
+		case event := <-received:
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("threshold event was not delivered to the webhook")
+		}
+		return ThresholdEvent{}
+	}
+
+	// 4/10 used - no threshold crossed yet
+	sendRequests("first", 4)
+	assert.Empty(t, received)
+
+	// 5/10 used - 50% crossed
+	sendRequests("second", 1)
+	event := waitForEvent()
+	assert.Equal(t, int64(50), event.Percentage)
+	assert.Equal(t, int64(5), event.Used)
+	assert.Equal(t, int64(10), event.Limit)
+	assert.Equal(t, quotaStrategy.ID, event.QuotaID)
+
+	// 8/10 used - only 80% should be emitted, 50% was already emitted in this window
+	sendRequests("third", 3)
+	event = waitForEvent()
+	assert.Equal(t, int64(80), event.Percentage)
+
+	sendRequests("fourth", 1)
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, received)
+
+	// A new window should emit the thresholds again
+	mockClock.AdvanceTime(2 * time.Minute)
+	setMemoryTime(mockClock.Now())
+
+	sendRequests("fifth", 5)
+	event = waitForEvent()
+	assert.Equal(t, int64(50), event.Percentage)
+	assert.Equal(t, int64(5), event.Used)
+}
+
+func TestThresholdEventsAreEmittedOnceAcrossInstances(t *testing.T) {
+	var received atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// instances of the gateway share the threshold state
+	sharedContext := lunar_context.NewMemoryState[int64]()
+	config := &ThresholdsConfig{Percentages: []int64{50}, WebhookURL: server.URL}
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		notifier := newThresholdNotifier("TestThresholdEventsAreEmittedOnceAcrossInstances",
+			config, sharedContext, mockClock, log.Logger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			notifier.evaluate("group", 6, 10)
+		}()
+	}
+	wg.Wait()
+
+	require.Eventually(t, func() bool { return received.Load() == 1 },
+		2*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int64(1), received.Load())
+}
+
+func TestThresholdWebhookURLMustBeLocal(t *testing.T) {
+	for _, test := range []struct {
+		webhookURL string
+		valid      bool
+	}{
+		{"http://localhost:8080/events", true},
+		{"http://127.0.0.1:9000", true},
+		{"https://[::1]/events", true},
+		{"https://alerts.example.com/events", false},
+		{"http://10.0.0.5/events", false},
+		{"ftp://localhost/events", false},
+	} {
+		err := validateWebhookURL(test.webhookURL)
+		require.Equal(t, test.valid, err == nil, test.webhookURL)
+	}
+}
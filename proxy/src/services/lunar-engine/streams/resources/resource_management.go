@@ -6,6 +6,7 @@ import (
 	publicTypes "lunar/engine/streams/public-types"
 	pathParamsResource "lunar/engine/streams/resources/path_params"
 	quotaResource "lunar/engine/streams/resources/quota"
+	retryBudgetResource "lunar/engine/streams/resources/retry_budget"
 	resourceUtils "lunar/engine/streams/resources/utils"
 	"lunar/toolkit-core/network"
 
@@ -17,6 +18,7 @@ type ResourceManagement struct {
 	quotaLoader  *quotaResource.Loader
 	quotas       *resourceUtils.Resource[quotaResource.QuotaAdmI]
 	reqIDToQuota publicTypes.ContextI
+	retryBudgets *resourceUtils.Resource[*retryBudgetResource.RetryBudget]
 	flowData     map[publicTypes.ComparableFilter]*resourceUtils.SystemFlowRepresentation
 	loadedConfig []network.ConfigurationPayload
 }
@@ -82,6 +84,19 @@ func (rm *ResourceManagement) OnRequestDrop(APIStream publicTypes.APIStreamI) {
 
 func (rm *ResourceManagement) OnResponseFinish(APIStream publicTypes.APIStreamI) {
 	_, _ = rm.reqIDToQuota.Pop(APIStream.GetID())
+	for _, retryBudget := range rm.retryBudgets.GetAll() {
+		retryBudget.RecordResponse(APIStream)
+	}
+}
+
+func (rm *ResourceManagement) GetRetryBudget(
+	retryBudgetID string,
+) (publicTypes.RetryBudgetResourceI, error) {
+	retryBudget, found := rm.retryBudgets.Get(retryBudgetID)
+	if !found {
+		return nil, fmt.Errorf("retry budget resource with ID %s not found", retryBudgetID)
+	}
+	return retryBudget, nil
 }
 
 func (rm *ResourceManagement) GetQuota(
@@ -109,6 +124,28 @@ func (rm *ResourceManagement) GetQuota(
 	return quotaObj, nil
 }
 
+// GetQuotaOverages returns the overage consumed per soft-limited quota and group
+func (rm *ResourceManagement) GetQuotaOverages() map[string]map[string]int64 {
+	overages := make(map[string]map[string]int64)
+	for _, quota := range rm.quotas.GetAll() {
+		for quotaID, groupOverages := range quota.GetOverages() {
+			overages[quotaID] = groupOverages
+		}
+	}
+	return overages
+}
+
+// GetQuotaStates returns the state of each quota, per group
+func (rm *ResourceManagement) GetQuotaStates() map[string]map[string]quotaResource.QuotaGroupState {
+	states := make(map[string]map[string]quotaResource.QuotaGroupState)
+	for _, quota := range rm.quotas.GetAll() {
+		for quotaID, groupStates := range quota.GetStates() {
+			states[quotaID] = groupStates
+		}
+	}
+	return states
+}
+
 func (rm *ResourceManagement) UpdateQuota(
 	quotaID string,
 	metaData *quotaResource.SingleQuotaResourceData,
@@ -174,6 +211,10 @@ func (rm *ResourceManagement) setQuotaData() error {
 		}
 	}
 
+	for id, retryBudget := range rm.quotaLoader.GetRetryBudgets().GetAll() {
+		rm.retryBudgets.Set(id, retryBudget)
+	}
+
 	for filter, systemFlow := range rm.quotaLoader.GetFlowData() {
 		if _, found := rm.flowData[filter]; !found {
 			rm.flowData[filter] = systemFlow
@@ -195,6 +236,7 @@ func newResourceManagement(
 		loadedConfig: []network.ConfigurationPayload{},
 		quotas:       resourceUtils.NewResource[quotaResource.QuotaAdmI](),
 		reqIDToQuota: lunarContext.NewContext(),
+		retryBudgets: resourceUtils.NewResource[*retryBudgetResource.RetryBudget](),
 		flowData:     make(map[publicTypes.ComparableFilter]*resourceUtils.SystemFlowRepresentation),
 	}
 
@@ -0,0 +1,163 @@
+package retrybudgetresource
+
+import (
+	"errors"
+	"fmt"
+	publictypes "lunar/engine/streams/public-types"
+	"lunar/toolkit-core/clock"
+	context_manager "lunar/toolkit-core/context-manager"
+	"lunar/toolkit-core/urltree"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const defaultWindowSeconds = 10
+
+// RetryBudget is shared by the Retry processors referencing it, so retries during an outage
+// are limited to a share of the recent successful requests plus a minimum rate.
+// The requests are counted in buckets of a second over a sliding window.
+type RetryBudget struct {
+	config  *RetryBudgetConfig
+	urlTree *urltree.URLTree[RetryBudgetConfig]
+	clock   clock.Clock
+
+	mutex   sync.Mutex
+	buckets []budgetBucket
+}
+
+type budgetBucket struct {
+	second    int64
+	successes int64
+	retries   int64
+}
+
+func NewRetryBudget(config *RetryBudgetConfig) (*RetryBudget, error) {
+	if config == nil {
+		return nil, fmt.Errorf("retry budget config is nil")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	budget := &RetryBudget{
+		config:  config,
+		clock:   context_manager.Get().GetClock(),
+		buckets: make([]budgetBucket, config.getWindowSeconds()),
+	}
+
+	if config.Filter != nil && config.Filter.URL != "" {
+		budget.urlTree = urltree.NewURLTree[RetryBudgetConfig](false, 0)
+		if err := budget.urlTree.Insert(config.Filter.URL, config); err != nil {
+			return nil, fmt.Errorf("invalid filter of retry budget %s: %w", config.ID, err)
+		}
+	}
+	return budget, nil
+}
+
+func (c *RetryBudgetConfig) Validate() error {
+	validationErr := validator.New().Struct(c)
+	if validationErr == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(validationErr, &validationErrors) {
+		return validationErr
+	}
+
+	var errMsg error
+	for _, err := range validationErrors {
+		errMsg = errors.Join(errMsg, fmt.Errorf(
+			"validation error: %s, at retry budget: %s, error: %s=%s",
+			err.StructNamespace(), c.ID, err.Tag(), err.Param()))
+	}
+	return errMsg
+}
+
+func (rb *RetryBudget) GetID() string {
+	return rb.config.ID
+}
+
+// RecordResponse funds the budget with the successful responses of the requests it applies to
+func (rb *RetryBudget) RecordResponse(APIStream publictypes.APIStreamI) {
+	response := APIStream.GetResponse()
+	if response == nil || !isSuccessful(response.GetStatus()) || !rb.matches(APIStream) {
+		return
+	}
+
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+	rb.getCurrentBucket().successes++
+}
+
+// TryRetry consumes a retry from the budget, returns false when the budget is exhausted
+func (rb *RetryBudget) TryRetry() bool {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	bucket := rb.getCurrentBucket()
+	successes, retries := rb.getWindowTotals()
+	if float64(retries+1) > rb.getAllowedRetries(successes) {
+		return false
+	}
+
+	bucket.retries++
+	return true
+}
+
+func (rb *RetryBudget) getAllowedRetries(successes int64) float64 {
+	return float64(successes)*rb.config.RetryPercentage/100 +
+		rb.config.MinRetriesPerSecond*float64(len(rb.buckets))
+}
+
+// getCurrentBucket returns the bucket of the current second, reset if it was used for
+// a second which is already out of the window
+func (rb *RetryBudget) getCurrentBucket() *budgetBucket {
+	second := rb.clock.Now().Unix()
+	bucket := &rb.buckets[second%int64(len(rb.buckets))]
+	if bucket.second != second {
+		*bucket = budgetBucket{second: second}
+	}
+	return bucket
+}
+
+func (rb *RetryBudget) getWindowTotals() (successes int64, retries int64) {
+	windowStart := rb.clock.Now().Unix() - int64(len(rb.buckets))
+	for _, bucket := range rb.buckets {
+		if bucket.second <= windowStart {
+			continue
+		}
+		successes += bucket.successes
+		retries += bucket.retries
+	}
+	return successes, retries
+}
+
+func (rb *RetryBudget) matches(APIStream publictypes.APIStreamI) bool {
+	if rb.config.Filter == nil {
+		return true
+	}
+
+	if len(rb.config.Filter.Method) > 0 &&
+		!slices.ContainsFunc(rb.config.Filter.Method, func(method string) bool {
+			return strings.EqualFold(method, APIStream.GetMethod())
+		}) {
+		return false
+	}
+
+	return rb.urlTree == nil || rb.urlTree.Lookup(APIStream.GetURL()).Match
+}
+
+func (c *RetryBudgetConfig) getWindowSeconds() int64 {
+	if c.WindowSeconds <= 0 {
+		return defaultWindowSeconds
+	}
+	return c.WindowSeconds
+}
+
+func isSuccessful(status int) bool {
+	return status >= 200 && status < 400
+}
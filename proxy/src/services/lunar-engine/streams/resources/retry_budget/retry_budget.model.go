@@ -0,0 +1,19 @@
+package retrybudgetresource
+
+import (
+	streamconfig "lunar/engine/streams/config"
+)
+
+// RetryBudgetConfig is declared along with the quotas, under retry_budgets
+type RetryBudgetConfig struct {
+	ID string `yaml:"id" validate:"required"`
+	// Filter selects the requests whose successful responses fund the budget,
+	// all requests fund it when not set
+	Filter *streamconfig.Filter `yaml:"filter,omitempty"`
+	// RetryPercentage is the share of the recent successful requests which can be retried
+	RetryPercentage float64 `yaml:"retry_percentage" validate:"gte=0"`
+	// MinRetriesPerSecond are allowed regardless of the successful requests
+	MinRetriesPerSecond float64 `yaml:"min_retries_per_second" validate:"gte=0"`
+	// WindowSeconds is the period of the recent requests, 10 seconds when not set
+	WindowSeconds int64 `yaml:"window_seconds,omitempty" validate:"omitempty,gt=0"`
+}
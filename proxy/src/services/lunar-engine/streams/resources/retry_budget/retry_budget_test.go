@@ -0,0 +1,97 @@
+package retrybudgetresource
+
+import (
+	lunar_messages "lunar/engine/messages"
+	streamconfig "lunar/engine/streams/config"
+	lunar_context "lunar/engine/streams/lunar-context"
+	publictypes "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	context_manager "lunar/toolkit-core/context-manager"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestResponse(method, url string, status int) publictypes.APIStreamI {
+	return streamtypes.NewResponseAPIStream(lunar_messages.OnResponse{
+		Method: method,
+		URL:    url,
+		Status: status,
+	}, lunar_context.NewMemoryState[[]byte]())
+}
+
+func recordResponses(budget *RetryBudget, count int, method, url string, status int) {
+	for range count {
+		budget.RecordResponse(newTestResponse(method, url, status))
+	}
+}
+
+func tryRetries(budget *RetryBudget, count int) int {
+	allowed := 0
+	for range count {
+		if budget.TryRetry() {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestRetryBudgetAllowsShareOfSuccessfulRequests(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	budget, err := NewRetryBudget(&RetryBudgetConfig{
+		ID:                  "budget",
+		Filter:              &streamconfig.Filter{URL: "api.example.com/*", Method: []string{"GET"}},
+		RetryPercentage:     20,
+		MinRetriesPerSecond: 0.1,
+		WindowSeconds:       10,
+	})
+	require.NoError(t, err)
+
+	// the minimum rate allows a single retry over the window
+	require.Equal(t, 1, tryRetries(budget, 5))
+
+	recordResponses(budget, 50, "GET", "api.example.com/items", 200)
+	// not funding the budget: failures, other methods and other hosts
+	recordResponses(budget, 50, "GET", "api.example.com/items", 503)
+	recordResponses(budget, 50, "POST", "api.example.com/items", 200)
+	recordResponses(budget, 50, "GET", "other.example.com/items", 200)
+
+	// 20% of 50 successful requests plus the minimum, one of them already used
+	require.Equal(t, 10, tryRetries(budget, 20))
+
+	// the successful requests and the retries leave the window together
+	mockClock.AdvanceTime(11 * time.Second)
+	require.Equal(t, 1, tryRetries(budget, 5))
+}
+
+func TestRetryBudgetWindowSlides(t *testing.T) {
+	mockClock := context_manager.Get().SetMockClock().GetMockClock()
+	budget, err := NewRetryBudget(&RetryBudgetConfig{ID: "budget", RetryPercentage: 10})
+	require.NoError(t, err)
+
+	recordResponses(budget, 100, "GET", "api.example.com/items", 200)
+	mockClock.AdvanceTime(5 * time.Second)
+	recordResponses(budget, 100, "GET", "api.example.com/items", 200)
+	require.Equal(t, 20, tryRetries(budget, 30))
+
+	// the first successful requests left the default window, the retries did not
+	mockClock.AdvanceTime(6 * time.Second)
+	require.Zero(t, tryRetries(budget, 5))
+
+	mockClock.AdvanceTime(5 * time.Second)
+	recordResponses(budget, 100, "GET", "api.example.com/items", 200)
+	require.Equal(t, 10, tryRetries(budget, 30))
+}
+
+func TestRetryBudgetValidation(t *testing.T) {
+	for _, config := range []*RetryBudgetConfig{
+		{RetryPercentage: 10},
+		{ID: "budget", RetryPercentage: -1},
+		{ID: "budget", MinRetriesPerSecond: -1},
+		{ID: "budget", WindowSeconds: -1},
+	} {
+		_, err := NewRetryBudget(config)
+		require.Error(t, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	streamconfig "lunar/engine/streams/config"
 	internaltypes "lunar/engine/streams/internal-types"
 	publictypes "lunar/engine/streams/public-types"
+	"lunar/engine/streams/tracing"
 	streamtypes "lunar/engine/streams/types"
 
 	"github.com/rs/zerolog/log"
@@ -19,6 +20,7 @@ type ShortCircuitData struct {
 
 type Stream struct {
 	getMeasureProcExecFunc func(string) func(string, publictypes.APIStreamI, ProcessorExecuteFunc) (streamtypes.ProcessorIO, error) //nolint:lll
+	tracer                 *tracing.Tracer
 	Request                *streamconfig.RequestStream
 	Response               *streamconfig.ResponseStream
 }
@@ -37,6 +39,12 @@ func (s *Stream) WithProcExecutionMeasurement(
 	return s
 }
 
+// WithTracer traces the execution of every processor, a nil tracer traces nothing
+func (s *Stream) WithTracer(tracer *tracing.Tracer) *Stream {
+	s.tracer = tracer
+	return s
+}
+
 func (s *Stream) GetRequestStream() *streamconfig.RequestStream {
 	return s.Request
 }
@@ -52,7 +60,14 @@ func (s *Stream) ExecuteFlow(
 	actions *streamconfig.StreamActions,
 ) (*ShortCircuitData, error) {
 	closureFunc := func() (streamtypes.ProcessorIO, error) {
-		return node.GetProcessor().Execute(flow.GetName(), apiStream)
+		return s.tracer.TraceProcessor(
+			apiStream,
+			node.GetProcessorKey(),
+			node.GetProcessor(),
+			func() (streamtypes.ProcessorIO, error) {
+				return node.GetProcessor().Execute(flow.GetName(), apiStream)
+			},
+		)
 	}
 	var err error
 	var shortCircuitData *ShortCircuitData // internaltypes.FlowGraphNodeI
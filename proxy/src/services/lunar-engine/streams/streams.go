@@ -2,6 +2,7 @@ package streams
 
 import (
 	"fmt"
+	lunar_actions "lunar/engine/actions"
 	"lunar/engine/communication"
 	lunar_messages "lunar/engine/messages"
 	"lunar/engine/metrics"
@@ -11,12 +12,15 @@ import (
 	internaltypes "lunar/engine/streams/internal-types"
 	lunar_context "lunar/engine/streams/lunar-context"
 	"lunar/engine/streams/processors"
+	processorsutils "lunar/engine/streams/processors/utils"
 	publictypes "lunar/engine/streams/public-types"
 	"lunar/engine/streams/resources"
 	"lunar/engine/streams/stream"
+	"lunar/engine/streams/tracing"
 	stream_types "lunar/engine/streams/types"
 	"lunar/engine/utils"
 	"lunar/engine/utils/environment"
+	sharedActions "lunar/shared-model/actions"
 	"lunar/toolkit-core/network"
 
 	"github.com/rs/zerolog/log"
@@ -41,6 +45,7 @@ type Stream struct {
 	loadedConfig      network.ConfigurationData
 	lunarHub          *communication.HubCommunication
 	metricsData       *flowMetricsData
+	tracer            *tracing.Tracer
 
 	validationMode bool // if true - any error will stop initialization
 	validationPath string
@@ -53,7 +58,7 @@ func NewStream() (*Stream, error) {
 		return nil, err
 	}
 
-	return newStream(resources, newFlowMetricsData()), nil
+	return newStream(resources, newFlowMetricsData()).WithTracer(tracing.NewTracer()), nil
 }
 
 func NewValidationStream(dir string) (*Stream, error) {
@@ -78,6 +83,16 @@ func (s *Stream) GetLoadedConfig() network.ConfigurationData {
 	return s.loadedConfig
 }
 
+func (s *Stream) GetQuotaOverages() map[string]map[string]int64 {
+	return s.resources.GetQuotaOverages()
+}
+
+func (s *Stream) PurgeCache(
+	request stream_types.CachePurgeRequest,
+) (stream_types.CachePurgeResult, error) {
+	return s.processorsManager.PurgeCache(request)
+}
+
 func (s *Stream) GetActiveFlows() *metrics.MetricData {
 	return s.metricsData.getActiveFlows()
 }
@@ -98,6 +113,44 @@ func (s *Stream) GetProcessorExecutionData() *metrics.MetricData {
 	return s.metricsData.getProcessorExecutionData()
 }
 
+func (s *Stream) GetQuotaGroupsData() *metrics.MetricData {
+	data := &metrics.MetricData{}
+	for quotaID, groupStates := range s.resources.GetQuotaStates() {
+		for groupID, state := range groupStates {
+			data.QuotaGroups = append(data.QuotaGroups, &metrics.QuotaGroupData{
+				QuotaID:          quotaID,
+				GroupID:          groupID,
+				Used:             state.Used,
+				Limit:            state.Limit,
+				ResetIn:          state.ResetIn,
+				SpilloverBalance: state.SpilloverBalance,
+			})
+		}
+	}
+	return data
+}
+
+func (s *Stream) GetQueuesData() *metrics.MetricData {
+	data := &metrics.MetricData{}
+	for _, stats := range s.processorsManager.GetQueueStats() {
+		data.Queues = append(data.Queues, &metrics.QueueData{
+			ProcessorKey:  stats.ProcessorKey,
+			Group:         stats.Group,
+			Size:          stats.Size,
+			OldestItemAge: stats.OldestItemAge,
+			DroppedOnTTL:  stats.DroppedOnTTL,
+		})
+	}
+	return data
+}
+
+// WithTracer traces the transactions going through the flows, a nil tracer traces nothing
+func (s *Stream) WithTracer(tracer *tracing.Tracer) *Stream {
+	s.tracer = tracer
+	s.apiStreams.WithTracer(tracer)
+	return s
+}
+
 func (s *Stream) WithHub(hub *communication.HubCommunication) *Stream {
 	s.lunarHub = hub
 	return s
@@ -205,8 +258,11 @@ func (s *Stream) Initialize() error {
 			isBodyRequired := filterRequirements.IsBodyRequired || procRequirements.IsBodyRequired
 			isReqCaptureRequired := filterRequirements.IsReqCaptureRequired ||
 				procRequirements.IsReqCaptureRequired
+			isNetworkErrorRequired := filterRequirements.IsNetworkErrorRequired ||
+				procRequirements.IsNetworkErrorRequired
 			adminFilter.SetBodyRequired(isBodyRequired)
 			adminFilter.SetReqCaptureRequired(isReqCaptureRequired)
+			adminFilter.SetNetworkErrorRequired(isNetworkErrorRequired)
 		}
 	}
 
@@ -230,6 +286,12 @@ func (s *Stream) ExecuteFlow(
 ) error {
 	log.Trace().Msgf("Executing flow for APIStream %v", apiStream.GetName())
 
+	// Every transaction is traced, whether flows are found for it or not.
+	// The type is checked on end as a short circuit turns the request into a response.
+	s.tracer.OnStreamStart(apiStream)
+	defer s.tracer.OnStreamEnd(apiStream)
+	defer s.propagateTraceContext(apiStream, actions)
+
 	// resetting apiStream instance before flow execution
 	flowsToExecute, found := s.filterTree.GetFlow(apiStream)
 	if !found {
@@ -238,7 +300,8 @@ func (s *Stream) ExecuteFlow(
 	}
 
 	s.apiStreams = stream.NewStream().
-		WithProcExecutionMeasurement(s.metricsData.getProcMeasureExecFunc)
+		WithProcExecutionMeasurement(s.metricsData.getProcMeasureExecFunc).
+		WithTracer(s.tracer)
 
 	var err error
 	if apiStream.GetType().IsRequestType() {
@@ -252,6 +315,28 @@ func (s *Stream) ExecuteFlow(
 	return err
 }
 
+// propagateTraceContext sets the trace context on the request sent to the provider,
+// unless the flows returned a response for it
+func (s *Stream) propagateTraceContext(
+	apiStream publictypes.APIStreamI,
+	actions *streamconfig.StreamActions,
+) {
+	if !apiStream.GetType().IsRequestType() || actions == nil || actions.Request == nil {
+		return
+	}
+	for _, action := range actions.Request.Actions {
+		if action.ReqRunResult() == sharedActions.ReqObtainedResponse {
+			return
+		}
+	}
+	headers := s.tracer.TraceContextHeaders(apiStream)
+	if len(headers) == 0 {
+		return
+	}
+	actions.Request.Actions = append(actions.Request.Actions,
+		&lunar_actions.ModifyHeadersAction{HeadersToSet: headers})
+}
+
 // getFlows gets the flows from the flows directory.
 // It can be either the directory defined by ENV var or the validation directory.
 func (s *Stream) getFlows() (map[string]internaltypes.FlowRepI, error) {
@@ -401,10 +486,30 @@ func (s *Stream) executeRes(
 		}
 	}
 
+	s.clearTransactionData(flowsToExecute, apiStream)
 	s.resources.OnResponseFinish(apiStream)
 	return nil
 }
 
+// clearTransactionData removes the values the processors of the user flows published
+// for the transaction, once its response went through the flows
+func (s *Stream) clearTransactionData(
+	flowsToExecute internaltypes.FilterTreeResultI,
+	apiStream publictypes.APIStreamI,
+) {
+	userFlows, found := flowsToExecute.GetUserFlow()
+	if !found {
+		return
+	}
+	for _, userFlow := range userFlows {
+		flowContext := userFlow.GetExecutionContext().GetFlowContext()
+		if flowContext == nil {
+			continue
+		}
+		processorsutils.ClearTransactionData(flowContext, apiStream.GetID())
+	}
+}
+
 func (s *Stream) executeFlow(
 	flow internaltypes.FlowI,
 	apiStream publictypes.APIStreamI,
@@ -453,8 +558,10 @@ func (s *Stream) executeFlow(
 
 	var err error
 	closureFunc := func() error {
-		shortCircuitData, err = s.apiStreams.ExecuteFlow(flow, apiStream, node, actions)
-		return err
+		return s.tracer.TraceFlow(apiStream, flow.GetName(), func() error {
+			shortCircuitData, err = s.apiStreams.ExecuteFlow(flow, apiStream, node, actions)
+			return err
+		})
 	}
 
 	return shortCircuitData, s.metricsData.measureFlowExecutionTime(flow.GetName(), closureFunc)
@@ -0,0 +1,22 @@
+package testutils
+
+import (
+	public_types "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+)
+
+// NewProcessorParams builds the parameters of a processor from their values.
+// Values of later maps replace the values of the same name in earlier ones,
+// so tests can override the defaults they use for a processor.
+func NewProcessorParams(values ...map[string]any) map[string]streamtypes.ProcessorParam {
+	params := make(map[string]streamtypes.ProcessorParam)
+	for _, paramValues := range values {
+		for name, value := range paramValues {
+			params[name] = streamtypes.ProcessorParam{
+				Name:  name,
+				Value: public_types.NewParamValue(value),
+			}
+		}
+	}
+	return params
+}
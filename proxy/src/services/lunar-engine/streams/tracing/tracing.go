@@ -0,0 +1,511 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	publictypes "lunar/engine/streams/public-types"
+	streamtypes "lunar/engine/streams/types"
+	"lunar/engine/utils/environment"
+	"lunar/toolkit-core/otel"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "lunar-engine"
+
+	tempoGRPCEndpoint = "tempo:4317"
+	tempoHTTPEndpoint = "tempo:4318"
+
+	// Transactions which did not get a response within the TTL are ended as incomplete
+	transactionTTL = 2 * time.Minute
+	// Retries and async dispatches within the TTL become children of the original transaction
+	sequenceTTL = 5 * time.Minute
+	cleanPeriod = 30 * time.Second
+
+	TransactionIDAttribute   = attribute.Key("lunar.transaction_id")
+	SequenceIDAttribute      = attribute.Key("lunar.sequence_id")
+	FlowNameAttribute        = attribute.Key("lunar.flow.name")
+	StreamTypeAttribute      = attribute.Key("lunar.stream.type")
+	ProcessorKeyAttribute    = attribute.Key("lunar.processor.key")
+	ProcessorNameAttribute   = attribute.Key("lunar.processor.name")
+	ProcessorOutputAttribute = attribute.Key("lunar.processor.output")
+	QuotaIDAttribute         = attribute.Key("lunar.quota.id")
+	QuotaDecisionAttribute   = attribute.Key("lunar.quota.decision")
+)
+
+// activeTracer is the tracer of the automatic tracing mode, if enabled,
+// used by the processors to start their own spans within the transaction trace
+var activeTracer atomic.Pointer[Tracer]
+
+type transactionTrace struct {
+	root      context.Context // context of the transaction span
+	current   context.Context // context of the span of the executing flow or processor
+	startedAt time.Time
+	// propagated holds the trace context headers injected for the request to the provider
+	propagated map[string]string
+	// received holds the trace context headers the request was received with
+	received map[string]string
+}
+
+type sequenceTrace struct {
+	spanContext trace.SpanContext // span context of the first transaction of the sequence
+	startedAt   time.Time
+}
+
+// Tracer traces every transaction going through the flows, with a span per flow and
+// per processor execution. A nil Tracer is valid and traces nothing.
+type Tracer struct {
+	tracer       trace.Tracer
+	propagator   propagation.TextMapPropagator
+	propagate    bool
+	transactions map[string]*transactionTrace // key - transaction ID
+	sequences    map[string]*sequenceTrace    // key - sequence ID
+	mu           sync.Mutex
+}
+
+// NewTracer returns the tracer of the automatic tracing mode,
+// or nil when it is disabled or the trace exporter is not configured
+func NewTracer() *Tracer {
+	if !environment.IsAutoTracingEnabled() {
+		return nil
+	}
+
+	gatewayConfig, err := environment.LoadGatewayConfig()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load gateway config, automatic tracing is disabled")
+		return nil
+	}
+	provider, err := NewTracerProvider(
+		serviceName,
+		gatewayConfig.TraceExporter.TracesEndpoint,
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create tracer provider, automatic tracing is disabled")
+		return nil
+	}
+
+	tracer := newTracer(
+		provider.Tracer(serviceName),
+		environment.IsTraceContextPropagationEnabled(),
+	)
+	activeTracer.Store(tracer)
+	go tracer.cleanStaleTransactions(transactionTTL, sequenceTTL, cleanPeriod)
+	log.Info().Bool("traceContextPropagation", tracer.propagate).
+		Msgf("Automatic tracing enabled, exporting to %s",
+			gatewayConfig.TraceExporter.TracesEndpoint)
+	return tracer
+}
+
+// StartSpan starts a span within the flow currently executing for the transaction,
+// or a span of a new trace when the transaction is not traced
+func StartSpan(
+	apiStream publictypes.APIStreamI,
+	spanName string,
+) (context.Context, trace.Span) {
+	if tracer := activeTracer.Load(); tracer != nil {
+		if ctx, found := tracer.currentContext(apiStream.GetID()); found {
+			return tracer.tracer.Start(ctx, spanName)
+		}
+	}
+	return otel.Tracer(context.Background(), spanName)
+}
+
+// NewTracerProvider creates a tracer provider exporting the spans over OTLP gRPC
+// to the traces endpoint of the trace exporter configured in the gateway config
+func NewTracerProvider(
+	name string,
+	tracesEndpoint string,
+	options ...sdktrace.TracerProviderOption,
+) (*sdktrace.TracerProvider, error) {
+	if tracesEndpoint == "" {
+		return nil, fmt.Errorf("traces endpoint not found in gateway config")
+	}
+	// Endpoints without a scheme, e.g. tempo:4317, are plain HTTP
+	parsedEndpoint, err := url.Parse(tracesEndpoint)
+	if err != nil || parsedEndpoint.Host == "" {
+		if parsedEndpoint, err = url.Parse("http://" + tracesEndpoint); err != nil {
+			return nil, fmt.Errorf("failed to parse traces endpoint: %w", err)
+		}
+	}
+
+	endpoint := parsedEndpoint.Host
+	if endpoint == tempoHTTPEndpoint {
+		log.Warn().Msg("Tempo HTTP endpoint not supported. Switching to gRPC endpoint instead.")
+		endpoint = tempoGRPCEndpoint
+	}
+
+	ctx := context.Background()
+	exporterOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if parsedEndpoint.Scheme == "http" {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+	// TODO: add support for TLS creds in the future versions
+	exporter, err := otlptracegrpc.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceNameKey.String(name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otel resource: %w", err)
+	}
+
+	options = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	}, options...)
+	return sdktrace.NewTracerProvider(options...), nil
+}
+
+// OnStreamStart starts the transaction span when its request is received,
+// continuing the W3C trace context sent by the client.
+// A request retried or dispatched again by Lunar continues the trace of its sequence,
+// as a child of the span of the original transaction linked to it.
+func (t *Tracer) OnStreamStart(apiStream publictypes.APIStreamI) {
+	if t == nil || !apiStream.GetType().IsRequestType() {
+		return
+	}
+
+	headers := apiStream.GetHeaders()
+	ctx := t.propagator.Extract(context.Background(), headerCarrier(headers))
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			TransactionIDAttribute.String(apiStream.GetID()),
+			SequenceIDAttribute.String(apiStream.GetSequenceID()),
+			semconv.HTTPMethodKey.String(apiStream.GetMethod()),
+			semconv.HTTPURLKey.String(apiStream.GetURL()),
+		),
+	}
+	if sequence, found := t.getSequence(apiStream); found {
+		ctx = trace.ContextWithSpanContext(ctx, sequence.spanContext)
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: sequence.spanContext}))
+	}
+	ctx, span := t.tracer.Start(ctx,
+		fmt.Sprintf("%s %s", apiStream.GetMethod(), apiStream.GetURL()), options...)
+	log.Trace().
+		Str("txnID", apiStream.GetID()).
+		Str("traceID", span.SpanContext().TraceID().String()).
+		Msg("Started transaction span")
+
+	transaction := &transactionTrace{
+		root:      ctx,
+		current:   ctx,
+		startedAt: time.Now(),
+	}
+	if t.propagate {
+		transaction.propagated = t.injectTraceContext(ctx)
+		transaction.received = t.extractTraceContextHeaders(headers)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transactions[apiStream.GetID()] = transaction
+	if isNewSequence(apiStream) {
+		t.sequences[sequenceID(apiStream)] = &sequenceTrace{
+			spanContext: span.SpanContext(),
+			startedAt:   transaction.startedAt,
+		}
+	}
+}
+
+// TraceContextHeaders returns the trace context headers to set on the request
+// sent to the provider, empty unless the trace context propagation is enabled.
+// Processors which updated the trace context of the request, e.g. with a span of their own,
+// take precedence over the gateway span.
+func (t *Tracer) TraceContextHeaders(apiStream publictypes.APIStreamI) map[string]string {
+	if t == nil || !t.propagate {
+		return nil
+	}
+
+	t.mu.Lock()
+	transaction, found := t.transactions[apiStream.GetID()]
+	t.mu.Unlock()
+	if !found {
+		return nil
+	}
+
+	headers := make(map[string]string, len(transaction.propagated))
+	requestHeaders := headerCarrier(nil)
+	if request := apiStream.GetRequest(); request != nil {
+		requestHeaders = headerCarrier(request.GetHeaders())
+	}
+	for _, field := range t.propagator.Fields() {
+		// the headers set by the processors take precedence over the ones of the transaction
+		if value := requestHeaders.Get(field); value != "" && value != transaction.received[field] {
+			headers[field] = value
+		} else if value, found := transaction.propagated[field]; found {
+			headers[field] = value
+		}
+	}
+	return headers
+}
+
+// OnStreamEnd ends the transaction span once its response went through the flows
+func (t *Tracer) OnStreamEnd(apiStream publictypes.APIStreamI) {
+	if t == nil || !apiStream.GetType().IsResponseType() {
+		return
+	}
+
+	t.mu.Lock()
+	transaction, found := t.transactions[apiStream.GetID()]
+	delete(t.transactions, apiStream.GetID())
+	t.mu.Unlock()
+	if !found {
+		return
+	}
+
+	span := trace.SpanFromContext(transaction.root)
+	// A response generated by the flows, e.g. on an early return, has no response stream
+	if response := apiStream.GetResponse(); response != nil {
+		statusCode := response.GetStatus()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(statusCode))
+		if statusCode >= 400 {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", statusCode))
+		}
+	}
+	span.End()
+}
+
+// TraceFlow runs the flow execution within a span of the transaction
+func (t *Tracer) TraceFlow(
+	apiStream publictypes.APIStreamI,
+	flowName string,
+	execute func() error,
+) error {
+	if t == nil {
+		return execute()
+	}
+
+	t.mu.Lock()
+	transaction, found := t.transactions[apiStream.GetID()]
+	t.mu.Unlock()
+	if !found {
+		return execute()
+	}
+
+	ctx, span := t.tracer.Start(transaction.root, "flow "+flowName,
+		trace.WithAttributes(
+			FlowNameAttribute.String(flowName),
+			StreamTypeAttribute.String(apiStream.GetType().String()),
+		),
+	)
+	t.setCurrent(transaction, ctx)
+	defer t.setCurrent(transaction, transaction.root)
+
+	err := execute()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	return err
+}
+
+// TraceProcessor runs the processor execution within a span of the executing flow,
+// recording the output taken and the quota decision, if the processor made one
+func (t *Tracer) TraceProcessor(
+	apiStream publictypes.APIStreamI,
+	processorKey string,
+	processor streamtypes.ProcessorI,
+	execute func() (streamtypes.ProcessorIO, error),
+) (streamtypes.ProcessorIO, error) {
+	if t == nil {
+		return execute()
+	}
+
+	t.mu.Lock()
+	transaction, found := t.transactions[apiStream.GetID()]
+	var ctx context.Context
+	if found {
+		ctx = transaction.current
+	}
+	t.mu.Unlock()
+	if !found {
+		return execute()
+	}
+
+	processorCtx, span := t.tracer.Start(ctx, "processor "+processorKey,
+		trace.WithAttributes(
+			ProcessorKeyAttribute.String(processorKey),
+			ProcessorNameAttribute.String(processor.GetName()),
+		),
+	)
+	defer span.End()
+	// Spans started by the processor are children of the processor span
+	t.setCurrent(transaction, processorCtx)
+	defer t.setCurrent(transaction, ctx)
+
+	procIO, err := execute()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return procIO, err
+	}
+
+	span.SetAttributes(ProcessorOutputAttribute.String(procIO.Name))
+	quotaProcessor, isQuotaProcessor := processor.(streamtypes.QuotaProcessorI)
+	if isQuotaProcessor && quotaProcessor.GetQuotaID() != "" {
+		span.SetAttributes(
+			QuotaIDAttribute.String(quotaProcessor.GetQuotaID()),
+			QuotaDecisionAttribute.String(procIO.Name),
+		)
+	}
+	if procIO.Failure {
+		span.SetStatus(codes.Error, "processor failure")
+	}
+	return procIO, nil
+}
+
+func (t *Tracer) setCurrent(transaction *transactionTrace, ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	transaction.current = ctx
+}
+
+func (t *Tracer) currentContext(txnID string) (context.Context, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	transaction, found := t.transactions[txnID]
+	if !found {
+		return nil, false
+	}
+	return transaction.current, true
+}
+
+// getSequence returns the trace of the original transaction of a retried or
+// dispatched again request
+func (t *Tracer) getSequence(apiStream publictypes.APIStreamI) (*sequenceTrace, bool) {
+	if isNewSequence(apiStream) {
+		return nil, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sequence, found := t.sequences[apiStream.GetSequenceID()]
+	return sequence, found
+}
+
+// injectTraceContext returns the trace context headers of the transaction span.
+// The headers of the request are left as received, they are shared with the processors
+// and are only changed through the actions of the flows.
+func (t *Tracer) injectTraceContext(ctx context.Context) map[string]string {
+	propagated := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, propagated)
+	return propagated
+}
+
+// extractTraceContextHeaders returns the trace context headers among the request headers
+func (t *Tracer) extractTraceContextHeaders(headers map[string]string) map[string]string {
+	received := make(map[string]string)
+	for _, field := range t.propagator.Fields() {
+		if value := headerCarrier(headers).Get(field); value != "" {
+			received[field] = value
+		}
+	}
+	return received
+}
+
+// cleanStaleTransactions ends the spans of the transactions which never got a response
+// and forgets the sequences which can no longer be retried
+func (t *Tracer) cleanStaleTransactions(transactionTTL, sequenceTTL, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		t.endStaleTransactions(time.Now().Add(-transactionTTL))
+		t.forgetStaleSequences(time.Now().Add(-sequenceTTL))
+	}
+}
+
+func (t *Tracer) endStaleTransactions(startedBefore time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for txnID, transaction := range t.transactions {
+		if transaction.startedAt.After(startedBefore) {
+			continue
+		}
+		span := trace.SpanFromContext(transaction.root)
+		span.SetStatus(codes.Error, "no response received")
+		span.End()
+		delete(t.transactions, txnID)
+		log.Debug().Str("txnID", txnID).Msg("Ended span of stale transaction")
+	}
+}
+
+func (t *Tracer) forgetStaleSequences(startedBefore time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for sequenceID, sequence := range t.sequences {
+		if sequence.startedAt.Before(startedBefore) {
+			delete(t.sequences, sequenceID)
+		}
+	}
+}
+
+func newTracer(tracer trace.Tracer, propagate bool) *Tracer {
+	return &Tracer{
+		tracer: tracer,
+		propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+		propagate:    propagate,
+		transactions: make(map[string]*transactionTrace),
+		sequences:    make(map[string]*sequenceTrace),
+	}
+}
+
+// sequenceID returns the ID of the sequence of requests the transaction belongs to,
+// retries and async dispatches share the sequence ID of the original transaction
+func sequenceID(apiStream publictypes.APIStreamI) string {
+	if apiStream.GetSequenceID() == "" {
+		return apiStream.GetID()
+	}
+	return apiStream.GetSequenceID()
+}
+
+func isNewSequence(apiStream publictypes.APIStreamI) bool {
+	return sequenceID(apiStream) == apiStream.GetID()
+}
+
+// headerCarrier reads the trace context from headers regardless of their case
+type headerCarrier map[string]string
+
+func (carrier headerCarrier) Get(key string) string {
+	if value, found := carrier[key]; found {
+		return value
+	}
+	for name, value := range carrier {
+		if strings.EqualFold(name, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (carrier headerCarrier) Set(key, value string) {
+	carrier[key] = value
+}
+
+func (carrier headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,284 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+	lunar_messages "lunar/engine/messages"
+	lunar_context "lunar/engine/streams/lunar-context"
+	public_types "lunar/engine/streams/public-types"
+	stream_types "lunar/engine/streams/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const clientTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+type testProcessor struct {
+	name    string
+	quotaID string
+}
+
+func (p *testProcessor) GetName() string { return p.name }
+
+func (p *testProcessor) GetQuotaID() string { return p.quotaID }
+
+func (p *testProcessor) Execute(
+	_ string,
+	_ public_types.APIStreamI,
+) (stream_types.ProcessorIO, error) {
+	return stream_types.ProcessorIO{}, nil
+}
+
+func (p *testProcessor) GetRequirement() *stream_types.ProcessorRequirement {
+	return &stream_types.ProcessorRequirement{}
+}
+
+func newTestTracer(propagate bool) (*Tracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return newTracer(provider.Tracer(serviceName), propagate), recorder
+}
+
+func newTestStream(headers map[string]string) public_types.APIStreamI {
+	return newSequenceStream("txn-1", "seq-1", headers)
+}
+
+func newSequenceStream(
+	txnID string,
+	sequenceID string,
+	headers map[string]string,
+) public_types.APIStreamI {
+	return stream_types.NewRequestAPIStream(lunar_messages.OnRequest{
+		ID:         txnID,
+		SequenceID: sequenceID,
+		Method:     "GET",
+		URL:        "api.example.com/users",
+		Headers:    headers,
+	}, lunar_context.NewMemoryState[[]byte]())
+}
+
+func setTestResponse(apiStream public_types.APIStreamI, status int) {
+	apiStream.SetType(public_types.StreamTypeResponse)
+	apiStream.SetResponse(stream_types.NewResponse(lunar_messages.OnResponse{
+		ID:         "txn-1",
+		SequenceID: "seq-1",
+		Method:     "GET",
+		URL:        "api.example.com/users",
+		Status:     status,
+	}))
+}
+
+func spansByName(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, keyValue := range span.Attributes() {
+		if keyValue.Key == key {
+			return keyValue.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracerTracesFlowsAndProcessors(t *testing.T) {
+	tracer, recorder := newTestTracer(false)
+	apiStream := newTestStream(map[string]string{"Traceparent": clientTraceParent})
+	limiter := &testProcessor{name: "Limiter", quotaID: "quota-1"}
+
+	tracer.OnStreamStart(apiStream)
+	err := tracer.TraceFlow(apiStream, "flow-1", func() error {
+		_, err := tracer.TraceProcessor(apiStream, "limiter-1", limiter,
+			func() (stream_types.ProcessorIO, error) {
+				return stream_types.ProcessorIO{Name: "above_limit"}, nil
+			})
+		return err
+	})
+	require.NoError(t, err)
+	setTestResponse(apiStream, 429)
+	tracer.OnStreamEnd(apiStream)
+
+	spans := spansByName(recorder)
+	require.Len(t, spans, 3)
+	transaction := spans["GET api.example.com/users"]
+	flow := spans["flow flow-1"]
+	processor := spans["processor limiter-1"]
+	require.NotNil(t, transaction)
+	require.NotNil(t, flow)
+	require.NotNil(t, processor)
+
+	// The trace sent by the client is continued
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", transaction.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", transaction.Parent().SpanID().String())
+	assert.Equal(t, transaction.SpanContext().SpanID(), flow.Parent().SpanID())
+	assert.Equal(t, flow.SpanContext().SpanID(), processor.Parent().SpanID())
+
+	assert.Equal(t, int64(429), attributeValue(transaction, "http.status_code").AsInt64())
+	assert.Equal(t, codes.Error, transaction.Status().Code)
+	assert.Equal(t, "limiter-1", attributeValue(processor, ProcessorKeyAttribute).AsString())
+	assert.Equal(t, "above_limit", attributeValue(processor, ProcessorOutputAttribute).AsString())
+	assert.Equal(t, "quota-1", attributeValue(processor, QuotaIDAttribute).AsString())
+	assert.Equal(t, "above_limit", attributeValue(processor, QuotaDecisionAttribute).AsString())
+}
+
+func TestTracerRecordsFailedFlows(t *testing.T) {
+	tracer, recorder := newTestTracer(false)
+	apiStream := newTestStream(map[string]string{})
+
+	tracer.OnStreamStart(apiStream)
+	err := tracer.TraceFlow(apiStream, "flow-1", func() error {
+		_, err := tracer.TraceProcessor(apiStream, "filter-1", &testProcessor{name: "Filter"},
+			func() (stream_types.ProcessorIO, error) {
+				return stream_types.ProcessorIO{}, errors.New("boom")
+			})
+		return err
+	})
+	require.Error(t, err)
+
+	spans := spansByName(recorder)
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Error, spans["flow flow-1"].Status().Code)
+	assert.Equal(t, codes.Error, spans["processor filter-1"].Status().Code)
+
+	// The transaction span is only ended by the response or once stale
+	tracer.endStaleTransactions(time.Now().Add(time.Minute))
+	transaction := spansByName(recorder)["GET api.example.com/users"]
+	require.NotNil(t, transaction)
+	assert.Equal(t, codes.Error, transaction.Status().Code)
+}
+
+func TestNilTracerTracesNothing(t *testing.T) {
+	var tracer *Tracer
+	apiStream := newTestStream(map[string]string{})
+
+	tracer.OnStreamStart(apiStream)
+	executed := false
+	err := tracer.TraceFlow(apiStream, "flow-1", func() error {
+		executed = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, executed)
+	tracer.OnStreamEnd(apiStream)
+}
+
+func TestTracerPropagatesTraceContextOfTheTransactionSpan(t *testing.T) {
+	tracer, _ := newTestTracer(true)
+	headers := map[string]string{
+		"Traceparent": clientTraceParent,
+		"Baggage":     "tenant=acme",
+	}
+	apiStream := newTestStream(headers)
+
+	tracer.OnStreamStart(apiStream)
+	transaction := trace.SpanContextFromContext(tracer.transactions["txn-1"].root)
+	wantTraceParent := fmt.Sprintf("00-%s-%s-01",
+		transaction.TraceID().String(), transaction.SpanID().String())
+
+	assert.Equal(t, map[string]string{
+		"traceparent": wantTraceParent,
+		"baggage":     "tenant=acme",
+	}, tracer.TraceContextHeaders(apiStream))
+	// The headers of the request are left as received, the flows set the trace context
+	assert.Equal(t, map[string]string{
+		"Traceparent": clientTraceParent,
+		"Baggage":     "tenant=acme",
+	}, headers)
+}
+
+func TestTraceContextSetByProcessorsTakesPrecedence(t *testing.T) {
+	tracer, _ := newTestTracer(true)
+	apiStream := newTestStream(map[string]string{})
+
+	tracer.OnStreamStart(apiStream)
+	apiStream.GetRequest().GetHeaders()["traceparent"] = clientTraceParent
+
+	assert.Equal(t, clientTraceParent, tracer.TraceContextHeaders(apiStream)["traceparent"])
+}
+
+func TestTraceContextOfTheClientIsReplaced(t *testing.T) {
+	tracer, _ := newTestTracer(true)
+	apiStream := newTestStream(map[string]string{"Traceparent": clientTraceParent})
+
+	tracer.OnStreamStart(apiStream)
+
+	// the provider gets the span of the gateway as the parent, within the trace of the client
+	traceParent := tracer.TraceContextHeaders(apiStream)["traceparent"]
+	assert.NotEqual(t, clientTraceParent, traceParent)
+	assert.Equal(t, clientTraceParent[:35], traceParent[:35])
+}
+
+func TestTraceContextIsNotPropagatedUnlessEnabled(t *testing.T) {
+	tracer, _ := newTestTracer(false)
+	headers := map[string]string{}
+	apiStream := newTestStream(headers)
+
+	tracer.OnStreamStart(apiStream)
+
+	assert.Empty(t, tracer.TraceContextHeaders(apiStream))
+	assert.Empty(t, headers)
+}
+
+func TestRedispatchedRequestsAreChildrenOfTheirOriginalTransaction(t *testing.T) {
+	tracer, recorder := newTestTracer(false)
+	original := newSequenceStream("txn-1", "txn-1", map[string]string{})
+	retry := newSequenceStream("txn-2", "txn-1", map[string]string{})
+
+	tracer.OnStreamStart(original)
+	tracer.OnStreamStart(retry)
+	tracer.endStaleTransactions(time.Now().Add(time.Minute))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	spansByTransaction := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range spans {
+		spansByTransaction[attributeValue(span, TransactionIDAttribute).AsString()] = span
+	}
+	originalSpan := spansByTransaction["txn-1"].SpanContext()
+	retrySpan := spansByTransaction["txn-2"]
+
+	assert.Equal(t, originalSpan.TraceID(), retrySpan.SpanContext().TraceID())
+	assert.Equal(t, originalSpan.SpanID(), retrySpan.Parent().SpanID())
+	require.Len(t, retrySpan.Links(), 1)
+	assert.Equal(t, originalSpan.SpanID(), retrySpan.Links()[0].SpanContext.SpanID())
+
+	// Sequences which can no longer be retried are forgotten
+	tracer.forgetStaleSequences(time.Now().Add(time.Minute))
+	assert.Empty(t, tracer.sequences)
+}
+
+func TestStartSpanIsAChildOfTheExecutingProcessor(t *testing.T) {
+	tracer, recorder := newTestTracer(false)
+	activeTracer.Store(tracer)
+	t.Cleanup(func() { activeTracer.Store(nil) })
+	apiStream := newTestStream(map[string]string{})
+
+	tracer.OnStreamStart(apiStream)
+	err := tracer.TraceFlow(apiStream, "flow-1", func() error {
+		_, err := tracer.TraceProcessor(apiStream, "retry-1", &testProcessor{name: "Retry"},
+			func() (stream_types.ProcessorIO, error) {
+				_, span := StartSpan(apiStream, "retry#attempt")
+				span.End()
+				return stream_types.ProcessorIO{}, nil
+			})
+		return err
+	})
+	require.NoError(t, err)
+
+	spans := spansByName(recorder)
+	require.NotNil(t, spans["retry#attempt"])
+	assert.Equal(t, spans["processor retry-1"].SpanContext().SpanID(),
+		spans["retry#attempt"].Parent().SpanID())
+}
@@ -1,9 +1,13 @@
 package streamtypes
 
 import (
+	"fmt"
 	"lunar/engine/actions"
 	publictypes "lunar/engine/streams/public-types"
 	"lunar/toolkit-core/network"
+	"regexp"
+	"strings"
+	"time"
 )
 
 type ProcessorDefinition struct {
@@ -37,3 +41,96 @@ type ProcessorIO struct {
 	ShortCircuit *ShortCircuit
 	Failure      bool // for case if we want measure failure without returning error
 }
+
+// QueueStats is the current state of a queue of a processor on this gateway
+type QueueStats struct {
+	ProcessorKey  string
+	Group         string
+	Size          int64
+	OldestItemAge time.Duration
+	// DroppedOnTTL counts the requests which expired while waiting in the queue
+	DroppedOnTTL int64
+}
+
+// CachePurgeRequest selects the cache entries to purge.
+// Entries of all flows are considered when Flow is empty, and all entries of the
+// considered flows are purged when no other selector is given.
+type CachePurgeRequest struct {
+	Flow string `json:"flow,omitempty"`
+	// Key is a full cache key, as built from the flow name and the caching key parts
+	Key    string `json:"key,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// Pattern is a glob matched against the cache keys, e.g. my_flow_*_orders.
+	// * matches any characters, including /, since the key parts are often URLs or paths,
+	// and ? matches a single character.
+	Pattern string `json:"pattern,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+
+	// pattern is the compiled Pattern, shared by the copies of the request
+	pattern *regexp.Regexp
+}
+
+// Validate makes sure the request selects entries, so the whole cache is never purged by mistake,
+// and compiles the pattern once for all the keys it is matched against
+func (r *CachePurgeRequest) Validate() error {
+	if r.Flow == "" && r.Key == "" && r.Prefix == "" && r.Pattern == "" && r.Tag == "" {
+		return fmt.Errorf("at least one of flow, key, prefix, pattern or tag must be given")
+	}
+	pattern, err := compilePattern(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %s: %w", r.Pattern, err)
+	}
+	r.pattern = pattern
+	return nil
+}
+
+// MatchesKey returns true if the cache key is selected by the key, prefix and pattern.
+// The pattern of a request which was not validated is compiled on its first match.
+func (r *CachePurgeRequest) MatchesKey(cacheKey string) bool {
+	if r.Key != "" && r.Key != cacheKey {
+		return false
+	}
+	if r.Prefix != "" && !strings.HasPrefix(cacheKey, r.Prefix) {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+	if r.pattern == nil {
+		pattern, err := compilePattern(r.Pattern)
+		if err != nil {
+			return false
+		}
+		r.pattern = pattern
+	}
+	return r.pattern.MatchString(cacheKey)
+}
+
+// compilePattern turns the glob into an anchored regexp,
+// every character other than * and ? is matched literally
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	var expression strings.Builder
+	expression.WriteString("^")
+	for _, char := range pattern {
+		switch char {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	expression.WriteString("$")
+	return regexp.Compile(expression.String())
+}
+
+type CachePurgeResult struct {
+	PurgedEntries int64 `json:"purged_entries"`
+	PurgedBytes   int64 `json:"purged_bytes"`
+}
+
+func (r *CachePurgeResult) Add(other CachePurgeResult) {
+	r.PurgedEntries += other.PurgedEntries
+	r.PurgedBytes += other.PurgedBytes
+}
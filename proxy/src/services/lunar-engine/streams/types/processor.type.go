@@ -7,6 +7,9 @@ import (
 type ProcessorRequirement struct {
 	IsBodyRequired       bool
 	IsReqCaptureRequired bool
+	// IsNetworkErrorRequired sends the gateway responses of provider network errors
+	// to the response flows of the endpoint
+	IsNetworkErrorRequired bool
 }
 
 type ProcessorI interface {
@@ -15,6 +18,21 @@ type ProcessorI interface {
 	GetRequirement() *ProcessorRequirement
 }
 
+// QuotaProcessorI is implemented by processors deciding whether requests are allowed by a quota
+type QuotaProcessorI interface {
+	GetQuotaID() string
+}
+
+// CacheProcessorI is implemented by processors storing responses in a cache
+type CacheProcessorI interface {
+	PurgeCache(request CachePurgeRequest) (CachePurgeResult, error)
+}
+
+// QueueProcessorI is implemented by processors holding requests in queues
+type QueueProcessorI interface {
+	GetQueueStats() []QueueStats
+}
+
 type ProcessorParam struct {
 	Name  string
 	Value *publictypes.ParamValue
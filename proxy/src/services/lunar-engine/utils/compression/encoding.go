@@ -0,0 +1,44 @@
+package compression
+
+import "fmt"
+
+// Encoding is the compression algorithm of stored data
+type Encoding string
+
+const (
+	EncodingNone Encoding = "none"
+	EncodingGZip Encoding = "gzip"
+)
+
+// ParseEncoding returns the encoding of the given name, an empty name means no compression
+func ParseEncoding(name string) (Encoding, error) {
+	switch Encoding(name) {
+	case "", EncodingNone:
+		return EncodingNone, nil
+	case EncodingGZip:
+		return EncodingGZip, nil
+	}
+	return "", fmt.Errorf("unsupported compression: %s", name)
+}
+
+// Compress compresses the data with the encoding
+func Compress(encoding Encoding, data []byte) ([]byte, error) {
+	switch encoding {
+	case "", EncodingNone:
+		return data, nil
+	case EncodingGZip:
+		return CompressGZipBytes(data)
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", encoding)
+}
+
+// Decompress decompresses data compressed with the encoding
+func Decompress(encoding Encoding, data []byte) ([]byte, error) {
+	switch encoding {
+	case "", EncodingNone:
+		return data, nil
+	case EncodingGZip:
+		return DecompressGZipBytes(data)
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", encoding)
+}
@@ -7,16 +7,33 @@ import (
 )
 
 func DecompressGZip(compressed string) (string, error) {
-	reader, err := gzip.NewReader(bytes.NewBuffer([]byte(compressed)))
+	decompressed, err := DecompressGZipBytes([]byte(compressed))
 	if err != nil {
 		return "", err
 	}
-	defer reader.Close()
+	return string(decompressed), nil
+}
+
+// CompressGZipBytes compresses the data with gzip
+func CompressGZipBytes(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
 
-	bytes, err := io.ReadAll(reader)
+// DecompressGZipBytes decompresses gzip compressed data
+func DecompressGZipBytes(compressed []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	defer reader.Close()
 
-	return string(bytes), nil
+	return io.ReadAll(reader)
 }
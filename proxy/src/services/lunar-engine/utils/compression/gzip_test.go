@@ -3,6 +3,7 @@ package compression_test
 import (
 	"lunar/engine/utils/compression"
 	"lunar/toolkit-core/testutils"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,3 +18,25 @@ func TestDecompressGZip(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, decompressed, originalInput)
 }
+
+func TestCompressionRoundTrip(t *testing.T) {
+	t.Parallel()
+	originalInput := []byte(strings.Repeat(`{"hello":"world"}`, 100))
+	for _, name := range []string{"", "none", "gzip"} {
+		encoding, err := compression.ParseEncoding(name)
+		assert.Nil(t, err)
+
+		compressed, err := compression.Compress(encoding, originalInput)
+		assert.Nil(t, err)
+		if encoding == compression.EncodingGZip {
+			assert.Less(t, len(compressed), len(originalInput))
+		}
+
+		decompressed, err := compression.Decompress(encoding, compressed)
+		assert.Nil(t, err)
+		assert.Equal(t, originalInput, decompressed)
+	}
+
+	_, err := compression.ParseEncoding("brotli")
+	assert.NotNil(t, err)
+}
@@ -36,6 +36,11 @@ const (
 	lunarHubConnectionAttemptsWaitTimeExponentialGrowthEnvVar string = "LUNAR_HUB_CONNECTION_ATTEMPTS_WAIT_TIME_EXPONENTIAL_GROWTH"
 	discoveryStateLocationEnvVar                              string = "DISCOVERY_STATE_LOCATION"
 	remedyStatsStateLocationEnvVar                            string = "REMEDY_STATE_LOCATION"
+	schemasStateLocationEnvVar                                string = "SCHEMAS_STATE_LOCATION"
+	discoveryBodySampleRateEnvVar                             string = "LUNAR_DISCOVERY_BODY_SAMPLE_RATE"
+	quotaMetricsMaxGroupsEnvVar                               string = "LUNAR_QUOTA_METRICS_MAX_GROUPS"
+	autoTracingEnabledEnvVar                                  string = "LUNAR_AUTO_TRACING_ENABLED"
+	traceContextPropagationEnabledEnvVar                      string = "LUNAR_TRACE_CONTEXT_PROPAGATION_ENABLED"
 	streamsFeatureFlagEnvVar                                  string = "LUNAR_STREAMS_ENABLED"
 	streamsFlowsDirectoryEnvVar                               string = "LUNAR_PROXY_FLOW_DIRECTORY"
 	QuotasDirectoryEnvVar                                     string = "LUNAR_PROXY_QUOTAS_DIRECTORY"
@@ -81,6 +86,8 @@ const (
 	sharedQueueGCMaxTimeBetweenIterationsMinDefault        = 10 * time.Minute
 
 	accessLogMetricsCollectTimeIntervalSecDefault = 5
+	discoveryBodySampleRateDefault                = 0.0
+	quotaMetricsMaxGroupsDefault                  = 100
 )
 
 type GatewayConfig struct {
@@ -274,6 +281,55 @@ func SetDiscoveryStateLocation(val string) string {
 	return prev
 }
 
+func GetSchemasStateLocation() string {
+	return os.Getenv(schemasStateLocationEnvVar)
+}
+
+// GetDiscoveryBodySampleRate returns the fraction of the transactions whose JSON bodies
+// are sampled to infer the schemas of the discovered endpoints, 0 (the default) disables
+// the sampling. Bodies only reach the engine for the endpoints whose flows require them.
+func GetDiscoveryBodySampleRate() float64 {
+	raw := os.Getenv(discoveryBodySampleRateEnvVar)
+	if raw == "" {
+		return discoveryBodySampleRateDefault
+	}
+	rate, err := strconv.ParseFloat(raw, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		log.Warn().Msgf("Invalid %s %q, should be between 0 and 1, using %v",
+			discoveryBodySampleRateEnvVar, raw, discoveryBodySampleRateDefault)
+		return discoveryBodySampleRateDefault
+	}
+	return rate
+}
+
+// GetQuotaMetricsMaxGroups returns the number of groups per quota the quota metrics are
+// observed for, the groups using the most of their quota are kept
+func GetQuotaMetricsMaxGroups() int {
+	raw := os.Getenv(quotaMetricsMaxGroupsEnvVar)
+	if raw == "" {
+		return quotaMetricsMaxGroupsDefault
+	}
+	maxGroups, err := strconv.Atoi(raw)
+	if err != nil || maxGroups < 0 {
+		log.Warn().Msgf("Invalid %s %q, should be a non-negative number, using %v",
+			quotaMetricsMaxGroupsEnvVar, raw, quotaMetricsMaxGroupsDefault)
+		return quotaMetricsMaxGroupsDefault
+	}
+	return maxGroups
+}
+
+// IsAutoTracingEnabled tells whether every transaction is traced, with a span per flow and
+// per processor, and exported through the trace exporter of the gateway config
+func IsAutoTracingEnabled() bool {
+	return os.Getenv(autoTracingEnabledEnvVar) == "true"
+}
+
+// IsTraceContextPropagationEnabled tells whether the W3C trace context of the gateway span
+// is set on the requests sent to the providers, it requires the automatic tracing
+func IsTraceContextPropagationEnabled() bool {
+	return os.Getenv(traceContextPropagationEnabledEnvVar) == "true"
+}
+
 func GetProxyVersion() string {
 	return os.Getenv(proxyVersionEnvVar)
 }
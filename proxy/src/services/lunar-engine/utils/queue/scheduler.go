@@ -0,0 +1,704 @@
+package queue
+
+import (
+	"container/heap"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+)
+
+type SchedulingMode string
+
+const (
+	StrictPriority    SchedulingMode = "strict_priority"
+	WeightedFair      SchedulingMode = "weighted_fair"
+	DeficitRoundRobin SchedulingMode = "deficit_round_robin"
+
+	defaultGroupWeight = 1.0
+	// maxShareWindow is the number of recent dispatches used to measure a group's share
+	maxShareWindow = 100
+	// deficitEpsilon absorbs the rounding of fractional weights when counting dispatches
+	deficitEpsilon = 1e-9
+)
+
+// SchedulingConfig describes how queued items are picked across scheduling groups.
+// Weights and MaxShare are keyed by group name, MaxShare values are fractions in (0, 1].
+type SchedulingConfig struct {
+	Mode     SchedulingMode
+	Weights  map[string]float64
+	MaxShare map[string]float64
+}
+
+func (sc SchedulingConfig) Validate() error {
+	switch sc.Mode {
+	case "", StrictPriority, WeightedFair, DeficitRoundRobin:
+	default:
+		return fmt.Errorf("unknown scheduling mode: %s", sc.Mode)
+	}
+
+	for group, weight := range sc.Weights {
+		if weight <= 0 {
+			return fmt.Errorf("weight of group %s must be positive, got %v", group, weight)
+		}
+	}
+
+	for group, share := range sc.MaxShare {
+		if share <= 0 || share > 1 {
+			return fmt.Errorf("max share of group %s must be in (0, 1], got %v", group, share)
+		}
+	}
+	return nil
+}
+
+func (sc SchedulingConfig) weight(group string) float64 {
+	if weight, found := sc.Weights[group]; found {
+		return weight
+	}
+	return defaultGroupWeight
+}
+
+// Scheduler decides the order in which queued items are dispatched.
+// Implementations are not safe for concurrent use.
+//
+// In the fair modes, pushing back the item that was just popped restores its previous position,
+// so a dispatch attempt that was rejected does not cost its group a turn.
+// In strict priority mode it is enqueued again behind the items of the same priority.
+type Scheduler interface {
+	Push(item string, group string, priority float64)
+	Pop() (string, bool)
+	Remove(item string) bool
+	// Position returns the 1-based place of the item in the dispatch order, or 0 when it is not queued
+	Position(item string) int
+	Len() int
+}
+
+func NewScheduler(config SchedulingConfig) Scheduler {
+	switch config.Mode {
+	case WeightedFair:
+		return newWeightedFairScheduler(config)
+	case DeficitRoundRobin:
+		return newDeficitRoundRobinScheduler(config)
+	default:
+		return newStrictPriorityScheduler()
+	}
+}
+
+type scheduledItem struct {
+	value    string
+	group    string
+	priority float64
+	sequence uint64
+	start    float64
+	finish   float64
+}
+
+// strictPriorityScheduler always dispatches the lowest priority value first,
+// FIFO within the same priority.
+type strictPriorityScheduler struct {
+	items    scheduledItemHeap
+	sequence uint64
+}
+
+func newStrictPriorityScheduler() *strictPriorityScheduler {
+	scheduler := &strictPriorityScheduler{}
+	heap.Init(&scheduler.items)
+	return scheduler
+}
+
+func (s *strictPriorityScheduler) Push(item string, group string, priority float64) {
+	s.sequence++
+	heap.Push(&s.items, &scheduledItem{
+		value:    item,
+		group:    group,
+		priority: priority,
+		sequence: s.sequence,
+	})
+}
+
+func (s *strictPriorityScheduler) Pop() (string, bool) {
+	if s.items.Len() == 0 {
+		return "", false
+	}
+	item, _ := heap.Pop(&s.items).(*scheduledItem)
+	return item.value, true
+}
+
+func (s *strictPriorityScheduler) Remove(item string) bool {
+	for index, queued := range s.items {
+		if queued.value == item {
+			heap.Remove(&s.items, index)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *strictPriorityScheduler) Position(item string) int {
+	var target *scheduledItem
+	for _, queued := range s.items {
+		if queued.value == item {
+			target = queued
+			break
+		}
+	}
+	if target == nil {
+		return 0
+	}
+
+	position := 1
+	for _, queued := range s.items {
+		if queued != target && isHigherPriority(queued, target) {
+			position++
+		}
+	}
+	return position
+}
+
+func (s *strictPriorityScheduler) Len() int {
+	return s.items.Len()
+}
+
+type scheduledItemHeap []*scheduledItem
+
+func (h scheduledItemHeap) Len() int { return len(h) }
+
+func (h scheduledItemHeap) Less(i, j int) bool {
+	return isHigherPriority(h[i], h[j])
+}
+
+func isHigherPriority(a, b *scheduledItem) bool {
+	if a.priority == b.priority {
+		return a.sequence < b.sequence
+	}
+	return a.priority < b.priority
+}
+
+func (h scheduledItemHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *scheduledItemHeap) Push(x interface{}) {
+	item, valid := x.(*scheduledItem)
+	if !valid {
+		return
+	}
+	*h = append(*h, item)
+}
+
+func (h *scheduledItemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[0 : n-1]
+	return item
+}
+
+// groupQueue is the FIFO backlog of a single scheduling group
+type groupQueue struct {
+	name  string
+	items []*scheduledItem
+}
+
+func (gq *groupQueue) remove(item string) bool {
+	index := gq.indexOf(item)
+	if index < 0 {
+		return false
+	}
+	gq.items = append(gq.items[:index], gq.items[index+1:]...)
+	return true
+}
+
+func (gq *groupQueue) indexOf(item string) int {
+	return slices.IndexFunc(gq.items, func(queued *scheduledItem) bool {
+		return queued.value == item
+	})
+}
+
+// weightedFairScheduler implements self-clocked weighted fair queueing.
+// Each item gets a virtual finish time of max(virtual time, group's last finish) + 1/weight,
+// and the item with the earliest finish time is dispatched first,
+// so backlogged groups are served in proportion to their weights.
+type weightedFairScheduler struct {
+	config      SchedulingConfig
+	groups      map[string]*groupQueue
+	lastFinish  map[string]float64
+	virtualTime float64
+	sequence    uint64
+	size        int
+
+	// state before the last dispatch, restored when the dispatch is rejected
+	lastPopped      *scheduledItem
+	lastVirtualTime float64
+	lastFinishes    map[string]float64
+	lastSequence    uint64
+}
+
+func newWeightedFairScheduler(config SchedulingConfig) *weightedFairScheduler {
+	return &weightedFairScheduler{
+		config:     config,
+		groups:     make(map[string]*groupQueue),
+		lastFinish: make(map[string]float64),
+	}
+}
+
+func (s *weightedFairScheduler) Push(item string, group string, priority float64) {
+	if s.lastPopped != nil && s.lastPopped.value == item {
+		restored := s.lastPopped
+		s.lastPopped = nil
+		gq := s.getGroup(restored.group)
+		gq.items = append([]*scheduledItem{restored}, gq.items...)
+		s.rollbackVirtualTime()
+		s.size++
+		return
+	}
+
+	start := max(s.virtualTime, s.lastFinish[group])
+	finish := start + 1/s.config.weight(group)
+	s.lastFinish[group] = finish
+	s.sequence++
+
+	gq := s.getGroup(group)
+	gq.items = append(gq.items, &scheduledItem{
+		value:    item,
+		group:    group,
+		priority: priority,
+		sequence: s.sequence,
+		start:    start,
+		finish:   finish,
+	})
+	s.size++
+}
+
+func (s *weightedFairScheduler) Pop() (string, bool) {
+	var next *groupQueue
+	for _, gq := range s.groups {
+		if len(gq.items) == 0 {
+			continue
+		}
+		if next == nil || isServedBefore(gq.items[0], next.items[0]) {
+			next = gq
+		}
+	}
+	if next == nil {
+		return "", false
+	}
+
+	item := next.items[0]
+	next.items = next.items[1:]
+	s.size--
+
+	s.lastPopped = item
+	s.lastVirtualTime = s.virtualTime
+	s.lastFinishes = maps.Clone(s.lastFinish)
+	s.lastSequence = s.sequence
+	s.virtualTime = item.finish
+	return item.value, true
+}
+
+// rollbackVirtualTime restores the virtual time and the last finish of every group
+// to their values before the rejected dispatch. Items pushed since then were timed
+// against the virtual time of the rejected dispatch, so they are timed again.
+func (s *weightedFairScheduler) rollbackVirtualTime() {
+	s.virtualTime = s.lastVirtualTime
+	s.lastFinish = s.lastFinishes
+	s.lastFinishes = nil
+
+	for name, gq := range s.groups {
+		for _, queued := range gq.items {
+			if queued.sequence <= s.lastSequence {
+				continue
+			}
+			queued.start = max(s.virtualTime, s.lastFinish[name])
+			queued.finish = queued.start + 1/s.config.weight(name)
+			s.lastFinish[name] = queued.finish
+		}
+	}
+}
+
+func (s *weightedFairScheduler) Remove(item string) bool {
+	if s.lastPopped != nil && s.lastPopped.value == item {
+		s.lastPopped = nil
+		s.lastFinishes = nil
+	}
+	for _, gq := range s.groups {
+		if gq.remove(item) {
+			s.size--
+			return true
+		}
+	}
+	return false
+}
+
+// Position relies on the finish times growing within each group,
+// so the dispatch order is the order of all the queued items by finish time.
+func (s *weightedFairScheduler) Position(item string) int {
+	var target *scheduledItem
+	for _, gq := range s.groups {
+		if index := gq.indexOf(item); index >= 0 {
+			target = gq.items[index]
+			break
+		}
+	}
+	if target == nil {
+		return 0
+	}
+
+	position := 1
+	for _, gq := range s.groups {
+		for _, queued := range gq.items {
+			if queued != target && isServedBefore(queued, target) {
+				position++
+			}
+		}
+	}
+	return position
+}
+
+func (s *weightedFairScheduler) Len() int {
+	return s.size
+}
+
+func (s *weightedFairScheduler) getGroup(name string) *groupQueue {
+	gq, found := s.groups[name]
+	if !found {
+		gq = &groupQueue{name: name}
+		s.groups[name] = gq
+	}
+	return gq
+}
+
+func isServedBefore(a, b *scheduledItem) bool {
+	if a.finish == b.finish {
+		return a.sequence < b.sequence
+	}
+	return a.finish < b.finish
+}
+
+// deficitRoundRobinScheduler visits backlogged groups in round-robin order,
+// granting each group a quantum equal to its weight per round.
+// A group whose share of the recent dispatches reached its max share is skipped
+// as long as another backlogged group is able to use the slot.
+type deficitRoundRobinScheduler struct {
+	config   SchedulingConfig
+	groups   map[string]*groupQueue
+	active   []*groupQueue
+	deficit  map[string]float64
+	cursor   int
+	visiting bool
+	sequence uint64
+	size     int
+
+	recent      []string
+	recentCount map[string]int
+
+	lastDispatch *drrDispatch
+}
+
+// drrDispatch is the state before the last dispatch, restored when the dispatch is rejected
+type drrDispatch struct {
+	item     *scheduledItem
+	cursor   *groupQueue
+	visiting bool
+	// deficits of the groups the dispatch visited
+	deficits map[string]float64
+	// the group following the dispatched group, when the dispatch emptied it
+	emptied   bool
+	nextGroup *groupQueue
+	// the group which left the max share window to make room for the dispatch
+	evicted string
+}
+
+func newDeficitRoundRobinScheduler(config SchedulingConfig) *deficitRoundRobinScheduler {
+	return &deficitRoundRobinScheduler{
+		config:      config,
+		groups:      make(map[string]*groupQueue),
+		deficit:     make(map[string]float64),
+		recentCount: make(map[string]int),
+	}
+}
+
+func (s *deficitRoundRobinScheduler) Push(item string, group string, priority float64) {
+	if s.lastDispatch != nil && s.lastDispatch.item.value == item {
+		s.restoreLastDispatch()
+		return
+	}
+
+	s.sequence++
+	gq := s.getGroup(group)
+	gq.items = append(gq.items, &scheduledItem{
+		value:    item,
+		group:    group,
+		priority: priority,
+		sequence: s.sequence,
+	})
+	s.activate(gq)
+	s.size++
+}
+
+func (s *deficitRoundRobinScheduler) Pop() (string, bool) {
+	if len(s.active) == 0 {
+		return "", false
+	}
+
+	dispatch := &drrDispatch{
+		cursor:   s.active[s.cursor],
+		visiting: s.visiting,
+		deficits: make(map[string]float64),
+	}
+	enforceShare := true
+	// Consecutive groups skipped for reaching their max share
+	skippedForShare := 0
+	for {
+		gq := s.active[s.cursor]
+
+		if enforceShare && s.exceedsMaxShare(gq.name) {
+			skippedForShare++
+			if skippedForShare >= len(s.active) {
+				// Every backlogged group reached its share, keep the queue work-conserving
+				enforceShare = false
+			}
+			s.moveToNextGroup()
+			continue
+		}
+		skippedForShare = 0
+
+		if _, found := dispatch.deficits[gq.name]; !found {
+			dispatch.deficits[gq.name] = s.deficit[gq.name]
+		}
+		if !s.visiting {
+			s.deficit[gq.name] += s.config.weight(gq.name)
+			s.visiting = true
+		}
+
+		if s.deficit[gq.name] < 1 {
+			s.moveToNextGroup()
+			continue
+		}
+
+		item := gq.items[0]
+		gq.items = gq.items[1:]
+		s.deficit[gq.name]--
+		s.size--
+		dispatch.item = item
+		dispatch.evicted = s.recordDispatch(gq.name)
+
+		if len(gq.items) == 0 {
+			s.deactivateCurrent()
+			dispatch.emptied = true
+			if len(s.active) > 0 {
+				dispatch.nextGroup = s.active[s.cursor]
+			}
+		}
+		s.lastDispatch = dispatch
+		return item.value, true
+	}
+}
+
+// restoreLastDispatch queues the item of the last dispatch back at the head of its group,
+// and restores the deficits and the cursor to their values before the dispatch.
+// Groups activated since then keep their place.
+func (s *deficitRoundRobinScheduler) restoreLastDispatch() {
+	dispatch := s.lastDispatch
+	s.lastDispatch = nil
+
+	gq := s.getGroup(dispatch.item.group)
+	gq.items = append([]*scheduledItem{dispatch.item}, gq.items...)
+	s.size++
+
+	if dispatch.emptied {
+		// The group may have been activated again, behind the other groups
+		if index := slices.Index(s.active, gq); index >= 0 {
+			s.active = slices.Delete(s.active, index, index+1)
+		}
+		index := slices.Index(s.active, dispatch.nextGroup)
+		if index < 0 {
+			index = len(s.active)
+		}
+		s.active = slices.Insert(s.active, index, gq)
+	} else {
+		s.activate(gq)
+	}
+
+	for name, deficit := range dispatch.deficits {
+		s.deficit[name] = deficit
+	}
+	if index := slices.Index(s.active, dispatch.cursor); index >= 0 {
+		s.cursor = index
+		s.visiting = dispatch.visiting
+	} else {
+		s.cursor %= len(s.active)
+		s.visiting = false
+	}
+	s.forgetLastDispatch(dispatch.evicted)
+}
+
+func (s *deficitRoundRobinScheduler) Remove(item string) bool {
+	if s.lastDispatch != nil && s.lastDispatch.item.value == item {
+		s.lastDispatch = nil
+	}
+	for _, gq := range s.groups {
+		if !gq.remove(item) {
+			continue
+		}
+		s.size--
+		if len(gq.items) == 0 {
+			s.deactivate(gq)
+		}
+		return true
+	}
+	return false
+}
+
+// Position counts the items the other groups dispatch before the item, round by round.
+// A group dispatches floor(deficit + visits * weight) items along its next visits,
+// so the visit in which the item is dispatched is derived from its place in its group.
+// Groups skipped for reaching their max share are not accounted for,
+// so the position is an estimate when max shares are configured.
+func (s *deficitRoundRobinScheduler) Position(item string) int {
+	targetIndex := -1
+	var target *groupQueue
+	for _, gq := range s.active {
+		if targetIndex = gq.indexOf(item); targetIndex >= 0 {
+			target = gq
+			break
+		}
+	}
+	if target == nil {
+		return 0
+	}
+
+	targetOrder := s.roundOrder(target)
+	visits := s.visitsToDispatch(target, targetIndex+1)
+	position := targetIndex + 1
+	for _, gq := range s.active {
+		if gq == target {
+			continue
+		}
+		// Groups visited after the item's group in a round get a visit less
+		if s.roundOrder(gq) < targetOrder {
+			position += s.dispatchedAlong(gq, visits)
+		} else {
+			position += s.dispatchedAlong(gq, visits-1)
+		}
+	}
+	return position
+}
+
+// roundOrder returns the place of an active group in the round starting at the cursor
+func (s *deficitRoundRobinScheduler) roundOrder(gq *groupQueue) int {
+	index := slices.Index(s.active, gq)
+	return (index - s.cursor + len(s.active)) % len(s.active)
+}
+
+// deficitBeforeVisits returns the deficit of the group before its next visits,
+// the visit in progress counts as the first one
+func (s *deficitRoundRobinScheduler) deficitBeforeVisits(gq *groupQueue) float64 {
+	deficit := s.deficit[gq.name]
+	if s.visiting && s.active[s.cursor] == gq {
+		deficit -= s.config.weight(gq.name)
+	}
+	return deficit
+}
+
+// dispatchedAlong returns the number of items the group dispatches along its next visits
+func (s *deficitRoundRobinScheduler) dispatchedAlong(gq *groupQueue, visits int) int {
+	deficit := s.deficitBeforeVisits(gq) + float64(visits)*s.config.weight(gq.name)
+	return min(max(int(math.Floor(deficit+deficitEpsilon)), 0), len(gq.items))
+}
+
+// visitsToDispatch returns the number of visits it takes the group to dispatch the given count
+func (s *deficitRoundRobinScheduler) visitsToDispatch(gq *groupQueue, count int) int {
+	missing := float64(count) - s.deficitBeforeVisits(gq)
+	visits := int(math.Ceil(missing/s.config.weight(gq.name) - deficitEpsilon))
+	return max(visits, 1)
+}
+
+func (s *deficitRoundRobinScheduler) Len() int {
+	return s.size
+}
+
+func (s *deficitRoundRobinScheduler) getGroup(name string) *groupQueue {
+	gq, found := s.groups[name]
+	if !found {
+		gq = &groupQueue{name: name}
+		s.groups[name] = gq
+	}
+	return gq
+}
+
+func (s *deficitRoundRobinScheduler) activate(gq *groupQueue) {
+	if !slices.Contains(s.active, gq) {
+		s.active = append(s.active, gq)
+	}
+}
+
+func (s *deficitRoundRobinScheduler) moveToNextGroup() {
+	s.visiting = false
+	s.cursor = (s.cursor + 1) % len(s.active)
+}
+
+// deactivateCurrent drops the group under the cursor, the cursor then points to the next group
+func (s *deficitRoundRobinScheduler) deactivateCurrent() {
+	gq := s.active[s.cursor]
+	s.deficit[gq.name] = 0
+	s.visiting = false
+	s.active = append(s.active[:s.cursor], s.active[s.cursor+1:]...)
+	if s.cursor >= len(s.active) {
+		s.cursor = 0
+	}
+}
+
+func (s *deficitRoundRobinScheduler) deactivate(gq *groupQueue) {
+	for index, active := range s.active {
+		if active != gq {
+			continue
+		}
+		if index == s.cursor {
+			s.deactivateCurrent()
+			return
+		}
+		s.deficit[gq.name] = 0
+		s.active = append(s.active[:index], s.active[index+1:]...)
+		if index < s.cursor {
+			s.cursor--
+		}
+		return
+	}
+}
+
+func (s *deficitRoundRobinScheduler) exceedsMaxShare(group string) bool {
+	maxShare, found := s.config.MaxShare[group]
+	if !found || len(s.active) < 2 || len(s.recent) == 0 {
+		return false
+	}
+	share := float64(s.recentCount[group]+1) / float64(len(s.recent)+1)
+	return share > maxShare
+}
+
+// recordDispatch adds the dispatch to the max share window,
+// and returns the group of the dispatch which left the window, if one did
+func (s *deficitRoundRobinScheduler) recordDispatch(group string) string {
+	evicted := ""
+	if len(s.recent) == maxShareWindow {
+		evicted = s.recent[0]
+		s.recentCount[evicted]--
+		s.recent = s.recent[1:]
+	}
+	s.recent = append(s.recent, group)
+	s.recentCount[group]++
+	return evicted
+}
+
+// forgetLastDispatch removes the last dispatch from the max share window,
+// bringing back the dispatch it evicted
+func (s *deficitRoundRobinScheduler) forgetLastDispatch(evicted string) {
+	if len(s.recent) == 0 {
+		return
+	}
+	last := s.recent[len(s.recent)-1]
+	s.recent = s.recent[:len(s.recent)-1]
+	s.recentCount[last]--
+	if evicted != "" {
+		s.recent = append([]string{evicted}, s.recent...)
+		s.recentCount[evicted]++
+	}
+}
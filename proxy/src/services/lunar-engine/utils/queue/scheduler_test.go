@@ -0,0 +1,373 @@
+package queue_test
+
+import (
+	"fmt"
+	"lunar/engine/utils/queue"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const itemsPerGroup = 1000
+
+// dispatchShares fills the scheduler with an equal backlog for every group,
+// dispatches the given amount of items and returns the share each group received.
+func dispatchShares(
+	t *testing.T,
+	scheduler queue.Scheduler,
+	groups []string,
+	dispatches int,
+) map[string]float64 {
+	for i := 0; i < itemsPerGroup; i++ {
+		for _, group := range groups {
+			scheduler.Push(fmt.Sprintf("%s-%d", group, i), group, 0)
+		}
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < dispatches; i++ {
+		item, found := scheduler.Pop()
+		require.True(t, found)
+		for _, group := range groups {
+			if strings.HasPrefix(item, group+"-") {
+				counts[group]++
+			}
+		}
+	}
+
+	shares := make(map[string]float64)
+	for _, group := range groups {
+		shares[group] = float64(counts[group]) / float64(dispatches)
+	}
+	return shares
+}
+
+func TestStrictPrioritySchedulerServesHigherPriorityFirst(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{Mode: queue.StrictPriority})
+	scheduler.Push("low-1", "low", 2)
+	scheduler.Push("high-1", "high", 1)
+	scheduler.Push("low-2", "low", 2)
+	scheduler.Push("high-2", "high", 1)
+
+	expected := []string{"high-1", "high-2", "low-1", "low-2"}
+	for _, expectedItem := range expected {
+		item, found := scheduler.Pop()
+		require.True(t, found)
+		assert.Equal(t, expectedItem, item)
+	}
+
+	_, found := scheduler.Pop()
+	assert.False(t, found)
+}
+
+func TestWeightedFairSchedulerSharesThroughputByWeight(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{
+		Mode:    queue.WeightedFair,
+		Weights: map[string]float64{"gold": 3, "silver": 1},
+	})
+
+	shares := dispatchShares(t, scheduler, []string{"gold", "silver"}, 400)
+	assert.InDelta(t, 0.75, shares["gold"], 0.01)
+	assert.InDelta(t, 0.25, shares["silver"], 0.01)
+}
+
+func TestWeightedFairSchedulerDoesNotStarveLowWeightGroup(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{
+		Mode:    queue.WeightedFair,
+		Weights: map[string]float64{"heavy": 9},
+	})
+
+	// The default weight of 1 still guarantees a tenth of the throughput
+	shares := dispatchShares(t, scheduler, []string{"heavy", "light"}, 100)
+	assert.InDelta(t, 0.9, shares["heavy"], 0.01)
+	assert.InDelta(t, 0.1, shares["light"], 0.01)
+}
+
+func TestWeightedFairSchedulerIdleGroupDoesNotBankCredit(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{Mode: queue.WeightedFair})
+
+	for i := 0; i < 10; i++ {
+		scheduler.Push(fmt.Sprintf("busy-%d", i), "busy", 0)
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = scheduler.Pop()
+	}
+
+	// A group joining late is interleaved instead of taking over the queue
+	scheduler.Push("late-0", "late", 0)
+	scheduler.Push("late-1", "late", 0)
+
+	order := make([]string, 0, scheduler.Len())
+	for scheduler.Len() > 0 {
+		item, _ := scheduler.Pop()
+		order = append(order, item)
+	}
+	expected := []string{"busy-5", "late-0", "busy-6", "late-1", "busy-7", "busy-8", "busy-9"}
+	assert.Equal(t, expected, order)
+}
+
+func TestDeficitRoundRobinSchedulerSharesThroughputByWeight(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{
+		Mode:    queue.DeficitRoundRobin,
+		Weights: map[string]float64{"a": 2, "b": 1, "c": 1},
+	})
+
+	shares := dispatchShares(t, scheduler, []string{"a", "b", "c"}, 400)
+	assert.InDelta(t, 0.5, shares["a"], 0.01)
+	assert.InDelta(t, 0.25, shares["b"], 0.01)
+	assert.InDelta(t, 0.25, shares["c"], 0.01)
+}
+
+func TestDeficitRoundRobinSchedulerCapsGroupAtMaxShare(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{
+		Mode:     queue.DeficitRoundRobin,
+		Weights:  map[string]float64{"a": 4, "b": 1},
+		MaxShare: map[string]float64{"a": 0.6},
+	})
+
+	shares := dispatchShares(t, scheduler, []string{"a", "b"}, 500)
+	assert.InDelta(t, 0.6, shares["a"], 0.02)
+	assert.InDelta(t, 0.4, shares["b"], 0.02)
+}
+
+func TestDeficitRoundRobinSchedulerMaxShareIsWorkConserving(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{
+		Mode:     queue.DeficitRoundRobin,
+		MaxShare: map[string]float64{"a": 0.2},
+	})
+
+	// Without contention the capped group may use the whole throughput
+	shares := dispatchShares(t, scheduler, []string{"a"}, 100)
+	assert.Equal(t, 1.0, shares["a"])
+}
+
+func TestSchedulersRestoreRejectedDispatch(t *testing.T) {
+	modes := []queue.SchedulingMode{
+		queue.WeightedFair,
+		queue.DeficitRoundRobin,
+	}
+
+	for _, mode := range modes {
+		t.Run(string(mode), func(t *testing.T) {
+			scheduler := queue.NewScheduler(queue.SchedulingConfig{Mode: mode})
+			scheduler.Push("a-0", "a", 0)
+			scheduler.Push("b-0", "b", 0)
+			scheduler.Push("a-1", "a", 0)
+
+			item, _ := scheduler.Pop()
+			require.Equal(t, "a-0", item)
+
+			// The dispatch was rejected, the item should keep its place
+			scheduler.Push(item, "a", 0)
+			assert.Equal(t, 3, scheduler.Len())
+
+			item, _ = scheduler.Pop()
+			assert.Equal(t, "a-0", item)
+		})
+	}
+}
+
+func TestStrictPrioritySchedulerRequeuesRejectedDispatch(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{Mode: queue.StrictPriority})
+	scheduler.Push("a-0", "a", 1)
+	scheduler.Push("b-0", "b", 1)
+	scheduler.Push("c-0", "c", 2)
+
+	item, _ := scheduler.Pop()
+	require.Equal(t, "a-0", item)
+
+	// The dispatch was rejected, the item is queued behind the items of the same priority
+	scheduler.Push(item, "a", 1)
+
+	expected := []string{"b-0", "a-0", "c-0"}
+	for _, expectedItem := range expected {
+		item, found := scheduler.Pop()
+		require.True(t, found)
+		assert.Equal(t, expectedItem, item)
+	}
+}
+
+func TestWeightedFairSchedulerRejectedDispatchesKeepShares(t *testing.T) {
+	config := queue.SchedulingConfig{
+		Mode:    queue.WeightedFair,
+		Weights: map[string]float64{"gold": 3, "silver": 1},
+	}
+	accepting := queue.NewScheduler(config)
+	rejecting := queue.NewScheduler(config)
+	for i := 0; i < 10; i++ {
+		for _, scheduler := range []queue.Scheduler{accepting, rejecting} {
+			scheduler.Push(fmt.Sprintf("gold-%d", i), "gold", 0)
+		}
+	}
+
+	// Silver requests arrive while every gold dispatch is rejected once
+	var acceptedOrder, rejectedOrder []string
+	for i := 0; i < 10; i++ {
+		silverItem := fmt.Sprintf("silver-%d", i)
+
+		accepting.Push(silverItem, "silver", 0)
+		item, _ := accepting.Pop()
+		acceptedOrder = append(acceptedOrder, item)
+
+		item, _ = rejecting.Pop()
+		rejecting.Push(silverItem, "silver", 0)
+		rejecting.Push(item, "gold", 0)
+		item, _ = rejecting.Pop()
+		rejectedOrder = append(rejectedOrder, item)
+	}
+
+	assert.Equal(t, acceptedOrder, rejectedOrder)
+	assert.Equal(t, accepting.Len(), rejecting.Len())
+}
+
+func TestSchedulersRemove(t *testing.T) {
+	modes := []queue.SchedulingMode{
+		queue.StrictPriority,
+		queue.WeightedFair,
+		queue.DeficitRoundRobin,
+	}
+
+	for _, mode := range modes {
+		t.Run(string(mode), func(t *testing.T) {
+			scheduler := queue.NewScheduler(queue.SchedulingConfig{Mode: mode})
+			scheduler.Push("a-0", "a", 0)
+			scheduler.Push("b-0", "b", 0)
+
+			assert.True(t, scheduler.Remove("a-0"))
+			assert.False(t, scheduler.Remove("a-0"))
+			assert.Equal(t, 1, scheduler.Len())
+
+			item, found := scheduler.Pop()
+			require.True(t, found)
+			assert.Equal(t, "b-0", item)
+			_, found = scheduler.Pop()
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestSchedulingConfigValidation(t *testing.T) {
+	assert.NoError(t, queue.SchedulingConfig{}.Validate())
+	assert.Error(t, queue.SchedulingConfig{Mode: "lottery"}.Validate())
+	assert.Error(t, queue.SchedulingConfig{
+		Mode:    queue.WeightedFair,
+		Weights: map[string]float64{"a": 0},
+	}.Validate())
+	assert.Error(t, queue.SchedulingConfig{
+		Mode:     queue.DeficitRoundRobin,
+		MaxShare: map[string]float64{"a": 1.5},
+	}.Validate())
+}
+
+func TestSchedulersPosition(t *testing.T) {
+	testCases := []struct {
+		config   queue.SchedulingConfig
+		expected []string
+	}{
+		{
+			config:   queue.SchedulingConfig{Mode: queue.StrictPriority},
+			expected: []string{"b-0", "b-1", "a-0", "a-1", "a-2"},
+		},
+		{
+			config: queue.SchedulingConfig{
+				Mode:    queue.WeightedFair,
+				Weights: map[string]float64{"a": 2},
+			},
+			expected: []string{"a-0", "a-1", "b-0", "a-2", "b-1"},
+		},
+		{
+			config: queue.SchedulingConfig{
+				Mode:    queue.DeficitRoundRobin,
+				Weights: map[string]float64{"a": 2},
+			},
+			expected: []string{"a-0", "a-1", "b-0", "a-2", "b-1"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(string(testCase.config.Mode), func(t *testing.T) {
+			scheduler := queue.NewScheduler(testCase.config)
+			for i := 0; i < 3; i++ {
+				scheduler.Push(fmt.Sprintf("a-%d", i), "a", 2)
+			}
+			for i := 0; i < 2; i++ {
+				scheduler.Push(fmt.Sprintf("b-%d", i), "b", 1)
+			}
+
+			for index, item := range testCase.expected {
+				assert.Equal(t, index+1, scheduler.Position(item), item)
+			}
+			assert.Equal(t, 0, scheduler.Position("missing"))
+
+			// Positions do not change the dispatch order
+			for _, expectedItem := range testCase.expected {
+				item, found := scheduler.Pop()
+				require.True(t, found)
+				assert.Equal(t, expectedItem, item)
+			}
+		})
+	}
+}
+
+func TestDeficitRoundRobinSchedulerRejectedDispatchesKeepOrder(t *testing.T) {
+	config := queue.SchedulingConfig{
+		Mode:     queue.DeficitRoundRobin,
+		Weights:  map[string]float64{"a": 1.5, "b": 0.5},
+		MaxShare: map[string]float64{"a": 0.7},
+	}
+	accepting := queue.NewScheduler(config)
+	rejecting := queue.NewScheduler(config)
+	for _, scheduler := range []queue.Scheduler{accepting, rejecting} {
+		for i := 0; i < 6; i++ {
+			scheduler.Push(fmt.Sprintf("a-%d", i), "a", 0)
+		}
+		scheduler.Push("b-0", "b", 0)
+		scheduler.Push("c-0", "c", 0)
+	}
+
+	// Every dispatch is rejected once, including the ones emptying their group
+	var acceptedOrder, rejectedOrder []string
+	for accepting.Len() > 0 {
+		item, _ := accepting.Pop()
+		acceptedOrder = append(acceptedOrder, item)
+
+		item, _ = rejecting.Pop()
+		rejecting.Push(item, strings.Split(item, "-")[0], 0)
+		item, _ = rejecting.Pop()
+		rejectedOrder = append(rejectedOrder, item)
+	}
+
+	assert.Equal(t, acceptedOrder, rejectedOrder)
+	assert.Equal(t, 0, rejecting.Len())
+}
+
+func TestDeficitRoundRobinSchedulerPositionWithinRound(t *testing.T) {
+	scheduler := queue.NewScheduler(queue.SchedulingConfig{
+		Mode:    queue.DeficitRoundRobin,
+		Weights: map[string]float64{"a": 1.5, "b": 0.5},
+	})
+	for i := 0; i < 5; i++ {
+		for _, group := range []string{"a", "b", "c"} {
+			scheduler.Push(fmt.Sprintf("%s-%d", group, i), group, 0)
+		}
+	}
+	// Leaves the cursor in the middle of a visit, with fractional deficits
+	for i := 0; i < 4; i++ {
+		_, _ = scheduler.Pop()
+	}
+
+	positions := make(map[string]int)
+	for _, group := range []string{"a", "b", "c"} {
+		for i := 0; i < 5; i++ {
+			item := fmt.Sprintf("%s-%d", group, i)
+			positions[item] = scheduler.Position(item)
+		}
+	}
+
+	for position := 1; scheduler.Len() > 0; position++ {
+		item, _ := scheduler.Pop()
+		assert.Equal(t, position, positions[item], item)
+	}
+}